@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -14,7 +15,101 @@ import (
 	"edusync/models"
 )
 
-// LoginHandler authenticates a user and returns a JWT token
+// IssueToken signs a JWT for the user. sessionVersion is the user's current session_version; raising it revokes
+// every token issued before.
+func IssueToken(userID int, role string, orgID, sessionVersion int) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"role":    role,
+		"org_id":  orgID,
+		"sv":      sessionVersion,
+		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.ConfigInstance.JWTSecret))
+}
+
+// loginAccount is what logging in needs to know about a user
+type loginAccount struct {
+	models.User
+	password         string
+	sessionVersion   int
+	twoFactorEnabled bool
+	// twoFactorMissing is set for teachers whose organization requires two-factor authentication they have not set up
+	twoFactorMissing bool
+}
+
+// findLoginAccount loads an active user of an active organization by the given condition on u
+func findLoginAccount(db *sql.DB, where string, arg interface{}) (loginAccount, error) {
+	var a loginAccount
+	err := db.QueryRow(`
+		SELECT u.user_id, u.name, u.email, u.email_verified_at IS NOT NULL, u.password, u.role, u.org_id, o.name,
+		u.is_org_admin, u.session_version, u.totp_enabled_at IS NOT NULL,
+		u.role = 'teacher' AND o.require_teacher_2fa AND u.totp_enabled_at IS NULL
+		FROM user u
+		JOIN organization o ON u.org_id = o.org_id
+		WHERE `+where+` AND u.archive_delete_flag = TRUE AND o.archive_delete_flag = TRUE`, arg).Scan(
+		&a.UserID, &a.Name, &a.Email, &a.EmailVerified, &a.password, &a.Role, &a.OrgID, &a.Org, &a.IsOrgAdmin,
+		&a.sessionVersion, &a.twoFactorEnabled, &a.twoFactorMissing,
+	)
+	return a, err
+}
+
+// Throttled answers 429 when the account or client has to wait before trying again. It writes the response itself.
+func Throttled(c *gin.Context, guard *LoginGuard, email string, now time.Time) bool {
+	retryAt, locked, err := guard.blocked(email, c.ClientIP(), now)
+	if err != nil {
+		log.Printf("Error checking failed logins: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return true
+	}
+	if retryAt.IsZero() {
+		return false
+	}
+	wait := int(retryAt.Sub(now).Seconds()) + 1
+	c.Header("Retry-After", strconv.Itoa(wait))
+	message := "Too many failed login attempts; try again shortly"
+	if locked {
+		message = "Too many failed login attempts; login is locked for now"
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": message, "retry_after": wait})
+	return true
+}
+
+// completeLogin clears the account's failed logins and answers with a session token
+func completeLogin(c *gin.Context, guard *LoginGuard, a loginAccount) {
+	// The client address keeps its count, or one known password would clear the way for guessing others
+	if err := guard.Store.Reset(AccountKey(a.Email)); err != nil {
+		log.Printf("Error clearing failed logins for %s: %v", a.Email, err)
+	}
+
+	tokenString, err := IssueToken(a.UserID, a.Role, a.OrgID, a.sessionVersion)
+	if err != nil {
+		log.Printf("Error signing token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token": tokenString,
+		"user": gin.H{
+			"user_id":        a.UserID,
+			"name":           a.Name,
+			"email":          a.Email,
+			"role":           a.Role,
+			"org_id":         a.OrgID,
+			"org":            a.Org,
+			"is_org_admin":   a.IsOrgAdmin,
+			"email_verified": a.EmailVerified,
+		},
+		// Until it is set up, the token only reaches the two-factor setup routes
+		"two_factor_setup_required": a.twoFactorMissing,
+	})
+}
+
+// LoginHandler authenticates a user and returns a JWT token. Repeated failures for an account or from a client
+// address make further attempts wait, and eventually lock them out for a while; see LoginGuard. Users with
+// two-factor authentication get a challenge token instead, to exchange at LoginTwoFactorHandler.
 func LoginHandler(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -23,16 +118,16 @@ func LoginHandler(c *gin.Context) {
 	}
 
 	db := c.MustGet("db").(*sql.DB)
-	var user models.User
-	var password string
-	err := db.QueryRow(`
-		SELECT user_id, name, email, password, role 
-		FROM user 
-		WHERE email = ? AND archive_delete_flag = TRUE`, req.Email).Scan(
-		&user.UserID, &user.Name, &user.Email, &password, &user.Role,
-	)
+	guard := c.MustGet("loginGuard").(*LoginGuard)
+	now := time.Now()
+	if Throttled(c, guard, req.Email, now) {
+		return
+	}
+
+	account, err := findLoginAccount(db, "u.email = ?", req.Email)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			guard.Fail(db, req.Email, c.ClientIP(), 0, now)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		} else {
 			log.Printf("Error querying user: %v", err)
@@ -41,33 +136,36 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(password), []byte(req.Password)); err != nil {
+	if err := bcrypt.CompareHashAndPassword([]byte(account.password), []byte(req.Password)); err != nil {
+		guard.Fail(db, req.Email, c.ClientIP(), account.UserID, now)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	claims := jwt.MapClaims{
-		"user_id": user.UserID,
-		"role":    user.Role,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+	// Checked after the password so the answer does not reveal which addresses are registered
+	if config.ConfigInstance.RequireEmailVerification && !account.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address is not verified"})
+		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.ConfigInstance.JWTSecret))
-	if err != nil {
-		log.Printf("Error signing token: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+
+	// Failed logins are only cleared once the second factor checks out, so that knowing the password does not
+	// allow unlimited guesses at the code
+	if account.twoFactorEnabled {
+		challenge, err := issueChallenge(account.UserID, account.sessionVersion)
+		if err != nil {
+			log.Printf("Error signing challenge token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int(challengeTTL.Seconds()),
+		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": tokenString,
-		"user": gin.H{
-			"user_id": user.UserID,
-			"name":    user.Name,
-			"email":   user.Email,
-			"role":    user.Role,
-		},
-	})
+	completeLogin(c, guard, account)
 }
 
 // AuthMiddleware verifies JWT token
@@ -99,6 +197,12 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+			// Challenge tokens only prove the password and are good for nothing but the second login step
+			if _, ok := claims["purpose"]; ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				c.Abort()
+				return
+			}
 			userID, ok := claims["user_id"].(float64)
 			if !ok {
 				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
@@ -111,8 +215,50 @@ func AuthMiddleware() gin.HandlerFunc {
 				c.Abort()
 				return
 			}
+			orgID, ok := claims["org_id"].(float64)
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+				c.Abort()
+				return
+			}
+			sessionVersion, ok := claims["sv"].(float64)
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+				c.Abort()
+				return
+			}
+
+			// Tokens die with their account or organization, and when the user revokes their sessions
+			db := c.MustGet("db").(*sql.DB)
+			var current int
+			var twoFactorMissing bool
+			err := db.QueryRow(`
+				SELECT u.session_version, u.role = 'teacher' AND o.require_teacher_2fa AND u.totp_enabled_at IS NULL
+				FROM user u
+				JOIN organization o ON u.org_id = o.org_id AND o.archive_delete_flag = TRUE
+				WHERE u.user_id = ? AND u.archive_delete_flag = TRUE`, int(userID)).Scan(&current, &twoFactorMissing)
+			if err != nil && err != sql.ErrNoRows {
+				log.Printf("Error querying user session: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				c.Abort()
+				return
+			}
+			if err == sql.ErrNoRows || current != int(sessionVersion) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+				c.Abort()
+				return
+			}
+			if twoFactorMissing && !twoFactorSetupPaths[c.FullPath()] {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error":                     "Your organization requires two-factor authentication; set it up first",
+					"two_factor_setup_required": true,
+				})
+				c.Abort()
+				return
+			}
 			c.Set("userID", int(userID))
 			c.Set("role", role)
+			c.Set("orgID", int(orgID))
 			c.Next()
 		} else {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
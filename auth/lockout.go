@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"edusync/config"
+)
+
+// staleAttempts is how long an idle key is kept before it is pruned. It must exceed every policy's Window.
+const staleAttempts = 24 * time.Hour
+
+// Attempts is the failed-login state of one account or client address
+type Attempts struct {
+	Failures    int
+	LastFailure time.Time
+	RetryAt     time.Time // No login is accepted before this
+	Locked      bool      // RetryAt ends a lockout rather than a backoff delay
+}
+
+// LockoutPolicy decides how long a key has to wait after each failed login
+type LockoutPolicy struct {
+	FreeFailures int           // Failures allowed before any delay
+	BaseDelay    time.Duration // Delay after the first failure past FreeFailures, doubled after each further one
+	MaxDelay     time.Duration
+	MaxFailures  int // Failures that lock the key out
+	Lockout      time.Duration
+	Window       time.Duration // A key with no failures for this long starts over
+}
+
+// next returns the state after another failure
+func (p LockoutPolicy) next(a Attempts, now time.Time) Attempts {
+	if !now.Before(a.RetryAt) && (a.Locked || now.Sub(a.LastFailure) > p.Window) {
+		a = Attempts{}
+	}
+	a.Failures++
+	a.LastFailure = now
+	a.Locked = false
+	a.RetryAt = time.Time{}
+
+	switch {
+	case a.Failures >= p.MaxFailures:
+		a.Locked = true
+		a.RetryAt = now.Add(p.Lockout)
+	case a.Failures > p.FreeFailures:
+		delay := p.MaxDelay
+		if shift := a.Failures - p.FreeFailures - 1; shift < 30 && p.BaseDelay<<shift < p.MaxDelay {
+			delay = p.BaseDelay << shift
+		}
+		a.RetryAt = now.Add(delay)
+	}
+	return a
+}
+
+// AttemptStore keeps failed-login state by key
+type AttemptStore interface {
+	// Get returns the key's state, which is zero for keys without failures
+	Get(key string) (Attempts, error)
+	// Fail records a failure under the policy and returns the new state
+	Fail(key string, policy LockoutPolicy, now time.Time) (Attempts, error)
+	// Reset forgets the key's failures, lifting any lockout
+	Reset(key string) error
+}
+
+// MemoryAttemptStore keeps failed-login state in process memory. Each instance counts on its own.
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempts
+	sweepAt  time.Time
+}
+
+// NewMemoryAttemptStore returns an empty in-memory store
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{attempts: make(map[string]Attempts)}
+}
+
+// Get returns the key's state
+func (s *MemoryAttemptStore) Get(key string) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts[key], nil
+}
+
+// Fail records a failure, dropping idle keys now and then so the map does not grow without bound
+func (s *MemoryAttemptStore) Fail(key string, policy LockoutPolicy, now time.Time) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.After(s.sweepAt) {
+		for k, a := range s.attempts {
+			if now.Sub(a.LastFailure) > staleAttempts && now.After(a.RetryAt) {
+				delete(s.attempts, k)
+			}
+		}
+		s.sweepAt = now.Add(time.Hour)
+	}
+	a := policy.next(s.attempts[key], now)
+	s.attempts[key] = a
+	return a, nil
+}
+
+// Reset forgets the key
+func (s *MemoryAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// DBAttemptStore keeps failed-login state in the login_attempt table, shared by every instance
+type DBAttemptStore struct {
+	DB *sql.DB
+}
+
+// Get returns the key's state
+func (s *DBAttemptStore) Get(key string) (Attempts, error) {
+	var a Attempts
+	var last, retry sql.NullTime
+	err := s.DB.QueryRow(`
+		SELECT failures, last_failure_at, retry_at, locked FROM login_attempt
+		WHERE attempt_key = ?`, key).Scan(&a.Failures, &last, &retry, &a.Locked)
+	if err == sql.ErrNoRows {
+		return Attempts{}, nil
+	} else if err != nil {
+		return Attempts{}, err
+	}
+	a.LastFailure, a.RetryAt = last.Time, retry.Time
+	return a, nil
+}
+
+// Fail records a failure, locking the key's row so concurrent failures from other instances all count
+func (s *DBAttemptStore) Fail(key string, policy LockoutPolicy, now time.Time) (Attempts, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return Attempts{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT IGNORE INTO login_attempt (attempt_key) VALUES (?)`, key); err != nil {
+		return Attempts{}, err
+	}
+	var a Attempts
+	var last, retry sql.NullTime
+	err = tx.QueryRow(`
+		SELECT failures, last_failure_at, retry_at, locked FROM login_attempt
+		WHERE attempt_key = ?
+		FOR UPDATE`, key).Scan(&a.Failures, &last, &retry, &a.Locked)
+	if err != nil {
+		return Attempts{}, err
+	}
+	a.LastFailure, a.RetryAt = last.Time, retry.Time
+
+	a = policy.next(a, now)
+	retry = sql.NullTime{Time: a.RetryAt, Valid: !a.RetryAt.IsZero()}
+	_, err = tx.Exec(`
+		UPDATE login_attempt SET failures = ?, last_failure_at = ?, retry_at = ?, locked = ?
+		WHERE attempt_key = ?`, a.Failures, a.LastFailure, retry, a.Locked, key)
+	if err != nil {
+		return Attempts{}, err
+	}
+	return a, tx.Commit()
+}
+
+// Reset forgets the key
+func (s *DBAttemptStore) Reset(key string) error {
+	_, err := s.DB.Exec(`DELETE FROM login_attempt WHERE attempt_key = ?`, key)
+	return err
+}
+
+// PruneLoginAttempts deletes login_attempt rows that have been idle long enough to be forgotten anyway
+func PruneLoginAttempts(db *sql.DB) error {
+	now := time.Now()
+	_, err := db.Exec(`
+		DELETE FROM login_attempt
+		WHERE last_failure_at < ? AND (retry_at IS NULL OR retry_at < ?)`, now.Add(-staleAttempts), now)
+	return err
+}
+
+// AccountKey is the attempt key of the account behind an email address. Addresses without an account are tracked
+// the same way, so a lockout does not reveal whether an address is registered.
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// clientKey is the attempt key of a client address
+func clientKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginGuard throttles password guessing. Failures are counted per account and per client address: an account is
+// locked after a handful of failures, and an address is locked after many more, spread over any number of accounts.
+// Handlers take the guard from the request context under "loginGuard".
+type LoginGuard struct {
+	Store   AttemptStore
+	Account LockoutPolicy
+	Client  LockoutPolicy
+}
+
+// NewLoginGuard returns a guard using the configured store and limits
+func NewLoginGuard(cfg *config.Config, db *sql.DB) *LoginGuard {
+	var store AttemptStore = &DBAttemptStore{DB: db}
+	if cfg.LoginAttemptStore == "memory" {
+		store = NewMemoryAttemptStore()
+	}
+	window := max(time.Hour, cfg.LoginLockout)
+	return &LoginGuard{
+		Store: store,
+		Account: LockoutPolicy{
+			FreeFailures: 3,
+			BaseDelay:    time.Second,
+			MaxDelay:     30 * time.Second,
+			MaxFailures:  cfg.LoginMaxFailures,
+			Lockout:      cfg.LoginLockout,
+			Window:       window,
+		},
+		Client: LockoutPolicy{
+			FreeFailures: 20,
+			BaseDelay:    time.Second,
+			MaxDelay:     time.Minute,
+			MaxFailures:  10 * cfg.LoginMaxFailures,
+			Lockout:      cfg.LoginLockout,
+			Window:       window,
+		},
+	}
+}
+
+// blocked returns when the account and client may try again, and whether either is locked out. A zero time means
+// the attempt can go ahead.
+func (g *LoginGuard) blocked(email, ip string, now time.Time) (time.Time, bool, error) {
+	var retryAt time.Time
+	locked := false
+	for _, key := range []string{AccountKey(email), clientKey(ip)} {
+		a, err := g.Store.Get(key)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		if now.Before(a.RetryAt) {
+			if a.RetryAt.After(retryAt) {
+				retryAt = a.RetryAt
+			}
+			locked = locked || a.Locked
+		}
+	}
+	return retryAt, locked, nil
+}
+
+// Fail records a failed login, audit logging any lockout it causes. userID is 0 for unknown addresses.
+func (g *LoginGuard) Fail(db *sql.DB, email, ip string, userID int, now time.Time) {
+	account, err := g.Store.Fail(AccountKey(email), g.Account, now)
+	if err != nil {
+		log.Printf("Error recording failed login for %s: %v", email, err)
+	} else if account.Locked && account.Failures == g.Account.MaxFailures {
+		logLoginEvent(db, "lockout", AccountKey(email), userID, ip, 0)
+	}
+	client, err := g.Store.Fail(clientKey(ip), g.Client, now)
+	if err != nil {
+		log.Printf("Error recording failed login from %s: %v", ip, err)
+	} else if client.Locked && client.Failures == g.Client.MaxFailures {
+		logLoginEvent(db, "lockout", clientKey(ip), 0, ip, 0)
+	}
+}
+
+// Unlock lifts a lockout or backoff on the account and audit logs who lifted it
+func (g *LoginGuard) Unlock(db *sql.DB, userID int, email string, actorID int) error {
+	if err := g.Store.Reset(AccountKey(email)); err != nil {
+		return err
+	}
+	logLoginEvent(db, "unlock", AccountKey(email), userID, "", actorID)
+	return nil
+}
+
+// LogTwoFactorReset audit logs an administrator turning off a member's two-factor authentication
+func LogTwoFactorReset(db *sql.DB, userID int, email string, actorID int) {
+	logLoginEvent(db, "two_factor_reset", AccountKey(email), userID, "", actorID)
+}
+
+// logLoginEvent writes a lockout, unlock or two-factor reset to the audit log. Zero IDs and empty addresses are stored as NULL.
+func logLoginEvent(db *sql.DB, event, key string, userID int, ip string, actorID int) {
+	log.Printf("Login %s: %s (user %d, ip %q, by %d)", event, key, userID, ip, actorID)
+	_, err := db.Exec(`
+		INSERT INTO login_audit (event, attempt_key, user_id, ip_address, actor_id, created_at)
+		VALUES (?, ?, NULLIF(?, 0), NULLIF(?, ''), NULLIF(?, 0), NOW())`, event, key, userID, ip, actorID)
+	if err != nil {
+		log.Printf("Error writing login audit log: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"edusync/utils"
+)
+
+// TOTP follows RFC 6238 with the parameters every authenticator app supports: SHA-1, six digits, 30-second steps
+const (
+	totpIssuer = "EduSync"
+	totpPeriod = 30
+	totpDigits = 6
+	totpModulo = 1_000_000 // 10^totpDigits
+	// totpSkew is how many steps either side of the current one are accepted, for clocks that drift
+	totpSkew = 1
+)
+
+// backupCodeCount is how many recovery codes are issued at a time
+const backupCodeCount = 10
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random secret, base32 encoded as authenticator apps expect
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return secretEncoding.EncodeToString(b), nil
+}
+
+// TOTPProvisioningURI is the otpauth:// URI an authenticator app reads from a QR code
+func TOTPProvisioningURI(account, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", totpIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(totpIssuer+":"+account) + "?" + q.Encode()
+}
+
+// totpCode computes the code for one time step
+func totpCode(key []byte, step int64) string {
+	mac := hmac.New(sha1.New, key)
+	binary.Write(mac, binary.BigEndian, step)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulo)
+}
+
+// ValidateTOTP checks a code against the secret and returns the time step it belongs to. Steps up to lastStep have
+// been used already and are refused, so an observed code cannot be replayed.
+func ValidateTOTP(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	code = normalizeCode(code)
+	key, err := secretEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step > lastStep && hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// normalizeCode strips the spaces and dashes people type into codes
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// IssueBackupCodes replaces the user's recovery codes with new ones and returns them. Only their hashes are kept,
+// so this is the only time they can be shown.
+func IssueBackupCodes(tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec(`DELETE FROM backup_code WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, backupCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(secretEncoding.EncodeToString(b)) // 8 characters
+		_, err := tx.Exec(`
+			INSERT INTO backup_code (user_id, code_hash, created_at)
+			VALUES (?, ?, NOW())`, userID, utils.HashToken(code))
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code[:4] + "-" + code[4:]
+	}
+	return codes, nil
+}
+
+// VerifySecondFactor checks a six-digit authenticator code or an unused backup code for a user with two-factor
+// authentication turned on, spending the code if it is good
+func VerifySecondFactor(tx *sql.Tx, userID int, code string) (bool, error) {
+	code = normalizeCode(code)
+
+	var secret sql.NullString
+	var lastStep sql.NullInt64
+	err := tx.QueryRow(`
+		SELECT totp_secret, totp_last_step FROM user
+		WHERE user_id = ? AND totp_enabled_at IS NOT NULL
+		FOR UPDATE`, userID).Scan(&secret, &lastStep)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if len(code) == totpDigits {
+		step, ok := ValidateTOTP(secret.String, code, lastStep.Int64, time.Now())
+		if !ok {
+			return false, nil
+		}
+		_, err := tx.Exec(`UPDATE user SET totp_last_step = ? WHERE user_id = ?`, step, userID)
+		return err == nil, err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE backup_code SET used_at = NOW()
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`, userID, utils.HashToken(code))
+	if err != nil {
+		return false, err
+	}
+	used, err := result.RowsAffected()
+	return used == 1, err
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcKey is the SHA-1 key of the RFC 6238 test vectors, and rfcSecret its base32 form as users store it
+var (
+	rfcKey    = []byte("12345678901234567890")
+	rfcSecret = secretEncoding.EncodeToString(rfcKey)
+)
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238 appendix B lists eight-digit codes; six-digit codes are their last six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(rfcKey, tt.unix/totpPeriod); got != tt.code {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+		step, ok := ValidateTOTP(rfcSecret, tt.code, 0, time.Unix(tt.unix, 0))
+		if !ok || step != tt.unix/totpPeriod {
+			t.Errorf("ValidateTOTP at %d = %d, %v, want %d, true", tt.unix, step, ok, tt.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+	tests := []struct {
+		offset int64
+		ok     bool
+	}{
+		{-2, false},
+		{-1, true},
+		{0, true},
+		{1, true},
+		{2, false},
+	}
+	for _, tt := range tests {
+		code := totpCode(rfcKey, current+tt.offset)
+		step, ok := ValidateTOTP(rfcSecret, code, 0, now)
+		if ok != tt.ok {
+			t.Errorf("code %d steps away: ok = %v, want %v", tt.offset, ok, tt.ok)
+		}
+		if ok && step != current+tt.offset {
+			t.Errorf("code %d steps away: step = %d, want %d", tt.offset, step, current+tt.offset)
+		}
+	}
+}
+
+func TestValidateTOTPReplay(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step, ok := ValidateTOTP(rfcSecret, "050471", 0, now)
+	if !ok {
+		t.Fatal("first use of the code was rejected")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, "050471", step, now); ok {
+		t.Error("code was accepted again at the step already used")
+	}
+
+	// Once a later step is used, codes of earlier steps in the window are spent too
+	earlier := totpCode(rfcKey, step-1)
+	if _, ok := ValidateTOTP(rfcSecret, earlier, step, now); ok {
+		t.Error("code of an earlier step was accepted after a later one was used")
+	}
+	later := totpCode(rfcKey, step+1)
+	if _, ok := ValidateTOTP(rfcSecret, later, step, now); !ok {
+		t.Error("code of the next step was rejected")
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		ok     bool
+	}{
+		{"spaced code", rfcSecret, "050 471", true},
+		{"dashed code", rfcSecret, "050-471", true},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "050471", true},
+		{"wrong code", rfcSecret, "050472", false},
+		{"short code", rfcSecret, "05047", false},
+		{"long code", rfcSecret, "0504710", false},
+		{"bad secret", "not base32!", "050471", false},
+	}
+	for _, tt := range tests {
+		if _, ok := ValidateTOTP(tt.secret, tt.code, 0, now); ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+		}
+	}
+}
+
+func TestNormalizeCode(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"abcd-efgh", "abcdefgh"},
+		{"ABCD-EFGH", "abcdefgh"},
+		{" abcd efgh ", "abcdefgh"},
+		{"Ab-Cd Ef-Gh", "abcdefgh"},
+		{"123 456", "123456"},
+	}
+	for _, tt := range tests {
+		if got := normalizeCode(tt.in); got != tt.want {
+			t.Errorf("normalizeCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+
+	"edusync/config"
+	"edusync/models"
+)
+
+// challengeTTL is how long a user has to enter their code after the password
+const challengeTTL = 5 * time.Minute
+
+// twoFactorSetupPaths are the routes open to users who must set up two-factor authentication before anything else
+var twoFactorSetupPaths = map[string]bool{
+	"/api/auth/check":               true,
+	"/api/profile":                  true,
+	"/api/account/2fa":              true,
+	"/api/account/2fa/enroll":       true,
+	"/api/account/2fa/confirm":      true,
+	"/api/account/2fa/backup-codes": true,
+}
+
+var errInvalidChallenge = errors.New("invalid login challenge")
+
+// issueChallenge signs a token saying the user got their password right. AuthMiddleware refuses it; only
+// LoginTwoFactorHandler takes it.
+func issueChallenge(userID, sessionVersion int) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"purpose": "2fa",
+		"sv":      sessionVersion,
+		"exp":     time.Now().Add(challengeTTL).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.ConfigInstance.JWTSecret))
+}
+
+// parseChallenge checks a challenge token and returns the user and session version it was issued for
+func parseChallenge(tokenString string) (int, int, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(config.ConfigInstance.JWTSecret), nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != "2fa" {
+		return 0, 0, errInvalidChallenge
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, 0, errInvalidChallenge
+	}
+	sessionVersion, ok := claims["sv"].(float64)
+	if !ok {
+		return 0, 0, errInvalidChallenge
+	}
+	return int(userID), int(sessionVersion), nil
+}
+
+// LoginTwoFactorHandler finishes a login by exchanging a challenge token and an authenticator or backup code for a
+// session token. Wrong codes count as failed logins.
+func LoginTwoFactorHandler(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	userID, sessionVersion, err := parseChallenge(req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login challenge is invalid or has expired"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	guard := c.MustGet("loginGuard").(*LoginGuard)
+	now := time.Now()
+	account, err := findLoginAccount(db, "u.user_id = ?", userID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	// A password change since the challenge was issued voids it
+	if err == sql.ErrNoRows || account.sessionVersion != sessionVersion || !account.twoFactorEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login challenge is invalid or has expired"})
+		return
+	}
+	if Throttled(c, guard, account.Email, now) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	ok, err := VerifySecondFactor(tx, userID, req.Code)
+	if err != nil {
+		log.Printf("Error checking authentication code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !ok {
+		// Release the user row first; the audit log entry for a lockout references it
+		tx.Rollback()
+		guard.Fail(db, account.Email, c.ClientIP(), userID, now)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	completeLogin(c, guard, account)
+}
@@ -3,15 +3,38 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 // Config holds the application configuration
 type Config struct {
-	DatabaseURL string
-	Port        string
-	JWTSecret   string
+	DatabaseURL       string
+	Port              string
+	JWTSecret         string
+	SchedulerInterval time.Duration
+	GraderInterval    time.Duration
+	GraderUID         int // Host user sandboxed submissions run as; unprivileged and used for nothing else
+	GraderGID         int
+	AppURL            string // Base of the links mailed to users
+	SMTPHost          string // Mail is logged instead of sent when empty
+	SMTPPort          string
+	SMTPUsername      string
+	SMTPPassword      string
+	MailFrom          string
+	UploadDir         string // Where uploaded images are stored
+	UploadURL         string // Base URL the stored images are served from
+	// RequireEmailVerification refuses logins until the address has been verified
+	RequireEmailVerification bool
+	LoginAttemptStore        string        // "database" shares failed-login counts between instances, "memory" does not
+	LoginMaxFailures         int           // Failed logins that lock an account
+	LoginLockout             time.Duration // How long a locked account stays locked
+	// TrustedProxies are the addresses or CIDR ranges allowed to report the client address in X-Forwarded-For.
+	// When empty, the client address is always the connecting peer.
+	TrustedProxies []string
 }
 
 // ConfigInstance is the global configuration instance
@@ -22,14 +45,39 @@ func LoadConfig() (*Config, error) {
 	_ = godotenv.Load()
 
 	config := &Config{
-		DatabaseURL: os.Getenv("DATABASE_URL"),
-		Port:        os.Getenv("PORT"),
-		JWTSecret:   os.Getenv("JWT_SECRET"),
+		DatabaseURL:  os.Getenv("DATABASE_URL"),
+		Port:         os.Getenv("PORT"),
+		JWTSecret:    os.Getenv("JWT_SECRET"),
+		AppURL:       os.Getenv("APP_URL"),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     os.Getenv("SMTP_PORT"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		MailFrom:     os.Getenv("MAIL_FROM"),
+		UploadDir:    os.Getenv("UPLOAD_DIR"),
+		UploadURL:    os.Getenv("UPLOAD_URL"),
 	}
 
 	if config.Port == "" {
 		config.Port = "8080"
 	}
+	if config.AppURL == "" {
+		config.AppURL = "http://localhost:" + config.Port
+	}
+	config.AppURL = strings.TrimSuffix(config.AppURL, "/")
+	if config.SMTPPort == "" {
+		config.SMTPPort = "587"
+	}
+	if config.MailFrom == "" {
+		config.MailFrom = "no-reply@edusync.local"
+	}
+	if config.UploadDir == "" {
+		config.UploadDir = "uploads"
+	}
+	if config.UploadURL == "" {
+		config.UploadURL = "http://localhost:" + config.Port + "/uploads"
+	}
+	config.UploadURL = strings.TrimSuffix(config.UploadURL, "/")
 
 	if config.DatabaseURL == "" {
 		config.DatabaseURL = fmt.Sprintf(
@@ -42,6 +90,75 @@ func LoadConfig() (*Config, error) {
 		)
 	}
 
+	config.SchedulerInterval = time.Minute
+	if interval := os.Getenv("SCHEDULER_INTERVAL"); interval != "" {
+		parsed, err := time.ParseDuration(interval)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid SCHEDULER_INTERVAL %q", interval)
+		}
+		config.SchedulerInterval = parsed
+	}
+
+	config.GraderInterval = 5 * time.Second
+	if interval := os.Getenv("GRADER_POLL_INTERVAL"); interval != "" {
+		parsed, err := time.ParseDuration(interval)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid GRADER_POLL_INTERVAL %q", interval)
+		}
+		config.GraderInterval = parsed
+	}
+
+	config.GraderUID, config.GraderGID = 65534, 65534 // nobody
+	for name, id := range map[string]*int{"GRADER_UID": &config.GraderUID, "GRADER_GID": &config.GraderGID} {
+		if v := os.Getenv(name); v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*id = parsed
+		}
+	}
+
+	if v := os.Getenv("REQUIRE_EMAIL_VERIFICATION"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REQUIRE_EMAIL_VERIFICATION %q", v)
+		}
+		config.RequireEmailVerification = parsed
+	}
+
+	config.LoginAttemptStore = os.Getenv("LOGIN_ATTEMPT_STORE")
+	if config.LoginAttemptStore == "" {
+		config.LoginAttemptStore = "database"
+	}
+	if config.LoginAttemptStore != "database" && config.LoginAttemptStore != "memory" {
+		return nil, fmt.Errorf("invalid LOGIN_ATTEMPT_STORE %q", config.LoginAttemptStore)
+	}
+
+	config.LoginMaxFailures = 10
+	if v := os.Getenv("LOGIN_MAX_FAILURES"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid LOGIN_MAX_FAILURES %q", v)
+		}
+		config.LoginMaxFailures = parsed
+	}
+
+	config.LoginLockout = 15 * time.Minute
+	if v := os.Getenv("LOGIN_LOCKOUT"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid LOGIN_LOCKOUT %q", v)
+		}
+		config.LoginLockout = parsed
+	}
+
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			config.TrustedProxies = append(config.TrustedProxies, proxy)
+		}
+	}
+
 	if config.JWTSecret == "" {
 		return nil, fmt.Errorf("JWT_SECRET is required")
 	}
@@ -3,6 +3,26 @@ DROP DATABASE IF EXISTS edusync_db;
 CREATE DATABASE edusync_db;
 USE edusync_db;
 
+-- Create ORGANIZATION table
+CREATE TABLE organization (
+    org_id INT PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    slug VARCHAR(50) NOT NULL UNIQUE,
+    logo_url VARCHAR(255),
+    primary_color CHAR(7),
+    require_teacher_2fa BOOLEAN DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    archive_delete_flag BOOLEAN DEFAULT TRUE
+);
+
+-- Create ORG_EMAIL_DOMAIN table
+CREATE TABLE org_email_domain (
+    org_id INT NOT NULL,
+    domain VARCHAR(100) NOT NULL,
+    PRIMARY KEY (org_id, domain),
+    FOREIGN KEY (org_id) REFERENCES organization(org_id) ON DELETE CASCADE
+);
+
 -- Create USER table
 CREATE TABLE user (
     user_id INT PRIMARY KEY AUTO_INCREMENT,
@@ -12,9 +32,18 @@ CREATE TABLE user (
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     contact_number VARCHAR(20),
     profile_picture VARCHAR(255),
+    profile_picture_key VARCHAR(100),
     role ENUM('teacher', 'student') NOT NULL,
-    org VARCHAR(100),
-    archive_delete_flag BOOLEAN DEFAULT TRUE
+    email_verified_at DATETIME,
+    pending_email VARCHAR(100),
+    session_version INT DEFAULT 0,
+    totp_secret VARCHAR(64),
+    totp_enabled_at DATETIME,
+    totp_last_step BIGINT,
+    org_id INT NOT NULL,
+    is_org_admin BOOLEAN DEFAULT FALSE,
+    archive_delete_flag BOOLEAN DEFAULT TRUE,
+    FOREIGN KEY (org_id) REFERENCES organization(org_id) ON DELETE CASCADE
 );
 
 -- Create TEACHER table
@@ -39,14 +68,42 @@ CREATE TABLE student (
 -- Create CLASSROOM table
 CREATE TABLE classroom (
     course_id INT PRIMARY KEY AUTO_INCREMENT,
+    org_id INT NOT NULL,
     teacher_id INT NOT NULL,
     title VARCHAR(255) NOT NULL,
     description TEXT,
     start_date DATE,
     end_date DATE,
     subject_area VARCHAR(100),
+    cloned_from_course_id INT,
+    is_archived BOOLEAN DEFAULT FALSE,
+    archived_at DATETIME,
+    is_listed BOOLEAN DEFAULT FALSE,
+    capacity INT,
     archive_delete_flag BOOLEAN DEFAULT TRUE,
-    FOREIGN KEY (teacher_id) REFERENCES teacher(teacher_id) ON DELETE CASCADE
+    FOREIGN KEY (org_id) REFERENCES organization(org_id) ON DELETE CASCADE,
+    FOREIGN KEY (teacher_id) REFERENCES teacher(teacher_id) ON DELETE CASCADE,
+    FOREIGN KEY (cloned_from_course_id) REFERENCES classroom(course_id) ON DELETE SET NULL
+);
+
+-- Create CLASSROOM_STAFF table
+CREATE TABLE classroom_staff (
+    staff_id INT PRIMARY KEY AUTO_INCREMENT,
+    course_id INT NOT NULL,
+    teacher_id INT NOT NULL,
+    role ENUM('owner', 'co_teacher', 'ta') NOT NULL,
+    status ENUM('invited', 'active') DEFAULT 'invited',
+    can_edit_classroom BOOLEAN DEFAULT FALSE,
+    can_edit_content BOOLEAN DEFAULT FALSE,
+    can_grade BOOLEAN DEFAULT FALSE,
+    can_manage_students BOOLEAN DEFAULT FALSE,
+    can_manage_staff BOOLEAN DEFAULT FALSE,
+    invited_by INT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    archive_delete_flag BOOLEAN DEFAULT TRUE,
+    FOREIGN KEY (course_id) REFERENCES classroom(course_id) ON DELETE CASCADE,
+    FOREIGN KEY (teacher_id) REFERENCES teacher(teacher_id) ON DELETE CASCADE,
+    FOREIGN KEY (invited_by) REFERENCES teacher(teacher_id) ON DELETE SET NULL
 );
 
 -- Create ENROLLMENT table
@@ -61,6 +118,26 @@ CREATE TABLE enrollment (
     FOREIGN KEY (course_id) REFERENCES classroom(course_id) ON DELETE CASCADE
 );
 
+-- Create STUDENT_GROUP table
+CREATE TABLE student_group (
+    group_id INT PRIMARY KEY AUTO_INCREMENT,
+    course_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    archive_delete_flag BOOLEAN DEFAULT TRUE,
+    FOREIGN KEY (course_id) REFERENCES classroom(course_id) ON DELETE CASCADE
+);
+
+-- Create STUDENT_GROUP_MEMBER table
+CREATE TABLE student_group_member (
+    group_id INT NOT NULL,
+    student_id INT NOT NULL,
+    archive_delete_flag BOOLEAN DEFAULT TRUE,
+    PRIMARY KEY (group_id, student_id),
+    FOREIGN KEY (group_id) REFERENCES student_group(group_id) ON DELETE CASCADE,
+    FOREIGN KEY (student_id) REFERENCES student(student_id) ON DELETE CASCADE
+);
+
 -- Create MATERIAL table
 CREATE TABLE material (
     material_id INT PRIMARY KEY AUTO_INCREMENT,
@@ -82,8 +159,12 @@ CREATE TABLE announcement (
     content TEXT,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     is_pinned BOOLEAN DEFAULT FALSE,
+    status ENUM('draft', 'scheduled', 'published') DEFAULT 'published',
+    publish_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    source_announcement_id INT,
     archive_delete_flag BOOLEAN DEFAULT TRUE,
-    FOREIGN KEY (course_id) REFERENCES classroom(course_id) ON DELETE CASCADE
+    FOREIGN KEY (course_id) REFERENCES classroom(course_id) ON DELETE CASCADE,
+    FOREIGN KEY (source_announcement_id) REFERENCES announcement(announcement_id) ON DELETE SET NULL
 );
 
 -- Create ASSIGNMENT table
@@ -95,8 +176,13 @@ CREATE TABLE assignment (
     due_date DATETIME NOT NULL,
     max_points INT DEFAULT 100,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    status ENUM('draft', 'scheduled', 'published') DEFAULT 'published',
+    publish_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    source_assignment_id INT,
+    is_group_assignment BOOLEAN DEFAULT FALSE,
     archive_delete_flag BOOLEAN DEFAULT TRUE,
-    FOREIGN KEY (course_id) REFERENCES classroom(course_id) ON DELETE CASCADE
+    FOREIGN KEY (course_id) REFERENCES classroom(course_id) ON DELETE CASCADE,
+    FOREIGN KEY (source_assignment_id) REFERENCES assignment(assignment_id) ON DELETE SET NULL
 );
 
 -- Create SUBMISSION table
@@ -109,24 +195,420 @@ CREATE TABLE submission (
     score INT,
     feedback TEXT,
     status VARCHAR(20) DEFAULT 'submitted',
+    group_id INT,
+    source_code MEDIUMTEXT,
     archive_delete_flag BOOLEAN DEFAULT TRUE,
     FOREIGN KEY (assignment_id) REFERENCES assignment(assignment_id) ON DELETE CASCADE,
+    FOREIGN KEY (student_id) REFERENCES student(student_id) ON DELETE CASCADE,
+    FOREIGN KEY (group_id) REFERENCES student_group(group_id) ON DELETE SET NULL
+);
+
+-- Create SUBMISSION_MEMBER_GRADE table (per-member adjustments to a group submission's grade)
+CREATE TABLE submission_member_grade (
+    submission_id INT NOT NULL,
+    student_id INT NOT NULL,
+    score INT,
+    feedback TEXT,
+    PRIMARY KEY (submission_id, student_id),
+    FOREIGN KEY (submission_id) REFERENCES submission(submission_id) ON DELETE CASCADE,
     FOREIGN KEY (student_id) REFERENCES student(student_id) ON DELETE CASCADE
 );
 
+-- Create QUESTION_BANK table
+CREATE TABLE question_bank (
+    bank_id INT PRIMARY KEY AUTO_INCREMENT,
+    course_id INT NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    archive_delete_flag BOOLEAN DEFAULT TRUE,
+    FOREIGN KEY (course_id) REFERENCES classroom(course_id) ON DELETE CASCADE
+);
+
+-- Create QUIZ_QUESTION table
+CREATE TABLE quiz_question (
+    question_id INT PRIMARY KEY AUTO_INCREMENT,
+    bank_id INT NOT NULL,
+    question_type ENUM('multiple_choice', 'multi_select', 'true_false', 'numeric', 'short_answer') NOT NULL,
+    prompt TEXT NOT NULL,
+    options JSON,
+    correct_answer JSON,
+    tolerance DOUBLE DEFAULT 0,
+    points DOUBLE DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    archive_delete_flag BOOLEAN DEFAULT TRUE,
+    FOREIGN KEY (bank_id) REFERENCES question_bank(bank_id) ON DELETE CASCADE
+);
+
+-- Create QUIZ table (quiz settings for an assignment)
+CREATE TABLE quiz (
+    assignment_id INT PRIMARY KEY,
+    bank_id INT NOT NULL,
+    question_count INT,
+    time_limit_minutes INT,
+    max_attempts INT DEFAULT 1,
+    shuffle_questions BOOLEAN DEFAULT FALSE,
+    shuffle_options BOOLEAN DEFAULT FALSE,
+    archive_delete_flag BOOLEAN DEFAULT TRUE,
+    FOREIGN KEY (assignment_id) REFERENCES assignment(assignment_id) ON DELETE CASCADE,
+    FOREIGN KEY (bank_id) REFERENCES question_bank(bank_id) ON DELETE CASCADE
+);
+
+-- Create QUIZ_ATTEMPT table
+CREATE TABLE quiz_attempt (
+    attempt_id INT PRIMARY KEY AUTO_INCREMENT,
+    assignment_id INT NOT NULL,
+    student_id INT NOT NULL,
+    submission_id INT,
+    attempt_number INT NOT NULL,
+    status ENUM('in_progress', 'needs_review', 'graded', 'expired') DEFAULT 'in_progress',
+    started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME,
+    submitted_at DATETIME,
+    points_earned DOUBLE,
+    points_possible DOUBLE NOT NULL,
+    FOREIGN KEY (assignment_id) REFERENCES assignment(assignment_id) ON DELETE CASCADE,
+    FOREIGN KEY (student_id) REFERENCES student(student_id) ON DELETE CASCADE,
+    FOREIGN KEY (submission_id) REFERENCES submission(submission_id) ON DELETE SET NULL
+);
+
+-- Create QUIZ_ANSWER table (one row per question drawn for an attempt)
+CREATE TABLE quiz_answer (
+    attempt_id INT NOT NULL,
+    question_id INT NOT NULL,
+    position INT NOT NULL,
+    option_order JSON,
+    answer JSON,
+    points_awarded DOUBLE,
+    PRIMARY KEY (attempt_id, question_id),
+    FOREIGN KEY (attempt_id) REFERENCES quiz_attempt(attempt_id) ON DELETE CASCADE,
+    FOREIGN KEY (question_id) REFERENCES quiz_question(question_id) ON DELETE CASCADE
+);
+
+-- Create CODE_ASSIGNMENT table (auto-graded programming settings for an assignment)
+CREATE TABLE code_assignment (
+    assignment_id INT PRIMARY KEY,
+    language VARCHAR(20) NOT NULL,
+    time_limit_ms INT DEFAULT 2000,
+    memory_limit_mb INT DEFAULT 256,
+    archive_delete_flag BOOLEAN DEFAULT TRUE,
+    FOREIGN KEY (assignment_id) REFERENCES assignment(assignment_id) ON DELETE CASCADE
+);
+
+-- Create CODE_TEST_CASE table
+CREATE TABLE code_test_case (
+    test_id INT PRIMARY KEY AUTO_INCREMENT,
+    assignment_id INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    input TEXT,
+    expected_output TEXT NOT NULL,
+    points DOUBLE DEFAULT 1,
+    is_hidden BOOLEAN DEFAULT FALSE,
+    position INT DEFAULT 0,
+    archive_delete_flag BOOLEAN DEFAULT TRUE,
+    FOREIGN KEY (assignment_id) REFERENCES assignment(assignment_id) ON DELETE CASCADE
+);
+
+-- Create GRADING_JOB table (queue of submissions waiting for the code runner)
+CREATE TABLE grading_job (
+    job_id INT PRIMARY KEY AUTO_INCREMENT,
+    submission_id INT NOT NULL,
+    status ENUM('queued', 'running', 'completed', 'failed', 'cancelled') DEFAULT 'queued',
+    error TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    started_at DATETIME,
+    finished_at DATETIME,
+    FOREIGN KEY (submission_id) REFERENCES submission(submission_id) ON DELETE CASCADE
+);
+
+-- Create GRADING_RESULT table (outcome of each test in a grading job)
+CREATE TABLE grading_result (
+    job_id INT NOT NULL,
+    test_id INT NOT NULL,
+    passed BOOLEAN NOT NULL,
+    stdout TEXT,
+    stderr TEXT,
+    exit_code INT,
+    timed_out BOOLEAN DEFAULT FALSE,
+    runtime_ms INT,
+    PRIMARY KEY (job_id, test_id),
+    FOREIGN KEY (job_id) REFERENCES grading_job(job_id) ON DELETE CASCADE,
+    FOREIGN KEY (test_id) REFERENCES code_test_case(test_id) ON DELETE CASCADE
+);
+
+-- Create SIMILARITY_REPORT table (background plagiarism check across an assignment's submissions)
+CREATE TABLE similarity_report (
+    report_id INT PRIMARY KEY AUTO_INCREMENT,
+    assignment_id INT NOT NULL,
+    requested_by INT NOT NULL,
+    threshold DOUBLE NOT NULL,
+    status ENUM('queued', 'running', 'completed', 'failed') DEFAULT 'queued',
+    submission_count INT DEFAULT 0,
+    pairs_total INT DEFAULT 0,
+    pairs_done INT DEFAULT 0,
+    error TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    started_at DATETIME,
+    finished_at DATETIME,
+    FOREIGN KEY (assignment_id) REFERENCES assignment(assignment_id) ON DELETE CASCADE,
+    FOREIGN KEY (requested_by) REFERENCES teacher(teacher_id) ON DELETE CASCADE
+);
+
+-- Create SIMILARITY_MATCH table (pairs of submissions flagged by a report)
+CREATE TABLE similarity_match (
+    report_id INT NOT NULL,
+    submission_a INT NOT NULL,
+    submission_b INT NOT NULL,
+    similarity DOUBLE NOT NULL,
+    spans JSON,
+    PRIMARY KEY (report_id, submission_a, submission_b),
+    FOREIGN KEY (report_id) REFERENCES similarity_report(report_id) ON DELETE CASCADE,
+    FOREIGN KEY (submission_a) REFERENCES submission(submission_id) ON DELETE CASCADE,
+    FOREIGN KEY (submission_b) REFERENCES submission(submission_id) ON DELETE CASCADE
+);
+
+-- Create PEER_REVIEW_SETTINGS table (peer review configuration for an assignment)
+CREATE TABLE peer_review_settings (
+    assignment_id INT PRIMARY KEY,
+    reviews_per_submission INT NOT NULL DEFAULT 2,
+    review_due_date DATETIME NOT NULL,
+    rubric JSON NOT NULL,
+    grade_weight DOUBLE DEFAULT 0,
+    assigned_at DATETIME,
+    archive_delete_flag BOOLEAN DEFAULT TRUE,
+    FOREIGN KEY (assignment_id) REFERENCES assignment(assignment_id) ON DELETE CASCADE
+);
+
+-- Create PEER_REVIEW table (one student anonymously reviewing one submission)
+CREATE TABLE peer_review (
+    review_id INT PRIMARY KEY AUTO_INCREMENT,
+    submission_id INT NOT NULL,
+    reviewer_id INT NOT NULL,
+    status ENUM('assigned', 'submitted') DEFAULT 'assigned',
+    scores JSON,
+    comments TEXT,
+    score DOUBLE,
+    assigned_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    submitted_at DATETIME,
+    FOREIGN KEY (submission_id) REFERENCES submission(submission_id) ON DELETE CASCADE,
+    FOREIGN KEY (reviewer_id) REFERENCES student(student_id) ON DELETE CASCADE
+);
+
+-- Create CLASS_SESSION table (a scheduled meeting of a classroom)
+CREATE TABLE class_session (
+    session_id INT PRIMARY KEY AUTO_INCREMENT,
+    course_id INT NOT NULL,
+    session_date DATE NOT NULL,
+    topic VARCHAR(255),
+    check_in_code VARCHAR(10),
+    check_in_expires_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    archive_delete_flag BOOLEAN DEFAULT TRUE,
+    FOREIGN KEY (course_id) REFERENCES classroom(course_id) ON DELETE CASCADE
+);
+
+-- Create ATTENDANCE table (one student's attendance at one session)
+CREATE TABLE attendance (
+    session_id INT NOT NULL,
+    student_id INT NOT NULL,
+    status ENUM('present', 'absent', 'late', 'excused') NOT NULL,
+    note VARCHAR(255),
+    checked_in_at DATETIME,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (session_id, student_id),
+    FOREIGN KEY (session_id) REFERENCES class_session(session_id) ON DELETE CASCADE,
+    FOREIGN KEY (student_id) REFERENCES student(student_id) ON DELETE CASCADE
+);
+
+-- Create CALENDAR_FEED table (secret token for a user's subscribable iCalendar feed)
+CREATE TABLE calendar_feed (
+    user_id INT PRIMARY KEY,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_accessed_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES user(user_id) ON DELETE CASCADE
+);
+
+-- Create CLASS_MODULE table (an ordered unit grouping a classroom's content)
+CREATE TABLE class_module (
+    module_id INT PRIMARY KEY AUTO_INCREMENT,
+    course_id INT NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    position INT NOT NULL DEFAULT 0,
+    unlock_at DATETIME,
+    lock_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    archive_delete_flag BOOLEAN DEFAULT TRUE,
+    FOREIGN KEY (course_id) REFERENCES classroom(course_id) ON DELETE CASCADE
+);
+
+-- Create MODULE_ITEM table (a material or assignment placed in a module; each belongs to at most one module)
+CREATE TABLE module_item (
+    module_id INT NOT NULL,
+    item_type ENUM('material', 'assignment') NOT NULL,
+    content_id INT NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (item_type, content_id),
+    FOREIGN KEY (module_id) REFERENCES class_module(module_id) ON DELETE CASCADE
+);
+
+-- Create MODULE_PREREQUISITE table (modules that must be completed before another unlocks)
+CREATE TABLE module_prerequisite (
+    module_id INT NOT NULL,
+    prerequisite_id INT NOT NULL,
+    PRIMARY KEY (module_id, prerequisite_id),
+    FOREIGN KEY (module_id) REFERENCES class_module(module_id) ON DELETE CASCADE,
+    FOREIGN KEY (prerequisite_id) REFERENCES class_module(module_id) ON DELETE CASCADE
+);
+
+-- Create MATERIAL_COMPLETION table (materials a student has marked as done)
+CREATE TABLE material_completion (
+    material_id INT NOT NULL,
+    student_id INT NOT NULL,
+    completed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (material_id, student_id),
+    FOREIGN KEY (material_id) REFERENCES material(material_id) ON DELETE CASCADE,
+    FOREIGN KEY (student_id) REFERENCES student(student_id) ON DELETE CASCADE
+);
+
+-- Create MATERIAL_VIEW table (how often each student has opened and downloaded a material)
+CREATE TABLE material_view (
+    material_id INT NOT NULL,
+    student_id INT NOT NULL,
+    view_count INT NOT NULL DEFAULT 0,
+    download_count INT NOT NULL DEFAULT 0,
+    first_viewed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_viewed_at DATETIME,
+    last_downloaded_at DATETIME,
+    PRIMARY KEY (material_id, student_id),
+    FOREIGN KEY (material_id) REFERENCES material(material_id) ON DELETE CASCADE,
+    FOREIGN KEY (student_id) REFERENCES student(student_id) ON DELETE CASCADE
+);
+
+-- Create USER_TOKEN table (single-use links mailed to users, such as invitations and password resets; only hashes
+-- are stored)
+CREATE TABLE user_token (
+    token_id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    purpose VARCHAR(20) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES user(user_id) ON DELETE CASCADE
+);
+
+-- Create BACKUP_CODE table (single-use two-factor recovery codes; only hashes are stored)
+CREATE TABLE backup_code (
+    code_id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES user(user_id) ON DELETE CASCADE
+);
+
+-- Create LOGIN_ATTEMPT table (failed-login counts by account or client address, shared between app instances)
+CREATE TABLE login_attempt (
+    attempt_key VARCHAR(191) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at DATETIME,
+    retry_at DATETIME,
+    locked BOOLEAN DEFAULT FALSE
+);
+
+-- Create LOGIN_AUDIT table (login lockouts, the admins who lifted them, and admin two-factor resets)
+CREATE TABLE login_audit (
+    audit_id INT PRIMARY KEY AUTO_INCREMENT,
+    event ENUM('lockout', 'unlock', 'two_factor_reset') NOT NULL,
+    attempt_key VARCHAR(191) NOT NULL,
+    user_id INT,
+    ip_address VARCHAR(45),
+    actor_id INT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES user(user_id) ON DELETE SET NULL,
+    FOREIGN KEY (actor_id) REFERENCES user(user_id) ON DELETE SET NULL
+);
+
+-- Create SUBMISSION_COMMENT table
+CREATE TABLE submission_comment (
+    comment_id INT PRIMARY KEY AUTO_INCREMENT,
+    submission_id INT NOT NULL,
+    user_id INT NOT NULL,
+    content TEXT NOT NULL,
+    anchor_type ENUM('line', 'char'),
+    anchor_start INT,
+    anchor_end INT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    archive_delete_flag BOOLEAN DEFAULT TRUE,
+    FOREIGN KEY (submission_id) REFERENCES submission(submission_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES user(user_id) ON DELETE CASCADE
+);
+
 -- Create indexes for performance optimization
 CREATE INDEX idx_user_email ON user(email);
 CREATE INDEX idx_student_user ON student(user_id);
 CREATE INDEX idx_teacher_user ON teacher(user_id);
 CREATE INDEX idx_classroom_teacher ON classroom(teacher_id);
+CREATE INDEX idx_classroom_archive ON classroom(is_archived, end_date);
+CREATE INDEX idx_classroom_staff_teacher ON classroom_staff(teacher_id);
 CREATE INDEX idx_enrollment_student ON enrollment(student_id);
 CREATE INDEX idx_enrollment_course ON enrollment(course_id);
 CREATE INDEX idx_material_course ON material(course_id);
 CREATE INDEX idx_announcement_course ON announcement(course_id);
 CREATE INDEX idx_assignment_course ON assignment(course_id);
+CREATE INDEX idx_announcement_publish ON announcement(status, publish_at);
+CREATE INDEX idx_assignment_publish ON assignment(status, publish_at);
+CREATE INDEX idx_announcement_source ON announcement(source_announcement_id);
+CREATE INDEX idx_assignment_source ON assignment(source_assignment_id);
 CREATE INDEX idx_submission_assignment ON submission(assignment_id);
 CREATE INDEX idx_submission_student ON submission(student_id);
+CREATE INDEX idx_submission_group ON submission(group_id);
+CREATE INDEX idx_student_group_course ON student_group(course_id);
+CREATE INDEX idx_student_group_member_student ON student_group_member(student_id);
+CREATE INDEX idx_submission_comment_submission ON submission_comment(submission_id);
+CREATE INDEX idx_question_bank_course ON question_bank(course_id);
+CREATE INDEX idx_quiz_question_bank ON quiz_question(bank_id);
+CREATE INDEX idx_quiz_attempt_student ON quiz_attempt(assignment_id, student_id);
+CREATE INDEX idx_code_test_case_assignment ON code_test_case(assignment_id);
+CREATE INDEX idx_grading_job_status ON grading_job(status, job_id);
+CREATE INDEX idx_grading_job_submission ON grading_job(submission_id);
+CREATE INDEX idx_similarity_report_assignment ON similarity_report(assignment_id, status);
+CREATE INDEX idx_peer_review_reviewer ON peer_review(reviewer_id);
+CREATE INDEX idx_class_session_course ON class_session(course_id, session_date);
+CREATE INDEX idx_attendance_student ON attendance(student_id);
+CREATE INDEX idx_class_module_course ON class_module(course_id, position);
+CREATE INDEX idx_module_item_module ON module_item(module_id, position);
+CREATE INDEX idx_material_completion_student ON material_completion(student_id);
+CREATE INDEX idx_material_view_student ON material_view(student_id);
+CREATE FULLTEXT INDEX idx_announcement_search ON announcement(title, content);
+CREATE FULLTEXT INDEX idx_material_search ON material(title, description);
+CREATE FULLTEXT INDEX idx_assignment_search ON assignment(title, description);
+CREATE INDEX idx_classroom_listed ON classroom(is_listed, start_date);
+CREATE INDEX idx_user_org ON user(org_id, role);
+CREATE INDEX idx_classroom_org ON classroom(org_id, is_listed);
+CREATE INDEX idx_org_email_domain ON org_email_domain(domain);
+CREATE INDEX idx_user_token_user ON user_token(user_id, purpose);
+CREATE INDEX idx_login_attempt_stale ON login_attempt(last_failure_at);
+CREATE INDEX idx_login_audit_user ON login_audit(user_id, created_at);
+CREATE INDEX idx_backup_code_user ON backup_code(user_id, code_hash);
 
 -- Add unique constraint to prevent duplicate enrollments
 ALTER TABLE enrollment ADD CONSTRAINT uq_student_course UNIQUE (student_id, course_id);
 
+-- Add unique constraint so a teacher holds at most one staff role per classroom
+ALTER TABLE classroom_staff ADD CONSTRAINT uq_staff_course_teacher UNIQUE (course_id, teacher_id);
+
+-- Add unique constraint so a student reviews each submission at most once
+ALTER TABLE peer_review ADD CONSTRAINT uq_peer_review_submission_reviewer UNIQUE (submission_id, reviewer_id);
+
+-- Every existing classroom's teacher becomes its owner
+INSERT INTO classroom_staff (course_id, teacher_id, role, status, can_edit_classroom, can_edit_content,
+    can_grade, can_manage_students, can_manage_staff)
+SELECT course_id, teacher_id, 'owner', 'active', TRUE, TRUE, TRUE, TRUE, TRUE FROM classroom;
+
+-- Users can only register into an existing organization, so start with one
+INSERT INTO organization (name, slug) VALUES ('Default', 'default');
+
+-- Accounts created before email verification are trusted
+UPDATE user SET email_verified_at = COALESCE(created_at, NOW()) WHERE email_verified_at IS NULL;
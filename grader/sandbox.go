@@ -0,0 +1,164 @@
+package grader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxOutputBytes caps how much of a program's stdout and stderr is kept
+const maxOutputBytes = 64 * 1024
+
+// maxFileKB caps the size of any file a submission writes
+const maxFileKB = 10 * 1024
+
+// Limits bounds the resources of a single sandboxed process
+type Limits struct {
+	Timeout  time.Duration
+	MemoryMB int
+}
+
+// Runtime describes how to build and run a submission in one language
+type Runtime struct {
+	Source  string   // File name the source code is written to
+	Compile []string // Optional build command, run once before the tests
+	Run     []string // Command that runs the program for each test
+}
+
+// Runtimes lists the supported languages by the name stored on code assignments
+var Runtimes = map[string]Runtime{
+	"python": {Source: "main.py", Run: []string{"python3", "main.py"}},
+	"c":      {Source: "main.c", Compile: []string{"gcc", "-O2", "-o", "main", "main.c", "-lm"}, Run: []string{"./main"}},
+}
+
+// Result is the outcome of one sandboxed process
+type Result struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int // 128 plus the signal number when a signal killed the program
+	TimedOut bool
+	Duration time.Duration
+}
+
+// limitedBuffer keeps the first maxOutputBytes written to it and discards the rest
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxOutputBytes - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// Run executes argv in a sandbox holding a copy of the files in dir, with stdin as its input. The program runs as
+// an unprivileged user in its own namespaces, without network access, under memory, CPU, process and file size
+// limits, and everything it started is killed when the timeout expires. A non-zero exit or timeout is reported in
+// the Result; the error is only set when the sandbox itself fails.
+func Run(dir string, argv []string, stdin string, limits Limits) (Result, error) {
+	return run(dir, argv, stdin, limits, false)
+}
+
+// run is Run, copying the files the program leaves in the sandbox back into dir when keep is set
+func run(dir string, argv []string, stdin string, limits Limits, keep bool) (Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), limits.Timeout)
+	defer cancel()
+
+	cmd, setupErr := sandboxCommand(ctx, dir, argv, limits, keep)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr limitedBuffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	result := Result{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Duration: time.Since(start),
+	}
+	if err := setupErr(); err != nil {
+		return result, err
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		result.TimedOut = true
+		result.ExitCode = -1
+		return result, nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+		return result, nil
+	}
+	return result, err
+}
+
+// Workspace is a temporary directory holding one submission's source and build output
+type Workspace struct {
+	Dir     string
+	runtime Runtime
+}
+
+// NewWorkspace writes the source code for the language into a fresh temporary directory
+func NewWorkspace(language, source string) (*Workspace, error) {
+	runtime, ok := Runtimes[language]
+	if !ok {
+		return nil, errors.New("unsupported language " + strconv.Quote(language))
+	}
+	dir, err := os.MkdirTemp("", "edusync-grader-")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, runtime.Source), []byte(source), 0o644); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &Workspace{Dir: dir, runtime: runtime}, nil
+}
+
+// Build compiles the source if the language needs it. A failed build is returned in the Result.
+func (w *Workspace) Build(limits Limits) (Result, bool, error) {
+	if len(w.runtime.Compile) == 0 {
+		return Result{}, true, nil
+	}
+	// The build output has to outlive the sandbox it was built in
+	result, err := run(w.Dir, w.runtime.Compile, "", limits, true)
+	return result, err == nil && result.ExitCode == 0, err
+}
+
+// Exec runs the program with the given input
+func (w *Workspace) Exec(stdin string, limits Limits) (Result, error) {
+	return Run(w.Dir, w.runtime.Run, stdin, limits)
+}
+
+// Close removes the workspace
+func (w *Workspace) Close() error {
+	return os.RemoveAll(w.Dir)
+}
+
+// OutputMatches compares program output with the expected output, ignoring trailing whitespace on each
+// line and trailing blank lines
+func OutputMatches(got, want string) bool {
+	return normalizeOutput(got) == normalizeOutput(want)
+}
+
+func normalizeOutput(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
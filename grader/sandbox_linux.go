@@ -0,0 +1,435 @@
+//go:build linux
+
+package grader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"edusync/config"
+)
+
+// The server binary doubles as the sandbox. It re-executes itself under these names: first as the init process of
+// the new namespaces, which prepares them, then as the sandbox user, which applies the resource limits and
+// replaces itself with the program.
+const (
+	sandboxInitName = "edusync-sandbox-init"
+	sandboxExecName = "edusync-sandbox-exec"
+)
+
+// sandboxUser is the user and group the program runs as inside the namespaces. Outside, it is GRADER_UID and
+// GRADER_GID.
+const sandboxUser = 1000
+
+// sandboxDir is where the program runs. It and /dev/shm are private tmpfs mounts, so nothing a program writes is
+// seen by the host or by later programs.
+const sandboxDir = "/tmp"
+
+var scratchDirs = []string{sandboxDir, "/dev/shm"}
+
+// tmpfsSize caps the memory each scratch tmpfs may take
+const tmpfsSize = "64m"
+
+// rootMount is where the sandbox's root filesystem is put together before it replaces the host's. Any directory
+// will do, as the workspace is opened beforehand.
+const rootMount = "/tmp"
+
+// hostPaths are the only parts of the host filesystem the sandbox sees, all read-only: the compilers, interpreters
+// and libraries, and what the dynamic loader needs to find them. Missing ones are skipped, and links are recreated
+// as links.
+var hostPaths = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32", "/etc/ld.so.cache", "/etc/alternatives",
+}
+
+// devices are the device nodes programs may use
+var devices = []string{"/dev/null", "/dev/zero", "/dev/random", "/dev/urandom"}
+
+// maxProcesses caps the processes and threads of the sandbox user
+const maxProcesses = 64
+
+// sandboxEnv is the whole environment of a sandboxed program
+var sandboxEnv = []string{"PATH=/usr/local/bin:/usr/bin:/bin", "HOME=" + sandboxDir, "TMPDIR=" + sandboxDir, "LANG=C.UTF-8"}
+
+func init() {
+	if len(os.Args) == 0 {
+		return
+	}
+	switch os.Args[0] {
+	case sandboxInitName:
+		sandboxInit(os.Args[1:])
+	case sandboxExecName:
+		sandboxExec(os.Args[1:])
+	}
+}
+
+// sandboxCommand prepares argv to run in fresh user, PID, mount, network, IPC and UTS namespaces; see sandboxInit
+// for what happens inside. Killing the command kills the init process, and with it everything else in its PID
+// namespace. Mapping the sandbox user needs root, or CAP_SETUID and CAP_SETGID. The returned function reports a
+// sandbox that could not be set up, once the command has finished.
+func sandboxCommand(ctx context.Context, dir string, argv []string, limits Limits, keep bool) (*exec.Cmd, func() error) {
+	cpuSeconds := max(1, int(limits.Timeout.Seconds()+0.999))
+	args := append([]string{dir, strconv.FormatBool(keep), strconv.Itoa(limits.MemoryMB), strconv.Itoa(cpuSeconds)},
+		argv...)
+	cmd := exec.CommandContext(ctx, "/proc/self/exe", args...)
+	cmd.Args[0] = sandboxInitName
+	cmd.Env = sandboxEnv
+
+	uid, gid := config.ConfigInstance.GraderUID, config.ConfigInstance.GraderGID
+	if uid == os.Getuid() || gid == os.Getgid() {
+		cmd.Err = errors.New("GRADER_UID and GRADER_GID must differ from the server's own user and group")
+		return cmd, func() error { return nil }
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET |
+			syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		// Root inside is the server's own user, so the init process can read and write the workspace
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getuid(), Size: 1},
+			{ContainerID: sandboxUser, HostID: uid, Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getgid(), Size: 1},
+			{ContainerID: sandboxUser, HostID: gid, Size: 1},
+		},
+		GidMappingsEnableSetgroups: true,
+		Pdeathsig:                  syscall.SIGKILL,
+	}
+
+	// The init process writes setup failures to file descriptor 3
+	r, w, err := os.Pipe()
+	if err != nil {
+		cmd.Err = err
+		return cmd, func() error { return nil }
+	}
+	cmd.ExtraFiles = []*os.File{w}
+	return cmd, func() error {
+		w.Close()
+		defer r.Close()
+		report, _ := io.ReadAll(r)
+		if len(report) > 0 {
+			return errors.New("sandbox: " + string(report))
+		}
+		return nil
+	}
+}
+
+// sandboxInit is the first process in the namespaces, running as root there. It moves into a root of its own (see
+// buildRoot), copies the workspace into sandboxDir and runs the program there as sandboxUser. Its exit status is
+// the program's; with keep set, the files the program leaves behind are copied back first.
+func sandboxInit(args []string) {
+	report := os.NewFile(3, "sandbox-report")
+	syscall.CloseOnExec(3)
+	fail := func(step string, err error) {
+		fmt.Fprintf(report, "%s: %v", step, err)
+		os.Exit(1)
+	}
+	if len(args) < 5 {
+		fail("starting", errors.New("missing arguments"))
+	}
+	dir, keep := args[0], args[1] == "true"
+
+	// The workspace is on the host's root, so it is opened before that is unmounted
+	workspace, err := os.OpenRoot(dir)
+	if err != nil {
+		fail("opening workspace", err)
+	}
+	if err := buildRoot(); err != nil {
+		fail("mounting", err)
+	}
+	if err := copyIn(workspace); err != nil {
+		fail("copying workspace", err)
+	}
+
+	cmd := exec.Command("/proc/self/exe", args[2:]...)
+	cmd.Args[0] = sandboxExecName
+	cmd.Dir = sandboxDir
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: sandboxUser, Gid: sandboxUser},
+	}
+	code := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			fail("starting program", err)
+		}
+		if status := exitErr.Sys().(syscall.WaitStatus); status.Signaled() {
+			code = 128 + int(status.Signal())
+		} else {
+			code = status.ExitStatus()
+		}
+	}
+
+	if keep {
+		if err := copyOut(workspace); err != nil {
+			fail("copying workspace back", err)
+		}
+	}
+	os.Exit(code)
+}
+
+// buildRoot detaches the mount namespace from the host's and replaces its root with a fresh tmpfs holding only
+// hostPaths, devices, the scratch directories and a /proc for the new PID namespace. The host's root is unmounted,
+// so what a program can read does not depend on the permissions of host files.
+func buildRoot() error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", rootMount, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755,size=1m"); err != nil {
+		return fmt.Errorf("%s: %w", rootMount, err)
+	}
+	for _, path := range hostPaths {
+		if err := exposeHostPath(path); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for _, dev := range devices {
+		if err := bindFile(dev, rootMount+dev); err != nil {
+			return fmt.Errorf("%s: %w", dev, err)
+		}
+	}
+	for _, dir := range scratchDirs {
+		flags := uintptr(unix.MS_NOSUID | unix.MS_NODEV)
+		if dir != sandboxDir {
+			flags |= unix.MS_NOEXEC
+		}
+		if err := os.MkdirAll(rootMount+dir, 0o755); err != nil {
+			return err
+		}
+		if err := unix.Mount("tmpfs", rootMount+dir, "tmpfs", flags, "mode=1777,size="+tmpfsSize); err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+	}
+	if err := os.Chown(rootMount+sandboxDir, sandboxUser, sandboxUser); err != nil {
+		return err
+	}
+	if err := os.Chmod(rootMount+sandboxDir, 0o755); err != nil {
+		return err
+	}
+	if err := os.Mkdir(rootMount+"/proc", 0o555); err != nil {
+		return err
+	}
+	err := unix.Mount("proc", rootMount+"/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "")
+	if err != nil {
+		return fmt.Errorf("/proc: %w", err)
+	}
+
+	// Pivoting onto the current directory stacks the host's root on top of the new one, from where it is detached
+	if err := os.Chdir(rootMount); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot_root: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("unmounting host root: %w", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	return unix.Mount("", "/", "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, "")
+}
+
+// exposeHostPath makes path from the host's root available read-only under rootMount
+func exposeHostPath(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	target := rootMount + path
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, target)
+	case info.IsDir():
+		if err := os.Mkdir(target, 0o755); err != nil {
+			return err
+		}
+		if err := unix.Mount(path, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return err
+		}
+	default:
+		if err := bindFile(path, target); err != nil {
+			return err
+		}
+	}
+	return remountReadOnly(target)
+}
+
+// bindFile bind mounts the file at source onto target, which it creates
+func bindFile(source, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return unix.Mount(source, target, "", unix.MS_BIND, "")
+}
+
+// lockedFlags are the flags a bind mount inherits from its source that a user namespace may not clear, as statfs
+// reports them and as mount takes them
+var lockedFlags = map[int64]uintptr{
+	unix.ST_NODEV:      unix.MS_NODEV,
+	unix.ST_NOEXEC:     unix.MS_NOEXEC,
+	unix.ST_NOATIME:    unix.MS_NOATIME,
+	unix.ST_NODIRATIME: unix.MS_NODIRATIME,
+	unix.ST_RELATIME:   unix.MS_RELATIME,
+}
+
+// remountReadOnly makes the bind mount at target read-only and setuid files on it powerless
+func remountReadOnly(target string) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(target, &st); err != nil {
+		return err
+	}
+	flags := uintptr(unix.MS_REMOUNT | unix.MS_BIND | unix.MS_RDONLY | unix.MS_NOSUID)
+	for statFlag, mountFlag := range lockedFlags {
+		if st.Flags&statFlag != 0 {
+			flags |= mountFlag
+		}
+	}
+	return unix.Mount("", target, "", flags, "")
+}
+
+// copyIn copies the regular files of the workspace into sandboxDir, owned by sandboxUser
+func copyIn(workspace *os.Root) error {
+	root, err := workspace.Open(".")
+	if err != nil {
+		return err
+	}
+	entries, err := root.ReadDir(-1)
+	root.Close()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		src, err := workspace.Open(e.Name())
+		if err != nil {
+			return err
+		}
+		dst, err := copyFile(src, func(mode os.FileMode) (*os.File, error) {
+			return os.OpenFile(filepath.Join(sandboxDir, e.Name()), os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+		})
+		if err == nil {
+			err = dst.Chown(sandboxUser, sandboxUser)
+			dst.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyOut copies the regular files left in sandboxDir back into the workspace. Links are skipped, as the program
+// chose where they point.
+func copyOut(workspace *os.Root) error {
+	entries, err := os.ReadDir(sandboxDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		src, err := os.OpenFile(filepath.Join(sandboxDir, e.Name()), os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+		if errors.Is(err, syscall.ELOOP) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		dst, err := copyFile(src, func(mode os.FileMode) (*os.File, error) {
+			return workspace.OpenFile(e.Name(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+		})
+		if dst != nil {
+			dst.Close()
+		}
+		if err != nil && !errors.Is(err, errNotRegular) {
+			return err
+		}
+	}
+	return nil
+}
+
+var errNotRegular = errors.New("not a regular file")
+
+// copyFile copies src, which it closes, into the file create opens with src's permissions
+func copyFile(src *os.File, create func(mode os.FileMode) (*os.File, error)) (*os.File, error) {
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, errNotRegular
+	}
+	dst, err := create(info.Mode().Perm())
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(dst, src)
+	return dst, err
+}
+
+// sandboxExec runs as sandboxUser. It applies the resource limits and replaces itself with the program, which
+// can no longer gain privileges through setuid files.
+func sandboxExec(args []string) {
+	if len(args) < 3 {
+		fmt.Fprintln(os.Stderr, "sandbox: missing arguments")
+		os.Exit(126)
+	}
+	memoryMB, _ := strconv.Atoi(args[0])
+	cpuSeconds, _ := strconv.Atoi(args[1])
+	argv := args[2:]
+
+	// No new privileges is set per thread, so the exec has to come from the same one
+	runtime.LockOSThread()
+	limits := []struct {
+		resource int
+		value    uint64
+	}{
+		{unix.RLIMIT_AS, uint64(memoryMB) << 20},
+		{unix.RLIMIT_CPU, uint64(cpuSeconds)},
+		{unix.RLIMIT_FSIZE, maxFileKB << 10},
+		{unix.RLIMIT_NPROC, maxProcesses},
+		{unix.RLIMIT_CORE, 0},
+	}
+	for _, l := range limits {
+		if err := unix.Setrlimit(l.resource, &unix.Rlimit{Cur: l.value, Max: l.value}); err != nil {
+			fmt.Fprintf(os.Stderr, "sandbox: setting limit %d: %v\n", l.resource, err)
+			os.Exit(126)
+		}
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+		os.Exit(126)
+	}
+
+	path, err := exec.LookPath(argv[0])
+	if err == nil {
+		err = syscall.Exec(path, argv, sandboxEnv)
+	}
+	fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+	os.Exit(127)
+}
@@ -0,0 +1,210 @@
+package grader
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// compileTimeout bounds how long building a submission may take
+const compileTimeout = 30 * time.Second
+
+// wake is signalled when a job is queued so the worker does not wait for its next poll
+var wake = make(chan struct{}, 1)
+
+// Wake tells the worker that a new job is waiting
+func Wake() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// testCase is a teacher-provided test of a code assignment
+type testCase struct {
+	ID       int
+	Input    string
+	Expected string
+	Points   float64
+}
+
+// Start runs the grading worker in the background. Jobs are processed one at a time, in the order they
+// were queued, whenever Wake is called and at least every poll interval.
+func Start(db *sql.DB, poll time.Duration) {
+	// Jobs left running by a previous process never finished
+	if _, err := db.Exec(`UPDATE grading_job SET status = 'queued', started_at = NULL WHERE status = 'running'`); err != nil {
+		log.Printf("Failed to requeue interrupted grading jobs: %v", err)
+	}
+
+	go func() {
+		for {
+			for {
+				processed, err := RunNext(db)
+				if err != nil {
+					log.Printf("Grading worker failed: %v", err)
+					break
+				}
+				if !processed {
+					break
+				}
+			}
+			select {
+			case <-wake:
+			case <-time.After(poll):
+			}
+		}
+	}()
+}
+
+// RunNext claims the oldest queued job and grades it. It reports whether a job was found.
+func RunNext(db *sql.DB) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var jobID, submissionID int
+	err = tx.QueryRow(`
+		SELECT job_id, submission_id FROM grading_job
+		WHERE status = 'queued'
+		ORDER BY job_id LIMIT 1 FOR UPDATE`).Scan(&jobID, &submissionID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`
+		UPDATE grading_job SET status = 'running', started_at = NOW()
+		WHERE job_id = ?`, jobID); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	if err := gradeJob(db, jobID, submissionID); err != nil {
+		log.Printf("Grading job %d failed: %v", jobID, err)
+		_, err = db.Exec(`
+			UPDATE grading_job SET status = 'failed', error = ?, finished_at = NOW()
+			WHERE job_id = ?`, err.Error(), jobID)
+		return true, err
+	}
+	return true, nil
+}
+
+// gradeJob runs a submission against every test of its assignment and scores it
+func gradeJob(db *sql.DB, jobID, submissionID int) error {
+	var source sql.NullString
+	var assignmentID, maxPoints, timeLimitMS, memoryMB int
+	var language string
+	err := db.QueryRow(`
+		SELECT s.source_code, a.assignment_id, a.max_points, ca.language, ca.time_limit_ms, ca.memory_limit_mb
+		FROM submission s
+		JOIN assignment a ON s.assignment_id = a.assignment_id
+		JOIN code_assignment ca ON ca.assignment_id = a.assignment_id AND ca.archive_delete_flag = TRUE
+		WHERE s.submission_id = ? AND s.archive_delete_flag = TRUE`, submissionID).
+		Scan(&source, &assignmentID, &maxPoints, &language, &timeLimitMS, &memoryMB)
+	if err != nil {
+		return fmt.Errorf("loading submission: %w", err)
+	}
+
+	tests, err := loadTests(db, assignmentID)
+	if err != nil {
+		return fmt.Errorf("loading tests: %w", err)
+	}
+
+	workspace, err := NewWorkspace(language, source.String)
+	if err != nil {
+		return err
+	}
+	defer workspace.Close()
+
+	limits := Limits{Timeout: time.Duration(timeLimitMS) * time.Millisecond, MemoryMB: memoryMB}
+	build, built, err := workspace.Build(Limits{Timeout: compileTimeout, MemoryMB: max(memoryMB, 512)})
+	if err != nil {
+		return fmt.Errorf("building: %w", err)
+	}
+
+	var earned, possible float64
+	for _, test := range tests {
+		possible += test.Points
+
+		result := build
+		passed := false
+		if built {
+			result, err = workspace.Exec(test.Input, limits)
+			if err != nil {
+				return fmt.Errorf("running test %d: %w", test.ID, err)
+			}
+			passed = !result.TimedOut && result.ExitCode == 0 && OutputMatches(result.Stdout, test.Expected)
+		}
+		if passed {
+			earned += test.Points
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO grading_result (job_id, test_id, passed, stdout, stderr, exit_code, timed_out, runtime_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			jobID, test.ID, passed, result.Stdout, result.Stderr, result.ExitCode, result.TimedOut, result.Duration.Milliseconds())
+		if err != nil {
+			return fmt.Errorf("saving result: %w", err)
+		}
+	}
+
+	score := 0
+	if possible > 0 {
+		score = int(math.Round(earned / possible * float64(maxPoints)))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var jobError interface{}
+	if !built {
+		jobError = "Compilation failed"
+	}
+	if _, err := tx.Exec(`
+		UPDATE grading_job SET status = 'completed', error = ?, finished_at = NOW()
+		WHERE job_id = ?`, jobError, jobID); err != nil {
+		return err
+	}
+	// A newer job for the submission will set the score when it runs
+	if _, err := tx.Exec(`
+		UPDATE submission SET score = ?, status = 'graded'
+		WHERE submission_id = ? AND NOT EXISTS (
+			SELECT 1 FROM grading_job WHERE submission_id = ? AND job_id > ? AND status IN ('queued', 'running')
+		)`, score, submissionID, submissionID, jobID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// loadTests reads the active tests of a code assignment in order
+func loadTests(db *sql.DB, assignmentID int) ([]testCase, error) {
+	rows, err := db.Query(`
+		SELECT test_id, input, expected_output, points FROM code_test_case
+		WHERE assignment_id = ? AND archive_delete_flag = TRUE
+		ORDER BY position, test_id`, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tests []testCase
+	for rows.Next() {
+		var t testCase
+		var input sql.NullString
+		if err := rows.Scan(&t.ID, &input, &t.Expected, &t.Points); err != nil {
+			return nil, err
+		}
+		t.Input = input.String
+		tests = append(tests, t)
+	}
+	return tests, rows.Err()
+}
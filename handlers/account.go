@@ -0,0 +1,664 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/auth"
+	"edusync/mailer"
+	"edusync/utils"
+)
+
+// EmailRequest is the request body of the endpoints that mail a link to an address
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest is the request body for choosing a new password with a reset token
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// VerifyEmailRequest is the request body for confirming an email address
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ChangePasswordRequest is the request body for changing the caller's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+// ChangeEmailRequest is the request body for moving the caller's account to a new address
+type ChangeEmailRequest struct {
+	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+}
+
+// DeleteAccountRequest is the request body for deleting the caller's account
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// passwordResetMessage is the email carrying a password reset link
+func passwordResetMessage(name, email, token string) mailer.Message {
+	return mailer.Message{
+		To:      email,
+		Subject: "Reset your EduSync password",
+		Body: "Hello " + name + ",\n\n" +
+			"Someone asked to reset the password of your account. Choose a new one here:\n\n" +
+			tokenLink("/reset-password", token) + "\n\n" +
+			"This link expires in " + strconv.Itoa(int(passwordResetTTL.Minutes())) + " minutes. " +
+			"If you did not ask for it, you can ignore this email.\n",
+	}
+}
+
+// verificationMessage is the email asking a user to confirm their address
+func verificationMessage(name, email, token string) mailer.Message {
+	return mailer.Message{
+		To:      email,
+		Subject: "Verify your EduSync email address",
+		Body: "Hello " + name + ",\n\n" +
+			"Confirm that this is your email address:\n\n" +
+			tokenLink("/verify-email", token) + "\n\n" +
+			"This link expires in " + strconv.Itoa(int(emailVerificationTTL.Hours())) + " hours.\n",
+	}
+}
+
+// emailChangeMessage is the email asking a user to confirm the address they are moving their account to
+func emailChangeMessage(name, email, token string) mailer.Message {
+	return mailer.Message{
+		To:      email,
+		Subject: "Confirm your new EduSync email address",
+		Body: "Hello " + name + ",\n\n" +
+			"Confirm that your account should use this email address from now on:\n\n" +
+			tokenLink("/confirm-email", token) + "\n\n" +
+			"This link expires in " + strconv.Itoa(int(emailVerificationTTL.Hours())) + " hours.\n",
+	}
+}
+
+// emailChangeNotice tells the current address that the account is being moved to another one
+func emailChangeNotice(name, email, newEmail string) mailer.Message {
+	return mailer.Message{
+		To:      email,
+		Subject: "Your EduSync email address is changing",
+		Body: "Hello " + name + ",\n\n" +
+			"Your account will use " + newEmail + " once that address is confirmed. " +
+			"If you did not ask for this, reset your password right away.\n",
+	}
+}
+
+// checkPassword verifies the caller's current password. It writes the error response itself.
+func checkPassword(c *gin.Context, db *sql.DB, password string) bool {
+	userID, _ := c.Get("userID")
+
+	var hash string
+	err := db.QueryRow(`
+		SELECT password FROM user
+		WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&hash)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return false
+	} else if err != nil {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if utils.ComparePassword(hash, password) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return false
+	}
+	return true
+}
+
+// mailUserToken issues a token for the user and mails it with the message built by compose. Failures are only
+// logged, since the endpoints that call it answer the same either way.
+func mailUserToken(c *gin.Context, db *sql.DB, userID int64, name, email, purpose string, ttl time.Duration,
+	compose func(name, email, token string) mailer.Message) {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	token, err := issueUserToken(tx, userID, purpose, ttl)
+	if err != nil {
+		log.Printf("Error issuing %s token: %v", purpose, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return
+	}
+	if err := sendMail(c, compose(name, email, token)); err != nil {
+		log.Printf("Error mailing %s link to %s: %v", purpose, email, err)
+	}
+}
+
+// ForgotPasswordHandler mails a password reset link. It answers the same whether or not the address belongs to an
+// account, so it cannot be used to find out who is registered.
+func ForgotPasswordHandler(c *gin.Context) {
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	var userID int64
+	var name string
+	err := db.QueryRow(`
+		SELECT user_id, name FROM user
+		WHERE email = ? AND archive_delete_flag = TRUE`, req.Email).Scan(&userID, &name)
+	if err == nil {
+		mailUserToken(c, db, userID, name, req.Email, tokenPasswordReset, passwordResetTTL, passwordResetMessage)
+	} else if err != sql.ErrNoRows {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an account uses that email, a reset link has been sent to it"})
+}
+
+// ResetPasswordHandler sets a new password using a mailed reset token, signing the account out everywhere. Since the
+// link reached the user's mailbox, the address counts as verified too.
+func ResetPasswordHandler(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	passwordHash, err := utils.HashPassword(req.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeUserToken(tx, req.Token, tokenPasswordReset)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reset link is invalid or has expired"})
+		return
+	} else if err != nil {
+		log.Printf("Error checking reset token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE user SET password = ?, email_verified_at = COALESCE(email_verified_at, NOW()),
+		session_version = session_version + 1
+		WHERE user_id = ? AND archive_delete_flag = TRUE`, passwordHash, userID)
+	if err != nil {
+		log.Printf("Error resetting password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	var email string
+	if err := tx.QueryRow(`SELECT email FROM user WHERE user_id = ?`, userID).Scan(&email); err != nil {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	// Whoever followed the link owns the mailbox, so a lockout from someone guessing the old password is lifted
+	guard := c.MustGet("loginGuard").(*auth.LoginGuard)
+	if err := guard.Store.Reset(auth.AccountKey(email)); err != nil {
+		log.Printf("Error clearing failed logins for %s: %v", email, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset; you can now log in"})
+}
+
+// VerifyEmailHandler confirms a user's email address using a mailed verification token
+func VerifyEmailHandler(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeUserToken(tx, req.Token, tokenEmailVerification)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification link is invalid or has expired"})
+		return
+	} else if err != nil {
+		log.Printf("Error checking verification token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if _, err := tx.Exec(`UPDATE user SET email_verified_at = NOW() WHERE user_id = ?`, userID); err != nil {
+		log.Printf("Error verifying email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// ResendVerificationHandler mails a new verification link to an unverified address. Like ForgotPasswordHandler it
+// answers the same for every address.
+func ResendVerificationHandler(c *gin.Context) {
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	var userID int64
+	var name string
+	err := db.QueryRow(`
+		SELECT user_id, name FROM user
+		WHERE email = ? AND email_verified_at IS NULL AND archive_delete_flag = TRUE`, req.Email).Scan(&userID, &name)
+	if err == nil {
+		mailUserToken(c, db, userID, name, req.Email, tokenEmailVerification, emailVerificationTTL, verificationMessage)
+	} else if err != sql.ErrNoRows {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If that email is awaiting verification, a new link has been sent to it"})
+}
+
+// ChangePasswordHandler changes the caller's password and signs out every other session. The response carries a
+// new token for the current one.
+func ChangePasswordHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if !checkPassword(c, db, req.CurrentPassword) {
+		return
+	}
+
+	passwordHash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE user SET password = ?, session_version = session_version + 1
+		WHERE user_id = ?`, passwordHash, userID)
+	if err != nil {
+		log.Printf("Error changing password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+	// Reset links mailed earlier would undo the change
+	_, err = tx.Exec(`
+		UPDATE user_token SET used_at = NOW()
+		WHERE user_id = ? AND purpose = ? AND used_at IS NULL`, userID, tokenPasswordReset)
+	if err != nil {
+		log.Printf("Error revoking reset tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+	var sessionVersion int
+	if err := tx.QueryRow(`SELECT session_version FROM user WHERE user_id = ?`, userID).Scan(&sessionVersion); err != nil {
+		log.Printf("Error querying session version: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	roleName, _ := role.(string)
+	token, err := auth.IssueToken(userID.(int), roleName, c.GetInt("orgID"), sessionVersion)
+	if err != nil {
+		log.Printf("Error signing token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "message": "Password changed; other sessions have been signed out"})
+}
+
+// ChangeEmailHandler starts moving the caller's account to a new address. The account keeps its current address
+// until the link mailed to the new one is followed.
+func ChangeEmailHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if !utils.ValidateEmail(req.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email format"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if !checkPassword(c, db, req.Password) {
+		return
+	}
+
+	var name, email string
+	err := db.QueryRow(`SELECT name, email FROM user WHERE user_id = ?`, userID).Scan(&name, &email)
+	if err != nil {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if strings.EqualFold(email, req.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "That is already your email address"})
+		return
+	}
+
+	var taken bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM user WHERE email = ?)`, req.Email).Scan(&taken); err != nil {
+		log.Printf("Error checking existing email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		return
+	}
+	allowed, err := orgAllowsEmail(db, c.GetInt("orgID"), req.Email)
+	if err != nil {
+		log.Printf("Error checking email domain: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email domain is not allowed by this organization"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE user SET pending_email = ? WHERE user_id = ?`, req.Email, userID); err != nil {
+		log.Printf("Error setting pending email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+	token, err := issueUserToken(tx, int64(userID.(int)), tokenEmailChange, emailVerificationTTL)
+	if err != nil {
+		log.Printf("Error issuing email change token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	if err := sendMail(c, emailChangeMessage(name, req.Email, token)); err != nil {
+		log.Printf("Error mailing email change link to %s: %v", req.Email, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send the confirmation email"})
+		return
+	}
+	if err := sendMail(c, emailChangeNotice(name, email, req.Email)); err != nil {
+		log.Printf("Error mailing email change notice to %s: %v", email, err)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"pending_email": req.Email,
+		"message":       "Follow the link sent to the new address to finish the change",
+	})
+}
+
+// ConfirmEmailChangeHandler moves an account to its pending address using the token mailed there
+func ConfirmEmailChangeHandler(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeUserToken(tx, req.Token, tokenEmailChange)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Confirmation link is invalid or has expired"})
+		return
+	} else if err != nil {
+		log.Printf("Error checking email change token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var pending sql.NullString
+	err = tx.QueryRow(`
+		SELECT pending_email FROM user
+		WHERE user_id = ? AND archive_delete_flag = TRUE
+		FOR UPDATE`, userID).Scan(&pending)
+	if err == sql.ErrNoRows || (err == nil && !pending.Valid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Confirmation link is invalid or has expired"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Someone may have registered the address since the change was asked for
+	var taken bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM user WHERE email = ? AND user_id <> ?)`, pending.String, userID).
+		Scan(&taken)
+	if err != nil {
+		log.Printf("Error checking existing email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE user SET email = pending_email, pending_email = NULL, email_verified_at = NOW()
+		WHERE user_id = ?`, userID)
+	if err != nil {
+		log.Printf("Error changing email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"email": pending.String, "message": "Email changed"})
+}
+
+// DeleteAccountHandler deletes the caller's account. Personal details are erased, but the student or teacher record
+// stays so submissions and grades keep adding up. Teachers must first archive or delete the classrooms they own,
+// and an organization's last admin must first make someone else admin.
+func DeleteAccountHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	orgID, _ := c.Get("orgID")
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if !checkPassword(c, db, req.Password) {
+		return
+	}
+
+	var lastAdmin bool
+	var picture *string
+	err := db.QueryRow(`
+		SELECT u.profile_picture_key, u.is_org_admin AND NOT EXISTS (
+			SELECT 1 FROM user o
+			WHERE o.org_id = ? AND o.user_id <> u.user_id AND o.is_org_admin = TRUE AND o.archive_delete_flag = TRUE
+		)
+		FROM user u WHERE u.user_id = ?`, orgID, userID).Scan(&picture, &lastAdmin)
+	if err != nil {
+		log.Printf("Error checking organization admins: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if lastAdmin {
+		c.JSON(http.StatusConflict, gin.H{"error": "Make another member an organization admin first"})
+		return
+	}
+
+	var teacherID int
+	if role == "teacher" {
+		err := db.QueryRow(`
+			SELECT teacher_id FROM teacher
+			WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&teacherID)
+		if err != nil {
+			log.Printf("Error querying teacher: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Teacher not found"})
+			return
+		}
+		var owns bool
+		err = db.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM classroom_staff cs
+				JOIN classroom c ON cs.course_id = c.course_id
+				WHERE cs.teacher_id = ? AND cs.role = 'owner' AND cs.status = 'active' AND cs.archive_delete_flag = TRUE
+				AND c.is_archived = FALSE AND c.archive_delete_flag = TRUE
+			)`, teacherID).Scan(&owns)
+		if err != nil {
+			log.Printf("Error checking owned classrooms: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if owns {
+			c.JSON(http.StatusConflict, gin.H{"error": "Archive or delete the classrooms you own first"})
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// The placeholder address keeps the email column unique and frees the real one for a new account
+	_, err = tx.Exec(`
+		UPDATE user SET name = 'Deleted user', email = CONCAT('deleted-', user_id, '@deleted.invalid'), password = '',
+		contact_number = NULL, profile_picture = NULL, profile_picture_key = NULL, email_verified_at = NULL,
+		pending_email = NULL, totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, is_org_admin = FALSE,
+		session_version = session_version + 1, archive_delete_flag = FALSE
+		WHERE user_id = ?`, userID)
+	if err != nil {
+		log.Printf("Error anonymizing user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	for _, query := range []string{
+		`DELETE FROM user_token WHERE user_id = ?`,
+		`DELETE FROM backup_code WHERE user_id = ?`,
+		`DELETE FROM calendar_feed WHERE user_id = ?`,
+	} {
+		if _, err := tx.Exec(query, userID); err != nil {
+			log.Printf("Error deleting account data: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+			return
+		}
+	}
+	if teacherID != 0 {
+		_, err = tx.Exec(`
+			UPDATE classroom_staff SET archive_delete_flag = FALSE
+			WHERE teacher_id = ? AND role <> 'owner'`, teacherID)
+		if err != nil {
+			log.Printf("Error removing classroom staff: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	removePicture(c, picture)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
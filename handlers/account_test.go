@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+
+	"edusync/auth"
+	"edusync/config"
+	"edusync/mailer"
+)
+
+// testDB loads a fresh copy of db_design/createv2.sql into the MySQL server named by EDUSYNC_TEST_DSN and connects
+// to it. The schema drops and recreates edusync_db, so the DSN must point at a scratch server. Tests that need the
+// database are skipped when the variable is unset.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("EDUSYNC_TEST_DSN")
+	if dsn == "" {
+		t.Skip("EDUSYNC_TEST_DSN is not set")
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("parsing EDUSYNC_TEST_DSN: %v", err)
+	}
+	schema, err := os.ReadFile("../db_design/createv2.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.DBName = ""
+	cfg.MultiStatements = true
+	server, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	if _, err := server.Exec(string(schema)); err != nil {
+		t.Fatalf("loading schema: %v", err)
+	}
+
+	cfg.DBName = "edusync_db"
+	cfg.MultiStatements = false
+	cfg.ParseTime = true
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// testRouter serves the account endpoints with the context main.go provides, mailing into mail
+func testRouter(t *testing.T, db *sql.DB, mail mailer.Sender, requireVerification bool) *gin.Engine {
+	t.Helper()
+	previous := config.ConfigInstance
+	config.ConfigInstance = &config.Config{
+		JWTSecret:                "test-secret",
+		AppURL:                   "https://app.example.test",
+		RequireEmailVerification: requireVerification,
+		LoginAttemptStore:        "memory",
+		LoginMaxFailures:         10,
+		LoginLockout:             time.Minute,
+	}
+	t.Cleanup(func() { config.ConfigInstance = previous })
+
+	gin.SetMode(gin.TestMode)
+	guard := auth.NewLoginGuard(config.ConfigInstance, db)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("mailer", mail)
+		c.Set("loginGuard", guard)
+		c.Next()
+	})
+	router.POST("/api/register", RegisterHandler)
+	router.POST("/api/login", auth.LoginHandler)
+	router.POST("/api/password/forgot", ForgotPasswordHandler)
+	router.POST("/api/password/reset", ResetPasswordHandler)
+	router.POST("/api/email/verify", VerifyEmailHandler)
+	return router
+}
+
+// postJSON sends body to path and returns the response
+func postJSON(router *gin.Engine, path string, body gin.H) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// register signs up a student in the default organization
+func register(t *testing.T, router *gin.Engine, email, password string) {
+	t.Helper()
+	w := postJSON(router, "/api/register", gin.H{
+		"name": "Test Student", "email": email, "password": password, "role": "student", "org": "default",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("register: status %d: %s", w.Code, w.Body)
+	}
+}
+
+// mailedToken returns the token in the link of the latest message mailed to the address
+func mailedToken(t *testing.T, mail *mailer.Recorder, to string) string {
+	t.Helper()
+	messages := mail.Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].To != to {
+			continue
+		}
+		for _, line := range strings.Split(messages[i].Body, "\n") {
+			if !strings.HasPrefix(line, config.ConfigInstance.AppURL) {
+				continue
+			}
+			link, err := url.Parse(line)
+			if err != nil {
+				t.Fatalf("parsing mailed link %q: %v", line, err)
+			}
+			return link.Query().Get("token")
+		}
+		t.Fatalf("no link in message to %s: %q", to, messages[i].Body)
+	}
+	t.Fatalf("nothing was mailed to %s", to)
+	return ""
+}
+
+func TestVerificationTokenIsSingleUse(t *testing.T) {
+	db := testDB(t)
+	mail := &mailer.Recorder{}
+	router := testRouter(t, db, mail, false)
+
+	register(t, router, "single@example.test", "correct horse")
+	token := mailedToken(t, mail, "single@example.test")
+
+	if w := postJSON(router, "/api/email/verify", gin.H{"token": token}); w.Code != http.StatusOK {
+		t.Fatalf("first verify: status %d: %s", w.Code, w.Body)
+	}
+	if w := postJSON(router, "/api/email/verify", gin.H{"token": token}); w.Code != http.StatusBadRequest {
+		t.Errorf("second verify: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestConsumeUserToken(t *testing.T) {
+	db := testDB(t)
+	mail := &mailer.Recorder{}
+	router := testRouter(t, db, mail, false)
+	register(t, router, "tokens@example.test", "correct horse")
+
+	var userID int64
+	if err := db.QueryRow(`SELECT user_id FROM user WHERE email = ?`, "tokens@example.test").Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	issue := func(purpose string, ttl time.Duration) string {
+		t.Helper()
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		token, err := issueUserToken(tx, userID, purpose, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	consume := func(token, purpose string) (int64, error) {
+		t.Helper()
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		id, err := consumeUserToken(tx, token, purpose)
+		if err == nil {
+			err = tx.Commit()
+		}
+		return id, err
+	}
+
+	token := issue(tokenPasswordReset, time.Hour)
+	if id, err := consume(token, tokenPasswordReset); err != nil || id != userID {
+		t.Fatalf("first use = %d, %v, want %d, nil", id, err, userID)
+	}
+	if _, err := consume(token, tokenPasswordReset); err != sql.ErrNoRows {
+		t.Errorf("second use: err = %v, want sql.ErrNoRows", err)
+	}
+
+	expired := issue(tokenPasswordReset, -time.Minute)
+	if _, err := consume(expired, tokenPasswordReset); err != sql.ErrNoRows {
+		t.Errorf("expired token: err = %v, want sql.ErrNoRows", err)
+	}
+
+	replaced := issue(tokenPasswordReset, time.Hour)
+	latest := issue(tokenPasswordReset, time.Hour)
+	if _, err := consume(replaced, tokenPasswordReset); err != sql.ErrNoRows {
+		t.Errorf("replaced token: err = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := consume(latest, tokenEmailVerification); err != sql.ErrNoRows {
+		t.Errorf("token for another purpose: err = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := consume(latest, tokenPasswordReset); err != nil {
+		t.Errorf("latest token: err = %v, want nil", err)
+	}
+}
+
+func TestVerifyRejectsResetToken(t *testing.T) {
+	db := testDB(t)
+	mail := &mailer.Recorder{}
+	router := testRouter(t, db, mail, false)
+	register(t, router, "reset@example.test", "correct horse")
+
+	if w := postJSON(router, "/api/password/forgot", gin.H{"email": "reset@example.test"}); w.Code != http.StatusOK {
+		t.Fatalf("forgot password: status %d: %s", w.Code, w.Body)
+	}
+	token := mailedToken(t, mail, "reset@example.test")
+
+	if w := postJSON(router, "/api/email/verify", gin.H{"token": token}); w.Code != http.StatusBadRequest {
+		t.Errorf("verify with a reset token: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	var verified bool
+	err := db.QueryRow(`SELECT email_verified_at IS NOT NULL FROM user WHERE email = ?`, "reset@example.test").
+		Scan(&verified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified {
+		t.Error("a reset token verified the address")
+	}
+
+	// The refused attempt must not have spent the token
+	w := postJSON(router, "/api/password/reset", gin.H{"token": token, "password": "battery staple"})
+	if w.Code != http.StatusOK {
+		t.Errorf("reset password: status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestLoginRequiresVerifiedEmail(t *testing.T) {
+	db := testDB(t)
+	mail := &mailer.Recorder{}
+	router := testRouter(t, db, mail, true)
+	register(t, router, "unverified@example.test", "correct horse")
+	login := gin.H{"email": "unverified@example.test", "password": "correct horse"}
+
+	if w := postJSON(router, "/api/login", login); w.Code != http.StatusForbidden {
+		t.Errorf("login before verifying: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	// A wrong password still gets the generic answer, so the block does not reveal the account
+	wrong := gin.H{"email": "unverified@example.test", "password": "wrong password"}
+	if w := postJSON(router, "/api/login", wrong); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password before verifying: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	token := mailedToken(t, mail, "unverified@example.test")
+	if w := postJSON(router, "/api/email/verify", gin.H{"token": token}); w.Code != http.StatusOK {
+		t.Fatalf("verify: status %d: %s", w.Code, w.Body)
+	}
+	if w := postJSON(router, "/api/login", login); w.Code != http.StatusOK {
+		t.Errorf("login after verifying: status %d: %s", w.Code, w.Body)
+	}
+}
@@ -12,6 +12,19 @@ import (
 	"edusync/models"
 )
 
+// AnnouncementRequest is the request body for creating or updating an announcement. publish_at is an RFC 3339
+// timestamp; an update that omits is_draft keeps a draft a draft.
+type AnnouncementRequest struct {
+	CourseID  int     `json:"course_id"`
+	Title     string  `json:"title"`
+	Content   *string `json:"content"`
+	IsPinned  bool    `json:"is_pinned"`
+	IsDraft   *bool   `json:"is_draft"`
+	PublishAt *string `json:"publish_at"`
+	CourseIDs []int   `json:"course_ids"` // Additional classrooms to cross-post into
+	Propagate bool    `json:"propagate"`  // Apply an update to linked copies as well
+}
+
 // CreateAnnouncementHandler creates a new announcement
 func CreateAnnouncementHandler(c *gin.Context) {
 	userID, _ := c.Get("userID")
@@ -21,7 +34,7 @@ func CreateAnnouncementHandler(c *gin.Context) {
 		return
 	}
 
-	var req models.Announcement
+	var req AnnouncementRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
 		return
@@ -38,13 +51,9 @@ func CreateAnnouncementHandler(c *gin.Context) {
 		return
 	}
 
-	// Check if the teacher is authorized to create announcements for this classroom
-	var exists bool
-	err = db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 FROM classroom 
-			WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE
-		)`, req.CourseID, teacherID).Scan(&exists)
+	// Check if the teacher is authorized to create announcements for every target classroom
+	courseIDs := crossPostTargets(req.CourseID, req.CourseIDs)
+	exists, err := teacherCanAll(db, teacherID, courseIDs, permEditContent)
 	if err != nil {
 		log.Printf("Error checking classroom authorization: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -55,23 +64,72 @@ func CreateAnnouncementHandler(c *gin.Context) {
 		return
 	}
 
-	result, err := db.Exec(`
-		INSERT INTO announcement (course_id, title, content, created_at, is_pinned, archive_delete_flag)
-		VALUES (?, ?, ?, ?, ?, TRUE)`,
-		req.CourseID, req.Title, req.Content, time.Now(), req.IsPinned)
+	// Archived classrooms are read-only
+	for _, courseID := range courseIDs {
+		if !requireWritableClassroom(c, db, "classroom", courseID) {
+			return
+		}
+	}
+
+	// Drafts stay hidden; a future publish_at schedules the announcement instead of posting it now
+	status, publishAt, err := resolvePublication(req.IsDraft != nil && *req.IsDraft, req.PublishAt, sql.NullTime{})
 	if err != nil {
-		log.Printf("Error inserting announcement: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid publish_at format, expected YYYY-MM-DDThh:mm:ssZ (e.g., 2025-05-10T14:30:00Z)"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// The first classroom holds the original; the rest get copies linked back to it
+	now := time.Now()
+	var announcementID int64
+	var linkedCopies []gin.H
+	for i, courseID := range courseIDs {
+		var sourceID interface{}
+		if i > 0 {
+			sourceID = announcementID
+		}
+		result, err := tx.Exec(`
+			INSERT INTO announcement (course_id, title, content, created_at, is_pinned, status, publish_at, source_announcement_id, archive_delete_flag)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, TRUE)`,
+			courseID, req.Title, req.Content, now, req.IsPinned, status, publishAt, sourceID)
+		if err != nil {
+			log.Printf("Error inserting announcement for course_id %d: %v", courseID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		insertedID, _ := result.LastInsertId()
+		if i == 0 {
+			announcementID = insertedID
+			continue
+		}
+		linkedCopies = append(linkedCopies, gin.H{
+			"announcement_id": insertedID,
+			"course_id":       courseID,
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
 
-	announcementID, _ := result.LastInsertId()
 	c.JSON(http.StatusOK, gin.H{
 		"announcement_id": announcementID,
 		"course_id":       req.CourseID,
 		"title":           req.Title,
 		"content":         req.Content,
 		"is_pinned":       req.IsPinned,
+		"status":          status,
+		"publish_at":      publishAt,
+		"linked_copies":   linkedCopies,
 	})
 }
 
@@ -90,7 +148,7 @@ func UpdateAnnouncementHandler(c *gin.Context) {
 		return
 	}
 
-	var req models.Announcement
+	var req AnnouncementRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
 		return
@@ -108,14 +166,7 @@ func UpdateAnnouncementHandler(c *gin.Context) {
 	}
 
 	// Check if the teacher is authorized to update this announcement
-	var exists bool
-	err = db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 FROM announcement a
-			JOIN classroom c ON a.course_id = c.course_id
-			WHERE a.announcement_id = ? AND c.teacher_id = ? AND a.archive_delete_flag = TRUE
-			AND c.archive_delete_flag = TRUE
-		)`, announcementID, teacherID).Scan(&exists)
+	exists, err := teacherCanOn(db, teacherID, "announcement", announcementID, permEditContent)
 	if err != nil {
 		log.Printf("Error checking announcement authorization: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -126,22 +177,91 @@ func UpdateAnnouncementHandler(c *gin.Context) {
 		return
 	}
 
-	_, err = db.Exec(`
+	if !requireWritableClassroom(c, db, "announcement", announcementID) {
+		return
+	}
+
+	var currentStatus string
+	var currentPublishAt sql.NullTime
+	err = db.QueryRow(`
+		SELECT status, publish_at FROM announcement 
+		WHERE announcement_id = ? AND archive_delete_flag = TRUE`, announcementID).Scan(&currentStatus, &currentPublishAt)
+	if err != nil {
+		log.Printf("Error querying announcement publish time: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	isDraft := currentStatus == statusDraft
+	if req.IsDraft != nil {
+		isDraft = *req.IsDraft
+	}
+	status, publishAt, err := resolvePublication(isDraft, req.PublishAt, currentPublishAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid publish_at format, expected YYYY-MM-DDThh:mm:ssZ (e.g., 2025-05-10T14:30:00Z)"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
 		UPDATE announcement 
-		SET title = ?, content = ?, is_pinned = ?
+		SET title = ?, content = ?, is_pinned = ?, status = ?, publish_at = ?
 		WHERE announcement_id = ? AND archive_delete_flag = TRUE`,
-		req.Title, req.Content, req.IsPinned, announcementID)
+		req.Title, req.Content, req.IsPinned, status, publishAt, announcementID)
 	if err != nil {
 		log.Printf("Error updating announcement: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
+	// Optionally push the edit to the copies cross-posted from this announcement; copies the teacher may not edit
+	// are left alone and reported
+	var propagated int64
+	skipped := []int{}
+	if req.Propagate {
+		skipped, err = skippedCopies(tx, "announcement", announcementID, teacherID)
+		if err != nil {
+			log.Printf("Error querying linked announcements: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		result, err := tx.Exec(`
+			UPDATE announcement a
+			JOIN classroom c ON a.course_id = c.course_id
+			SET a.title = ?, a.content = ?, a.is_pinned = ?, a.status = ?, a.publish_at = ?
+			WHERE a.source_announcement_id = ? AND a.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE
+			AND `+editableCopy,
+			req.Title, req.Content, req.IsPinned, status, publishAt, announcementID, teacherID)
+		if err != nil {
+			log.Printf("Error updating linked announcements: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		propagated, _ = result.RowsAffected()
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"announcement_id": announcementID,
-		"title":           req.Title,
-		"content":         req.Content,
-		"is_pinned":       req.IsPinned,
+		"announcement_id":       announcementID,
+		"title":                 req.Title,
+		"content":               req.Content,
+		"is_pinned":             req.IsPinned,
+		"status":                status,
+		"publish_at":            publishAt,
+		"linked_copies_updated": propagated,
+		"linked_copies_skipped": skipped,
 	})
 }
 
@@ -172,14 +292,7 @@ func DeleteAnnouncementHandler(c *gin.Context) {
 	}
 
 	// Check if the teacher is authorized to delete this announcement
-	var exists bool
-	err = db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 FROM announcement a
-			JOIN classroom c ON a.course_id = c.course_id
-			WHERE a.announcement_id = ? AND c.teacher_id = ? AND a.archive_delete_flag = TRUE
-			AND c.archive_delete_flag = TRUE
-		)`, announcementID, teacherID).Scan(&exists)
+	exists, err := teacherCanOn(db, teacherID, "announcement", announcementID, permEditContent)
 	if err != nil {
 		log.Printf("Error checking announcement authorization: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -190,6 +303,10 @@ func DeleteAnnouncementHandler(c *gin.Context) {
 		return
 	}
 
+	if !requireWritableClassroom(c, db, "announcement", announcementID) {
+		return
+	}
+
 	_, err = db.Exec(`
 		UPDATE announcement 
 		SET archive_delete_flag = FALSE 
@@ -203,6 +320,22 @@ func DeleteAnnouncementHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Announcement deleted"})
 }
 
+// announcementListSpec is the sorting and filtering of a classroom's announcement list
+var announcementListSpec = listSpec{
+	Sorts: map[string]listColumn{
+		"created_at": {Expr: "COALESCE(created_at, TIMESTAMP '1970-01-01 00:00:00')", Kind: kindTime},
+		"title":      {Expr: "title", Kind: kindString},
+	},
+	DefaultSort: "-created_at",
+	ID:          "announcement_id",
+	Filters: map[string]listFilter{
+		"status":         {Expr: "status", Kind: kindString, Values: []string{statusDraft, statusScheduled, statusPublished}},
+		"is_pinned":      {Expr: "is_pinned", Kind: kindBool},
+		"created_before": {Expr: "created_at", Kind: kindTime, Op: "<"},
+		"created_after":  {Expr: "created_at", Kind: kindTime, Op: ">="},
+	},
+}
+
 // GetAnnouncementsByClassroomHandler lists announcements for a classroom
 func GetAnnouncementsByClassroomHandler(c *gin.Context) {
 	userID, _ := c.Get("userID")
@@ -228,12 +361,7 @@ func GetAnnouncementsByClassroomHandler(c *gin.Context) {
 		}
 
 		// Check if the teacher is authorized to view this classroom
-		var exists bool
-		err = db.QueryRow(`
-			SELECT EXISTS (
-				SELECT 1 FROM classroom 
-				WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE
-			)`, courseID, teacherID).Scan(&exists)
+		exists, err := teacherCan(db, teacherID, courseID, permViewClassroom)
 		if err != nil {
 			log.Printf("Error checking classroom authorization: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -275,10 +403,22 @@ func GetAnnouncementsByClassroomHandler(c *gin.Context) {
 		return
 	}
 
-	rows, err := db.Query(`
-		SELECT announcement_id, course_id, title, content, created_at, is_pinned
+	page, err := parseListPage(c, announcementListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Students only see announcements that have gone live
+	query := `
+		SELECT announcement_id, course_id, title, content, created_at, is_pinned, status, publish_at, source_announcement_id` + page.Select() + `
 		FROM announcement 
-		WHERE course_id = ? AND archive_delete_flag = TRUE`, courseID)
+		WHERE course_id = ? AND archive_delete_flag = TRUE`
+	if role == "student" {
+		query += ` AND ` + visibleToStudents("")
+	}
+
+	rows, err := db.Query(query+page.Where()+page.OrderLimit(), append([]interface{}{courseID}, page.Args()...)...)
 	if err != nil {
 		log.Printf("Error querying announcements: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -287,14 +427,25 @@ func GetAnnouncementsByClassroomHandler(c *gin.Context) {
 	defer rows.Close()
 
 	var announcements []models.Announcement
-	for rows.Next() {
+	for rows.Next() && page.Next() {
 		var a models.Announcement
-		if err := rows.Scan(&a.AnnouncementID, &a.CourseID, &a.Title, &a.Content, &a.CreatedAt, &a.IsPinned); err != nil {
+		var publishAt sql.NullTime
+		var sourceID sql.NullInt64
+		if err := rows.Scan(page.Dest(&a.AnnouncementID, &a.CourseID, &a.Title, &a.Content, &a.CreatedAt, &a.IsPinned, &a.Status, &publishAt, &sourceID)...); err != nil {
 			log.Printf("Error scanning announcement: %v", err)
 			continue
 		}
+		if publishAt.Valid {
+			publishAtValue := publishAt.Time
+			a.PublishAt = &publishAtValue
+		}
+		if sourceID.Valid {
+			sourceIDValue := int(sourceID.Int64)
+			a.SourceID = &sourceIDValue
+		}
 		announcements = append(announcements, a)
 	}
 
+	page.SetNextCursor(c)
 	c.JSON(http.StatusOK, announcements)
 }
\ No newline at end of file
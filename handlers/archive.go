@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// archivedLookups finds the archive state of the classroom that owns a given row
+var archivedLookups = map[string]string{
+	"classroom": `
+		SELECT is_archived FROM classroom
+		WHERE course_id = ? AND archive_delete_flag = TRUE`,
+	"announcement": `
+		SELECT c.is_archived FROM announcement a
+		JOIN classroom c ON a.course_id = c.course_id
+		WHERE a.announcement_id = ? AND c.archive_delete_flag = TRUE`,
+	"assignment": `
+		SELECT c.is_archived FROM assignment a
+		JOIN classroom c ON a.course_id = c.course_id
+		WHERE a.assignment_id = ? AND c.archive_delete_flag = TRUE`,
+	"material": `
+		SELECT c.is_archived FROM material m
+		JOIN classroom c ON m.course_id = c.course_id
+		WHERE m.material_id = ? AND c.archive_delete_flag = TRUE`,
+	"group": `
+		SELECT c.is_archived FROM student_group g
+		JOIN classroom c ON g.course_id = c.course_id
+		WHERE g.group_id = ? AND c.archive_delete_flag = TRUE`,
+	"question_bank": `
+		SELECT c.is_archived FROM question_bank b
+		JOIN classroom c ON b.course_id = c.course_id
+		WHERE b.bank_id = ? AND c.archive_delete_flag = TRUE`,
+	"question": `
+		SELECT c.is_archived FROM quiz_question q
+		JOIN question_bank b ON q.bank_id = b.bank_id
+		JOIN classroom c ON b.course_id = c.course_id
+		WHERE q.question_id = ? AND c.archive_delete_flag = TRUE`,
+	"submission": `
+		SELECT c.is_archived FROM submission s
+		JOIN assignment a ON s.assignment_id = a.assignment_id
+		JOIN classroom c ON a.course_id = c.course_id
+		WHERE s.submission_id = ? AND c.archive_delete_flag = TRUE`,
+	"session": `
+		SELECT c.is_archived FROM class_session cs
+		JOIN classroom c ON cs.course_id = c.course_id
+		WHERE cs.session_id = ? AND c.archive_delete_flag = TRUE`,
+	"module": `
+		SELECT c.is_archived FROM class_module m
+		JOIN classroom c ON m.course_id = c.course_id
+		WHERE m.module_id = ? AND c.archive_delete_flag = TRUE`,
+}
+
+// classroomArchived reports whether the classroom owning the given row is archived and therefore read-only.
+// kind is one of the keys of archivedLookups.
+func classroomArchived(db *sql.DB, kind string, id int) (bool, error) {
+	var archived bool
+	err := db.QueryRow(archivedLookups[kind], id).Scan(&archived)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return archived, err
+}
+
+// requireWritableClassroom refuses changes to an archived classroom, checked through the row as classroomArchived
+// does. It writes the error response itself.
+func requireWritableClassroom(c *gin.Context, db *sql.DB, kind string, id int) bool {
+	archived, err := classroomArchived(db, kind, id)
+	if err != nil {
+		log.Printf("Error checking classroom archive state: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if archived {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Classroom is archived and read-only"})
+		return false
+	}
+	return true
+}
+
+// ArchiveClassroomHandler puts a classroom into the read-only archived state
+func ArchiveClassroomHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	if role != "teacher" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only teachers can archive classrooms"})
+		return
+	}
+
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	var teacherID int
+	err = db.QueryRow(`
+		SELECT teacher_id FROM teacher
+		WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&teacherID)
+	if err != nil {
+		log.Printf("Error querying teacher: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Teacher not found"})
+		return
+	}
+
+	allowed, err := teacherCan(db, teacherID, courseID, permEditClassroom)
+	if err != nil {
+		log.Printf("Error checking classroom authorization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to archive this classroom"})
+		return
+	}
+
+	archived, err := classroomArchived(db, "classroom", courseID)
+	if err != nil {
+		log.Printf("Error checking classroom archive state: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if archived {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Classroom is already archived"})
+		return
+	}
+
+	now := time.Now()
+	_, err = db.Exec(`
+		UPDATE classroom
+		SET is_archived = TRUE, archived_at = ?
+		WHERE course_id = ? AND archive_delete_flag = TRUE`,
+		now, courseID)
+	if err != nil {
+		log.Printf("Error archiving classroom: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"course_id":   courseID,
+		"is_archived": true,
+		"archived_at": now,
+		"message":     "Classroom archived",
+	})
+}
+
+// RestoreClassroomHandler makes an archived classroom writable again
+func RestoreClassroomHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	if role != "teacher" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only teachers can restore classrooms"})
+		return
+	}
+
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	// An optional new end date extends the term; the classroom is then archived again automatically once it passes
+	var req struct {
+		EndDate *string `json:"end_date"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+	}
+	endDate, err := parseDate(req.EndDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format, expected YYYY-MM-DD"})
+		return
+	}
+	if endDate != nil && endDate.Before(time.Now().Truncate(24*time.Hour)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must not be in the past"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	var teacherID int
+	err = db.QueryRow(`
+		SELECT teacher_id FROM teacher
+		WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&teacherID)
+	if err != nil {
+		log.Printf("Error querying teacher: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Teacher not found"})
+		return
+	}
+
+	allowed, err := teacherCan(db, teacherID, courseID, permEditClassroom)
+	if err != nil {
+		log.Printf("Error checking classroom authorization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to restore this classroom"})
+		return
+	}
+
+	archived, err := classroomArchived(db, "classroom", courseID)
+	if err != nil {
+		log.Printf("Error checking classroom archive state: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !archived {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Classroom is not archived"})
+		return
+	}
+
+	// archived_at is kept on a plain restore so the auto-archiver leaves the classroom alone
+	if endDate != nil {
+		_, err = db.Exec(`
+			UPDATE classroom
+			SET is_archived = FALSE, archived_at = NULL, end_date = ?
+			WHERE course_id = ? AND archive_delete_flag = TRUE`,
+			endDate, courseID)
+	} else {
+		_, err = db.Exec(`
+			UPDATE classroom
+			SET is_archived = FALSE
+			WHERE course_id = ? AND archive_delete_flag = TRUE`,
+			courseID)
+	}
+	if err != nil {
+		log.Printf("Error restoring classroom: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"course_id":   courseID,
+		"is_archived": false,
+		"end_date":    endDate,
+		"message":     "Classroom restored",
+	})
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"edusync/grader"
 	"edusync/models"
 )
 
@@ -19,6 +20,11 @@ type AssignmentRequest struct {
 	Description *string `json:"description"`
 	DueDate     string  `json:"due_date" binding:"required"`
 	MaxPoints   int     `json:"max_points" binding:"required"`
+	IsDraft     *bool   `json:"is_draft"` // Omitted on update: a draft stays a draft
+	PublishAt   *string `json:"publish_at"`
+	CourseIDs   []int   `json:"course_ids"` // Additional classrooms to cross-post into
+	Propagate   bool    `json:"propagate"`  // Apply an update to linked copies as well
+	IsGroup     bool    `json:"is_group_assignment"`
 }
 
 // CreateAssignmentHandler creates a new assignment
@@ -54,13 +60,9 @@ func CreateAssignmentHandler(c *gin.Context) {
 		return
 	}
 
-	// Check if the teacher is authorized to create an assignment for this course
-	var exists bool
-	err = db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 FROM classroom 
-			WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE
-		)`, req.CourseID, teacherID).Scan(&exists)
+	// Check if the teacher is authorized to create an assignment for every target course
+	courseIDs := crossPostTargets(req.CourseID, req.CourseIDs)
+	exists, err := teacherCanAll(db, teacherID, courseIDs, permEditContent)
 	if err != nil {
 		log.Printf("Error checking classroom authorization: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -71,21 +73,74 @@ func CreateAssignmentHandler(c *gin.Context) {
 		return
 	}
 
-	result, err := db.Exec(`
-		INSERT INTO assignment (course_id, title, description, due_date, max_points, archive_delete_flag)
-		VALUES (?, ?, ?, ?, ?, TRUE)`,
-		req.CourseID, req.Title, req.Description, dueDate, req.MaxPoints)
+	// Archived classrooms are read-only
+	for _, courseID := range courseIDs {
+		if !requireWritableClassroom(c, db, "classroom", courseID) {
+			return
+		}
+	}
+
+	// Drafts stay hidden; a future publish_at schedules the assignment instead of posting it now
+	status, publishAt, err := resolvePublication(req.IsDraft != nil && *req.IsDraft, req.PublishAt, sql.NullTime{})
 	if err != nil {
-		log.Printf("Error inserting assignment: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid publish_at format, expected YYYY-MM-DDThh:mm:ssZ (e.g., 2025-05-10T14:30:00Z)"})
+		return
+	}
+	if publishAt != nil && publishAt.After(dueDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "publish_at must be before due_date"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// The first course holds the original; the rest get copies linked back to it
+	var assignmentID int64
+	var linkedCopies []gin.H
+	for i, courseID := range courseIDs {
+		var sourceID interface{}
+		if i > 0 {
+			sourceID = assignmentID
+		}
+		result, err := tx.Exec(`
+			INSERT INTO assignment (course_id, title, description, due_date, max_points, status, publish_at, source_assignment_id, is_group_assignment, archive_delete_flag)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, TRUE)`,
+			courseID, req.Title, req.Description, dueDate, req.MaxPoints, status, publishAt, sourceID, req.IsGroup)
+		if err != nil {
+			log.Printf("Error inserting assignment for course_id %d: %v", courseID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		insertedID, _ := result.LastInsertId()
+		if i == 0 {
+			assignmentID = insertedID
+			continue
+		}
+		linkedCopies = append(linkedCopies, gin.H{
+			"assignment_id": insertedID,
+			"course_id":     courseID,
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
 
-	assignmentID, _ := result.LastInsertId()
 	c.JSON(http.StatusOK, gin.H{
-		"assignment_id": assignmentID,
-		"course_id":     req.CourseID,
-		"title":         req.Title,
+		"assignment_id":       assignmentID,
+		"course_id":           req.CourseID,
+		"title":               req.Title,
+		"status":              status,
+		"publish_at":          publishAt,
+		"is_group_assignment": req.IsGroup,
+		"linked_copies":       linkedCopies,
 	})
 }
 
@@ -129,14 +184,7 @@ func UpdateAssignmentHandler(c *gin.Context) {
 	}
 
 	// Check if the teacher is authorized to update this assignment
-	var exists bool
-	err = db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 
-			FROM assignment a
-			JOIN classroom c ON a.course_id = c.course_id
-			WHERE a.assignment_id = ? AND c.teacher_id = ? AND a.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE
-		)`, assignmentID, teacherID).Scan(&exists)
+	exists, err := teacherCanOn(db, teacherID, "assignment", assignmentID, permEditContent)
 	if err != nil {
 		log.Printf("Error checking assignment authorization: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -147,21 +195,147 @@ func UpdateAssignmentHandler(c *gin.Context) {
 		return
 	}
 
-	_, err = db.Exec(`
+	if !requireWritableClassroom(c, db, "assignment", assignmentID) {
+		return
+	}
+
+	var currentStatus string
+	var currentPublishAt sql.NullTime
+	var currentCourseID int
+	var currentIsGroup, hasSubmissions, quiz, peerReviewed bool
+	err = db.QueryRow(`
+		SELECT a.course_id, a.status, a.publish_at, a.is_group_assignment, EXISTS (
+			SELECT 1 FROM submission s WHERE s.assignment_id = a.assignment_id AND s.archive_delete_flag = TRUE
+		), EXISTS (
+			SELECT 1 FROM quiz q WHERE q.assignment_id = a.assignment_id AND q.archive_delete_flag = TRUE
+		), EXISTS (
+			SELECT 1 FROM peer_review_settings p WHERE p.assignment_id = a.assignment_id AND p.archive_delete_flag = TRUE
+		)
+		FROM assignment a
+		WHERE a.assignment_id = ? AND a.archive_delete_flag = TRUE`, assignmentID).Scan(&currentCourseID, &currentStatus, &currentPublishAt, &currentIsGroup, &hasSubmissions, &quiz, &peerReviewed)
+	if err != nil {
+		log.Printf("Error querying assignment publish time: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Switching between individual and group work would orphan existing submissions
+	if req.IsGroup != currentIsGroup && hasSubmissions {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "is_group_assignment cannot be changed once submissions exist"})
+		return
+	}
+	if req.IsGroup && quiz {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quizzes cannot be group assignments"})
+		return
+	}
+	if req.IsGroup && peerReviewed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Peer-reviewed assignments cannot be group assignments"})
+		return
+	}
+
+	// Moving the assignment needs the same rights on a writable classroom of the same organization
+	if req.CourseID != currentCourseID {
+		if hasSubmissions {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "course_id cannot be changed once submissions exist"})
+			return
+		}
+		allowed, err := teacherCan(db, teacherID, req.CourseID, permEditContent)
+		if err == nil && allowed {
+			err = db.QueryRow(`
+				SELECT EXISTS (
+					SELECT 1 FROM classroom src
+					JOIN classroom dst ON dst.org_id = src.org_id
+					WHERE src.course_id = ? AND dst.course_id = ? AND dst.archive_delete_flag = TRUE
+				)`, currentCourseID, req.CourseID).Scan(&allowed)
+		}
+		if err != nil {
+			log.Printf("Error checking target classroom authorization: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to move this assignment to that classroom"})
+			return
+		}
+		if !requireWritableClassroom(c, db, "classroom", req.CourseID) {
+			return
+		}
+	}
+
+	isDraft := currentStatus == statusDraft
+	if req.IsDraft != nil {
+		isDraft = *req.IsDraft
+	}
+	status, publishAt, err := resolvePublication(isDraft, req.PublishAt, currentPublishAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid publish_at format, expected YYYY-MM-DDThh:mm:ssZ (e.g., 2025-05-10T14:30:00Z)"})
+		return
+	}
+	if publishAt != nil && publishAt.After(dueDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "publish_at must be before due_date"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
 		UPDATE assignment 
-		SET course_id = ?, title = ?, description = ?, due_date = ?, max_points = ?
+		SET course_id = ?, title = ?, description = ?, due_date = ?, max_points = ?, status = ?, publish_at = ?, is_group_assignment = ?
 		WHERE assignment_id = ? AND archive_delete_flag = TRUE`,
-		req.CourseID, req.Title, req.Description, dueDate, req.MaxPoints, assignmentID)
+		req.CourseID, req.Title, req.Description, dueDate, req.MaxPoints, status, publishAt, req.IsGroup, assignmentID)
 	if err != nil {
 		log.Printf("Error updating assignment: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
+	// Optionally push the edit to the copies cross-posted from this assignment; each copy keeps its own course, and
+	// copies the teacher may not edit are left alone and reported
+	var propagated int64
+	skipped := []int{}
+	if req.Propagate {
+		skipped, err = skippedCopies(tx, "assignment", assignmentID, teacherID)
+		if err != nil {
+			log.Printf("Error querying linked assignments: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		result, err := tx.Exec(`
+			UPDATE assignment a
+			JOIN classroom c ON a.course_id = c.course_id
+			SET a.title = ?, a.description = ?, a.due_date = ?, a.max_points = ?, a.status = ?, a.publish_at = ?
+			WHERE a.source_assignment_id = ? AND a.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE
+			AND `+editableCopy,
+			req.Title, req.Description, dueDate, req.MaxPoints, status, publishAt, assignmentID, teacherID)
+		if err != nil {
+			log.Printf("Error updating linked assignments: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		propagated, _ = result.RowsAffected()
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"assignment_id": assignmentID,
-		"course_id":     req.CourseID,
-		"title":         req.Title,
+		"assignment_id":         assignmentID,
+		"course_id":             req.CourseID,
+		"title":                 req.Title,
+		"status":                status,
+		"publish_at":            publishAt,
+		"is_group_assignment":   req.IsGroup,
+		"linked_copies_updated": propagated,
+		"linked_copies_skipped": skipped,
 	})
 }
 
@@ -192,14 +366,7 @@ func DeleteAssignmentHandler(c *gin.Context) {
 	}
 
 	// Check if the teacher is authorized to delete this assignment
-	var exists bool
-	err = db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 
-			FROM assignment a
-			JOIN classroom c ON a.course_id = c.course_id
-			WHERE a.assignment_id = ? AND c.teacher_id = ? AND a.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE
-		)`, assignmentID, teacherID).Scan(&exists)
+	exists, err := teacherCanOn(db, teacherID, "assignment", assignmentID, permEditContent)
 	if err != nil {
 		log.Printf("Error checking assignment authorization: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -210,6 +377,10 @@ func DeleteAssignmentHandler(c *gin.Context) {
 		return
 	}
 
+	if !requireWritableClassroom(c, db, "assignment", assignmentID) {
+		return
+	}
+
 	_, err = db.Exec(`
 		UPDATE assignment 
 		SET archive_delete_flag = FALSE 
@@ -224,6 +395,24 @@ func DeleteAssignmentHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Assignment deleted"})
 }
 
+// assignmentListSpec is the sorting and filtering of a classroom's assignment list
+var assignmentListSpec = listSpec{
+	Sorts: map[string]listColumn{
+		"due_date":   {Expr: "due_date", Kind: kindTime},
+		"created_at": {Expr: "COALESCE(created_at, due_date)", Kind: kindTime},
+		"title":      {Expr: "title", Kind: kindString},
+		"max_points": {Expr: "COALESCE(max_points, 0)", Kind: kindInt},
+	},
+	DefaultSort: "due_date",
+	ID:          "assignment_id",
+	Filters: map[string]listFilter{
+		"status":     {Expr: "status", Kind: kindString, Values: []string{statusDraft, statusScheduled, statusPublished}},
+		"due_before": {Expr: "due_date", Kind: kindTime, Op: "<"},
+		"due_after":  {Expr: "due_date", Kind: kindTime, Op: ">="},
+		"is_group":   {Expr: "is_group_assignment", Kind: kindBool},
+	},
+}
+
 // GetAssignmentsByClassroomHandler lists all assignments for a classroom
 func GetAssignmentsByClassroomHandler(c *gin.Context) {
 	userID, _ := c.Get("userID")
@@ -266,12 +455,7 @@ func GetAssignmentsByClassroomHandler(c *gin.Context) {
 		}
 
 		// Check if the teacher is authorized to view this classroom
-		var teacherAuthorized bool
-		err = db.QueryRow(`
-			SELECT EXISTS (
-				SELECT 1 FROM classroom 
-				WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE
-			)`, courseID, teacherID).Scan(&teacherAuthorized)
+		teacherAuthorized, err := teacherCan(db, teacherID, courseID, permViewClassroom)
 		if err != nil {
 			log.Printf("Error checking teacher authorization: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -313,10 +497,23 @@ func GetAssignmentsByClassroomHandler(c *gin.Context) {
 		return
 	}
 
-	rows, err := db.Query(`
-		SELECT assignment_id, course_id, title, description, due_date, max_points
+	page, err := parseListPage(c, assignmentListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Students only see assignments that have gone live
+	query := `
+		SELECT assignment_id, course_id, title, description, due_date, max_points, status, publish_at, source_assignment_id, is_group_assignment,
+		EXISTS (SELECT 1 FROM quiz q WHERE q.assignment_id = assignment.assignment_id AND q.archive_delete_flag = TRUE)` + page.Select() + `
 		FROM assignment 
-		WHERE course_id = ? AND archive_delete_flag = TRUE`, courseID)
+		WHERE course_id = ? AND archive_delete_flag = TRUE`
+	if role == "student" {
+		query += ` AND ` + visibleToStudents("")
+	}
+
+	rows, err := db.Query(query+page.Where()+page.OrderLimit(), append([]interface{}{courseID}, page.Args()...)...)
 	if err != nil {
 		log.Printf("Error querying assignments: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -325,22 +522,39 @@ func GetAssignmentsByClassroomHandler(c *gin.Context) {
 	defer rows.Close()
 
 	var assignments []map[string]interface{}
-	for rows.Next() {
+	for rows.Next() && page.Next() {
 		var assignment models.Assignment
-		if err := rows.Scan(&assignment.AssignmentID, &assignment.CourseID, &assignment.Title, &assignment.Description, &assignment.DueDate, &assignment.MaxPoints); err != nil {
+		var publishAt sql.NullTime
+		var sourceID sql.NullInt64
+		if err := rows.Scan(page.Dest(&assignment.AssignmentID, &assignment.CourseID, &assignment.Title, &assignment.Description, &assignment.DueDate, &assignment.MaxPoints, &assignment.Status, &publishAt, &sourceID, &assignment.IsGroup, &assignment.IsQuiz)...); err != nil {
 			log.Printf("Error scanning assignment: %v", err)
 			continue
 		}
-		assignments = append(assignments, map[string]interface{}{
-			"assignment_id": assignment.AssignmentID,
-			"course_id":     assignment.CourseID,
-			"title":         assignment.Title,
-			"description":   assignment.Description,
-			"due_date":      assignment.DueDate.Format(time.RFC3339), // Ensure ISO 8601 format in response
-			"max_points":    assignment.MaxPoints,
-		})
+		item := map[string]interface{}{
+			"assignment_id":       assignment.AssignmentID,
+			"course_id":           assignment.CourseID,
+			"title":               assignment.Title,
+			"description":         assignment.Description,
+			"due_date":            assignment.DueDate.Format(time.RFC3339), // Ensure ISO 8601 format in response
+			"max_points":          assignment.MaxPoints,
+			"is_group_assignment": assignment.IsGroup,
+			"is_quiz":             assignment.IsQuiz,
+		}
+		if role == "teacher" {
+			item["status"] = assignment.Status
+			item["publish_at"] = nil
+			if publishAt.Valid {
+				item["publish_at"] = publishAt.Time.Format(time.RFC3339)
+			}
+			item["source_assignment_id"] = nil
+			if sourceID.Valid {
+				item["source_assignment_id"] = sourceID.Int64
+			}
+		}
+		assignments = append(assignments, item)
 	}
 
+	page.SetNextCursor(c)
 	c.JSON(http.StatusOK, assignments)
 }
 
@@ -372,7 +586,8 @@ func GetUpcomingAssignmentsHandler(c *gin.Context) {
 		SELECT a.assignment_id, a.course_id, a.title, a.description, a.due_date, a.max_points
 		FROM assignment a
 		JOIN classroom c ON a.course_id = c.course_id
-		WHERE c.teacher_id = ? 
+		JOIN classroom_staff cs ON cs.course_id = c.course_id AND cs.status = 'active' AND cs.archive_delete_flag = TRUE
+		WHERE cs.teacher_id = ? 
 		AND a.due_date >= ? 
 		AND a.due_date <= ?
 		AND a.archive_delete_flag = TRUE 
@@ -436,14 +651,7 @@ func GetAssignmentStatsHandler(c *gin.Context) {
 	}
 
 	// Check if the teacher is authorized to view this assignment
-	exists = false
-	err = db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 
-			FROM assignment a
-			JOIN classroom c ON a.course_id = c.course_id
-			WHERE a.assignment_id = ? AND c.teacher_id = ? AND a.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE
-		)`, assignmentID, teacherID).Scan(&exists)
+	exists, err = teacherCanOn(db, teacherID, "assignment", assignmentID, permViewClassroom)
 	if err != nil {
 		log.Printf("Error checking assignment authorization: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -504,3 +712,268 @@ func GetAssignmentStatsHandler(c *gin.Context) {
 		"grade_distribution": gradeDistribution,
 	})
 }
+
+// assignmentStudent resolves the calling student and checks they are enrolled in the classroom of a visible assignment.
+// It returns sql.ErrNoRows when the student cannot see the assignment.
+func assignmentStudent(db *sql.DB, userID interface{}, assignmentID int) (int, int, error) {
+	var studentID, courseID int
+	err := db.QueryRow(`
+		SELECT s.student_id, a.course_id
+		FROM student s
+		JOIN enrollment e ON e.student_id = s.student_id AND e.archive_delete_flag = TRUE
+		JOIN assignment a ON a.course_id = e.course_id
+		WHERE s.user_id = ? AND s.archive_delete_flag = TRUE
+		AND a.assignment_id = ? AND a.archive_delete_flag = TRUE
+		AND `+visibleToStudents("a"), userID, assignmentID).
+		Scan(&studentID, &courseID)
+	return studentID, courseID, err
+}
+
+// CodeTestCaseRequest is one teacher-provided test of a code assignment
+type CodeTestCaseRequest struct {
+	Name           string   `json:"name" binding:"required"`
+	Input          string   `json:"input"`
+	ExpectedOutput string   `json:"expected_output"`
+	Points         *float64 `json:"points"`
+	IsHidden       bool     `json:"is_hidden"` // Students see only the name and outcome of hidden tests
+}
+
+// CodeAssignmentRequest is the request body for turning an assignment into an auto-graded code assignment
+type CodeAssignmentRequest struct {
+	Language      string                `json:"language" binding:"required"`
+	TimeLimitMS   int                   `json:"time_limit_ms"`
+	MemoryLimitMB int                   `json:"memory_limit_mb"`
+	TestCases     []CodeTestCaseRequest `json:"test_cases" binding:"required,min=1,dive"`
+	Regrade       bool                  `json:"regrade"` // Queue existing submissions against the new tests
+}
+
+// isCodeAssignment reports whether an assignment is graded by running its tests
+func isCodeAssignment(db *sql.DB, assignmentID int) (bool, error) {
+	var code bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM code_assignment WHERE assignment_id = ? AND archive_delete_flag = TRUE
+		)`, assignmentID).Scan(&code)
+	return code, err
+}
+
+// SetCodeAssignmentHandler sets the language, limits and tests of a code assignment, replacing any previous tests
+func SetCodeAssignmentHandler(c *gin.Context) {
+	assignmentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		return
+	}
+
+	var req CodeAssignmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if _, ok := grader.Runtimes[req.Language]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported language"})
+		return
+	}
+	if req.TimeLimitMS == 0 {
+		req.TimeLimitMS = 2000
+	}
+	if req.MemoryLimitMB == 0 {
+		req.MemoryLimitMB = 256
+	}
+	if req.TimeLimitMS < 100 || req.TimeLimitMS > 10000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "time_limit_ms must be between 100 and 10000"})
+		return
+	}
+	if req.MemoryLimitMB < 32 || req.MemoryLimitMB > 1024 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "memory_limit_mb must be between 32 and 1024"})
+		return
+	}
+	for i := range req.TestCases {
+		if req.TestCases[i].Points == nil {
+			one := 1.0
+			req.TestCases[i].Points = &one
+		}
+		if *req.TestCases[i].Points <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Test case points must be positive"})
+			return
+		}
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "assignment", assignmentID, permEditContent); !ok {
+		return
+	}
+
+	quiz, err := isQuiz(db, assignmentID)
+	if err != nil {
+		log.Printf("Error checking quiz: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if quiz {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quizzes cannot be code assignments"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO code_assignment (assignment_id, language, time_limit_ms, memory_limit_mb, archive_delete_flag)
+		VALUES (?, ?, ?, ?, TRUE)
+		ON DUPLICATE KEY UPDATE language = VALUES(language), time_limit_ms = VALUES(time_limit_ms),
+		memory_limit_mb = VALUES(memory_limit_mb), archive_delete_flag = TRUE`,
+		assignmentID, req.Language, req.TimeLimitMS, req.MemoryLimitMB)
+	if err != nil {
+		log.Printf("Error saving code assignment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save code assignment"})
+		return
+	}
+
+	// Old tests are kept for the results that refer to them
+	_, err = tx.Exec(`
+		UPDATE code_test_case SET archive_delete_flag = FALSE
+		WHERE assignment_id = ?`, assignmentID)
+	if err != nil {
+		log.Printf("Error replacing test cases: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save test cases"})
+		return
+	}
+	for position, t := range req.TestCases {
+		_, err = tx.Exec(`
+			INSERT INTO code_test_case (assignment_id, name, input, expected_output, points, is_hidden, position, archive_delete_flag)
+			VALUES (?, ?, ?, ?, ?, ?, ?, TRUE)`,
+			assignmentID, t.Name, t.Input, t.ExpectedOutput, *t.Points, t.IsHidden, position)
+		if err != nil {
+			log.Printf("Error inserting test case: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save test cases"})
+			return
+		}
+	}
+
+	queued := 0
+	if req.Regrade {
+		rows, err := tx.Query(`
+			SELECT submission_id FROM submission
+			WHERE assignment_id = ? AND source_code IS NOT NULL AND archive_delete_flag = TRUE`, assignmentID)
+		if err != nil {
+			log.Printf("Error querying submissions: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue regrading"})
+			return
+		}
+		var submissionIDs []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				log.Printf("Error scanning submission: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue regrading"})
+				return
+			}
+			submissionIDs = append(submissionIDs, id)
+		}
+		rows.Close()
+		for _, id := range submissionIDs {
+			if err := queueGradingJob(tx, id); err != nil {
+				log.Printf("Error queueing grading job: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue regrading"})
+				return
+			}
+		}
+		queued = len(submissionIDs)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	if queued > 0 {
+		grader.Wake()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Code assignment saved successfully",
+		"assignment_id":   assignmentID,
+		"language":        req.Language,
+		"time_limit_ms":   req.TimeLimitMS,
+		"memory_limit_mb": req.MemoryLimitMB,
+		"test_count":      len(req.TestCases),
+		"regrade_queued":  queued,
+	})
+}
+
+// GetCodeAssignmentHandler returns the settings and tests of a code assignment.
+// Students do not see the input and expected output of hidden tests.
+func GetCodeAssignmentHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+
+	assignmentID, err := strconv.Atoi(c.Param("assignment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if role == "teacher" {
+		if _, ok := authorizeStaffAccess(c, db, "assignment", assignmentID, permViewClassroom); !ok {
+			return
+		}
+	} else {
+		_, _, err := assignmentStudent(db, userID, assignmentID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+			return
+		} else if err != nil {
+			log.Printf("Error checking assignment access: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	code := models.CodeAssignment{AssignmentID: assignmentID, TestCases: []models.CodeTestCase{}}
+	err = db.QueryRow(`
+		SELECT language, time_limit_ms, memory_limit_mb FROM code_assignment
+		WHERE assignment_id = ? AND archive_delete_flag = TRUE`, assignmentID).
+		Scan(&code.Language, &code.TimeLimitMS, &code.MemoryLimitMB)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment is not a code assignment"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying code assignment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch code assignment"})
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT test_id, name, input, expected_output, points, is_hidden FROM code_test_case
+		WHERE assignment_id = ? AND archive_delete_flag = TRUE
+		ORDER BY position, test_id`, assignmentID)
+	if err != nil {
+		log.Printf("Error querying test cases: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch test cases"})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.CodeTestCase
+		if err := rows.Scan(&t.TestID, &t.Name, &t.Input, &t.ExpectedOutput, &t.Points, &t.IsHidden); err != nil {
+			log.Printf("Error scanning test case: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process test cases"})
+			return
+		}
+		if t.IsHidden && role != "teacher" {
+			t.Input, t.ExpectedOutput = nil, nil
+		}
+		code.TestCases = append(code.TestCases, t)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code_assignment": code})
+}
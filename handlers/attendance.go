@@ -0,0 +1,697 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/models"
+)
+
+// Attendance statuses
+const (
+	attendancePresent = "present"
+	attendanceAbsent  = "absent"
+	attendanceLate    = "late"
+	attendanceExcused = "excused"
+)
+
+var attendanceStatuses = map[string]bool{
+	attendancePresent: true,
+	attendanceAbsent:  true,
+	attendanceLate:    true,
+	attendanceExcused: true,
+}
+
+// checkInAlphabet leaves out characters that are easily confused when read off a projector
+const checkInAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// checkInCodeLength is the number of characters in a self check-in code
+const checkInCodeLength = 6
+
+// maxCheckInMinutes caps how long a check-in code stays valid
+const maxCheckInMinutes = 120
+
+// ClassSessionRequest is the request body for creating or updating a class session
+type ClassSessionRequest struct {
+	SessionDate string  `json:"session_date" binding:"required"` // YYYY-MM-DD
+	Topic       *string `json:"topic"`
+}
+
+// AttendanceEntry is one student's status in a bulk attendance update
+type AttendanceEntry struct {
+	StudentID int     `json:"student_id" binding:"required"`
+	Status    string  `json:"status" binding:"required"`
+	Note      *string `json:"note"`
+}
+
+// MarkAttendanceRequest is the request body for marking attendance in bulk
+type MarkAttendanceRequest struct {
+	Records []AttendanceEntry `json:"records" binding:"dive"`
+	// Applied to every enrolled student who is neither in records nor already marked, e.g. "absent" at the end of class
+	UnmarkedStatus *string `json:"unmarked_status"`
+}
+
+// CheckInCodeRequest is the request body for opening self check-in
+type CheckInCodeRequest struct {
+	ExpiresInMinutes int `json:"expires_in_minutes"` // Defaults to 10
+}
+
+// CheckInRequest is the request body for a student checking in
+type CheckInRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// classroomStudent resolves the calling student and checks they are enrolled in the classroom.
+// It returns sql.ErrNoRows when they are not.
+func classroomStudent(db *sql.DB, userID interface{}, courseID int) (int, error) {
+	var studentID int
+	err := db.QueryRow(`
+		SELECT s.student_id
+		FROM student s
+		JOIN user u ON s.user_id = u.user_id
+		JOIN enrollment e ON e.student_id = s.student_id AND e.archive_delete_flag = TRUE
+		JOIN classroom c ON e.course_id = c.course_id AND c.org_id = u.org_id
+		WHERE s.user_id = ? AND s.archive_delete_flag = TRUE
+		AND c.course_id = ? AND c.archive_delete_flag = TRUE`, userID, courseID).Scan(&studentID)
+	return studentID, err
+}
+
+// newCheckInCode returns a random code from checkInAlphabet
+func newCheckInCode() (string, error) {
+	code := make([]byte, checkInCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(checkInAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = checkInAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// attendanceSummaries counts the attendance of a student over the past sessions of each of their classrooms, keyed
+// by course ID. courseID limits the summary to one classroom when it is non-zero.
+func attendanceSummaries(db *sql.DB, studentID, courseID int) (map[int]*models.AttendanceSummary, error) {
+	query := `
+		SELECT cs.course_id, COUNT(*),
+		COALESCE(SUM(a.status = 'present'), 0), COALESCE(SUM(a.status = 'late'), 0),
+		COALESCE(SUM(a.status = 'absent'), 0), COALESCE(SUM(a.status = 'excused'), 0)
+		FROM class_session cs
+		JOIN enrollment e ON e.course_id = cs.course_id AND e.student_id = ? AND e.archive_delete_flag = TRUE
+		LEFT JOIN attendance a ON a.session_id = cs.session_id AND a.student_id = e.student_id
+		WHERE cs.archive_delete_flag = TRUE AND cs.session_date <= CURDATE()`
+	args := []interface{}{studentID}
+	if courseID != 0 {
+		query += ` AND cs.course_id = ?`
+		args = append(args, courseID)
+	}
+	rows, err := db.Query(query+` GROUP BY cs.course_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := map[int]*models.AttendanceSummary{}
+	for rows.Next() {
+		var id int
+		s := &models.AttendanceSummary{}
+		if err := rows.Scan(&id, &s.Sessions, &s.Present, &s.Late, &s.Absent, &s.Excused); err != nil {
+			return nil, err
+		}
+		s.Unmarked = s.Sessions - s.Present - s.Late - s.Absent - s.Excused
+		if counted := s.Present + s.Late + s.Absent; counted > 0 {
+			rate := float64(s.Present+s.Late) / float64(counted)
+			s.AttendanceRate = &rate
+		}
+		summaries[id] = s
+	}
+	return summaries, rows.Err()
+}
+
+// CreateClassSessionHandler adds a session to a classroom
+func CreateClassSessionHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	var req ClassSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	sessionDate, err := parseDate(&req.SessionDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session_date format, expected YYYY-MM-DD"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "classroom", courseID, permEditContent); !ok {
+		return
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO class_session (course_id, session_date, topic, created_at, archive_delete_flag)
+		VALUES (?, ?, ?, NOW(), TRUE)`, courseID, sessionDate, req.Topic)
+	if err != nil {
+		log.Printf("Error creating class session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	sessionID, _ := result.LastInsertId()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Session created successfully",
+		"session": models.ClassSession{
+			SessionID:   int(sessionID),
+			CourseID:    courseID,
+			SessionDate: *sessionDate,
+			Topic:       req.Topic,
+			CreatedAt:   time.Now(),
+		},
+	})
+}
+
+// GetClassSessionsHandler lists the sessions of a classroom, oldest first. Staff get attendance counts per status;
+// students get their own status for each session.
+func GetClassSessionsHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if role == "teacher" {
+		if _, ok := authorizeStaffAccess(c, db, "classroom", courseID, permViewClassroom); !ok {
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT cs.session_id, cs.course_id, cs.session_date, cs.topic, cs.check_in_expires_at, cs.created_at,
+			COALESCE(SUM(a.status = 'present'), 0), COALESCE(SUM(a.status = 'late'), 0),
+			COALESCE(SUM(a.status = 'absent'), 0), COALESCE(SUM(a.status = 'excused'), 0)
+			FROM class_session cs
+			LEFT JOIN attendance a ON a.session_id = cs.session_id
+			WHERE cs.course_id = ? AND cs.archive_delete_flag = TRUE
+			GROUP BY cs.session_id, cs.course_id, cs.session_date, cs.topic, cs.check_in_expires_at, cs.created_at
+			ORDER BY cs.session_date, cs.session_id`, courseID)
+		if err != nil {
+			log.Printf("Error querying class sessions: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+			return
+		}
+		defer rows.Close()
+
+		sessions := []gin.H{}
+		for rows.Next() {
+			var s models.ClassSession
+			var present, late, absent, excused int
+			if err := rows.Scan(&s.SessionID, &s.CourseID, &s.SessionDate, &s.Topic, &s.CheckInExpiresAt, &s.CreatedAt,
+				&present, &late, &absent, &excused); err != nil {
+				log.Printf("Error scanning class session: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process sessions"})
+				return
+			}
+			sessions = append(sessions, gin.H{
+				"session": s,
+				"counts": gin.H{
+					attendancePresent: present,
+					attendanceLate:    late,
+					attendanceAbsent:  absent,
+					attendanceExcused: excused,
+				},
+			})
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error iterating class sessions: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+		return
+	}
+
+	studentID, err := classroomStudent(db, userID, courseID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not enrolled in this classroom"})
+		return
+	} else if err != nil {
+		log.Printf("Error checking enrollment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT cs.session_id, cs.course_id, cs.session_date, cs.topic, cs.created_at, a.status
+		FROM class_session cs
+		LEFT JOIN attendance a ON a.session_id = cs.session_id AND a.student_id = ?
+		WHERE cs.course_id = ? AND cs.archive_delete_flag = TRUE
+		ORDER BY cs.session_date, cs.session_id`, studentID, courseID)
+	if err != nil {
+		log.Printf("Error querying class sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+	defer rows.Close()
+
+	sessions := []models.ClassSession{}
+	for rows.Next() {
+		var s models.ClassSession
+		if err := rows.Scan(&s.SessionID, &s.CourseID, &s.SessionDate, &s.Topic, &s.CreatedAt, &s.Attendance); err != nil {
+			log.Printf("Error scanning class session: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process sessions"})
+			return
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating class sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	summaries, err := attendanceSummaries(db, studentID, courseID)
+	if err != nil {
+		log.Printf("Error querying attendance summary: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance summary"})
+		return
+	}
+	summary := summaries[courseID]
+	if summary == nil {
+		summary = &models.AttendanceSummary{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions, "summary": summary})
+}
+
+// UpdateClassSessionHandler changes the date or topic of a session
+func UpdateClassSessionHandler(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	var req ClassSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	sessionDate, err := parseDate(&req.SessionDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session_date format, expected YYYY-MM-DD"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "session", sessionID, permEditContent); !ok {
+		return
+	}
+
+	_, err = db.Exec(`
+		UPDATE class_session SET session_date = ?, topic = ?
+		WHERE session_id = ? AND archive_delete_flag = TRUE`, sessionDate, req.Topic, sessionID)
+	if err != nil {
+		log.Printf("Error updating class session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Session updated successfully",
+		"session_id":   sessionID,
+		"session_date": req.SessionDate,
+		"topic":        req.Topic,
+	})
+}
+
+// DeleteClassSessionHandler removes a session; its attendance no longer counts towards summaries
+func DeleteClassSessionHandler(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "session", sessionID, permEditContent); !ok {
+		return
+	}
+
+	_, err = db.Exec(`
+		UPDATE class_session SET archive_delete_flag = FALSE, check_in_code = NULL, check_in_expires_at = NULL
+		WHERE session_id = ?`, sessionID)
+	if err != nil {
+		log.Printf("Error deleting class session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session deleted successfully"})
+}
+
+// GetSessionAttendanceHandler returns the roster of a session with each active student's status
+func GetSessionAttendanceHandler(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "session", sessionID, permViewClassroom); !ok {
+		return
+	}
+
+	// Students who have left the classroom still appear if they were marked before leaving
+	rows, err := db.Query(`
+		SELECT st.student_id, u.name, a.status, a.note, a.checked_in_at
+		FROM class_session cs
+		JOIN enrollment e ON e.course_id = cs.course_id
+		JOIN student st ON e.student_id = st.student_id
+		JOIN user u ON st.user_id = u.user_id
+		LEFT JOIN attendance a ON a.session_id = cs.session_id AND a.student_id = st.student_id
+		WHERE cs.session_id = ? AND st.archive_delete_flag = TRUE
+		AND ((e.status = 'active' AND e.archive_delete_flag = TRUE) OR a.status IS NOT NULL)
+		ORDER BY u.name`, sessionID)
+	if err != nil {
+		log.Printf("Error querying attendance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance"})
+		return
+	}
+	defer rows.Close()
+
+	records := []models.AttendanceRecord{}
+	for rows.Next() {
+		r := models.AttendanceRecord{SessionID: sessionID}
+		if err := rows.Scan(&r.StudentID, &r.Name, &r.Status, &r.Note, &r.CheckedInAt); err != nil {
+			log.Printf("Error scanning attendance: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process attendance"})
+			return
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating attendance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"session_id": sessionID, "attendance": records})
+}
+
+// MarkAttendanceHandler sets the attendance of many students at once
+func MarkAttendanceHandler(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	var req MarkAttendanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if len(req.Records) == 0 && req.UnmarkedStatus == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "records or unmarked_status is required"})
+		return
+	}
+	for _, r := range req.Records {
+		if !attendanceStatuses[r.Status] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status " + strconv.Quote(r.Status) + ", expected present, absent, late or excused"})
+			return
+		}
+	}
+	if req.UnmarkedStatus != nil && !attendanceStatuses[*req.UnmarkedStatus] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid unmarked_status, expected present, absent, late or excused"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "session", sessionID, permGrade); !ok {
+		return
+	}
+
+	var courseID int
+	err = db.QueryRow(`
+		SELECT course_id FROM class_session
+		WHERE session_id = ? AND archive_delete_flag = TRUE`, sessionID).Scan(&courseID)
+	if err != nil {
+		log.Printf("Error querying class session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch session"})
+		return
+	}
+
+	for _, r := range req.Records {
+		var enrolled bool
+		err = db.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM enrollment
+				WHERE student_id = ? AND course_id = ? AND status = 'active' AND archive_delete_flag = TRUE
+			)`, r.StudentID, courseID).Scan(&enrolled)
+		if err != nil {
+			log.Printf("Error checking enrollment: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !enrolled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Student " + strconv.Itoa(r.StudentID) + " is not enrolled in this classroom"})
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	for _, r := range req.Records {
+		_, err = tx.Exec(`
+			INSERT INTO attendance (session_id, student_id, status, note)
+			VALUES (?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE status = VALUES(status), note = VALUES(note)`,
+			sessionID, r.StudentID, r.Status, r.Note)
+		if err != nil {
+			log.Printf("Error saving attendance: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attendance"})
+			return
+		}
+	}
+
+	filled := int64(0)
+	if req.UnmarkedStatus != nil {
+		result, err := tx.Exec(`
+			INSERT INTO attendance (session_id, student_id, status)
+			SELECT ?, e.student_id, ? FROM enrollment e
+			JOIN student st ON e.student_id = st.student_id
+			WHERE e.course_id = ? AND e.status = 'active' AND e.archive_delete_flag = TRUE
+			AND st.archive_delete_flag = TRUE
+			AND NOT EXISTS (SELECT 1 FROM attendance a WHERE a.session_id = ? AND a.student_id = e.student_id)`,
+			sessionID, *req.UnmarkedStatus, courseID, sessionID)
+		if err != nil {
+			log.Printf("Error filling unmarked attendance: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attendance"})
+			return
+		}
+		filled, _ = result.RowsAffected()
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Attendance saved successfully",
+		"session_id":       sessionID,
+		"marked":           len(req.Records),
+		"unmarked_updated": filled,
+	})
+}
+
+// OpenCheckInHandler generates a short-lived code students can use to mark themselves present.
+// A new code replaces any earlier one for the session.
+func OpenCheckInHandler(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	var req CheckInCodeRequest
+	// The body is optional
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if req.ExpiresInMinutes == 0 {
+		req.ExpiresInMinutes = 10
+	}
+	if req.ExpiresInMinutes < 0 || req.ExpiresInMinutes > maxCheckInMinutes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_minutes must be between 1 and " + strconv.Itoa(maxCheckInMinutes)})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "session", sessionID, permGrade); !ok {
+		return
+	}
+
+	code, err := newCheckInCode()
+	if err != nil {
+		log.Printf("Error generating check-in code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate check-in code"})
+		return
+	}
+	expiresAt := time.Now().Add(time.Duration(req.ExpiresInMinutes) * time.Minute)
+
+	_, err = db.Exec(`
+		UPDATE class_session SET check_in_code = ?, check_in_expires_at = ?
+		WHERE session_id = ? AND archive_delete_flag = TRUE`, code, expiresAt, sessionID)
+	if err != nil {
+		log.Printf("Error saving check-in code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open check-in"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session_id": sessionID,
+		"code":       code,
+		"expires_at": expiresAt,
+	})
+}
+
+// CloseCheckInHandler invalidates the check-in code of a session before it expires
+func CloseCheckInHandler(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "session", sessionID, permGrade); !ok {
+		return
+	}
+
+	_, err = db.Exec(`
+		UPDATE class_session SET check_in_code = NULL, check_in_expires_at = NULL
+		WHERE session_id = ?`, sessionID)
+	if err != nil {
+		log.Printf("Error closing check-in: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close check-in"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Check-in closed"})
+}
+
+// CheckInHandler marks the calling student present using the session's current check-in code.
+// A status already set by staff, such as excused, is not overwritten.
+func CheckInHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	if role != "student" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only students can check in"})
+		return
+	}
+
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	var req CheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	var courseID int
+	var code sql.NullString
+	var expiresAt sql.NullTime
+	err = db.QueryRow(`
+		SELECT course_id, check_in_code, check_in_expires_at FROM class_session
+		WHERE session_id = ? AND archive_delete_flag = TRUE`, sessionID).Scan(&courseID, &code, &expiresAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying class session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch session"})
+		return
+	}
+
+	studentID, err := classroomStudent(db, userID, courseID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error checking enrollment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if !requireWritableClassroom(c, db, "session", sessionID) {
+		return
+	}
+
+	if !code.Valid || !expiresAt.Valid || time.Now().After(expiresAt.Time) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Check-in is not open for this session"})
+		return
+	}
+	if !strings.EqualFold(strings.TrimSpace(req.Code), code.String) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid check-in code"})
+		return
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO attendance (session_id, student_id, status, checked_in_at)
+		VALUES (?, ?, 'present', NOW())
+		ON DUPLICATE KEY UPDATE checked_in_at = NOW(),
+		status = IF(status = 'absent', 'present', status)`, sessionID, studentID)
+	if err != nil {
+		log.Printf("Error saving check-in: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in"})
+		return
+	}
+
+	var status string
+	err = db.QueryRow(`
+		SELECT status FROM attendance
+		WHERE session_id = ? AND student_id = ?`, sessionID, studentID).Scan(&status)
+	if err != nil {
+		log.Printf("Error querying attendance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Checked in successfully",
+		"session_id": sessionID,
+		"status":     status,
+	})
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/models"
+	"edusync/utils"
+)
+
+// defaultCalendarDays is the range returned when no end date is given
+const defaultCalendarDays = 30
+
+// maxCalendarDays caps the range of a single calendar request
+const maxCalendarDays = 366
+
+// calendarFeedPast and calendarFeedFuture bound the events included in the subscribable feed
+const (
+	calendarFeedPast   = 90 * 24 * time.Hour
+	calendarFeedFuture = 365 * 24 * time.Hour
+)
+
+// accessibleCourses lists the classrooms the user teaches or is enrolled in, skipping deleted ones
+func accessibleCourses(db *sql.DB, userID interface{}, role string) ([]int, error) {
+	query := `
+		SELECT e.course_id FROM enrollment e
+		JOIN student s ON e.student_id = s.student_id
+		JOIN user u ON s.user_id = u.user_id
+		JOIN classroom c ON e.course_id = c.course_id AND c.org_id = u.org_id
+		WHERE s.user_id = ? AND s.archive_delete_flag = TRUE
+		AND e.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE`
+	if role == "teacher" {
+		query = `
+			SELECT cs.course_id FROM classroom_staff cs
+			JOIN classroom c ON cs.course_id = c.course_id` + staffInOrg + `
+			WHERE t.user_id = ? AND t.archive_delete_flag = TRUE AND cs.status = 'active'
+			AND cs.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE`
+	}
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var courseIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		courseIDs = append(courseIDs, id)
+	}
+	return courseIDs, rows.Err()
+}
+
+// calendarEvents collects the events of the user's classrooms that fall within [from, to).
+// Students only see assignments that have been published.
+func calendarEvents(db *sql.DB, userID interface{}, role string, from, to time.Time) ([]models.CalendarEvent, error) {
+	events := []models.CalendarEvent{}
+	courseIDs, err := accessibleCourses(db, userID, role)
+	if err != nil || len(courseIDs) == 0 {
+		return events, err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(courseIDs)), ",")
+	inCourses := func(extra ...interface{}) []interface{} {
+		args := make([]interface{}, 0, len(courseIDs)+len(extra))
+		for _, id := range courseIDs {
+			args = append(args, id)
+		}
+		return append(args, extra...)
+	}
+	visible := ""
+	if role != "teacher" {
+		visible = ` AND ` + visibleToStudents("a")
+	}
+
+	// Each query yields source ID, course ID, course title, event title and start time
+	sources := []struct {
+		kind   string
+		allDay bool
+		query  string
+	}{
+		{"assignment_due", false, `
+			SELECT a.assignment_id, a.course_id, c.title, a.title, a.due_date
+			FROM assignment a
+			JOIN classroom c ON a.course_id = c.course_id
+			WHERE a.course_id IN (` + placeholders + `) AND a.archive_delete_flag = TRUE` + visible + `
+			AND a.due_date >= ? AND a.due_date < ?`},
+		{"peer_review_due", false, `
+			SELECT a.assignment_id, a.course_id, c.title, CONCAT('Peer reviews: ', a.title), p.review_due_date
+			FROM peer_review_settings p
+			JOIN assignment a ON p.assignment_id = a.assignment_id
+			JOIN classroom c ON a.course_id = c.course_id
+			WHERE a.course_id IN (` + placeholders + `) AND a.archive_delete_flag = TRUE` + visible + `
+			AND p.archive_delete_flag = TRUE AND p.review_due_date >= ? AND p.review_due_date < ?`},
+		{"class_session", true, `
+			SELECT s.session_id, s.course_id, c.title, COALESCE(s.topic, c.title), s.session_date
+			FROM class_session s
+			JOIN classroom c ON s.course_id = c.course_id
+			WHERE s.course_id IN (` + placeholders + `) AND s.archive_delete_flag = TRUE
+			AND s.session_date >= DATE(?) AND s.session_date < ?`},
+		{"classroom_start", true, `
+			SELECT c.course_id, c.course_id, c.title, CONCAT(c.title, ' starts'), c.start_date
+			FROM classroom c
+			WHERE c.course_id IN (` + placeholders + `) AND c.start_date >= DATE(?) AND c.start_date < ?`},
+		{"classroom_end", true, `
+			SELECT c.course_id, c.course_id, c.title, CONCAT(c.title, ' ends'), c.end_date
+			FROM classroom c
+			WHERE c.course_id IN (` + placeholders + `) AND c.end_date >= DATE(?) AND c.end_date < ?`},
+	}
+
+	for _, source := range sources {
+		rows, err := db.Query(source.query, inCourses(from, to)...)
+		if err != nil {
+			return nil, fmt.Errorf("querying %s events: %w", source.kind, err)
+		}
+		for rows.Next() {
+			e := models.CalendarEvent{Type: source.kind, AllDay: source.allDay}
+			if err := rows.Scan(&e.SourceID, &e.CourseID, &e.CourseTitle, &e.Title, &e.Start); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			e.UID = fmt.Sprintf("%s-%d", strings.ReplaceAll(source.kind, "_", "-"), e.SourceID)
+			if e.AllDay {
+				end := e.Start.AddDate(0, 0, 1)
+				e.End = &end
+			}
+			events = append(events, e)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Start.Before(events[j].Start) })
+	return events, nil
+}
+
+// GetCalendarHandler returns the events of every classroom the user teaches or is enrolled in.
+// from and to are inclusive dates (YYYY-MM-DD); the range defaults to the next 30 days.
+func GetCalendarHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+
+	from := time.Now().UTC().Truncate(24 * time.Hour)
+	if v := c.Query("from"); v != "" {
+		parsed, err := parseDate(&v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from format, expected YYYY-MM-DD"})
+			return
+		}
+		from = *parsed
+	}
+	to := from.AddDate(0, 0, defaultCalendarDays-1)
+	if v := c.Query("to"); v != "" {
+		parsed, err := parseDate(&v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to format, expected YYYY-MM-DD"})
+			return
+		}
+		to = *parsed
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return
+	}
+	if to.Sub(from) >= maxCalendarDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("The range may span at most %d days", maxCalendarDays)})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	roleName, _ := role.(string)
+	events, err := calendarEvents(db, userID, roleName, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		log.Printf("Error querying calendar events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch calendar"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":   from.Format("2006-01-02"),
+		"to":     to.Format("2006-01-02"),
+		"events": events,
+	})
+}
+
+// CreateCalendarFeedHandler issues a new secret feed URL for the user, revoking any previous one.
+// The token is only shown once; it is stored hashed.
+func CreateCalendarFeedHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	token, err := utils.GenerateToken(32)
+	if err != nil {
+		log.Printf("Error generating calendar token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create calendar feed"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	_, err = db.Exec(`
+		INSERT INTO calendar_feed (user_id, token_hash, created_at)
+		VALUES (?, ?, NOW())
+		ON DUPLICATE KEY UPDATE token_hash = VALUES(token_hash), created_at = NOW(), last_accessed_at = NULL`,
+		userID, utils.HashToken(token))
+	if err != nil {
+		log.Printf("Error saving calendar token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create calendar feed"})
+		return
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	path := "/api/calendar/feed/" + token + ".ics"
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Calendar feed created; previous feed URLs no longer work",
+		"feed_url": scheme + "://" + c.Request.Host + path,
+		"path":     path,
+	})
+}
+
+// DeleteCalendarFeedHandler revokes the user's feed URL
+func DeleteCalendarFeedHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, err := db.Exec(`DELETE FROM calendar_feed WHERE user_id = ?`, userID); err != nil {
+		log.Printf("Error deleting calendar token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke calendar feed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar feed revoked"})
+}
+
+// CalendarFeedHandler serves the user's events as iCalendar. It is public: the secret token in the URL
+// identifies the user so calendar apps can subscribe without a JWT.
+func CalendarFeedHandler(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	db := c.MustGet("db").(*sql.DB)
+	var userID int
+	var role string
+	err := db.QueryRow(`
+		SELECT u.user_id, u.role FROM calendar_feed f
+		JOIN user u ON f.user_id = u.user_id
+		WHERE f.token_hash = ? AND u.archive_delete_flag = TRUE`, utils.HashToken(token)).Scan(&userID, &role)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "Calendar feed not found")
+		return
+	} else if err != nil {
+		log.Printf("Error querying calendar feed: %v", err)
+		c.String(http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	now := time.Now().UTC()
+	events, err := calendarEvents(db, userID, role, now.Add(-calendarFeedPast), now.Add(calendarFeedFuture))
+	if err != nil {
+		log.Printf("Error querying calendar events: %v", err)
+		c.String(http.StatusInternalServerError, "Failed to build calendar")
+		return
+	}
+
+	if _, err := db.Exec(`UPDATE calendar_feed SET last_accessed_at = NOW() WHERE user_id = ?`, userID); err != nil {
+		log.Printf("Error recording calendar feed access: %v", err)
+	}
+
+	c.Header("Cache-Control", "private, max-age=900")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(renderICS(events, now)))
+}
+
+// renderICS formats events as an RFC 5545 calendar
+func renderICS(events []models.CalendarEvent, stamp time.Time) string {
+	var b strings.Builder
+	line := func(s string) { b.WriteString(foldICSLine(s)) }
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//EduSync//Calendar//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:EduSync")
+	for _, e := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + e.UID + "@edusync")
+		line("DTSTAMP:" + stamp.UTC().Format("20060102T150405Z"))
+		if e.AllDay {
+			line("DTSTART;VALUE=DATE:" + e.Start.Format("20060102"))
+			line("DTEND;VALUE=DATE:" + e.End.Format("20060102"))
+		} else {
+			line("DTSTART:" + e.Start.UTC().Format("20060102T150405Z"))
+		}
+		line("SUMMARY:" + escapeICSText(e.Title))
+		line("DESCRIPTION:" + escapeICSText(e.CourseTitle))
+		line("CATEGORIES:" + strings.ToUpper(e.Type))
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+// escapeICSText escapes the characters with special meaning in iCalendar text values
+func escapeICSText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// foldICSLine terminates a content line with CRLF, folding it so no physical line exceeds 75 octets
+// and no UTF-8 character is split
+func foldICSLine(s string) string {
+	var b strings.Builder
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space, which counts towards their length
+		limit = 74
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+	return b.String()
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/models"
+)
+
+// catalogListSpec is the sorting and filtering of the classroom catalog. from and to keep classrooms whose dates
+// overlap the range; classrooms without dates are open-ended.
+var catalogListSpec = listSpec{
+	Sorts: map[string]listColumn{
+		"title":      {Expr: "c.title", Kind: kindString},
+		"start_date": {Expr: "COALESCE(c.start_date, TIMESTAMP '1970-01-01 00:00:00')", Kind: kindTime},
+	},
+	DefaultSort: "title",
+	ID:          "c.course_id",
+	Filters: map[string]listFilter{
+		"q":            {Expr: "c.title", Kind: kindString, Op: "LIKE"},
+		"subject_area": {Expr: "c.subject_area", Kind: kindString},
+		"teacher":      {Expr: "u.name", Kind: kindString, Op: "LIKE"},
+		"from":         {Expr: "COALESCE(c.end_date, DATE '9999-12-31')", Kind: kindTime, Op: ">="},
+		"to":           {Expr: "COALESCE(c.start_date, DATE '1000-01-01')", Kind: kindTime, Op: "<="},
+	},
+}
+
+// GetCatalogHandler lists the classrooms of the caller's organization that their teachers have put in the catalog,
+// with how many places are taken. Archived classrooms are left out.
+func GetCatalogHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	orgID, _ := c.Get("orgID")
+
+	page, err := parseListPage(c, catalogListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	rows, err := db.Query(`
+		SELECT c.course_id, c.title, c.description, c.start_date, c.end_date, c.subject_area, u.name,
+		(SELECT COUNT(*) FROM enrollment e
+			WHERE e.course_id = c.course_id AND e.status = 'active' AND e.archive_delete_flag = TRUE),
+		c.capacity,
+		EXISTS (
+			SELECT 1 FROM enrollment e
+			JOIN student s ON e.student_id = s.student_id
+			WHERE e.course_id = c.course_id AND s.user_id = ? AND e.archive_delete_flag = TRUE
+		)`+page.Select()+`
+		FROM classroom c
+		JOIN teacher t ON c.teacher_id = t.teacher_id
+		JOIN user u ON t.user_id = u.user_id
+		WHERE c.org_id = ? AND c.is_listed = TRUE AND c.is_archived = FALSE AND c.archive_delete_flag = TRUE`+
+		page.Where()+page.OrderLimit(),
+		append([]interface{}{userID, orgID}, page.Args()...)...)
+	if err != nil {
+		log.Printf("Error querying catalog: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.CatalogEntry{}
+	for rows.Next() && page.Next() {
+		var e models.CatalogEntry
+		if err := rows.Scan(page.Dest(&e.CourseID, &e.Title, &e.Description, &e.StartDate, &e.EndDate, &e.SubjectArea,
+			&e.TeacherName, &e.Enrolled, &e.Capacity, &e.IsEnrolled)...); err != nil {
+			log.Printf("Error scanning catalog entry: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process catalog"})
+			return
+		}
+		e.IsFull = e.Capacity != nil && e.Enrolled >= *e.Capacity
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating catalog: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	page.SetNextCursor(c)
+	c.JSON(http.StatusOK, entries)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
@@ -19,6 +20,8 @@ type ClassroomRequest struct {
 	StartDate   *string `json:"start_date"`
 	EndDate     *string `json:"end_date"`
 	SubjectArea *string `json:"subject_area"`
+	IsListed    *bool   `json:"is_listed"` // Left unchanged when omitted on update
+	Capacity    *int    `json:"capacity"`  // Null for no enrollment limit
 }
 
 // parseDate converts a date string (YYYY-MM-DD) to time.Time
@@ -33,10 +36,19 @@ func parseDate(dateStr *string) (*time.Time, error) {
 	return &parsed, nil
 }
 
+// enrolledStudentsFrom selects the students enrolled in a classroom, aliasing enrollment e, student s and user u.
+// Bind the course ID.
+const enrolledStudentsFrom = `
+		FROM enrollment e
+		JOIN student s ON e.student_id = s.student_id
+		JOIN user u ON s.user_id = u.user_id
+		WHERE e.course_id = ? AND e.archive_delete_flag = TRUE AND s.archive_delete_flag = TRUE AND u.archive_delete_flag = TRUE`
+
 // CreateClassroomHandler creates a new classroom
 func CreateClassroomHandler(c *gin.Context) {
 	userID, _ := c.Get("userID")
 	role, _ := c.Get("role")
+	orgID, _ := c.Get("orgID")
 	if role != "teacher" {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Only teachers can create classrooms"})
 		return
@@ -59,6 +71,10 @@ func CreateClassroomHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format, expected YYYY-MM-DD"})
 		return
 	}
+	if req.Capacity != nil && *req.Capacity < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "capacity must be at least 1"})
+		return
+	}
 
 	// Map to models.Classroom
 	classroom := models.Classroom{
@@ -67,6 +83,7 @@ func CreateClassroomHandler(c *gin.Context) {
 		StartDate:   startDate,
 		EndDate:     endDate,
 		SubjectArea: req.SubjectArea,
+		Capacity:    req.Capacity,
 	}
 
 	db := c.MustGet("db").(*sql.DB)
@@ -83,10 +100,19 @@ func CreateClassroomHandler(c *gin.Context) {
 	// Log the current time for debugging
 	log.Printf("Creating classroom at %v", time.Now())
 
-	result, err := db.Exec(`
-		INSERT INTO classroom (teacher_id, title, description, start_date, end_date, subject_area, archive_delete_flag)
-		VALUES (?, ?, ?, ?, ?, ?, TRUE)`,
-		teacherID, classroom.Title, classroom.Description, classroom.StartDate, classroom.EndDate, classroom.SubjectArea)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO classroom (org_id, teacher_id, title, description, start_date, end_date, subject_area, is_listed, capacity, archive_delete_flag)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, TRUE)`,
+		orgID, teacherID, classroom.Title, classroom.Description, classroom.StartDate, classroom.EndDate, classroom.SubjectArea,
+		req.IsListed != nil && *req.IsListed, classroom.Capacity)
 	if err != nil {
 		log.Printf("Error inserting classroom: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -94,6 +120,20 @@ func CreateClassroomHandler(c *gin.Context) {
 	}
 
 	courseID, _ := result.LastInsertId()
+
+	// The creating teacher is the classroom's owner
+	if err := addClassroomOwner(tx, courseID, teacherID); err != nil {
+		log.Printf("Error adding classroom owner: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"course_id": courseID,
 		"title":     classroom.Title,
@@ -132,6 +172,10 @@ func UpdateClassroomHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format, expected YYYY-MM-DD"})
 		return
 	}
+	if req.Capacity != nil && *req.Capacity < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "capacity must be at least 1"})
+		return
+	}
 
 	// Map to models.Classroom
 	classroom := models.Classroom{
@@ -140,6 +184,7 @@ func UpdateClassroomHandler(c *gin.Context) {
 		StartDate:   startDate,
 		EndDate:     endDate,
 		SubjectArea: req.SubjectArea,
+		Capacity:    req.Capacity,
 	}
 
 	db := c.MustGet("db").(*sql.DB)
@@ -154,12 +199,7 @@ func UpdateClassroomHandler(c *gin.Context) {
 	}
 
 	// Check if the teacher is authorized to update this classroom
-	var exists bool
-	err = db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 FROM classroom 
-			WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE
-		)`, courseID, teacherID).Scan(&exists)
+	exists, err := teacherCan(db, teacherID, courseID, permEditClassroom)
 	if err != nil {
 		log.Printf("Error checking classroom authorization: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -170,11 +210,17 @@ func UpdateClassroomHandler(c *gin.Context) {
 		return
 	}
 
+	if !requireWritableClassroom(c, db, "classroom", courseID) {
+		return
+	}
+
 	_, err = db.Exec(`
 		UPDATE classroom 
-		SET title = ?, description = ?, start_date = ?, end_date = ?, subject_area = ?
-		WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE`,
-		classroom.Title, classroom.Description, classroom.StartDate, classroom.EndDate, classroom.SubjectArea, courseID, teacherID)
+		SET title = ?, description = ?, start_date = ?, end_date = ?, subject_area = ?,
+		is_listed = COALESCE(?, is_listed), capacity = ?
+		WHERE course_id = ? AND archive_delete_flag = TRUE`,
+		classroom.Title, classroom.Description, classroom.StartDate, classroom.EndDate, classroom.SubjectArea,
+		req.IsListed, classroom.Capacity, courseID)
 	if err != nil {
 		log.Printf("Error updating classroom: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -214,12 +260,7 @@ func DeleteClassroomHandler(c *gin.Context) {
 	}
 
 	// Check if the teacher is authorized to delete this classroom
-	var exists bool
-	err = db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 FROM classroom 
-			WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE
-		)`, courseID, teacherID).Scan(&exists)
+	exists, err := teacherCan(db, teacherID, courseID, permDeleteClassroom)
 	if err != nil {
 		log.Printf("Error checking classroom authorization: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -233,8 +274,8 @@ func DeleteClassroomHandler(c *gin.Context) {
 	_, err = db.Exec(`
 		UPDATE classroom 
 		SET archive_delete_flag = FALSE 
-		WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE`,
-		courseID, teacherID)
+		WHERE course_id = ? AND archive_delete_flag = TRUE`,
+		courseID)
 	if err != nil {
 		log.Printf("Error deleting classroom: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -265,9 +306,12 @@ func GetTeacherClassroomsHandler(c *gin.Context) {
 	}
 
 	rows, err := db.Query(`
-		SELECT course_id, teacher_id, title, description, start_date, end_date, subject_area
-		FROM classroom 
-		WHERE teacher_id = ? AND archive_delete_flag = TRUE`, teacherID)
+		SELECT c.course_id, c.teacher_id, c.title, c.description, c.start_date, c.end_date, c.subject_area,
+		c.is_archived, c.archived_at, c.is_listed, c.capacity, cs.role
+		FROM classroom_staff cs
+		JOIN classroom c ON cs.course_id = c.course_id
+		WHERE cs.teacher_id = ? AND cs.status = 'active' AND cs.archive_delete_flag = TRUE
+		AND c.archive_delete_flag = TRUE`, teacherID)
 	if err != nil {
 		log.Printf("Error querying classrooms: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -278,7 +322,7 @@ func GetTeacherClassroomsHandler(c *gin.Context) {
 	var classrooms []models.Classroom
 	for rows.Next() {
 		var c models.Classroom
-		if err := rows.Scan(&c.CourseID, &c.TeacherID, &c.Title, &c.Description, &c.StartDate, &c.EndDate, &c.SubjectArea); err != nil {
+		if err := rows.Scan(&c.CourseID, &c.TeacherID, &c.Title, &c.Description, &c.StartDate, &c.EndDate, &c.SubjectArea, &c.IsArchived, &c.ArchivedAt, &c.IsListed, &c.Capacity, &c.StaffRole); err != nil {
 			log.Printf("Error scanning classroom: %v", err)
 			continue
 		}
@@ -335,12 +379,7 @@ func GetClassroomDetailsHandler(c *gin.Context) {
 		}
 
 		// Check if the teacher is authorized to view this classroom
-		var teacherAuthorized bool
-		err = db.QueryRow(`
-			SELECT EXISTS (
-				SELECT 1 FROM classroom 
-				WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE
-			)`, courseID, teacherID).Scan(&teacherAuthorized)
+		teacherAuthorized, err := teacherCan(db, teacherID, courseID, permViewClassroom)
 		if err != nil {
 			log.Printf("Error checking teacher authorization for course_id %d, teacher_id %d: %v", courseID, teacherID, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -353,12 +392,14 @@ func GetClassroomDetailsHandler(c *gin.Context) {
 		}
 
 		err = db.QueryRow(`
-			SELECT course_id, teacher_id, title, description, start_date, end_date, subject_area
+			SELECT course_id, teacher_id, title, description, start_date, end_date, subject_area, is_archived, archived_at,
+			is_listed, capacity
 			FROM classroom 
-			WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE`,
-			courseID, teacherID).Scan(
+			WHERE course_id = ? AND archive_delete_flag = TRUE`,
+			courseID).Scan(
 			&classroom.CourseID, &classroom.TeacherID, &classroom.Title, &classroom.Description,
-			&classroom.StartDate, &classroom.EndDate, &classroom.SubjectArea)
+			&classroom.StartDate, &classroom.EndDate, &classroom.SubjectArea, &classroom.IsArchived, &classroom.ArchivedAt,
+			&classroom.IsListed, &classroom.Capacity)
 		if err != nil {
 			log.Printf("Error querying classroom for course_id %d, teacher_id %d: %v", courseID, teacherID, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -394,11 +435,13 @@ func GetClassroomDetailsHandler(c *gin.Context) {
 		}
 
 		err = db.QueryRow(`
-			SELECT course_id, teacher_id, title, description, start_date, end_date, subject_area
+			SELECT course_id, teacher_id, title, description, start_date, end_date, subject_area, is_archived, archived_at,
+			is_listed, capacity
 			FROM classroom 
 			WHERE course_id = ? AND archive_delete_flag = TRUE`, courseID).Scan(
 			&classroom.CourseID, &classroom.TeacherID, &classroom.Title, &classroom.Description,
-			&classroom.StartDate, &classroom.EndDate, &classroom.SubjectArea)
+			&classroom.StartDate, &classroom.EndDate, &classroom.SubjectArea, &classroom.IsArchived, &classroom.ArchivedAt,
+			&classroom.IsListed, &classroom.Capacity)
 		if err != nil {
 			log.Printf("Error querying classroom for course_id %d (student role): %v", courseID, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -445,12 +488,7 @@ func GetEnrolledStudentsHandler(c *gin.Context) {
 	}
 
 	// Check if the teacher is authorized to view this classroom
-	exists = false
-	err = db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 FROM classroom 
-			WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE
-		)`, courseID, teacherID).Scan(&exists)
+	exists, err = teacherCan(db, teacherID, courseID, permViewClassroom)
 	if err != nil {
 		log.Printf("Error checking classroom authorization: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -462,11 +500,7 @@ func GetEnrolledStudentsHandler(c *gin.Context) {
 	}
 
 	rows, err := db.Query(`
-		SELECT e.enrollment_id, e.student_id, u.name, s.grade_level, s.enrollment_year
-		FROM enrollment e
-		JOIN student s ON e.student_id = s.student_id
-		JOIN user u ON s.user_id = u.user_id
-		WHERE e.course_id = ? AND e.archive_delete_flag = TRUE AND s.archive_delete_flag = TRUE AND u.archive_delete_flag = TRUE`, courseID)
+		SELECT e.enrollment_id, e.student_id, u.name, s.grade_level, s.enrollment_year`+enrolledStudentsFrom, courseID)
 	if err != nil {
 		log.Printf("Error querying enrolled students: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -532,12 +566,7 @@ func RemoveStudentFromClassroomHandler(c *gin.Context) {
 	}
 
 	// Check if the teacher is authorized to manage this classroom
-	exists = false
-	err = db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 FROM classroom 
-			WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE
-		)`, courseID, teacherID).Scan(&exists)
+	exists, err = teacherCan(db, teacherID, courseID, permManageStudents)
 	if err != nil {
 		log.Printf("Error checking classroom authorization: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -548,6 +577,10 @@ func RemoveStudentFromClassroomHandler(c *gin.Context) {
 		return
 	}
 
+	if !requireWritableClassroom(c, db, "classroom", courseID) {
+		return
+	}
+
 	// Check if the student is enrolled
 	var enrollmentExists bool
 	err = db.QueryRow(`
@@ -615,12 +648,7 @@ func GetStudentProfileHandler(c *gin.Context) {
 	}
 
 	// Check if the teacher is authorized to view this classroom
-	exists = false
-	err = db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 FROM classroom 
-			WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE
-		)`, courseID, teacherID).Scan(&exists)
+	exists, err = teacherCan(db, teacherID, courseID, permViewClassroom)
 	if err != nil {
 		log.Printf("Error checking classroom authorization: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -667,10 +695,348 @@ func GetStudentProfileHandler(c *gin.Context) {
 		return
 	}
 
+	summaries, err := attendanceSummaries(db, studentID, courseID)
+	if err != nil {
+		log.Printf("Error querying attendance summary: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	attendance := summaries[courseID]
+	if attendance == nil {
+		attendance = &models.AttendanceSummary{}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"student_id":      studentID,
 		"name":            name,
 		"grade_level":     gradeLevel.String,
 		"enrollment_year": enrollmentYear.Int64,
+		"attendance":      attendance,
+	})
+}
+
+// CloneClassroomRequest describes the new term for a cloned classroom
+type CloneClassroomRequest struct {
+	Title      *string `json:"title"`
+	StartDate  string  `json:"start_date" binding:"required"`
+	EndDate    *string `json:"end_date"`
+	OffsetDays *int    `json:"offset_days"` // Shift applied to assignment dates; defaults to the gap between start dates
+}
+
+// CloneClassroomHandler copies a classroom's content into a new classroom for another term
+func CloneClassroomHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	orgID, _ := c.Get("orgID")
+	if role != "teacher" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only teachers can clone classrooms"})
+		return
+	}
+
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	var req CloneClassroomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	startDate, err := parseDate(&req.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format, expected YYYY-MM-DD"})
+		return
+	}
+	endDate, err := parseDate(req.EndDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format, expected YYYY-MM-DD"})
+		return
+	}
+	if endDate != nil && endDate.Before(*startDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must not be before start_date"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	var teacherID int
+	err = db.QueryRow(`
+		SELECT teacher_id FROM teacher 
+		WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&teacherID)
+	if err != nil {
+		log.Printf("Error querying teacher: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Teacher not found"})
+		return
+	}
+
+	// Check if the teacher is authorized to clone this classroom
+	allowed, err := teacherCan(db, teacherID, courseID, permEditClassroom)
+	if err != nil {
+		log.Printf("Error checking classroom authorization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to clone this classroom"})
+		return
+	}
+
+	var source models.Classroom
+	err = db.QueryRow(`
+		SELECT course_id, teacher_id, title, description, start_date, end_date, subject_area
+		FROM classroom 
+		WHERE course_id = ? AND archive_delete_flag = TRUE`,
+		courseID).Scan(
+		&source.CourseID, &source.TeacherID, &source.Title, &source.Description,
+		&source.StartDate, &source.EndDate, &source.SubjectArea)
+	if err != nil {
+		log.Printf("Error querying classroom: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Work out how far to move assignment dates
+	var offset time.Duration
+	if req.OffsetDays != nil {
+		offset = time.Duration(*req.OffsetDays) * 24 * time.Hour
+	} else if source.StartDate != nil {
+		offset = startDate.Sub(*source.StartDate)
+	}
+
+	title := source.Title
+	if req.Title != nil && *req.Title != "" {
+		title = *req.Title
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO classroom (org_id, teacher_id, title, description, start_date, end_date, subject_area, cloned_from_course_id, archive_delete_flag)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, TRUE)`,
+		orgID, teacherID, title, source.Description, startDate, endDate, source.SubjectArea, courseID)
+	if err != nil {
+		log.Printf("Error inserting cloned classroom: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	newCourseID, _ := result.LastInsertId()
+
+	// The cloning teacher owns the new classroom; staff are not carried over
+	if err := addClassroomOwner(tx, newCourseID, teacherID); err != nil {
+		log.Printf("Error adding classroom owner: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Materials are copied as they are
+	result, err = tx.Exec(`
+		INSERT INTO material (course_id, title, type, file_path, uploaded_at, description, archive_delete_flag)
+		SELECT ?, title, type, file_path, NOW(), description, TRUE
+		FROM material 
+		WHERE course_id = ? AND archive_delete_flag = TRUE`, newCourseID, courseID)
+	if err != nil {
+		log.Printf("Error cloning materials: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	materialCount, _ := result.RowsAffected()
+
+	// Question banks come first so the cloned quizzes can draw from the copies
+	offsetSeconds := int64(offset / time.Second)
+	banks, err := cloneQuestionBanks(tx, courseID, newCourseID)
+	if err != nil {
+		log.Printf("Error cloning question banks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	assignmentCount, err := cloneAssignments(tx, courseID, newCourseID, offsetSeconds, banks)
+	if err != nil {
+		log.Printf("Error cloning assignments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Announcements come across as drafts for the teacher to review and publish
+	result, err = tx.Exec(`
+		INSERT INTO announcement (course_id, title, content, created_at, is_pinned, status, publish_at, archive_delete_flag)
+		SELECT ?, title, content, NOW(), is_pinned, 'draft', NULL, TRUE
+		FROM announcement 
+		WHERE course_id = ? AND archive_delete_flag = TRUE`, newCourseID, courseID)
+	if err != nil {
+		log.Printf("Error cloning announcements: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	announcementCount, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"course_id":             newCourseID,
+		"cloned_from_course_id": courseID,
+		"title":                 title,
+		"start_date":            startDate,
+		"end_date":              endDate,
+		"offset_days":           int64(offset / (24 * time.Hour)),
+		"materials_copied":      materialCount,
+		"assignments_copied":    assignmentCount,
+		"question_banks_copied": len(banks),
+		"announcements_copied":  announcementCount,
 	})
-}
\ No newline at end of file
+}
+
+// cloneQuestionBanks copies the question banks of a classroom, with their questions, into another. It returns the
+// new bank ID of each copied bank.
+func cloneQuestionBanks(tx *sql.Tx, fromCourseID int, toCourseID int64) (map[int]int64, error) {
+	rows, err := tx.Query(`
+		SELECT bank_id FROM question_bank
+		WHERE course_id = ? AND archive_delete_flag = TRUE
+		ORDER BY bank_id`, fromCourseID)
+	if err != nil {
+		return nil, err
+	}
+	var bankIDs []int
+	for rows.Next() {
+		var bankID int
+		if err := rows.Scan(&bankID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		bankIDs = append(bankIDs, bankID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	banks := map[int]int64{}
+	for _, bankID := range bankIDs {
+		result, err := tx.Exec(`
+			INSERT INTO question_bank (course_id, title, created_at, archive_delete_flag)
+			SELECT ?, title, NOW(), TRUE
+			FROM question_bank
+			WHERE bank_id = ?`, toCourseID, bankID)
+		if err != nil {
+			return nil, err
+		}
+		newBankID, _ := result.LastInsertId()
+		_, err = tx.Exec(`
+			INSERT INTO quiz_question (bank_id, question_type, prompt, options, correct_answer, tolerance, points, created_at, archive_delete_flag)
+			SELECT ?, question_type, prompt, options, correct_answer, tolerance, points, NOW(), TRUE
+			FROM quiz_question
+			WHERE bank_id = ? AND archive_delete_flag = TRUE
+			ORDER BY question_id`, newBankID, bankID)
+		if err != nil {
+			return nil, err
+		}
+		banks[bankID] = newBankID
+	}
+	return banks, nil
+}
+
+// cloneAssignments copies the assignments of a classroom into another, with their quiz, autograder and peer review
+// setup. Publication state is kept and dates are shifted by offsetSeconds; quizzes draw from the copied banks.
+// It returns the number of assignments copied.
+func cloneAssignments(tx *sql.Tx, fromCourseID int, toCourseID, offsetSeconds int64, banks map[int]int64) (int, error) {
+	rows, err := tx.Query(`
+		SELECT a.assignment_id, q.bank_id
+		FROM assignment a
+		LEFT JOIN quiz q ON q.assignment_id = a.assignment_id AND q.archive_delete_flag = TRUE
+		WHERE a.course_id = ? AND a.archive_delete_flag = TRUE
+		ORDER BY a.assignment_id`, fromCourseID)
+	if err != nil {
+		return 0, err
+	}
+	type source struct {
+		assignmentID int
+		bankID       sql.NullInt64
+	}
+	var sources []source
+	for rows.Next() {
+		var src source
+		if err := rows.Scan(&src.assignmentID, &src.bankID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		sources = append(sources, src)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, src := range sources {
+		result, err := tx.Exec(`
+			INSERT INTO assignment (course_id, title, description, due_date, max_points, created_at, status, publish_at, is_group_assignment, archive_delete_flag)
+			SELECT ?, title, description, due_date + INTERVAL ? SECOND, max_points, NOW(),
+				CASE
+					WHEN status = 'draft' THEN 'draft'
+					WHEN publish_at + INTERVAL ? SECOND > NOW() THEN 'scheduled'
+					ELSE 'published'
+				END,
+				publish_at + INTERVAL ? SECOND, is_group_assignment, TRUE
+			FROM assignment
+			WHERE assignment_id = ?`,
+			toCourseID, offsetSeconds, offsetSeconds, offsetSeconds, src.assignmentID)
+		if err != nil {
+			return 0, err
+		}
+		assignmentID, _ := result.LastInsertId()
+
+		if src.bankID.Valid {
+			bankID, ok := banks[int(src.bankID.Int64)]
+			if !ok {
+				return 0, fmt.Errorf("quiz %d draws from a bank outside the classroom", src.assignmentID)
+			}
+			_, err = tx.Exec(`
+				INSERT INTO quiz (assignment_id, bank_id, question_count, time_limit_minutes, max_attempts, shuffle_questions, shuffle_options, archive_delete_flag)
+				SELECT ?, ?, question_count, time_limit_minutes, max_attempts, shuffle_questions, shuffle_options, TRUE
+				FROM quiz
+				WHERE assignment_id = ?`, assignmentID, bankID, src.assignmentID)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO code_assignment (assignment_id, language, time_limit_ms, memory_limit_mb, archive_delete_flag)
+			SELECT ?, language, time_limit_ms, memory_limit_mb, TRUE
+			FROM code_assignment
+			WHERE assignment_id = ? AND archive_delete_flag = TRUE`, assignmentID, src.assignmentID)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO code_test_case (assignment_id, name, input, expected_output, points, is_hidden, position, archive_delete_flag)
+			SELECT ?, name, input, expected_output, points, is_hidden, position, TRUE
+			FROM code_test_case
+			WHERE assignment_id = ? AND archive_delete_flag = TRUE
+			ORDER BY position, test_id`, assignmentID, src.assignmentID)
+		if err != nil {
+			return 0, err
+		}
+
+		// Reviews are assigned afresh in the new term
+		_, err = tx.Exec(`
+			INSERT INTO peer_review_settings (assignment_id, reviews_per_submission, review_due_date, rubric, grade_weight, assigned_at, archive_delete_flag)
+			SELECT ?, reviews_per_submission, review_due_date + INTERVAL ? SECOND, rubric, grade_weight, NULL, TRUE
+			FROM peer_review_settings
+			WHERE assignment_id = ? AND archive_delete_flag = TRUE`, assignmentID, offsetSeconds, src.assignmentID)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(sources), nil
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/models"
+)
+
+// SubmissionCommentRequest is the request body for posting a comment on a submission
+type SubmissionCommentRequest struct {
+	Content     string  `json:"content" binding:"required"`
+	AnchorType  *string `json:"anchor_type"`
+	AnchorStart *int    `json:"anchor_start"`
+	AnchorEnd   *int    `json:"anchor_end"`
+}
+
+// submissionParticipants reports whether the given user is the submitting student or a member of the submitting group,
+// and whether they are grading staff on the submission's classroom, along with the submission content
+func submissionParticipants(db *sql.DB, submissionID, userID int) (bool, bool, sql.NullString, error) {
+	var isStudent, isGrader bool
+	var content sql.NullString
+	err := db.QueryRow(`
+		SELECT s.content, (st.user_id = ? OR EXISTS (
+			SELECT 1 FROM student_group_member gm
+			JOIN student gs ON gm.student_id = gs.student_id
+			WHERE gm.group_id = s.group_id AND gs.user_id = ? AND gm.archive_delete_flag = TRUE
+		)), EXISTS (
+			SELECT 1 FROM classroom_staff cs
+			JOIN teacher t ON cs.teacher_id = t.teacher_id
+			WHERE cs.course_id = a.course_id AND t.user_id = ? AND cs.status = 'active'
+			AND cs.can_grade = TRUE AND cs.archive_delete_flag = TRUE AND t.archive_delete_flag = TRUE
+		)
+		FROM submission s
+		JOIN student st ON s.student_id = st.student_id
+		JOIN assignment a ON s.assignment_id = a.assignment_id
+		JOIN classroom c ON a.course_id = c.course_id
+		WHERE s.submission_id = ? AND s.archive_delete_flag = TRUE
+		AND st.archive_delete_flag = TRUE AND a.archive_delete_flag = TRUE
+		AND c.archive_delete_flag = TRUE`, userID, userID, userID, submissionID).
+		Scan(&content, &isStudent, &isGrader)
+	return isStudent, isGrader, content, err
+}
+
+// validateCommentAnchor checks that an optional anchor lies within the submission content
+func validateCommentAnchor(req SubmissionCommentRequest, content string) string {
+	if req.AnchorType == nil {
+		if req.AnchorStart != nil || req.AnchorEnd != nil {
+			return "anchor_type is required when anchor_start or anchor_end is set"
+		}
+		return ""
+	}
+	if req.AnchorStart == nil || req.AnchorEnd == nil {
+		return "anchor_start and anchor_end are required when anchor_type is set"
+	}
+	if *req.AnchorEnd < *req.AnchorStart {
+		return "anchor_end must not be before anchor_start"
+	}
+
+	switch *req.AnchorType {
+	case "line":
+		// Lines are 1-based and inclusive
+		lineCount := strings.Count(content, "\n") + 1
+		if *req.AnchorStart < 1 || *req.AnchorEnd > lineCount {
+			return "Line range is outside the submission content"
+		}
+	case "char":
+		// Character offsets are 0-based with an exclusive end
+		if *req.AnchorStart < 0 || *req.AnchorEnd > utf8.RuneCountInString(content) {
+			return "Character range is outside the submission content"
+		}
+	default:
+		return "anchor_type must be 'line' or 'char'"
+	}
+	return ""
+}
+
+// CreateSubmissionCommentHandler adds a private comment to a submission thread
+func CreateSubmissionCommentHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+	role, _ := c.Get("role")
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return
+	}
+
+	submissionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	var req SubmissionCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment content is required"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+
+	// Only the submitting student or group and the classroom's grading staff can take part in the thread
+	isStudent, isGrader, content, err := submissionParticipants(db, submissionID, userIDInt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying submission participants: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch submission: " + err.Error()})
+		return
+	}
+	if !isStudent && !isGrader {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to comment on this submission"})
+		return
+	}
+
+	if !requireWritableClassroom(c, db, "submission", submissionID) {
+		return
+	}
+
+	if msg := validateCommentAnchor(req, content.String); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO submission_comment (submission_id, user_id, content, anchor_type, anchor_start, anchor_end, created_at, archive_delete_flag)
+		VALUES (?, ?, ?, ?, ?, ?, NOW(), TRUE)`,
+		submissionID, userIDInt, req.Content, req.AnchorType, req.AnchorStart, req.AnchorEnd)
+	if err != nil {
+		log.Printf("Error inserting submission comment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment: " + err.Error()})
+		return
+	}
+
+	commentID, _ := result.LastInsertId()
+	c.JSON(http.StatusOK, gin.H{
+		"comment_id":    commentID,
+		"submission_id": submissionID,
+		"user_id":       userIDInt,
+		"author_role":   role,
+		"content":       req.Content,
+		"anchor_type":   req.AnchorType,
+		"anchor_start":  req.AnchorStart,
+		"anchor_end":    req.AnchorEnd,
+	})
+}
+
+// GetSubmissionCommentsHandler lists the comment thread for a submission
+func GetSubmissionCommentsHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return
+	}
+
+	submissionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+
+	isStudent, isGrader, _, err := submissionParticipants(db, submissionID, userIDInt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying submission participants: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch submission: " + err.Error()})
+		return
+	}
+	if !isStudent && !isGrader {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to view comments on this submission"})
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT sc.comment_id, sc.submission_id, sc.user_id, u.name, u.role, sc.content,
+		sc.anchor_type, sc.anchor_start, sc.anchor_end, sc.created_at
+		FROM submission_comment sc
+		JOIN user u ON sc.user_id = u.user_id
+		WHERE sc.submission_id = ? AND sc.archive_delete_flag = TRUE
+		ORDER BY sc.created_at ASC, sc.comment_id ASC`, submissionID)
+	if err != nil {
+		log.Printf("Error querying submission comments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comments: " + err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	var comments []models.SubmissionComment
+	for rows.Next() {
+		var sc models.SubmissionComment
+		var anchorType sql.NullString
+		var anchorStart, anchorEnd sql.NullInt64
+		if err := rows.Scan(&sc.CommentID, &sc.SubmissionID, &sc.UserID, &sc.AuthorName, &sc.AuthorRole, &sc.Content,
+			&anchorType, &anchorStart, &anchorEnd, &sc.CreatedAt); err != nil {
+			log.Printf("Error scanning submission comment: %v", err)
+			continue
+		}
+		if anchorType.Valid {
+			anchorTypeValue := anchorType.String
+			sc.AnchorType = &anchorTypeValue
+		}
+		if anchorStart.Valid {
+			anchorStartValue := int(anchorStart.Int64)
+			sc.AnchorStart = &anchorStartValue
+		}
+		if anchorEnd.Valid {
+			anchorEndValue := int(anchorEnd.Int64)
+			sc.AnchorEnd = &anchorEndValue
+		}
+		comments = append(comments, sc)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating submission comments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to iterate comments: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, comments)
+}
+
+// DeleteSubmissionCommentHandler removes one of the caller's own comments
+func DeleteSubmissionCommentHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID type"})
+		return
+	}
+
+	submissionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+	commentID, err := strconv.Atoi(c.Param("comment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	result, err := db.Exec(`
+		UPDATE submission_comment
+		SET archive_delete_flag = FALSE
+		WHERE comment_id = ? AND submission_id = ? AND user_id = ? AND archive_delete_flag = TRUE`,
+		commentID, submissionID, userIDInt)
+	if err != nil {
+		log.Printf("Error deleting submission comment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment: " + err.Error()})
+		return
+	}
+
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found or unauthorized"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted"})
+}
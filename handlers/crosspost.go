@@ -0,0 +1,49 @@
+package handlers
+
+import "database/sql"
+
+// crossPostTargets returns the primary course followed by each distinct extra course to copy into
+func crossPostTargets(primary int, extra []int) []int {
+	targets := []int{primary}
+	seen := map[int]bool{primary: true}
+	for _, courseID := range extra {
+		if courseID <= 0 || seen[courseID] {
+			continue
+		}
+		seen[courseID] = true
+		targets = append(targets, courseID)
+	}
+	return targets
+}
+
+// editableCopy is the condition on the classroom c of a cross-posted copy under which the teacher whose ID is bound
+// to it may push an edit to the copy: they hold the content permission there and the classroom is not archived
+var editableCopy = `c.is_archived = FALSE AND EXISTS (
+	SELECT 1 FROM classroom_staff cs` + staffInOrg + `
+	WHERE cs.course_id = c.course_id AND cs.teacher_id = ? AND cs.status = 'active'
+	AND cs.archive_delete_flag = TRUE AND ` + staffPermissionConditions[permEditContent] + `)`
+
+// skippedCopies lists the copies of a cross-posted row that the teacher may not edit, so an edit pushed to the
+// copies leaves them alone. table is announcement or assignment.
+func skippedCopies(tx *sql.Tx, table string, sourceID, teacherID int) ([]int, error) {
+	rows, err := tx.Query(`
+		SELECT x.`+table+`_id FROM `+table+` x
+		JOIN classroom c ON x.course_id = c.course_id
+		WHERE x.source_`+table+`_id = ? AND x.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE
+		AND NOT (`+editableCopy+`)
+		ORDER BY x.`+table+`_id`, sourceID, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	skipped := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		skipped = append(skipped, id)
+	}
+	return skipped, rows.Err()
+}
@@ -17,6 +17,7 @@ import (
 func EnrollStudentHandler(c *gin.Context) {
     userID, _ := c.Get("userID")
     role, _ := c.Get("role")
+    orgID, _ := c.Get("orgID")
     if role != "student" {
         c.JSON(http.StatusForbidden, gin.H{"error": "Only students can enroll in classrooms"})
         return
@@ -38,10 +39,6 @@ func EnrollStudentHandler(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Valid course ID is required"})
         return
     }
-    if req.TeacherName == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Teacher name is required"})
-        return
-    }
 
     db := c.MustGet("db").(*sql.DB)
     var studentID int
@@ -54,14 +51,16 @@ func EnrollStudentHandler(c *gin.Context) {
         return
     }
 
-    // Check if the course exists and fetch its details
+    // Check if the course exists in the student's organization and fetch its details
     var courseTitle, actualTeacherName sql.NullString
+    var isListed bool
+    var capacity sql.NullInt64
     err = db.QueryRow(`
-        SELECT c.title, u.name
+        SELECT c.title, u.name, c.is_listed, c.capacity
         FROM classroom c
         LEFT JOIN teacher t ON c.teacher_id = t.teacher_id
         LEFT JOIN user u ON t.user_id = u.user_id
-        WHERE c.course_id = ? AND c.archive_delete_flag = TRUE`, req.CourseID).Scan(&courseTitle, &actualTeacherName)
+        WHERE c.course_id = ? AND c.org_id = ? AND c.archive_delete_flag = TRUE`, req.CourseID, orgID).Scan(&courseTitle, &actualTeacherName, &isListed, &capacity)
     if err == sql.ErrNoRows {
         c.JSON(http.StatusNotFound, gin.H{"error": "No classroom exists"})
         return
@@ -71,17 +70,47 @@ func EnrollStudentHandler(c *gin.Context) {
         return
     }
 
-    // Compare the provided teacher name with the actual teacher name (case-insensitive)
-    providedTeacherName := strings.TrimSpace(req.TeacherName)
-    dbTeacherName := strings.TrimSpace(actualTeacherName.String)
-    if !strings.EqualFold(providedTeacherName, dbTeacherName) {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Teacher does not match the course"})
+    // Classrooms outside the catalog can only be joined by students who know the teacher's name
+    if !isListed {
+        if req.TeacherName == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Teacher name is required"})
+            return
+        }
+        // Compare the provided teacher name with the actual teacher name (case-insensitive)
+        providedTeacherName := strings.TrimSpace(req.TeacherName)
+        dbTeacherName := strings.TrimSpace(actualTeacherName.String)
+        if !strings.EqualFold(providedTeacherName, dbTeacherName) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Teacher does not match the course"})
+            return
+        }
+    }
+
+    if !requireWritableClassroom(c, db, "classroom", req.CourseID) {
+        return
+    }
+
+    // The classroom row is locked so concurrent enrollments cannot both take the last seat
+    tx, err := db.Begin()
+    if err != nil {
+        log.Printf("Error starting transaction: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+        return
+    }
+    defer tx.Rollback()
+
+    err = tx.QueryRow(`
+        SELECT capacity FROM classroom
+        WHERE course_id = ?
+        FOR UPDATE`, req.CourseID).Scan(&capacity)
+    if err != nil {
+        log.Printf("Error locking classroom: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
         return
     }
 
     // Check if the student is already enrolled
     var exists bool
-    err = db.QueryRow(`
+    err = tx.QueryRow(`
         SELECT EXISTS (
             SELECT 1 FROM enrollment 
             WHERE student_id = ? AND course_id = ? AND archive_delete_flag = TRUE
@@ -96,8 +125,25 @@ func EnrollStudentHandler(c *gin.Context) {
         return
     }
 
+    // Check the classroom has room left
+    if capacity.Valid {
+        var enrolled int64
+        err = tx.QueryRow(`
+            SELECT COUNT(*) FROM enrollment
+            WHERE course_id = ? AND status = 'active' AND archive_delete_flag = TRUE`, req.CourseID).Scan(&enrolled)
+        if err != nil {
+            log.Printf("Error counting enrollments: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+            return
+        }
+        if enrolled >= capacity.Int64 {
+            c.JSON(http.StatusConflict, gin.H{"error": "Classroom is full"})
+            return
+        }
+    }
+
     // Enroll the student
-    result, err := db.Exec(`
+    result, err := tx.Exec(`
         INSERT INTO enrollment (student_id, course_id, enrollment_date, status, archive_delete_flag)
         VALUES (?, ?, ?, 'active', TRUE)`,
         studentID, req.CourseID, time.Now())
@@ -107,6 +153,12 @@ func EnrollStudentHandler(c *gin.Context) {
         return
     }
 
+    if err := tx.Commit(); err != nil {
+        log.Printf("Error committing transaction: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+        return
+    }
+
     enrollmentID, _ := result.LastInsertId()
     c.JSON(http.StatusOK, gin.H{
         "enrollment_id": enrollmentID,
@@ -140,7 +192,7 @@ func GetStudentEnrollmentsHandler(c *gin.Context) {
 
     // Fetch enrollments with course title and teacher name
     rows, err := db.Query(`
-        SELECT e.enrollment_id, e.student_id, e.course_id, e.enrollment_date, e.status, c.title, u.name
+        SELECT e.enrollment_id, e.student_id, e.course_id, e.enrollment_date, e.status, c.title, u.name, c.is_archived
         FROM enrollment e
         JOIN classroom c ON e.course_id = c.course_id
         LEFT JOIN teacher t ON c.teacher_id = t.teacher_id
@@ -157,7 +209,8 @@ func GetStudentEnrollmentsHandler(c *gin.Context) {
     for rows.Next() {
         var e models.Enrollment
         var title, teacherName sql.NullString
-        if err := rows.Scan(&e.EnrollmentID, &e.StudentID, &e.CourseID, &e.EnrollmentDate, &e.Status, &title, &teacherName); err != nil {
+        var isArchived bool
+        if err := rows.Scan(&e.EnrollmentID, &e.StudentID, &e.CourseID, &e.EnrollmentDate, &e.Status, &title, &teacherName, &isArchived); err != nil {
             log.Printf("Error scanning enrollment: %v", err)
             continue
         }
@@ -169,6 +222,7 @@ func GetStudentEnrollmentsHandler(c *gin.Context) {
             "status":          e.Status,
             "title":           title.String,
             "teacher_name":    teacherName.String,
+            "is_archived":     isArchived,
         })
     }
 
@@ -259,7 +313,8 @@ func GetUserStatsHandler(c *gin.Context) {
             SELECT COALESCE(COUNT(DISTINCT e.student_id), 0)
             FROM enrollment e
             JOIN classroom c ON e.course_id = c.course_id
-            WHERE c.teacher_id = ? AND e.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE`, teacherID).Scan(&totalStudents)
+            JOIN classroom_staff cs ON cs.course_id = c.course_id AND cs.status = 'active' AND cs.archive_delete_flag = TRUE
+            WHERE cs.teacher_id = ? AND e.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE`, teacherID).Scan(&totalStudents)
         if err != nil {
             log.Printf("Error counting total students for teacher_id %d: %v", teacherID, err)
             c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -271,7 +326,8 @@ func GetUserStatsHandler(c *gin.Context) {
             SELECT COALESCE(COUNT(*), 0)
             FROM assignment a
             JOIN classroom c ON a.course_id = c.course_id
-            WHERE c.teacher_id = ? AND a.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE`, teacherID).Scan(&totalAssignments)
+            JOIN classroom_staff cs ON cs.course_id = c.course_id AND cs.status = 'active' AND cs.archive_delete_flag = TRUE
+            WHERE cs.teacher_id = ? AND a.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE`, teacherID).Scan(&totalAssignments)
         if err != nil {
             log.Printf("Error counting total assignments for teacher_id %d: %v", teacherID, err)
             c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -307,7 +363,8 @@ func GetUserStatsHandler(c *gin.Context) {
             SELECT COALESCE(COUNT(*), 0)
             FROM assignment a
             JOIN enrollment e ON a.course_id = e.course_id
-            WHERE e.student_id = ? AND a.archive_delete_flag = TRUE AND e.archive_delete_flag = TRUE`, studentID).Scan(&totalAssignments)
+            WHERE e.student_id = ? AND a.archive_delete_flag = TRUE AND e.archive_delete_flag = TRUE
+            AND `+visibleToStudents("a"), studentID).Scan(&totalAssignments)
         if err != nil {
             log.Printf("Error counting total assignments for student_id %d: %v", studentID, err)
             c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
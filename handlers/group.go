@@ -0,0 +1,540 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/models"
+)
+
+// submissionOwnedBy restricts a submission query aliased s to the student's own submissions
+// and those made by any group they belong to. Bind the student ID twice.
+const submissionOwnedBy = `(s.student_id = ? OR s.group_id IN (
+	SELECT group_id FROM student_group_member WHERE student_id = ? AND archive_delete_flag = TRUE))`
+
+// GroupRequest is the request body for creating or updating a group
+type GroupRequest struct {
+	Name       string `json:"name" binding:"required"`
+	StudentIDs []int  `json:"student_ids"`
+}
+
+// RandomGroupsRequest is the request body for splitting a classroom into random groups
+type RandomGroupsRequest struct {
+	GroupSize       int  `json:"group_size" binding:"required"`
+	ReplaceExisting bool `json:"replace_existing"` // Dissolve current groups first instead of only grouping unassigned students
+}
+
+// studentGroupID returns the group the student belongs to in a classroom, or sql.ErrNoRows
+func studentGroupID(db *sql.DB, studentID, courseID int) (int, error) {
+	var groupID int
+	err := db.QueryRow(`
+		SELECT g.group_id FROM student_group g
+		JOIN student_group_member gm ON g.group_id = gm.group_id
+		WHERE gm.student_id = ? AND g.course_id = ?
+		AND gm.archive_delete_flag = TRUE AND g.archive_delete_flag = TRUE`, studentID, courseID).Scan(&groupID)
+	return groupID, err
+}
+
+// validateGroupMembers checks that every student is enrolled in the classroom and not in another of its groups.
+// It returns a message for the client when the list is invalid.
+func validateGroupMembers(db *sql.DB, courseID, groupID int, studentIDs []int) (string, error) {
+	seen := map[int]bool{}
+	for _, studentID := range studentIDs {
+		if seen[studentID] {
+			return fmt.Sprintf("Student %d is listed more than once", studentID), nil
+		}
+		seen[studentID] = true
+
+		var enrolled bool
+		err := db.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM enrollment
+				WHERE student_id = ? AND course_id = ? AND archive_delete_flag = TRUE
+			)`, studentID, courseID).Scan(&enrolled)
+		if err != nil {
+			return "", err
+		}
+		if !enrolled {
+			return fmt.Sprintf("Student %d is not enrolled in this classroom", studentID), nil
+		}
+
+		currentGroup, err := studentGroupID(db, studentID, courseID)
+		if err == nil && currentGroup != groupID {
+			return fmt.Sprintf("Student %d is already in another group", studentID), nil
+		} else if err != nil && err != sql.ErrNoRows {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// setGroupMembers replaces the membership of a group
+func setGroupMembers(tx *sql.Tx, groupID int64, studentIDs []int) error {
+	_, err := tx.Exec(`
+		UPDATE student_group_member
+		SET archive_delete_flag = FALSE
+		WHERE group_id = ?`, groupID)
+	if err != nil {
+		return err
+	}
+	for _, studentID := range studentIDs {
+		_, err = tx.Exec(`
+			INSERT INTO student_group_member (group_id, student_id, archive_delete_flag)
+			VALUES (?, ?, TRUE)
+			ON DUPLICATE KEY UPDATE archive_delete_flag = TRUE`, groupID, studentID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateGroupHandler creates a group in a classroom from a list of students
+func CreateGroupHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	var req GroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "classroom", courseID, permManageStudents); !ok {
+		return
+	}
+
+	msg, err := validateGroupMembers(db, courseID, 0, req.StudentIDs)
+	if err != nil {
+		log.Printf("Error validating group members: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO student_group (course_id, name, created_at, archive_delete_flag)
+		VALUES (?, ?, NOW(), TRUE)`, courseID, req.Name)
+	if err != nil {
+		log.Printf("Error inserting group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	groupID, _ := result.LastInsertId()
+
+	if err := setGroupMembers(tx, groupID, req.StudentIDs); err != nil {
+		log.Printf("Error adding group members: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"group_id":    groupID,
+		"course_id":   courseID,
+		"name":        req.Name,
+		"student_ids": req.StudentIDs,
+	})
+}
+
+// CreateRandomGroupsHandler splits a classroom's ungrouped students into random groups of roughly equal size
+func CreateRandomGroupsHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	var req RandomGroupsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if req.GroupSize < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_size must be at least 1"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "classroom", courseID, permManageStudents); !ok {
+		return
+	}
+
+	// Groups that already submitted work cannot be dissolved
+	if req.ReplaceExisting {
+		var hasSubmissions bool
+		err = db.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM submission s
+				JOIN student_group g ON s.group_id = g.group_id
+				WHERE g.course_id = ? AND g.archive_delete_flag = TRUE AND s.archive_delete_flag = TRUE
+			)`, courseID).Scan(&hasSubmissions)
+		if err != nil {
+			log.Printf("Error checking group submissions: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if hasSubmissions {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Existing groups have submissions and cannot be replaced"})
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if req.ReplaceExisting {
+		_, err = tx.Exec(`
+			UPDATE student_group_member gm
+			JOIN student_group g ON gm.group_id = g.group_id
+			SET gm.archive_delete_flag = FALSE
+			WHERE g.course_id = ? AND g.archive_delete_flag = TRUE`, courseID)
+		if err == nil {
+			_, err = tx.Exec(`
+				UPDATE student_group
+				SET archive_delete_flag = FALSE
+				WHERE course_id = ? AND archive_delete_flag = TRUE`, courseID)
+		}
+		if err != nil {
+			log.Printf("Error removing existing groups: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	rows, err := tx.Query(`
+		SELECT e.student_id FROM enrollment e
+		WHERE e.course_id = ? AND e.archive_delete_flag = TRUE
+		AND NOT EXISTS (
+			SELECT 1 FROM student_group_member gm
+			JOIN student_group g ON gm.group_id = g.group_id
+			WHERE gm.student_id = e.student_id AND g.course_id = e.course_id
+			AND gm.archive_delete_flag = TRUE AND g.archive_delete_flag = TRUE
+		)`, courseID)
+	if err != nil {
+		log.Printf("Error querying ungrouped students: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var studentIDs []int
+	for rows.Next() {
+		var studentID int
+		if err := rows.Scan(&studentID); err != nil {
+			log.Printf("Error scanning student: %v", err)
+			continue
+		}
+		studentIDs = append(studentIDs, studentID)
+	}
+	rows.Close()
+	if len(studentIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No ungrouped students to assign"})
+		return
+	}
+
+	var existingGroups int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM student_group
+		WHERE course_id = ? AND archive_delete_flag = TRUE`, courseID).Scan(&existingGroups)
+	if err != nil {
+		log.Printf("Error counting groups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Deal the shuffled students round-robin so group sizes differ by at most one
+	rand.Shuffle(len(studentIDs), func(i, j int) { studentIDs[i], studentIDs[j] = studentIDs[j], studentIDs[i] })
+	groupCount := (len(studentIDs) + req.GroupSize - 1) / req.GroupSize
+	members := make([][]int, groupCount)
+	for i, studentID := range studentIDs {
+		members[i%groupCount] = append(members[i%groupCount], studentID)
+	}
+
+	var groups []gin.H
+	for i, studentIDs := range members {
+		name := fmt.Sprintf("Group %d", existingGroups+i+1)
+		result, err := tx.Exec(`
+			INSERT INTO student_group (course_id, name, created_at, archive_delete_flag)
+			VALUES (?, ?, NOW(), TRUE)`, courseID, name)
+		if err != nil {
+			log.Printf("Error inserting group: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		groupID, _ := result.LastInsertId()
+		if err := setGroupMembers(tx, groupID, studentIDs); err != nil {
+			log.Printf("Error adding group members: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		groups = append(groups, gin.H{
+			"group_id":    groupID,
+			"name":        name,
+			"student_ids": studentIDs,
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"course_id": courseID,
+		"groups":    groups,
+	})
+}
+
+// GetGroupsHandler lists a classroom's groups; students only see their own group
+func GetGroupsHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+
+	query := `
+		SELECT g.group_id, g.course_id, g.name, g.created_at, st.student_id, u.name
+		FROM student_group g
+		LEFT JOIN student_group_member gm ON g.group_id = gm.group_id AND gm.archive_delete_flag = TRUE
+		LEFT JOIN student st ON gm.student_id = st.student_id
+		LEFT JOIN user u ON st.user_id = u.user_id
+		WHERE g.course_id = ? AND g.archive_delete_flag = TRUE`
+	args := []interface{}{courseID}
+
+	if role == "teacher" {
+		var teacherID int
+		err = db.QueryRow(`
+			SELECT teacher_id FROM teacher
+			WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&teacherID)
+		if err != nil {
+			log.Printf("Error querying teacher: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Teacher not found"})
+			return
+		}
+
+		allowed, err := teacherCan(db, teacherID, courseID, permViewClassroom)
+		if err != nil {
+			log.Printf("Error checking classroom authorization: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to view this classroom"})
+			return
+		}
+	} else if role == "student" {
+		var studentID int
+		err = db.QueryRow(`
+			SELECT student_id FROM student
+			WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&studentID)
+		if err != nil {
+			log.Printf("Error querying student: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Student not found"})
+			return
+		}
+
+		query += ` AND g.group_id IN (
+			SELECT group_id FROM student_group_member WHERE student_id = ? AND archive_delete_flag = TRUE)`
+		args = append(args, studentID)
+	} else {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized role"})
+		return
+	}
+	query += ` ORDER BY g.group_id, u.name`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Printf("Error querying groups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	groups := []*models.StudentGroup{}
+	for rows.Next() {
+		var g models.StudentGroup
+		var studentID sql.NullInt64
+		var studentName sql.NullString
+		if err := rows.Scan(&g.GroupID, &g.CourseID, &g.Name, &g.CreatedAt, &studentID, &studentName); err != nil {
+			log.Printf("Error scanning group: %v", err)
+			continue
+		}
+		if len(groups) == 0 || groups[len(groups)-1].GroupID != g.GroupID {
+			g.Members = []models.GroupMember{}
+			groups = append(groups, &g)
+		}
+		if studentID.Valid {
+			current := groups[len(groups)-1]
+			current.Members = append(current.Members, models.GroupMember{
+				StudentID: int(studentID.Int64),
+				Name:      studentName.String,
+			})
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating groups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
+// UpdateGroupHandler renames a group and replaces its members
+func UpdateGroupHandler(c *gin.Context) {
+	groupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	var req GroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "group", groupID, permManageStudents); !ok {
+		return
+	}
+
+	var courseID int
+	err = db.QueryRow(`
+		SELECT course_id FROM student_group
+		WHERE group_id = ? AND archive_delete_flag = TRUE`, groupID).Scan(&courseID)
+	if err != nil {
+		log.Printf("Error querying group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	msg, err := validateGroupMembers(db, courseID, groupID, req.StudentIDs)
+	if err != nil {
+		log.Printf("Error validating group members: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE student_group
+		SET name = ?
+		WHERE group_id = ? AND archive_delete_flag = TRUE`, req.Name, groupID)
+	if err != nil {
+		log.Printf("Error updating group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := setGroupMembers(tx, int64(groupID), req.StudentIDs); err != nil {
+		log.Printf("Error updating group members: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"group_id":    groupID,
+		"course_id":   courseID,
+		"name":        req.Name,
+		"student_ids": req.StudentIDs,
+	})
+}
+
+// DeleteGroupHandler dissolves a group that has not submitted any work
+func DeleteGroupHandler(c *gin.Context) {
+	groupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "group", groupID, permManageStudents); !ok {
+		return
+	}
+
+	var hasSubmissions bool
+	err = db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM submission
+			WHERE group_id = ? AND archive_delete_flag = TRUE
+		)`, groupID).Scan(&hasSubmissions)
+	if err != nil {
+		log.Printf("Error checking group submissions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if hasSubmissions {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Group has submissions and cannot be deleted"})
+		return
+	}
+
+	_, err = db.Exec(`
+		UPDATE student_group g
+		LEFT JOIN student_group_member gm ON g.group_id = gm.group_id
+		SET g.archive_delete_flag = FALSE, gm.archive_delete_flag = FALSE
+		WHERE g.group_id = ? AND g.archive_delete_flag = TRUE`, groupID)
+	if err != nil {
+		log.Printf("Error deleting group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted"})
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"edusync/models"
+	"edusync/storage"
 	"edusync/utils"
 )
 
@@ -38,6 +39,32 @@ func RegisterHandler(c *gin.Context) {
 		return
 	}
 
+	// Join the organization named in the request, or else the one that claims the email's domain
+	var orgID int
+	if req.Org != nil && *req.Org != "" {
+		orgID, err = orgBySlug(db, *req.Org)
+	} else {
+		orgID, err = orgByEmailDomain(db, emailDomain(req.Email))
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown organization; set org to its slug"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying organization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	allowed, err := orgAllowsEmail(db, orgID, req.Email)
+	if err != nil {
+		log.Printf("Error checking email domain: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email domain is not allowed by this organization"})
+		return
+	}
+
 	passwordHash, err := utils.HashPassword(req.Password)
 	if err != nil {
 		log.Printf("Error hashing password: %v", err)
@@ -54,9 +81,9 @@ func RegisterHandler(c *gin.Context) {
 	defer tx.Rollback()
 
 	result, err := tx.Exec(`
-		INSERT INTO user (name, email, password, role, contact_number, profile_picture, org, archive_delete_flag)
+		INSERT INTO user (name, email, password, role, contact_number, profile_picture, org_id, archive_delete_flag)
 		VALUES (?, ?, ?, ?, ?, ?, ?, TRUE)`,
-		req.Name, req.Email, passwordHash, req.Role, req.ContactNumber, req.ProfilePicture, req.Org)
+		req.Name, req.Email, passwordHash, req.Role, req.ContactNumber, req.ProfilePicture, orgID)
 	if err != nil {
 		log.Printf("Error inserting user: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
@@ -85,17 +112,31 @@ func RegisterHandler(c *gin.Context) {
 		return
 	}
 
+	token, err := issueUserToken(tx, userID, tokenEmailVerification, emailVerificationTTL)
+	if err != nil {
+		log.Printf("Error issuing verification token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
 	if err := tx.Commit(); err != nil {
 		log.Printf("Error committing transaction: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
 
+	// A lost email can be sent again through /api/email/verify/resend, so failing to send it does not fail the request
+	if err := sendMail(c, verificationMessage(req.Name, req.Email, token)); err != nil {
+		log.Printf("Error mailing verification link to %s: %v", req.Email, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"user_id": userID,
-		"name":    req.Name,
-		"email":   req.Email,
-		"role":    req.Role,
+		"user_id":        userID,
+		"name":           req.Name,
+		"email":          req.Email,
+		"role":           req.Role,
+		"org_id":         orgID,
+		"email_verified": false,
 	})
 }
 
@@ -106,11 +147,16 @@ func GetProfileHandler(c *gin.Context) {
 
 	db := c.MustGet("db").(*sql.DB)
 	var user models.User
+	var pictureKey *string
 	err := db.QueryRow(`
-		SELECT user_id, name, email, role, contact_number, profile_picture, org
-		FROM user 
-		WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(
-		&user.UserID, &user.Name, &user.Email, &user.Role, &user.ContactNumber, &user.ProfilePicture, &user.Org,
+		SELECT u.user_id, u.name, u.email, u.email_verified_at IS NOT NULL, u.pending_email, u.role, u.contact_number,
+		u.profile_picture, u.profile_picture_key, u.org_id, o.name, u.is_org_admin
+		FROM user u
+		JOIN organization o ON u.org_id = o.org_id
+		WHERE u.user_id = ? AND u.archive_delete_flag = TRUE`, userID).Scan(
+		&user.UserID, &user.Name, &user.Email, &user.EmailVerified, &user.PendingEmail, &user.Role, &user.ContactNumber,
+		&user.ProfilePicture, &pictureKey,
+		&user.OrgID, &user.Org, &user.IsOrgAdmin,
 	)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -120,6 +166,9 @@ func GetProfileHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
+	if pictureKey != nil {
+		user.ProfileThumbnails = profileThumbnails(c.MustGet("storage").(storage.Store), *pictureKey)
+	}
 
 	var profile interface{}
 	if role == "teacher" {
@@ -39,12 +39,7 @@ func CreateMaterialHandler(c *gin.Context) {
 	}
 
 	// Check if the teacher is authorized to create materials for this classroom
-	var exists bool
-	err = db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 FROM classroom 
-			WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE
-		)`, req.CourseID, teacherID).Scan(&exists)
+	exists, err := teacherCan(db, teacherID, req.CourseID, permEditContent)
 	if err != nil {
 		log.Printf("Error checking classroom authorization: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -55,6 +50,10 @@ func CreateMaterialHandler(c *gin.Context) {
 		return
 	}
 
+	if !requireWritableClassroom(c, db, "classroom", req.CourseID) {
+		return
+	}
+
 	result, err := db.Exec(`
 		INSERT INTO material (course_id, title, type, file_path, uploaded_at, description, archive_delete_flag)
 		VALUES (?, ?, ?, ?, ?, ?, TRUE)`,
@@ -109,14 +108,7 @@ func UpdateMaterialHandler(c *gin.Context) {
 	}
 
 	// Check if the teacher is authorized to update this material
-	var exists bool
-	err = db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 FROM material m
-			JOIN classroom c ON m.course_id = c.course_id
-			WHERE m.material_id = ? AND c.teacher_id = ? AND m.archive_delete_flag = TRUE
-			AND c.archive_delete_flag = TRUE
-		)`, materialID, teacherID).Scan(&exists)
+	exists, err := teacherCanOn(db, teacherID, "material", materialID, permEditContent)
 	if err != nil {
 		log.Printf("Error checking material authorization: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -127,6 +119,10 @@ func UpdateMaterialHandler(c *gin.Context) {
 		return
 	}
 
+	if !requireWritableClassroom(c, db, "material", materialID) {
+		return
+	}
+
 	_, err = db.Exec(`
 		UPDATE material 
 		SET title = ?, type = ?, file_path = ?, description = ?
@@ -174,14 +170,7 @@ func DeleteMaterialHandler(c *gin.Context) {
 	}
 
 	// Check if the teacher is authorized to delete this material
-	var exists bool
-	err = db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 FROM material m
-			JOIN classroom c ON m.course_id = c.course_id
-			WHERE m.material_id = ? AND c.teacher_id = ? AND m.archive_delete_flag = TRUE
-			AND c.archive_delete_flag = TRUE
-		)`, materialID, teacherID).Scan(&exists)
+	exists, err := teacherCanOn(db, teacherID, "material", materialID, permEditContent)
 	if err != nil {
 		log.Printf("Error checking material authorization: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -192,6 +181,10 @@ func DeleteMaterialHandler(c *gin.Context) {
 		return
 	}
 
+	if !requireWritableClassroom(c, db, "material", materialID) {
+		return
+	}
+
 	_, err = db.Exec(`
 		UPDATE material 
 		SET archive_delete_flag = FALSE 
@@ -205,6 +198,21 @@ func DeleteMaterialHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Material deleted"})
 }
 
+// materialListSpec is the sorting and filtering of a classroom's material list
+var materialListSpec = listSpec{
+	Sorts: map[string]listColumn{
+		"uploaded_at": {Expr: "COALESCE(uploaded_at, TIMESTAMP '1970-01-01 00:00:00')", Kind: kindTime},
+		"title":       {Expr: "title", Kind: kindString},
+	},
+	DefaultSort: "uploaded_at",
+	ID:          "material_id",
+	Filters: map[string]listFilter{
+		"type":            {Expr: "type", Kind: kindString},
+		"uploaded_before": {Expr: "uploaded_at", Kind: kindTime, Op: "<"},
+		"uploaded_after":  {Expr: "uploaded_at", Kind: kindTime, Op: ">="},
+	},
+}
+
 // GetMaterialsByClassroomHandler lists materials for a classroom
 func GetMaterialsByClassroomHandler(c *gin.Context) {
 	userID, _ := c.Get("userID")
@@ -230,12 +238,7 @@ func GetMaterialsByClassroomHandler(c *gin.Context) {
 		}
 
 		// Check if the teacher is authorized to view this classroom
-		var exists bool
-		err = db.QueryRow(`
-			SELECT EXISTS (
-				SELECT 1 FROM classroom 
-				WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE
-			)`, courseID, teacherID).Scan(&exists)
+		exists, err := teacherCan(db, teacherID, courseID, permViewClassroom)
 		if err != nil {
 			log.Printf("Error checking classroom authorization: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -277,10 +280,16 @@ func GetMaterialsByClassroomHandler(c *gin.Context) {
 		return
 	}
 
+	page, err := parseListPage(c, materialListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	rows, err := db.Query(`
-		SELECT material_id, course_id, title, type, file_path, uploaded_at, description
+		SELECT material_id, course_id, title, type, file_path, uploaded_at, description`+page.Select()+`
 		FROM material 
-		WHERE course_id = ? AND archive_delete_flag = TRUE`, courseID)
+		WHERE course_id = ? AND archive_delete_flag = TRUE`+page.Where()+page.OrderLimit(), append([]interface{}{courseID}, page.Args()...)...)
 	if err != nil {
 		log.Printf("Error querying materials: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -289,14 +298,15 @@ func GetMaterialsByClassroomHandler(c *gin.Context) {
 	defer rows.Close()
 
 	var materials []models.Material
-	for rows.Next() {
+	for rows.Next() && page.Next() {
 		var m models.Material
-		if err := rows.Scan(&m.MaterialID, &m.CourseID, &m.Title, &m.Type, &m.FilePath, &m.UploadedAt, &m.Description); err != nil {
+		if err := rows.Scan(page.Dest(&m.MaterialID, &m.CourseID, &m.Title, &m.Type, &m.FilePath, &m.UploadedAt, &m.Description)...); err != nil {
 			log.Printf("Error scanning material: %v", err)
 			continue
 		}
 		materials = append(materials, m)
 	}
 
+	page.SetNextCursor(c)
 	c.JSON(http.StatusOK, materials)
 }
\ No newline at end of file
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/models"
+)
+
+// recordMaterialView counts a student opening or downloading a material
+func recordMaterialView(db *sql.DB, materialID, studentID int, download bool) error {
+	if download {
+		_, err := db.Exec(`
+			INSERT INTO material_view (material_id, student_id, download_count, first_viewed_at, last_downloaded_at)
+			VALUES (?, ?, 1, NOW(), NOW())
+			ON DUPLICATE KEY UPDATE download_count = download_count + 1, last_downloaded_at = NOW()`, materialID, studentID)
+		return err
+	}
+	_, err := db.Exec(`
+		INSERT INTO material_view (material_id, student_id, view_count, first_viewed_at, last_viewed_at)
+		VALUES (?, ?, 1, NOW(), NOW())
+		ON DUPLICATE KEY UPDATE view_count = view_count + 1, last_viewed_at = NOW()`, materialID, studentID)
+	return err
+}
+
+// materialAccess checks the caller may open a material: staff who can view its classroom, or enrolled students while
+// it is not in a locked module. It returns the student ID, 0 for staff, and writes the error response itself.
+func materialAccess(c *gin.Context, db *sql.DB, materialID int) (int, bool) {
+	role, _ := c.Get("role")
+	if role == "teacher" {
+		_, ok := authorizeStaffAccess(c, db, "material", materialID, permViewClassroom)
+		return 0, ok
+	}
+	return materialStudent(c, db, materialID)
+}
+
+// classroomProgress works out how far a student has worked through the materials, assignments and modules of a
+// classroom
+func classroomProgress(db *sql.DB, studentID, courseID int) (*models.ClassroomProgress, error) {
+	progress := &models.ClassroomProgress{CourseID: courseID, Materials: []models.MaterialProgress{}}
+
+	rows, err := db.Query(`
+		SELECT m.material_id, m.title, v.student_id IS NOT NULL, v.last_viewed_at,
+		COALESCE(v.download_count, 0) > 0, mc.student_id IS NOT NULL
+		FROM material m
+		LEFT JOIN material_view v ON v.material_id = m.material_id AND v.student_id = ?
+		LEFT JOIN material_completion mc ON mc.material_id = m.material_id AND mc.student_id = ?
+		WHERE m.course_id = ? AND m.archive_delete_flag = TRUE
+		ORDER BY m.uploaded_at, m.material_id`, studentID, studentID, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m models.MaterialProgress
+		if err := rows.Scan(&m.MaterialID, &m.Title, &m.Viewed, &m.LastViewedAt, &m.Downloaded, &m.Completed); err != nil {
+			return nil, err
+		}
+		progress.MaterialsTotal++
+		if m.Viewed {
+			progress.MaterialsViewed++
+		}
+		if m.Completed {
+			progress.MaterialsCompleted++
+		}
+		progress.Materials = append(progress.Materials, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(EXISTS (
+			SELECT 1 FROM submission s
+			WHERE s.assignment_id = a.assignment_id AND s.archive_delete_flag = TRUE AND `+submissionOwnedBy+`)), 0)
+		FROM assignment a
+		WHERE a.course_id = ? AND a.archive_delete_flag = TRUE AND `+visibleToStudents("a"), studentID, studentID, courseID).
+		Scan(&progress.AssignmentsTotal, &progress.AssignmentsSubmitted)
+	if err != nil {
+		return nil, err
+	}
+
+	modules, err := loadModules(db, courseID, studentID)
+	if err != nil {
+		return nil, err
+	}
+	progress.ModulesTotal = len(modules)
+	for _, m := range modules {
+		if m.Status == moduleCompleted {
+			progress.ModulesCompleted++
+		}
+	}
+	return progress, nil
+}
+
+// GetMaterialHandler returns a material. Opening it as a student counts as a view.
+func GetMaterialHandler(c *gin.Context) {
+	materialID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid material ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	studentID, ok := materialAccess(c, db, materialID)
+	if !ok {
+		return
+	}
+
+	var m models.Material
+	err = db.QueryRow(`
+		SELECT material_id, course_id, title, type, file_path, uploaded_at, description
+		FROM material
+		WHERE material_id = ? AND archive_delete_flag = TRUE`, materialID).
+		Scan(&m.MaterialID, &m.CourseID, &m.Title, &m.Type, &m.FilePath, &m.UploadedAt, &m.Description)
+	if err != nil {
+		log.Printf("Error querying material: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch material"})
+		return
+	}
+
+	if studentID == 0 {
+		c.JSON(http.StatusOK, gin.H{"material": m})
+		return
+	}
+
+	if err := recordMaterialView(db, materialID, studentID, false); err != nil {
+		log.Printf("Error recording material view: %v", err)
+	}
+	var completed bool
+	err = db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM material_completion WHERE material_id = ? AND student_id = ?)`, materialID, studentID).
+		Scan(&completed)
+	if err != nil {
+		log.Printf("Error checking material completion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"material": m, "completed": completed})
+}
+
+// DownloadMaterialHandler redirects to a material's file. Students' downloads are counted.
+func DownloadMaterialHandler(c *gin.Context) {
+	materialID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid material ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	studentID, ok := materialAccess(c, db, materialID)
+	if !ok {
+		return
+	}
+
+	var filePath sql.NullString
+	err = db.QueryRow(`
+		SELECT file_path FROM material
+		WHERE material_id = ? AND archive_delete_flag = TRUE`, materialID).Scan(&filePath)
+	if err != nil {
+		log.Printf("Error querying material: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch material"})
+		return
+	}
+	if filePath.String == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Material has no file"})
+		return
+	}
+
+	if studentID != 0 {
+		if err := recordMaterialView(db, materialID, studentID, true); err != nil {
+			log.Printf("Error recording material download: %v", err)
+		}
+	}
+
+	c.Redirect(http.StatusFound, filePath.String)
+}
+
+// GetMaterialViewsHandler reports which enrolled students have viewed, downloaded and completed a material
+func GetMaterialViewsHandler(c *gin.Context) {
+	materialID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid material ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "material", materialID, permViewClassroom); !ok {
+		return
+	}
+
+	var courseID int
+	err = db.QueryRow(`
+		SELECT course_id FROM material
+		WHERE material_id = ? AND archive_delete_flag = TRUE`, materialID).Scan(&courseID)
+	if err != nil {
+		log.Printf("Error querying material: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch material"})
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT es.student_id, es.name, v.student_id IS NOT NULL, COALESCE(v.view_count, 0), COALESCE(v.download_count, 0),
+		v.first_viewed_at, v.last_viewed_at, v.last_downloaded_at, mc.completed_at
+		FROM (SELECT e.student_id, u.name`+enrolledStudentsFrom+`) es
+		LEFT JOIN material_view v ON v.material_id = ? AND v.student_id = es.student_id
+		LEFT JOIN material_completion mc ON mc.material_id = ? AND mc.student_id = es.student_id
+		ORDER BY es.name`, courseID, materialID, materialID)
+	if err != nil {
+		log.Printf("Error querying material views: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch material views"})
+		return
+	}
+	defer rows.Close()
+
+	students := []models.MaterialViewRecord{}
+	viewed, completed := 0, 0
+	for rows.Next() {
+		var r models.MaterialViewRecord
+		if err := rows.Scan(&r.StudentID, &r.Name, &r.Viewed, &r.ViewCount, &r.DownloadCount,
+			&r.FirstViewedAt, &r.LastViewedAt, &r.LastDownloadedAt, &r.CompletedAt); err != nil {
+			log.Printf("Error scanning material view: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process material views"})
+			return
+		}
+		if r.Viewed {
+			viewed++
+		}
+		if r.CompletedAt != nil {
+			completed++
+		}
+		students = append(students, r)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating material views: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch material views"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"material_id": materialID,
+		"enrolled":    len(students),
+		"viewed":      viewed,
+		"not_viewed":  len(students) - viewed,
+		"completed":   completed,
+		"students":    students,
+	})
+}
+
+// GetClassroomProgressHandler returns the calling student's progress through a classroom
+func GetClassroomProgressHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	if role != "student" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only students can view their progress"})
+		return
+	}
+
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	studentID, err := classroomStudent(db, userID, courseID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not enrolled in this classroom"})
+		return
+	} else if err != nil {
+		log.Printf("Error checking enrollment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	progress, err := classroomProgress(db, studentID, courseID)
+	if err != nil {
+		log.Printf("Error querying classroom progress: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch progress"})
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
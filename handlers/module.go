@@ -0,0 +1,881 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/models"
+)
+
+// Module states in the student view
+const (
+	moduleLocked    = "locked"
+	moduleAvailable = "available"
+	moduleCompleted = "completed"
+)
+
+// Content kinds that can be placed in a module
+const (
+	moduleItemMaterial   = "material"
+	moduleItemAssignment = "assignment"
+)
+
+// ModuleRequest is the request body for creating or updating a module
+type ModuleRequest struct {
+	Title           string  `json:"title" binding:"required"`
+	Description     *string `json:"description"`
+	UnlockAt        *string `json:"unlock_at"` // RFC 3339; students cannot work on the module before then
+	LockAt          *string `json:"lock_at"`   // RFC 3339; students cannot work on the module after then
+	PrerequisiteIDs []int   `json:"prerequisite_ids"`
+}
+
+// ModuleOrderRequest is the request body for reordering the modules of a classroom
+type ModuleOrderRequest struct {
+	ModuleIDs []int `json:"module_ids" binding:"required"`
+}
+
+// ModuleItemEntry places one material or assignment in a module
+type ModuleItemEntry struct {
+	Type string `json:"type" binding:"required"` // material or assignment
+	ID   int    `json:"id" binding:"required"`
+}
+
+// ModuleItemsRequest is the request body for setting the contents of a module, in order
+type ModuleItemsRequest struct {
+	Items []ModuleItemEntry `json:"items" binding:"dive"`
+}
+
+// parseModuleDates parses the optional unlock and lock times of a module request
+func parseModuleDates(req ModuleRequest) (*time.Time, *time.Time, error) {
+	var unlockAt, lockAt *time.Time
+	if req.UnlockAt != nil {
+		parsed, err := time.Parse(time.RFC3339, *req.UnlockAt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid unlock_at format, expected RFC 3339")
+		}
+		unlockAt = &parsed
+	}
+	if req.LockAt != nil {
+		parsed, err := time.Parse(time.RFC3339, *req.LockAt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid lock_at format, expected RFC 3339")
+		}
+		lockAt = &parsed
+	}
+	if unlockAt != nil && lockAt != nil && !lockAt.After(*unlockAt) {
+		return nil, nil, fmt.Errorf("lock_at must be after unlock_at")
+	}
+	return unlockAt, lockAt, nil
+}
+
+// moduleCourse returns the classroom of a module
+func moduleCourse(db *sql.DB, moduleID int) (int, error) {
+	var courseID int
+	err := db.QueryRow(`
+		SELECT course_id FROM class_module
+		WHERE module_id = ? AND archive_delete_flag = TRUE`, moduleID).Scan(&courseID)
+	return courseID, err
+}
+
+// checkPrerequisites validates the prerequisites of a module: they must be other modules of the same classroom and
+// must not lead back to the module. moduleID is 0 for a new module. It returns a message for the client when the
+// prerequisites are rejected.
+func checkPrerequisites(db *sql.DB, courseID, moduleID int, prerequisiteIDs []int) (string, error) {
+	rows, err := db.Query(`
+		SELECT p.module_id, p.prerequisite_id FROM module_prerequisite p
+		JOIN class_module m ON p.module_id = m.module_id
+		WHERE m.course_id = ? AND m.archive_delete_flag = TRUE`, courseID)
+	if err != nil {
+		return "", err
+	}
+	edges := map[int][]int{}
+	for rows.Next() {
+		var from, to int
+		if err := rows.Scan(&from, &to); err != nil {
+			rows.Close()
+			return "", err
+		}
+		edges[from] = append(edges[from], to)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	modules, err := db.Query(`
+		SELECT module_id FROM class_module
+		WHERE course_id = ? AND archive_delete_flag = TRUE`, courseID)
+	if err != nil {
+		return "", err
+	}
+	inCourse := map[int]bool{}
+	for modules.Next() {
+		var id int
+		if err := modules.Scan(&id); err != nil {
+			modules.Close()
+			return "", err
+		}
+		inCourse[id] = true
+	}
+	modules.Close()
+	if err := modules.Err(); err != nil {
+		return "", err
+	}
+
+	seen := map[int]bool{}
+	for _, id := range prerequisiteIDs {
+		if id == moduleID {
+			return "A module cannot be its own prerequisite", nil
+		}
+		if !inCourse[id] {
+			return fmt.Sprintf("Module %d is not in this classroom", id), nil
+		}
+		if seen[id] {
+			return fmt.Sprintf("Module %d is listed twice", id), nil
+		}
+		seen[id] = true
+	}
+	if moduleID == 0 {
+		// Nothing depends on a module that does not exist yet
+		return "", nil
+	}
+
+	// The new edges close a cycle if the module is reachable from any of its prerequisites
+	edges[moduleID] = prerequisiteIDs
+	visited := map[int]bool{}
+	var reaches func(id int) bool
+	reaches = func(id int) bool {
+		if id == moduleID {
+			return true
+		}
+		if visited[id] {
+			return false
+		}
+		visited[id] = true
+		for _, next := range edges[id] {
+			if reaches(next) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, id := range prerequisiteIDs {
+		if reaches(id) {
+			return "Prerequisites would form a cycle", nil
+		}
+	}
+	return "", nil
+}
+
+// setPrerequisites replaces the prerequisites of a module
+func setPrerequisites(tx *sql.Tx, moduleID int, prerequisiteIDs []int) error {
+	if _, err := tx.Exec(`DELETE FROM module_prerequisite WHERE module_id = ?`, moduleID); err != nil {
+		return err
+	}
+	for _, id := range prerequisiteIDs {
+		if _, err := tx.Exec(`
+			INSERT INTO module_prerequisite (module_id, prerequisite_id)
+			VALUES (?, ?)`, moduleID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadModules returns the modules of a classroom in order with their items. studentID is 0 for the staff view;
+// otherwise unpublished assignments are left out and each module and item carries the student's progress.
+func loadModules(db *sql.DB, courseID, studentID int) ([]models.Module, error) {
+	rows, err := db.Query(`
+		SELECT module_id, course_id, title, description, position, unlock_at, lock_at, created_at
+		FROM class_module
+		WHERE course_id = ? AND archive_delete_flag = TRUE
+		ORDER BY position, module_id`, courseID)
+	if err != nil {
+		return nil, err
+	}
+	modules := []models.Module{}
+	index := map[int]int{}
+	for rows.Next() {
+		m := models.Module{PrerequisiteIDs: []int{}, Items: []models.ModuleItem{}}
+		if err := rows.Scan(&m.ModuleID, &m.CourseID, &m.Title, &m.Description, &m.Position, &m.UnlockAt, &m.LockAt, &m.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[m.ModuleID] = len(modules)
+		modules = append(modules, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	prereqs, err := db.Query(`
+		SELECT p.module_id, p.prerequisite_id FROM module_prerequisite p
+		JOIN class_module m ON p.module_id = m.module_id
+		JOIN class_module pm ON p.prerequisite_id = pm.module_id AND pm.archive_delete_flag = TRUE
+		WHERE m.course_id = ? AND m.archive_delete_flag = TRUE
+		ORDER BY pm.position, pm.module_id`, courseID)
+	if err != nil {
+		return nil, err
+	}
+	for prereqs.Next() {
+		var moduleID, prerequisiteID int
+		if err := prereqs.Scan(&moduleID, &prerequisiteID); err != nil {
+			prereqs.Close()
+			return nil, err
+		}
+		m := &modules[index[moduleID]]
+		m.PrerequisiteIDs = append(m.PrerequisiteIDs, prerequisiteID)
+	}
+	prereqs.Close()
+	if err := prereqs.Err(); err != nil {
+		return nil, err
+	}
+
+	// Students only see live assignments
+	published := ""
+	if studentID != 0 {
+		published = ` AND ` + visibleToStudents("a")
+	}
+	items, err := db.Query(`
+		SELECT mi.module_id, mi.item_type, mi.content_id, mi.position, mt.title, NULL,
+		EXISTS (SELECT 1 FROM material_completion WHERE material_id = mt.material_id AND student_id = ?)
+		FROM module_item mi
+		JOIN class_module m ON mi.module_id = m.module_id
+		JOIN material mt ON mi.content_id = mt.material_id AND mt.archive_delete_flag = TRUE
+		WHERE mi.item_type = 'material' AND m.course_id = ? AND m.archive_delete_flag = TRUE
+		UNION ALL
+		SELECT mi.module_id, mi.item_type, mi.content_id, mi.position, a.title, a.due_date,
+		EXISTS (SELECT 1 FROM submission s
+			WHERE s.assignment_id = a.assignment_id AND s.archive_delete_flag = TRUE AND `+submissionOwnedBy+`)
+		FROM module_item mi
+		JOIN class_module m ON mi.module_id = m.module_id
+		JOIN assignment a ON mi.content_id = a.assignment_id AND a.archive_delete_flag = TRUE`+published+`
+		WHERE mi.item_type = 'assignment' AND m.course_id = ? AND m.archive_delete_flag = TRUE
+		ORDER BY 1, 4`, studentID, courseID, studentID, studentID, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer items.Close()
+
+	for items.Next() {
+		var moduleID int
+		var item models.ModuleItem
+		var completed bool
+		if err := items.Scan(&moduleID, &item.ItemType, &item.ContentID, &item.Position, &item.Title, &item.DueDate, &completed); err != nil {
+			return nil, err
+		}
+		if studentID != 0 {
+			item.Completed = &completed
+		}
+		m := &modules[index[moduleID]]
+		m.Items = append(m.Items, item)
+	}
+	if err := items.Err(); err != nil {
+		return nil, err
+	}
+
+	if studentID != 0 {
+		applyModuleProgress(modules, time.Now())
+	}
+	return modules, nil
+}
+
+// applyModuleProgress works out the student's status of each module from the completion of its items.
+// A module is locked outside its unlock and lock times or while any prerequisite has items left to complete.
+func applyModuleProgress(modules []models.Module, now time.Time) {
+	done := map[int]bool{}
+	titles := map[int]string{}
+	for _, m := range modules {
+		complete := true
+		for _, item := range m.Items {
+			if item.Completed == nil || !*item.Completed {
+				complete = false
+				break
+			}
+		}
+		done[m.ModuleID] = complete
+		titles[m.ModuleID] = m.Title
+	}
+
+	for i := range modules {
+		m := &modules[i]
+		switch {
+		case m.UnlockAt != nil && now.Before(*m.UnlockAt):
+			m.Status = moduleLocked
+			m.LockedReason = "Unlocks at " + m.UnlockAt.Format(time.RFC3339)
+		case m.LockAt != nil && !now.Before(*m.LockAt):
+			m.Status = moduleLocked
+			m.LockedReason = "Locked since " + m.LockAt.Format(time.RFC3339)
+		default:
+			m.Status = moduleAvailable
+			if done[m.ModuleID] {
+				m.Status = moduleCompleted
+			}
+			for _, id := range m.PrerequisiteIDs {
+				if !done[id] {
+					m.Status = moduleLocked
+					m.LockedReason = fmt.Sprintf("Complete %q first", titles[id])
+					break
+				}
+			}
+		}
+	}
+}
+
+// moduleLockReason tells whether the module holding a material or assignment is locked for a student. It returns
+// an empty reason when the item is in no module or its module is open.
+func moduleLockReason(db *sql.DB, studentID int, itemType string, contentID int) (string, error) {
+	var moduleID, courseID int
+	err := db.QueryRow(`
+		SELECT m.module_id, m.course_id FROM module_item mi
+		JOIN class_module m ON mi.module_id = m.module_id
+		WHERE mi.item_type = ? AND mi.content_id = ? AND m.archive_delete_flag = TRUE`, itemType, contentID).
+		Scan(&moduleID, &courseID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	modules, err := loadModules(db, courseID, studentID)
+	if err != nil {
+		return "", err
+	}
+	for _, m := range modules {
+		if m.ModuleID == moduleID && m.Status == moduleLocked {
+			return fmt.Sprintf("Module %q is locked: %s", m.Title, m.LockedReason), nil
+		}
+	}
+	return "", nil
+}
+
+// CreateModuleHandler adds a module at the end of a classroom's modules
+func CreateModuleHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	var req ModuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	unlockAt, lockAt, err := parseModuleDates(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "classroom", courseID, permEditContent); !ok {
+		return
+	}
+
+	msg, err := checkPrerequisites(db, courseID, 0, req.PrerequisiteIDs)
+	if err != nil {
+		log.Printf("Error checking module prerequisites: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var position int
+	err = tx.QueryRow(`
+		SELECT COALESCE(MAX(position) + 1, 0) FROM class_module
+		WHERE course_id = ? AND archive_delete_flag = TRUE`, courseID).Scan(&position)
+	if err != nil {
+		log.Printf("Error querying module position: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create module"})
+		return
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO class_module (course_id, title, description, position, unlock_at, lock_at, created_at, archive_delete_flag)
+		VALUES (?, ?, ?, ?, ?, ?, NOW(), TRUE)`, courseID, req.Title, req.Description, position, unlockAt, lockAt)
+	if err != nil {
+		log.Printf("Error creating module: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create module"})
+		return
+	}
+	moduleID, _ := result.LastInsertId()
+
+	if err := setPrerequisites(tx, int(moduleID), req.PrerequisiteIDs); err != nil {
+		log.Printf("Error saving module prerequisites: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save prerequisites"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	prerequisiteIDs := req.PrerequisiteIDs
+	if prerequisiteIDs == nil {
+		prerequisiteIDs = []int{}
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Module created successfully",
+		"module": models.Module{
+			ModuleID:        int(moduleID),
+			CourseID:        courseID,
+			Title:           req.Title,
+			Description:     req.Description,
+			Position:        position,
+			UnlockAt:        unlockAt,
+			LockAt:          lockAt,
+			PrerequisiteIDs: prerequisiteIDs,
+			Items:           []models.ModuleItem{},
+			CreatedAt:       time.Now(),
+		},
+	})
+}
+
+// GetModulesHandler returns the modules of a classroom with their items in order. Students also get whether each
+// module is locked, available or completed, and which of its items they have completed.
+func GetModulesHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	studentID := 0
+	if role == "teacher" {
+		if _, ok := authorizeStaffAccess(c, db, "classroom", courseID, permViewClassroom); !ok {
+			return
+		}
+	} else {
+		studentID, err = classroomStudent(db, userID, courseID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not enrolled in this classroom"})
+			return
+		} else if err != nil {
+			log.Printf("Error checking enrollment: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	modules, err := loadModules(db, courseID, studentID)
+	if err != nil {
+		log.Printf("Error querying modules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch modules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"modules": modules})
+}
+
+// UpdateModuleHandler changes the title, description, dates and prerequisites of a module
+func UpdateModuleHandler(c *gin.Context) {
+	moduleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid module ID"})
+		return
+	}
+
+	var req ModuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	unlockAt, lockAt, err := parseModuleDates(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "module", moduleID, permEditContent); !ok {
+		return
+	}
+
+	courseID, err := moduleCourse(db, moduleID)
+	if err != nil {
+		log.Printf("Error querying module: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch module"})
+		return
+	}
+	msg, err := checkPrerequisites(db, courseID, moduleID, req.PrerequisiteIDs)
+	if err != nil {
+		log.Printf("Error checking module prerequisites: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE class_module SET title = ?, description = ?, unlock_at = ?, lock_at = ?
+		WHERE module_id = ? AND archive_delete_flag = TRUE`, req.Title, req.Description, unlockAt, lockAt, moduleID)
+	if err != nil {
+		log.Printf("Error updating module: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update module"})
+		return
+	}
+	if err := setPrerequisites(tx, moduleID, req.PrerequisiteIDs); err != nil {
+		log.Printf("Error saving module prerequisites: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save prerequisites"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Module updated successfully"})
+}
+
+// DeleteModuleHandler removes a module. Its materials and assignments stay in the classroom, outside any module,
+// and modules that required it no longer do.
+func DeleteModuleHandler(c *gin.Context) {
+	moduleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid module ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "module", moduleID, permEditContent); !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE class_module SET archive_delete_flag = FALSE WHERE module_id = ?`, moduleID); err != nil {
+		log.Printf("Error deleting module: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete module"})
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM module_item WHERE module_id = ?`, moduleID); err != nil {
+		log.Printf("Error deleting module items: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete module"})
+		return
+	}
+	if _, err := tx.Exec(`
+		DELETE FROM module_prerequisite
+		WHERE module_id = ? OR prerequisite_id = ?`, moduleID, moduleID); err != nil {
+		log.Printf("Error deleting module prerequisites: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete module"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Module deleted successfully"})
+}
+
+// ReorderModulesHandler sets the order of a classroom's modules. module_ids must list every module exactly once.
+func ReorderModulesHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	var req ModuleOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "classroom", courseID, permEditContent); !ok {
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT module_id FROM class_module
+		WHERE course_id = ? AND archive_delete_flag = TRUE`, courseID)
+	if err != nil {
+		log.Printf("Error querying modules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch modules"})
+		return
+	}
+	remaining := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			log.Printf("Error scanning module: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process modules"})
+			return
+		}
+		remaining[id] = true
+	}
+	rows.Close()
+
+	if len(req.ModuleIDs) != len(remaining) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "module_ids must list every module of the classroom exactly once"})
+		return
+	}
+	for _, id := range req.ModuleIDs {
+		if !remaining[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "module_ids must list every module of the classroom exactly once"})
+			return
+		}
+		delete(remaining, id)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	for position, id := range req.ModuleIDs {
+		if _, err := tx.Exec(`UPDATE class_module SET position = ? WHERE module_id = ?`, position, id); err != nil {
+			log.Printf("Error reordering modules: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder modules"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Modules reordered successfully"})
+}
+
+// SetModuleItemsHandler replaces the contents of a module with the given materials and assignments, in order.
+// Items already in another module of the classroom are moved here.
+func SetModuleItemsHandler(c *gin.Context) {
+	moduleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid module ID"})
+		return
+	}
+
+	var req ModuleItemsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "module", moduleID, permEditContent); !ok {
+		return
+	}
+
+	courseID, err := moduleCourse(db, moduleID)
+	if err != nil {
+		log.Printf("Error querying module: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch module"})
+		return
+	}
+
+	seen := map[ModuleItemEntry]bool{}
+	for _, item := range req.Items {
+		var query string
+		switch item.Type {
+		case moduleItemMaterial:
+			query = `SELECT EXISTS (SELECT 1 FROM material WHERE material_id = ? AND course_id = ? AND archive_delete_flag = TRUE)`
+		case moduleItemAssignment:
+			query = `SELECT EXISTS (SELECT 1 FROM assignment WHERE assignment_id = ? AND course_id = ? AND archive_delete_flag = TRUE)`
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Item type must be material or assignment"})
+			return
+		}
+		if seen[item] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s %d is listed twice", item.Type, item.ID)})
+			return
+		}
+		seen[item] = true
+
+		var exists bool
+		if err := db.QueryRow(query, item.ID, courseID).Scan(&exists); err != nil {
+			log.Printf("Error checking module item: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s %d is not in this classroom", item.Type, item.ID)})
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM module_item WHERE module_id = ?`, moduleID); err != nil {
+		log.Printf("Error clearing module items: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save module items"})
+		return
+	}
+	for position, item := range req.Items {
+		_, err := tx.Exec(`
+			INSERT INTO module_item (module_id, item_type, content_id, position)
+			VALUES (?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE module_id = VALUES(module_id), position = VALUES(position)`,
+			moduleID, item.Type, item.ID, position)
+		if err != nil {
+			log.Printf("Error saving module item: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save module items"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Module items updated successfully"})
+}
+
+// materialStudent resolves the calling student for a material of one of their classrooms and checks the material
+// is not in a locked module. It writes the error response itself.
+func materialStudent(c *gin.Context, db *sql.DB, materialID int) (int, bool) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	if role != "student" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only students can track their progress"})
+		return 0, false
+	}
+
+	var courseID int
+	err := db.QueryRow(`
+		SELECT course_id FROM material
+		WHERE material_id = ? AND archive_delete_flag = TRUE`, materialID).Scan(&courseID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Material not found"})
+		return 0, false
+	} else if err != nil {
+		log.Printf("Error querying material: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return 0, false
+	}
+
+	studentID, err := classroomStudent(db, userID, courseID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not enrolled in this classroom"})
+		return 0, false
+	} else if err != nil {
+		log.Printf("Error checking enrollment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return 0, false
+	}
+
+	reason, err := moduleLockReason(db, studentID, moduleItemMaterial, materialID)
+	if err != nil {
+		log.Printf("Error checking module lock: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return 0, false
+	}
+	if reason != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": reason})
+		return 0, false
+	}
+	return studentID, true
+}
+
+// CompleteMaterialHandler marks a material as done for the calling student
+func CompleteMaterialHandler(c *gin.Context) {
+	materialID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid material ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	studentID, ok := materialStudent(c, db, materialID)
+	if !ok {
+		return
+	}
+
+	_, err = db.Exec(`
+		INSERT IGNORE INTO material_completion (material_id, student_id, completed_at)
+		VALUES (?, ?, NOW())`, materialID, studentID)
+	if err != nil {
+		log.Printf("Error marking material complete: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark material as done"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Material marked as done"})
+}
+
+// UncompleteMaterialHandler clears the done mark of a material for the calling student
+func UncompleteMaterialHandler(c *gin.Context) {
+	materialID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid material ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	studentID, ok := materialStudent(c, db, materialID)
+	if !ok {
+		return
+	}
+
+	_, err = db.Exec(`
+		DELETE FROM material_completion
+		WHERE material_id = ? AND student_id = ?`, materialID, studentID)
+	if err != nil {
+		log.Printf("Error clearing material completion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear material completion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Material marked as not done"})
+}
@@ -0,0 +1,454 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/auth"
+	"edusync/models"
+)
+
+// Organizations are created by the operators of the service; their admins manage them from then on. Every user and
+// classroom belongs to exactly one organization, and memberships only ever join users to classrooms of their own.
+
+var (
+	hexColorPattern    = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	emailDomainPattern = regexp.MustCompile(`^[a-z0-9-]+(\.[a-z0-9-]+)+$`)
+)
+
+// OrganizationRequest is the request body for changing an organization's settings; omitted fields are left
+// unchanged and empty strings clear the branding
+type OrganizationRequest struct {
+	Name                *string   `json:"name"`
+	LogoURL             *string   `json:"logo_url"`
+	PrimaryColor        *string   `json:"primary_color"`         // #RRGGBB
+	AllowedEmailDomains *[]string `json:"allowed_email_domains"` // Replaces the whole list
+	RequireTeacher2FA   *bool     `json:"require_teacher_2fa"`
+}
+
+// OrgMemberRequest is the request body for granting or revoking a member's admin role
+type OrgMemberRequest struct {
+	IsOrgAdmin *bool `json:"is_org_admin" binding:"required"`
+}
+
+// orgMemberListSpec is the sorting and filtering of an organization's member list
+var orgMemberListSpec = listSpec{
+	Sorts: map[string]listColumn{
+		"name":       {Expr: "name", Kind: kindString},
+		"created_at": {Expr: "COALESCE(created_at, TIMESTAMP '1970-01-01 00:00:00')", Kind: kindTime},
+	},
+	DefaultSort: "name",
+	ID:          "user_id",
+	Filters: map[string]listFilter{
+		"q":            {Expr: "name", Kind: kindString, Op: "LIKE"},
+		"role":         {Expr: "role", Kind: kindString, Values: []string{"teacher", "student"}},
+		"is_org_admin": {Expr: "is_org_admin", Kind: kindBool},
+	},
+}
+
+// emailDomain returns the lowercased domain of an email address
+func emailDomain(email string) string {
+	return strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+}
+
+// orgBySlug looks up an active organization by its slug
+func orgBySlug(db *sql.DB, slug string) (int, error) {
+	var orgID int
+	err := db.QueryRow(`
+		SELECT org_id FROM organization
+		WHERE slug = ? AND archive_delete_flag = TRUE`, strings.ToLower(strings.TrimSpace(slug))).Scan(&orgID)
+	return orgID, err
+}
+
+// orgByEmailDomain finds the organization that claims an email domain. It returns sql.ErrNoRows unless exactly one
+// organization does.
+func orgByEmailDomain(db *sql.DB, domain string) (int, error) {
+	rows, err := db.Query(`
+		SELECT d.org_id FROM org_email_domain d
+		JOIN organization o ON d.org_id = o.org_id
+		WHERE d.domain = ? AND o.archive_delete_flag = TRUE
+		LIMIT 2`, domain)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var orgIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		orgIDs = append(orgIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(orgIDs) != 1 {
+		return 0, sql.ErrNoRows
+	}
+	return orgIDs[0], nil
+}
+
+// orgAllowsEmail reports whether an address may join the organization: any may when it lists no domains
+func orgAllowsEmail(db *sql.DB, orgID int, email string) (bool, error) {
+	var domains, matched int
+	err := db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(domain = ?), 0) FROM org_email_domain
+		WHERE org_id = ?`, emailDomain(email), orgID).Scan(&domains, &matched)
+	return domains == 0 || matched > 0, err
+}
+
+// loadOrganization reads an organization with its settings
+func loadOrganization(db *sql.DB, orgID interface{}) (*models.Organization, error) {
+	var org models.Organization
+	err := db.QueryRow(`
+		SELECT org_id, name, slug, logo_url, primary_color, require_teacher_2fa, created_at
+		FROM organization
+		WHERE org_id = ? AND archive_delete_flag = TRUE`, orgID).
+		Scan(&org.OrgID, &org.Name, &org.Slug, &org.LogoURL, &org.PrimaryColor, &org.RequireTeacher2FA, &org.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT domain FROM org_email_domain WHERE org_id = ? ORDER BY domain`, org.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	org.AllowedEmailDomains = []string{}
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			return nil, err
+		}
+		org.AllowedEmailDomains = append(org.AllowedEmailDomains, domain)
+	}
+	return &org, rows.Err()
+}
+
+// isOrgAdmin reports whether the user administers their organization
+func isOrgAdmin(db *sql.DB, userID interface{}) (bool, error) {
+	var isAdmin bool
+	err := db.QueryRow(`
+		SELECT is_org_admin FROM user
+		WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&isAdmin)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return isAdmin, err
+}
+
+// authorizeOrgAdmin checks that the caller administers their organization. It writes the error response itself.
+func authorizeOrgAdmin(c *gin.Context, db *sql.DB) bool {
+	userID, _ := c.Get("userID")
+
+	isAdmin, err := isOrgAdmin(db, userID)
+	if err != nil {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only organization admins can do this"})
+		return false
+	}
+	return true
+}
+
+// GetOrganizationHandler returns the caller's organization and its settings
+func GetOrganizationHandler(c *gin.Context) {
+	orgID, _ := c.Get("orgID")
+
+	db := c.MustGet("db").(*sql.DB)
+	org, err := loadOrganization(db, orgID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying organization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organization"})
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+// GetOrganizationBrandingHandler returns the public branding of an organization, for its login and registration
+// pages
+func GetOrganizationBrandingHandler(c *gin.Context) {
+	db := c.MustGet("db").(*sql.DB)
+	orgID, err := orgBySlug(db, c.Param("slug"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying organization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	org, err := loadOrganization(db, orgID)
+	if err != nil {
+		log.Printf("Error querying organization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organization"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":          org.Name,
+		"slug":          org.Slug,
+		"logo_url":      org.LogoURL,
+		"primary_color": org.PrimaryColor,
+	})
+}
+
+// UpdateOrganizationHandler changes the name, branding and allowed email domains of the caller's organization.
+// Restricting the domains only affects new registrations.
+func UpdateOrganizationHandler(c *gin.Context) {
+	orgID, _ := c.Get("orgID")
+
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if !authorizeOrgAdmin(c, db) {
+		return
+	}
+
+	org, err := loadOrganization(db, orgID)
+	if err != nil {
+		log.Printf("Error querying organization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organization"})
+		return
+	}
+
+	if req.Name != nil {
+		org.Name = strings.TrimSpace(*req.Name)
+		if org.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name cannot be empty"})
+			return
+		}
+	}
+	if req.LogoURL != nil {
+		org.LogoURL = nil
+		if url := strings.TrimSpace(*req.LogoURL); url != "" {
+			org.LogoURL = &url
+		}
+	}
+	if req.PrimaryColor != nil {
+		org.PrimaryColor = nil
+		if color := strings.TrimSpace(*req.PrimaryColor); color != "" {
+			if !hexColorPattern.MatchString(color) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "primary_color must look like #1a73e8"})
+				return
+			}
+			org.PrimaryColor = &color
+		}
+	}
+	if req.AllowedEmailDomains != nil {
+		org.AllowedEmailDomains = []string{}
+		for _, domain := range *req.AllowedEmailDomains {
+			domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "@")
+			if !emailDomainPattern.MatchString(domain) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email domain: " + domain})
+				return
+			}
+			if !slices.Contains(org.AllowedEmailDomains, domain) {
+				org.AllowedEmailDomains = append(org.AllowedEmailDomains, domain)
+			}
+		}
+		slices.Sort(org.AllowedEmailDomains)
+	}
+	if req.RequireTeacher2FA != nil {
+		org.RequireTeacher2FA = *req.RequireTeacher2FA
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE organization SET name = ?, logo_url = ?, primary_color = ?, require_teacher_2fa = ?
+		WHERE org_id = ?`, org.Name, org.LogoURL, org.PrimaryColor, org.RequireTeacher2FA, org.OrgID)
+	if err != nil {
+		log.Printf("Error updating organization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update organization"})
+		return
+	}
+	if req.AllowedEmailDomains != nil {
+		if _, err := tx.Exec(`DELETE FROM org_email_domain WHERE org_id = ?`, org.OrgID); err != nil {
+			log.Printf("Error clearing email domains: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update organization"})
+			return
+		}
+		for _, domain := range org.AllowedEmailDomains {
+			_, err := tx.Exec(`INSERT INTO org_email_domain (org_id, domain) VALUES (?, ?)`, org.OrgID, domain)
+			if err != nil {
+				log.Printf("Error inserting email domain: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update organization"})
+				return
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+// GetOrganizationMembersHandler lists the users of the caller's organization
+func GetOrganizationMembersHandler(c *gin.Context) {
+	orgID, _ := c.Get("orgID")
+
+	db := c.MustGet("db").(*sql.DB)
+	if !authorizeOrgAdmin(c, db) {
+		return
+	}
+
+	page, err := parseListPage(c, orgMemberListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT user_id, name, email, role, is_org_admin, created_at`+page.Select()+`
+		FROM user
+		WHERE org_id = ? AND archive_delete_flag = TRUE`+page.Where()+page.OrderLimit(),
+		append([]interface{}{orgID}, page.Args()...)...)
+	if err != nil {
+		log.Printf("Error querying organization members: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	members := []models.OrgMember{}
+	for rows.Next() && page.Next() {
+		var m models.OrgMember
+		if err := rows.Scan(page.Dest(&m.UserID, &m.Name, &m.Email, &m.Role, &m.IsOrgAdmin, &m.CreatedAt)...); err != nil {
+			log.Printf("Error scanning organization member: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process members"})
+			return
+		}
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating organization members: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	page.SetNextCursor(c)
+	c.JSON(http.StatusOK, members)
+}
+
+// UpdateOrganizationMemberHandler grants or revokes a member's admin role. Admins cannot revoke their own, so an
+// organization always keeps one.
+func UpdateOrganizationMemberHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	orgID, _ := c.Get("orgID")
+
+	memberID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req OrgMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if !authorizeOrgAdmin(c, db) {
+		return
+	}
+	if memberID == userID && !*req.IsOrgAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Admins cannot revoke their own admin role"})
+		return
+	}
+
+	var m models.OrgMember
+	err = db.QueryRow(`
+		SELECT user_id, name, email, role, created_at FROM user
+		WHERE user_id = ? AND org_id = ? AND archive_delete_flag = TRUE`, memberID, orgID).
+		Scan(&m.UserID, &m.Name, &m.Email, &m.Role, &m.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if _, err := db.Exec(`UPDATE user SET is_org_admin = ? WHERE user_id = ?`, *req.IsOrgAdmin, memberID); err != nil {
+		log.Printf("Error updating organization admin: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member"})
+		return
+	}
+
+	m.IsOrgAdmin = *req.IsOrgAdmin
+	c.JSON(http.StatusOK, m)
+}
+
+// UnlockOrganizationMemberHandler lifts a login lockout on a member's account
+func UnlockOrganizationMemberHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	orgID, _ := c.Get("orgID")
+
+	memberID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if !authorizeOrgAdmin(c, db) {
+		return
+	}
+
+	var email string
+	err = db.QueryRow(`
+		SELECT email FROM user
+		WHERE user_id = ? AND org_id = ? AND archive_delete_flag = TRUE`, memberID, orgID).Scan(&email)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	guard := c.MustGet("loginGuard").(*auth.LoginGuard)
+	if err := guard.Unlock(db, memberID, email, userID.(int)); err != nil {
+		log.Printf("Error unlocking user %d: %v", memberID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_id": memberID, "message": "Account unlocked"})
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// List endpoints share these query parameters:
+//
+//	limit   rows per page, 1 to maxListLimit, defaultListLimit when omitted
+//	sort    one of the endpoint's sort keys, prefixed with - for descending order
+//	cursor  the X-Next-Cursor header of the previous page
+//
+// and the filters the endpoint declares, such as status=graded or due_before=2025-05-01.
+// Pages are keyset-based, so rows added or removed between requests do not shift them.
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 100
+)
+
+// nextCursorHeader carries the cursor of the following page; it is left out on the last page
+const nextCursorHeader = "X-Next-Cursor"
+
+// Value kinds of sort keys and filters
+const (
+	kindString = iota
+	kindInt
+	kindTime // Filters take RFC 3339 or YYYY-MM-DD
+	kindBool
+)
+
+// listColumn is an SQL expression a list can be sorted on
+type listColumn struct {
+	Expr string
+	Kind int
+}
+
+// listFilter is a query parameter restricting a list
+type listFilter struct {
+	Expr   string
+	Kind   int
+	Op     string   // Comparison operator, = when empty; LIKE matches the value anywhere in a string
+	Values []string // Accepted values of a string filter, any when empty
+}
+
+// listSpec declares the sorting and filtering a list endpoint supports
+type listSpec struct {
+	Sorts       map[string]listColumn // Expressions must not be NULL; wrap nullable columns in COALESCE
+	DefaultSort string
+	ID          string // Unique column that orders rows with equal sort values
+	Filters     map[string]listFilter
+}
+
+// likeEscaper makes wildcards in a LIKE filter value match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// listCursor is the position after the last row of a page
+type listCursor struct {
+	Sort  string `json:"sort"`
+	Value string `json:"value"`
+	ID    int64  `json:"id"`
+}
+
+// listPage holds a request's list parameters and follows the rows read for the page.
+//
+//	page, err := parseListPage(c, spec)
+//	rows, err := db.Query(`SELECT a, b`+page.Select()+` FROM t WHERE ...`+page.Where()+page.OrderLimit(), append(args, page.Args()...)...)
+//	for rows.Next() && page.Next() {
+//		rows.Scan(page.Dest(&a, &b)...)
+//	}
+//	page.SetNextCursor(c)
+type listPage struct {
+	spec   listSpec
+	sort   string
+	column listColumn
+	desc   bool
+	limit  int
+	conds  []string
+	args   []interface{}
+
+	rows      int
+	more      bool
+	lastValue interface{}
+	lastID    int64
+}
+
+// parseListPage reads the list parameters of a request. Errors are meant for the client.
+func parseListPage(c *gin.Context, spec listSpec) (*listPage, error) {
+	p := &listPage{spec: spec, limit: defaultListLimit, sort: spec.DefaultSort}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			return nil, fmt.Errorf("Invalid limit, expected 1 to %d", maxListLimit)
+		}
+		p.limit = limit
+	}
+
+	if raw := c.Query("sort"); raw != "" {
+		p.sort = raw
+	}
+	column, ok := spec.Sorts[strings.TrimPrefix(p.sort, "-")]
+	if !ok {
+		keys := make([]string, 0, len(spec.Sorts))
+		for key := range spec.Sorts {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("Invalid sort, expected one of %s", strings.Join(keys, ", "))
+	}
+	p.column = column
+	p.desc = strings.HasPrefix(p.sort, "-")
+
+	// Walk the filters in a fixed order so the same request always builds the same query
+	names := make([]string, 0, len(spec.Filters))
+	for name := range spec.Filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		f := spec.Filters[name]
+		value, err := parseListValue(f.Kind, raw, true)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %v", name, err)
+		}
+		if len(f.Values) > 0 && !slices.Contains(f.Values, raw) {
+			return nil, fmt.Errorf("Invalid %s, expected one of %s", name, strings.Join(f.Values, ", "))
+		}
+		op := f.Op
+		if op == "" {
+			op = "="
+		}
+		if op == "LIKE" {
+			value = "%" + likeEscaper.Replace(raw) + "%"
+		}
+		p.conds = append(p.conds, f.Expr+" "+op+" ?")
+		p.args = append(p.args, value)
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		var cursor listCursor
+		decoded, err := base64.RawURLEncoding.DecodeString(raw)
+		if err == nil {
+			err = json.Unmarshal(decoded, &cursor)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cursor")
+		}
+		if cursor.Sort != p.sort {
+			return nil, fmt.Errorf("Cursor was issued for a different sort")
+		}
+		value, err := parseListValue(p.column.Kind, cursor.Value, false)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cursor")
+		}
+		cmp := ">"
+		if p.desc {
+			cmp = "<"
+		}
+		p.conds = append(p.conds, fmt.Sprintf("(%s %s ? OR (%s = ? AND %s %s ?))",
+			p.column.Expr, cmp, p.column.Expr, spec.ID, cmp))
+		p.args = append(p.args, value, value, cursor.ID)
+	}
+	return p, nil
+}
+
+// parseListValue converts a filter or cursor value to the kind of its column
+func parseListValue(kind int, raw string, filter bool) (interface{}, error) {
+	switch kind {
+	case kindInt:
+		return strconv.ParseInt(raw, 10, 64)
+	case kindBool:
+		if filter {
+			return strconv.ParseBool(raw)
+		}
+		return strconv.ParseInt(raw, 10, 64)
+	case kindTime:
+		if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+			return t, nil
+		}
+		if !filter {
+			return nil, fmt.Errorf("expected a timestamp")
+		}
+		t, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return nil, fmt.Errorf("expected RFC 3339 or YYYY-MM-DD")
+		}
+		return t, nil
+	}
+	return raw, nil
+}
+
+// Select returns the extra columns the page reads its cursor from, to append to the SELECT list
+func (p *listPage) Select() string {
+	return ", " + p.column.Expr + ", " + p.spec.ID
+}
+
+// Where returns the filter and cursor conditions, to append to an existing WHERE clause
+func (p *listPage) Where() string {
+	if len(p.conds) == 0 {
+		return ""
+	}
+	return " AND " + strings.Join(p.conds, " AND ")
+}
+
+// Args returns the arguments of the Where conditions
+func (p *listPage) Args() []interface{} {
+	return p.args
+}
+
+// OrderLimit returns the ORDER BY and LIMIT clauses. One row more than the page is fetched to tell whether
+// another page follows.
+func (p *listPage) OrderLimit() string {
+	dir := "ASC"
+	if p.desc {
+		dir = "DESC"
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, %s %s LIMIT %d", p.column.Expr, dir, p.spec.ID, dir, p.limit+1)
+}
+
+// Next reports whether the row about to be read belongs to the page
+func (p *listPage) Next() bool {
+	if p.rows == p.limit {
+		p.more = true
+		return false
+	}
+	p.rows++
+	return true
+}
+
+// Dest appends the page's cursor columns to a row's scan destinations
+func (p *listPage) Dest(dest ...interface{}) []interface{} {
+	return append(dest, &p.lastValue, &p.lastID)
+}
+
+// SetNextCursor sets the X-Next-Cursor header when another page follows
+func (p *listPage) SetNextCursor(c *gin.Context) {
+	if !p.more {
+		return
+	}
+	cursor := listCursor{Sort: p.sort, ID: p.lastID}
+	switch v := p.lastValue.(type) {
+	case time.Time:
+		cursor.Value = v.Format(time.RFC3339Nano)
+	case []byte:
+		cursor.Value = string(v)
+	default:
+		cursor.Value = fmt.Sprint(v)
+	}
+	encoded, _ := json.Marshal(cursor)
+	c.Header(nextCursorHeader, base64.RawURLEncoding.EncodeToString(encoded))
+}
@@ -0,0 +1,624 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/models"
+)
+
+// PeerReviewSettingsRequest is the request body for enabling peer review on an assignment
+type PeerReviewSettingsRequest struct {
+	ReviewsPerSubmission int                      `json:"reviews_per_submission" binding:"required,min=1"`
+	ReviewDueDate        string                   `json:"review_due_date" binding:"required"`
+	Rubric               []models.RubricCriterion `json:"rubric"`       // Optional; reviews without a rubric are comments only
+	GradeWeight          float64                  `json:"grade_weight"` // Share of the final grade taken from peer scores, 0 to leave grades alone
+}
+
+// PeerReviewRequest is the request body for submitting a peer review
+type PeerReviewRequest struct {
+	Scores   []float64 `json:"scores"` // Points for each rubric criterion, in rubric order
+	Comments string    `json:"comments"`
+}
+
+// validate checks the request against the rubric and returns the share of points awarded, or nil without a rubric
+func (r *PeerReviewRequest) validate(rubric []models.RubricCriterion) (*float64, string) {
+	r.Comments = strings.TrimSpace(r.Comments)
+	if len(rubric) == 0 {
+		if len(r.Scores) > 0 {
+			return nil, "This peer review has no rubric to score"
+		}
+		if r.Comments == "" {
+			return nil, "comments are required"
+		}
+		return nil, ""
+	}
+
+	if len(r.Scores) != len(rubric) {
+		return nil, "scores must have one entry per rubric criterion"
+	}
+	var earned, possible float64
+	for i, criterion := range rubric {
+		if r.Scores[i] < 0 || r.Scores[i] > criterion.MaxPoints {
+			return nil, "Score for " + strconv.Quote(criterion.Criterion) + " must be between 0 and " +
+				strconv.FormatFloat(criterion.MaxPoints, 'f', -1, 64)
+		}
+		earned += r.Scores[i]
+		possible += criterion.MaxPoints
+	}
+	score := earned / possible
+	return &score, ""
+}
+
+// loadPeerReviewSettings fetches the peer review settings of an assignment, or sql.ErrNoRows if peer review is off
+func loadPeerReviewSettings(db *sql.DB, assignmentID int) (models.PeerReviewSettings, error) {
+	var s models.PeerReviewSettings
+	var rubric []byte
+	err := db.QueryRow(`
+		SELECT assignment_id, reviews_per_submission, review_due_date, rubric, grade_weight, assigned_at
+		FROM peer_review_settings
+		WHERE assignment_id = ? AND archive_delete_flag = TRUE`, assignmentID).
+		Scan(&s.AssignmentID, &s.ReviewsPerSubmission, &s.ReviewDueDate, &rubric, &s.GradeWeight, &s.AssignedAt)
+	if err != nil {
+		return s, err
+	}
+	s.Rubric = []models.RubricCriterion{}
+	if err := json.Unmarshal(rubric, &s.Rubric); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// SetPeerReviewHandler enables peer review on an assignment or updates its settings.
+// Once reviews have been handed out only the review due date and grade weight can change.
+func SetPeerReviewHandler(c *gin.Context) {
+	assignmentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		return
+	}
+
+	var req PeerReviewSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	reviewDueDate, err := time.Parse(time.RFC3339, req.ReviewDueDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review_due_date format, expected YYYY-MM-DDThh:mm:ssZ (e.g., 2025-05-10T14:30:00Z)"})
+		return
+	}
+	if req.GradeWeight < 0 || req.GradeWeight > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "grade_weight must be between 0 and 1"})
+		return
+	}
+	if req.Rubric == nil {
+		req.Rubric = []models.RubricCriterion{}
+	}
+	for i := range req.Rubric {
+		req.Rubric[i].Criterion = strings.TrimSpace(req.Rubric[i].Criterion)
+		if req.Rubric[i].Criterion == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Every rubric criterion needs a name"})
+			return
+		}
+		if req.Rubric[i].MaxPoints <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_points of every rubric criterion must be positive"})
+			return
+		}
+	}
+	if req.GradeWeight > 0 && len(req.Rubric) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A rubric is required to blend peer scores into grades"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "assignment", assignmentID, permEditContent); !ok {
+		return
+	}
+
+	var dueDate time.Time
+	var isGroup bool
+	err = db.QueryRow(`
+		SELECT due_date, is_group_assignment FROM assignment
+		WHERE assignment_id = ? AND archive_delete_flag = TRUE`, assignmentID).Scan(&dueDate, &isGroup)
+	if err != nil {
+		log.Printf("Error querying assignment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignment"})
+		return
+	}
+	if isGroup {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Group assignments cannot be peer reviewed"})
+		return
+	}
+	quiz, err := isQuiz(db, assignmentID)
+	if err != nil {
+		log.Printf("Error checking quiz: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if quiz {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quizzes cannot be peer reviewed"})
+		return
+	}
+	if !reviewDueDate.After(dueDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "review_due_date must be after the assignment due date"})
+		return
+	}
+
+	current, err := loadPeerReviewSettings(db, assignmentID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error querying peer review settings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	rubric, _ := json.Marshal(req.Rubric)
+	if err == nil && current.AssignedAt != nil {
+		currentRubric, _ := json.Marshal(current.Rubric)
+		if req.ReviewsPerSubmission != current.ReviewsPerSubmission || string(rubric) != string(currentRubric) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Reviews have already been assigned; only review_due_date and grade_weight can change"})
+			return
+		}
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO peer_review_settings (assignment_id, reviews_per_submission, review_due_date, rubric, grade_weight, archive_delete_flag)
+		VALUES (?, ?, ?, ?, ?, TRUE)
+		ON DUPLICATE KEY UPDATE reviews_per_submission = VALUES(reviews_per_submission),
+		review_due_date = VALUES(review_due_date), rubric = VALUES(rubric), grade_weight = VALUES(grade_weight),
+		archive_delete_flag = TRUE`,
+		assignmentID, req.ReviewsPerSubmission, reviewDueDate, string(rubric), req.GradeWeight)
+	if err != nil {
+		log.Printf("Error saving peer review settings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save peer review settings"})
+		return
+	}
+
+	settings := models.PeerReviewSettings{
+		AssignmentID:         assignmentID,
+		ReviewsPerSubmission: req.ReviewsPerSubmission,
+		ReviewDueDate:        reviewDueDate,
+		Rubric:               req.Rubric,
+		GradeWeight:          req.GradeWeight,
+		AssignedAt:           current.AssignedAt,
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Peer review settings saved successfully",
+		"peer_review": settings,
+	})
+}
+
+// GetAssignmentPeerReviewsHandler returns the peer review settings of an assignment.
+// Teachers also get the aggregated peer score of every submission; students get the reviews assigned to them.
+func GetAssignmentPeerReviewsHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+
+	assignmentID, err := strconv.Atoi(c.Param("assignment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	var studentID int
+	if role == "teacher" {
+		if _, ok := authorizeStaffAccess(c, db, "assignment", assignmentID, permViewClassroom); !ok {
+			return
+		}
+	} else {
+		studentID, _, err = assignmentStudent(db, userID, assignmentID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+			return
+		} else if err != nil {
+			log.Printf("Error checking peer review access: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	settings, err := loadPeerReviewSettings(db, assignmentID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Peer review is not enabled for this assignment"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying peer review settings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch peer review settings"})
+		return
+	}
+
+	if role != "teacher" {
+		reviews, err := queryPeerReviews(db, `pr.reviewer_id = ? AND s.assignment_id = ?`, false, studentID, assignmentID)
+		if err != nil {
+			log.Printf("Error querying assigned peer reviews: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch peer reviews"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"peer_review": settings, "assigned_reviews": reviews})
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT s.submission_id, s.student_id, u.name, a.max_points,
+		COUNT(pr.review_id), COUNT(pr.submitted_at), AVG(pr.score)
+		FROM submission s
+		JOIN assignment a ON s.assignment_id = a.assignment_id
+		JOIN student st ON s.student_id = st.student_id
+		JOIN user u ON st.user_id = u.user_id
+		LEFT JOIN peer_review pr ON pr.submission_id = s.submission_id
+		WHERE s.assignment_id = ? AND s.archive_delete_flag = TRUE
+		GROUP BY s.submission_id, s.student_id, u.name, a.max_points
+		ORDER BY u.name`, assignmentID)
+	if err != nil {
+		log.Printf("Error querying peer scores: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch peer scores"})
+		return
+	}
+	defer rows.Close()
+
+	submissions := []gin.H{}
+	for rows.Next() {
+		var submissionID, authorID, maxPoints, assigned, submitted int
+		var name string
+		var score sql.NullFloat64
+		if err := rows.Scan(&submissionID, &authorID, &name, &maxPoints, &assigned, &submitted, &score); err != nil {
+			log.Printf("Error scanning peer score: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process peer scores"})
+			return
+		}
+		entry := gin.H{
+			"submission_id":     submissionID,
+			"student_id":        authorID,
+			"student_name":      name,
+			"reviews_assigned":  assigned,
+			"reviews_submitted": submitted,
+			"peer_score":        nil,
+			"peer_points":       nil,
+		}
+		if score.Valid {
+			entry["peer_score"] = score.Float64
+			entry["peer_points"] = math.Round(score.Float64*float64(maxPoints)*100) / 100
+		}
+		submissions = append(submissions, entry)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating peer scores: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch peer scores"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"peer_review": settings, "submissions": submissions})
+}
+
+// queryPeerReviews lists the peer reviews matching the condition, which may refer to peer_review pr and submission s.
+// Reviewer names are included only when withReviewer is set.
+func queryPeerReviews(db *sql.DB, condition string, withReviewer bool, args ...interface{}) ([]models.PeerReview, error) {
+	rows, err := db.Query(`
+		SELECT pr.review_id, pr.submission_id, pr.reviewer_id, u.name, pr.status, pr.scores, pr.comments, pr.score,
+		pr.assigned_at, pr.submitted_at
+		FROM peer_review pr
+		JOIN submission s ON pr.submission_id = s.submission_id
+		JOIN student st ON pr.reviewer_id = st.student_id
+		JOIN user u ON st.user_id = u.user_id
+		WHERE s.archive_delete_flag = TRUE AND `+condition+`
+		ORDER BY pr.review_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []models.PeerReview{}
+	for rows.Next() {
+		var r models.PeerReview
+		var reviewerID int
+		var reviewerName string
+		var scores []byte
+		if err := rows.Scan(&r.ReviewID, &r.SubmissionID, &reviewerID, &reviewerName, &r.Status, &scores, &r.Comments,
+			&r.Score, &r.AssignedAt, &r.SubmittedAt); err != nil {
+			return nil, err
+		}
+		if len(scores) > 0 {
+			if err := json.Unmarshal(scores, &r.Scores); err != nil {
+				return nil, err
+			}
+		}
+		if withReviewer {
+			r.ReviewerID = &reviewerID
+			r.ReviewerName = &reviewerName
+		}
+		reviews = append(reviews, r)
+	}
+	return reviews, rows.Err()
+}
+
+// peerReviewAccess resolves a review for the caller. Teachers with access to the classroom see everything;
+// students may only open reviews assigned to them.
+func peerReviewAccess(c *gin.Context, db *sql.DB, reviewID int, perm string) (models.PeerReview, int, bool) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+
+	var assignmentID, reviewerUserID int
+	err := db.QueryRow(`
+		SELECT s.assignment_id, st.user_id FROM peer_review pr
+		JOIN submission s ON pr.submission_id = s.submission_id
+		JOIN student st ON pr.reviewer_id = st.student_id
+		WHERE pr.review_id = ? AND s.archive_delete_flag = TRUE`, reviewID).Scan(&assignmentID, &reviewerUserID)
+	if err == sql.ErrNoRows || (err == nil && role != "teacher" && userID != reviewerUserID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Peer review not found"})
+		return models.PeerReview{}, 0, false
+	} else if err != nil {
+		log.Printf("Error querying peer review: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch peer review"})
+		return models.PeerReview{}, 0, false
+	}
+
+	reviews, err := queryPeerReviews(db, `pr.review_id = ?`, role == "teacher", reviewID)
+	if err != nil || len(reviews) == 0 {
+		log.Printf("Error querying peer review: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch peer review"})
+		return models.PeerReview{}, 0, false
+	}
+	review := reviews[0]
+
+	if role == "teacher" {
+		if _, ok := authorizeStaffAccess(c, db, "submission", review.SubmissionID, perm); !ok {
+			return models.PeerReview{}, 0, false
+		}
+	}
+	return review, assignmentID, true
+}
+
+// GetPeerReviewHandler returns a review together with the anonymized submission it is about
+func GetPeerReviewHandler(c *gin.Context) {
+	role, _ := c.Get("role")
+
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	review, assignmentID, ok := peerReviewAccess(c, db, reviewID, permViewClassroom)
+	if !ok {
+		return
+	}
+
+	settings, err := loadPeerReviewSettings(db, assignmentID)
+	if err != nil {
+		log.Printf("Error querying peer review settings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch peer review settings"})
+		return
+	}
+
+	var content, sourceCode sql.NullString
+	var submittedAt time.Time
+	var authorID int
+	var authorName string
+	err = db.QueryRow(`
+		SELECT s.content, s.source_code, s.submitted_at, s.student_id, u.name
+		FROM submission s
+		JOIN student st ON s.student_id = st.student_id
+		JOIN user u ON st.user_id = u.user_id
+		WHERE s.submission_id = ?`, review.SubmissionID).Scan(&content, &sourceCode, &submittedAt, &authorID, &authorName)
+	if err != nil {
+		log.Printf("Error querying reviewed submission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch submission"})
+		return
+	}
+
+	submission := gin.H{
+		"submission_id": review.SubmissionID,
+		"content":       content.String,
+		"source_code":   sourceCode.String,
+		"submitted_at":  submittedAt,
+	}
+	// The author stays anonymous to the reviewer
+	if role == "teacher" {
+		submission["student_id"] = authorID
+		submission["student_name"] = authorName
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"review":          review,
+		"submission":      submission,
+		"rubric":          settings.Rubric,
+		"review_due_date": settings.ReviewDueDate,
+	})
+}
+
+// SubmitPeerReviewHandler saves the assigned student's scores and comments. A review can be revised until the
+// review due date.
+func SubmitPeerReviewHandler(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != "student" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the assigned student can submit a peer review"})
+		return
+	}
+
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review ID"})
+		return
+	}
+
+	var req PeerReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	review, assignmentID, ok := peerReviewAccess(c, db, reviewID, permViewClassroom)
+	if !ok {
+		return
+	}
+
+	if !requireWritableClassroom(c, db, "submission", review.SubmissionID) {
+		return
+	}
+
+	settings, err := loadPeerReviewSettings(db, assignmentID)
+	if err != nil {
+		log.Printf("Error querying peer review settings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch peer review settings"})
+		return
+	}
+	if time.Now().After(settings.ReviewDueDate) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The review due date has passed"})
+		return
+	}
+
+	score, msg := req.validate(settings.Rubric)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	var scores interface{}
+	if len(req.Scores) > 0 {
+		encoded, _ := json.Marshal(req.Scores)
+		scores = string(encoded)
+	}
+
+	_, err = db.Exec(`
+		UPDATE peer_review SET status = 'submitted', scores = ?, comments = ?, score = ?, submitted_at = NOW()
+		WHERE review_id = ?`, scores, req.Comments, score, reviewID)
+	if err != nil {
+		log.Printf("Error saving peer review: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save peer review"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Peer review submitted successfully",
+		"review_id": reviewID,
+		"scores":    req.Scores,
+		"comments":  req.Comments,
+		"score":     score,
+	})
+}
+
+// GetSubmissionPeerReviewsHandler lists the reviews of a submission. Grading staff see every review with its
+// reviewer; the submitting student sees the completed reviews anonymously once the review due date has passed.
+func GetSubmissionPeerReviewsHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+
+	submissionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	var assignmentID, authorUserID int
+	err = db.QueryRow(`
+		SELECT s.assignment_id, st.user_id FROM submission s
+		JOIN student st ON s.student_id = st.student_id
+		WHERE s.submission_id = ? AND s.archive_delete_flag = TRUE`, submissionID).Scan(&assignmentID, &authorUserID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying submission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch submission"})
+		return
+	}
+
+	teacher := role == "teacher"
+	if teacher {
+		if _, ok := authorizeStaffAccess(c, db, "submission", submissionID, permViewClassroom); !ok {
+			return
+		}
+	} else if userID != authorUserID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found"})
+		return
+	}
+
+	settings, err := loadPeerReviewSettings(db, assignmentID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Peer review is not enabled for this assignment"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying peer review settings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch peer review settings"})
+		return
+	}
+	if !teacher && time.Now().Before(settings.ReviewDueDate) {
+		c.JSON(http.StatusOK, gin.H{
+			"rubric":          settings.Rubric,
+			"review_due_date": settings.ReviewDueDate,
+			"reviews":         []models.PeerReview{},
+		})
+		return
+	}
+
+	condition := `pr.submission_id = ?`
+	if !teacher {
+		condition += ` AND pr.status = 'submitted'`
+	}
+	reviews, err := queryPeerReviews(db, condition, teacher, submissionID)
+	if err != nil {
+		log.Printf("Error querying peer reviews: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch peer reviews"})
+		return
+	}
+
+	var total float64
+	scored := 0
+	for _, r := range reviews {
+		if r.Status == "submitted" && r.Score != nil {
+			total += *r.Score
+			scored++
+		}
+	}
+	var peerScore *float64
+	if scored > 0 {
+		average := total / float64(scored)
+		peerScore = &average
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rubric":          settings.Rubric,
+		"review_due_date": settings.ReviewDueDate,
+		"reviews":         reviews,
+		"peer_score":      peerScore,
+	})
+}
+
+// peerGrade blends a teacher's score with the average peer score of a submission by the assignment's grade weight.
+// The teacher's score is returned unchanged when peer review is off, unweighted or has no scored reviews.
+func peerGrade(tx *sql.Tx, submissionID, teacherScore int) (int, *float64, error) {
+	var weight float64
+	var maxPoints int
+	var peerScore sql.NullFloat64
+	err := tx.QueryRow(`
+		SELECT p.grade_weight, a.max_points, (
+			SELECT AVG(pr.score) FROM peer_review pr
+			WHERE pr.submission_id = s.submission_id AND pr.status = 'submitted'
+		)
+		FROM submission s
+		JOIN assignment a ON s.assignment_id = a.assignment_id
+		JOIN peer_review_settings p ON p.assignment_id = a.assignment_id AND p.archive_delete_flag = TRUE
+		WHERE s.submission_id = ?`, submissionID).Scan(&weight, &maxPoints, &peerScore)
+	if err == sql.ErrNoRows {
+		return teacherScore, nil, nil
+	} else if err != nil {
+		return 0, nil, err
+	}
+	if weight == 0 || !peerScore.Valid {
+		return teacherScore, nil, nil
+	}
+
+	peerPoints := peerScore.Float64 * float64(maxPoints)
+	blended := int(math.Round((1-weight)*float64(teacherScore) + weight*peerPoints))
+	return blended, &peerPoints, nil
+}
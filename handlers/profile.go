@@ -0,0 +1,433 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/storage"
+	"edusync/utils"
+)
+
+// maxProfilePatchBytes caps the size of a profile merge patch
+const maxProfilePatchBytes = 64 << 10
+
+// maxPictureBytes caps the size of an uploaded profile picture
+const maxPictureBytes = 5 << 20
+
+// pictureSizes are the square sizes, in pixels, a profile picture is stored at. The first is the full picture.
+var pictureSizes = []int{512, 128, 48}
+
+var contactNumberPattern = regexp.MustCompile(`^\+?[0-9][0-9 ()-]{4,17}[0-9]$`)
+
+// profileFields is the editable part of a profile
+type profileFields struct {
+	name           string
+	contactNumber  *string
+	removePicture  bool
+	dept           *string
+	gradeLevel     *string
+	enrollmentYear *int
+}
+
+// pictureKeys lists the storage keys of a stored profile picture, largest first
+func pictureKeys(prefix string) []string {
+	keys := make([]string, len(pictureSizes))
+	for i, size := range pictureSizes {
+		keys[i] = prefix + "/" + strconv.Itoa(size) + ".jpg"
+	}
+	return keys
+}
+
+// profileThumbnails maps each stored size of a profile picture to its URL
+func profileThumbnails(store storage.Store, prefix string) map[string]string {
+	thumbnails := make(map[string]string, len(pictureSizes))
+	for i, key := range pictureKeys(prefix) {
+		thumbnails[strconv.Itoa(pictureSizes[i])] = store.URL(key)
+	}
+	return thumbnails
+}
+
+// removePicture deletes the files of a profile picture that is no longer referenced. Failures are only logged,
+// since the picture is already unlinked from the profile.
+func removePicture(c *gin.Context, prefix *string) {
+	if prefix == nil {
+		return
+	}
+	store := c.MustGet("storage").(storage.Store)
+	for _, key := range pictureKeys(*prefix) {
+		if err := store.Delete(key); err != nil {
+			log.Printf("Error deleting profile picture %s: %v", key, err)
+		}
+	}
+}
+
+// optionalString decodes a merge patch member that may be a string or null. Blank strings count as null.
+func optionalString(raw json.RawMessage, field string, maxLen int) (*string, error) {
+	var value *string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, fmt.Errorf("%s must be a string or null", field)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	trimmed := strings.TrimSpace(*value)
+	if trimmed == "" {
+		return nil, nil
+	}
+	if utf8.RuneCountInString(trimmed) > maxLen {
+		return nil, fmt.Errorf("%s must be at most %d characters", field, maxLen)
+	}
+	return &trimmed, nil
+}
+
+// patchMembers decodes a merge patch object and returns its members in name order, so the first invalid member
+// reported does not depend on map iteration
+func patchMembers(raw json.RawMessage, field string) (map[string]json.RawMessage, []string, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil || members == nil {
+		return nil, nil, fmt.Errorf("%s must be an object", field)
+	}
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return members, names, nil
+}
+
+// applyProfilePatch applies a JSON merge patch (RFC 7386) shaped like the GET /api/profile response: a "user" object
+// with the shared fields and a "teacher" or "student" object with the role's own. Members set to null are cleared.
+func applyProfilePatch(fields *profileFields, role string, raw json.RawMessage) error {
+	patch, sections, err := patchMembers(raw, "Request body")
+	if err != nil {
+		return err
+	}
+
+	for _, section := range sections {
+		if section != "user" && section != role {
+			return fmt.Errorf("%s cannot be changed", section)
+		}
+		members, names, err := patchMembers(patch[section], section)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			value := members[name]
+			field := section + "." + name
+			switch section + "." + name {
+			case "user.name":
+				var updated string
+				if err := json.Unmarshal(value, &updated); err != nil {
+					return fmt.Errorf("%s must be a string", field)
+				}
+				updated = strings.TrimSpace(updated)
+				if updated == "" {
+					return fmt.Errorf("%s cannot be empty", field)
+				}
+				if utf8.RuneCountInString(updated) > 100 {
+					return fmt.Errorf("%s must be at most 100 characters", field)
+				}
+				fields.name = updated
+			case "user.contact_number":
+				number, err := optionalString(value, field, 20)
+				if err != nil {
+					return err
+				}
+				if number != nil && !contactNumberPattern.MatchString(*number) {
+					return fmt.Errorf("%s must be a phone number such as +1 555-010-0199", field)
+				}
+				fields.contactNumber = number
+			case "user.profile_picture":
+				if string(value) != "null" {
+					return fmt.Errorf("%s can only be removed here; upload a new picture to /api/profile/picture", field)
+				}
+				fields.removePicture = true
+			case "user.email":
+				return fmt.Errorf("%s is changed through /api/account/email", field)
+			case "user.org", "user.org_id", "user.is_org_admin":
+				return fmt.Errorf("%s is managed by organization admins", field)
+			case "teacher.dept":
+				dept, err := optionalString(value, field, 100)
+				if err != nil {
+					return err
+				}
+				fields.dept = dept
+			case "student.grade_level":
+				grade, err := optionalString(value, field, 20)
+				if err != nil {
+					return err
+				}
+				fields.gradeLevel = grade
+			case "student.enrollment_year":
+				var year *int
+				if err := json.Unmarshal(value, &year); err != nil {
+					return fmt.Errorf("%s must be a whole number or null", field)
+				}
+				if year != nil && (*year < 1900 || *year > time.Now().Year()+1) {
+					return fmt.Errorf("%s must be between 1900 and next year", field)
+				}
+				fields.enrollmentYear = year
+			default:
+				return fmt.Errorf("%s cannot be changed", field)
+			}
+		}
+	}
+	return nil
+}
+
+// UpdateProfileHandler updates the caller's profile from a JSON merge patch and returns the updated profile. Teachers
+// and students share the user fields and patch their own fields under "teacher" or "student".
+func UpdateProfileHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	roleName, _ := role.(string)
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxProfilePatchBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Request body is larger than %d bytes", maxProfilePatchBytes)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var fields profileFields
+	var oldPicture *string
+	err = tx.QueryRow(`
+		SELECT name, contact_number, profile_picture_key FROM user
+		WHERE user_id = ? AND archive_delete_flag = TRUE
+		FOR UPDATE`, userID).Scan(&fields.name, &fields.contactNumber, &oldPicture)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if roleName == "teacher" {
+		err = tx.QueryRow(`
+			SELECT dept FROM teacher
+			WHERE user_id = ? AND archive_delete_flag = TRUE
+			FOR UPDATE`, userID).Scan(&fields.dept)
+	} else {
+		err = tx.QueryRow(`
+			SELECT grade_level, enrollment_year FROM student
+			WHERE user_id = ? AND archive_delete_flag = TRUE
+			FOR UPDATE`, userID).Scan(&fields.gradeLevel, &fields.enrollmentYear)
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying %s profile: %v", roleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := applyProfilePatch(&fields, roleName, body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Pictures are only removed here; uploads go through UploadProfilePictureHandler
+	_, err = tx.Exec(`
+		UPDATE user SET name = ?, contact_number = ?,
+		profile_picture = IF(?, NULL, profile_picture), profile_picture_key = IF(?, NULL, profile_picture_key)
+		WHERE user_id = ?`, fields.name, fields.contactNumber, fields.removePicture, fields.removePicture, userID)
+	if err != nil {
+		log.Printf("Error updating user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+	if roleName == "teacher" {
+		_, err = tx.Exec(`
+			UPDATE teacher SET dept = ?
+			WHERE user_id = ? AND archive_delete_flag = TRUE`, fields.dept, userID)
+	} else {
+		_, err = tx.Exec(`
+			UPDATE student SET grade_level = ?, enrollment_year = ?
+			WHERE user_id = ? AND archive_delete_flag = TRUE`, fields.gradeLevel, fields.enrollmentYear, userID)
+	}
+	if err != nil {
+		log.Printf("Error updating %s profile: %v", roleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	if fields.removePicture {
+		removePicture(c, oldPicture)
+	}
+
+	GetProfileHandler(c)
+}
+
+// UploadProfilePictureHandler stores a new profile picture for the caller. The upload is cropped to a square and
+// kept at each of pictureSizes; the previous picture is deleted.
+func UploadProfilePictureHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxPictureBytes)
+	header, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Picture is larger than %d bytes", maxPictureBytes)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Picture file is required"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		log.Printf("Error opening picture: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read picture"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		log.Printf("Error reading picture: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read picture"})
+		return
+	}
+
+	img, err := storage.DecodeImage(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid picture: " + err.Error()})
+		return
+	}
+
+	suffix, err := utils.GenerateToken(9)
+	if err != nil {
+		log.Printf("Error generating picture name: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store picture"})
+		return
+	}
+	// A fresh key for every upload keeps caches from serving the old picture
+	prefix := fmt.Sprintf("avatars/%d/%s", userID, suffix)
+	store := c.MustGet("storage").(storage.Store)
+	keys := pictureKeys(prefix)
+	for i, size := range pictureSizes {
+		encoded, err := storage.EncodeJPEG(storage.SquareThumbnail(img, size))
+		if err == nil {
+			err = store.Put(keys[i], encoded)
+		}
+		if err != nil {
+			log.Printf("Error storing profile picture %s: %v", keys[i], err)
+			removePicture(c, &prefix)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store picture"})
+			return
+		}
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		removePicture(c, &prefix)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var oldPicture *string
+	err = tx.QueryRow(`
+		SELECT profile_picture_key FROM user
+		WHERE user_id = ? AND archive_delete_flag = TRUE
+		FOR UPDATE`, userID).Scan(&oldPicture)
+	if err == nil {
+		_, err = tx.Exec(`
+			UPDATE user SET profile_picture = ?, profile_picture_key = ?
+			WHERE user_id = ?`, store.URL(keys[0]), prefix, userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error saving profile picture: %v", err)
+		removePicture(c, &prefix)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save picture"})
+		return
+	}
+
+	removePicture(c, oldPicture)
+
+	c.JSON(http.StatusOK, gin.H{
+		"profile_picture":    store.URL(keys[0]),
+		"profile_thumbnails": profileThumbnails(store, prefix),
+	})
+}
+
+// DeleteProfilePictureHandler removes the caller's profile picture
+func DeleteProfilePictureHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	db := c.MustGet("db").(*sql.DB)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var oldPicture *string
+	err = tx.QueryRow(`
+		SELECT profile_picture_key FROM user
+		WHERE user_id = ? AND archive_delete_flag = TRUE
+		FOR UPDATE`, userID).Scan(&oldPicture)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	_, err = tx.Exec(`
+		UPDATE user SET profile_picture = NULL, profile_picture_key = NULL
+		WHERE user_id = ?`, userID)
+	if err != nil {
+		log.Printf("Error removing profile picture: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove picture"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	removePicture(c, oldPicture)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Profile picture removed"})
+}
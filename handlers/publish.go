@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Publication states shared by announcements and assignments
+const (
+	statusDraft     = "draft"
+	statusScheduled = "scheduled"
+	statusPublished = "published"
+)
+
+// resolvePublication works out the status and publish time for an announcement or assignment.
+// publishAt is an optional RFC 3339 timestamp from the request; currentPublishAt holds the stored
+// publish time when updating an existing row and is empty when creating one.
+func resolvePublication(isDraft bool, publishAt *string, currentPublishAt sql.NullTime) (string, *time.Time, error) {
+	now := time.Now()
+
+	var when *time.Time
+	if publishAt != nil {
+		parsed, err := time.Parse(time.RFC3339, *publishAt)
+		if err != nil {
+			return "", nil, err
+		}
+		when = &parsed
+	} else if currentPublishAt.Valid {
+		// Without a new time, scheduled items keep their slot and live items keep their original time
+		when = &currentPublishAt.Time
+	}
+
+	if isDraft {
+		return statusDraft, when, nil
+	}
+	if when == nil {
+		return statusPublished, &now, nil
+	}
+	if when.After(now) {
+		return statusScheduled, when, nil
+	}
+	return statusPublished, when, nil
+}
+
+// visibleToStudents is the SQL condition under which an announcement or assignment is live for students: published,
+// or scheduled with its publish time passed. alias qualifies the columns and may be empty.
+func visibleToStudents(alias string) string {
+	if alias != "" {
+		alias += "."
+	}
+	return "(" + alias + "status = '" + statusPublished + "' OR (" + alias + "status = '" + statusScheduled + "' AND " +
+		alias + "publish_at <= NOW()))"
+}
@@ -0,0 +1,738 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/models"
+)
+
+// Quiz question types
+const (
+	questionMultipleChoice = "multiple_choice"
+	questionMultiSelect    = "multi_select"
+	questionTrueFalse      = "true_false"
+	questionNumeric        = "numeric"
+	questionShortAnswer    = "short_answer"
+)
+
+// QuestionBankRequest is the request body for creating a question bank
+type QuestionBankRequest struct {
+	Title string `json:"title" binding:"required"`
+}
+
+// QuizQuestionRequest is the request body for creating or updating a quiz question.
+// correct_answer is an option index for multiple_choice, a list of option indexes for multi_select,
+// a boolean for true_false, a number for numeric and an optional reference answer for short_answer.
+type QuizQuestionRequest struct {
+	Type          string          `json:"question_type" binding:"required"`
+	Prompt        string          `json:"prompt" binding:"required"`
+	Options       []string        `json:"options"`
+	CorrectAnswer json.RawMessage `json:"correct_answer"`
+	Tolerance     float64         `json:"tolerance"`
+	Points        *float64        `json:"points"`
+}
+
+// QuizSettingsRequest is the request body for turning an assignment into a quiz
+type QuizSettingsRequest struct {
+	BankID           int  `json:"bank_id" binding:"required"`
+	QuestionCount    *int `json:"question_count"`     // Draw this many questions per attempt; all of the bank when omitted
+	TimeLimitMinutes *int `json:"time_limit_minutes"` // No limit when omitted
+	MaxAttempts      int  `json:"max_attempts"`
+	ShuffleQuestions bool `json:"shuffle_questions"`
+	ShuffleOptions   bool `json:"shuffle_options"`
+}
+
+// quizAnswerKey is what is needed to score one question
+type quizAnswerKey struct {
+	Type      string
+	Options   int
+	Correct   json.RawMessage
+	Tolerance float64
+	Points    float64
+}
+
+// validate checks the question against its type and returns a message for the client when it is invalid
+func (r *QuizQuestionRequest) validate() string {
+	if r.Points == nil {
+		one := 1.0
+		r.Points = &one
+	}
+	if *r.Points <= 0 {
+		return "points must be positive"
+	}
+
+	switch r.Type {
+	case questionMultipleChoice, questionMultiSelect:
+		if len(r.Options) < 2 {
+			return "At least two options are required"
+		}
+		key := quizAnswerKey{Type: r.Type, Options: len(r.Options)}
+		if len(r.CorrectAnswer) == 0 || !key.validAnswer(r.CorrectAnswer) {
+			return "correct_answer must reference the options by index"
+		}
+	case questionTrueFalse:
+		var b bool
+		if json.Unmarshal(r.CorrectAnswer, &b) != nil {
+			return "correct_answer must be true or false"
+		}
+		r.Options = nil
+	case questionNumeric:
+		var f float64
+		if json.Unmarshal(r.CorrectAnswer, &f) != nil {
+			return "correct_answer must be a number"
+		}
+		if r.Tolerance < 0 {
+			return "tolerance cannot be negative"
+		}
+		r.Options = nil
+	case questionShortAnswer:
+		// The reference answer is only shown to graders
+		var s *string
+		if len(r.CorrectAnswer) > 0 && json.Unmarshal(r.CorrectAnswer, &s) != nil {
+			return "correct_answer must be text"
+		}
+		r.Options = nil
+	default:
+		return "Invalid question_type"
+	}
+	return ""
+}
+
+// validAnswer reports whether a student's answer has the shape the question type expects
+func (k quizAnswerKey) validAnswer(answer json.RawMessage) bool {
+	switch k.Type {
+	case questionMultipleChoice:
+		var i int
+		return json.Unmarshal(answer, &i) == nil && i >= 0 && i < k.Options
+	case questionMultiSelect:
+		var list []int
+		if json.Unmarshal(answer, &list) != nil || len(list) == 0 {
+			return false
+		}
+		for _, i := range list {
+			if i < 0 || i >= k.Options {
+				return false
+			}
+		}
+		return true
+	case questionTrueFalse:
+		var b bool
+		return json.Unmarshal(answer, &b) == nil
+	case questionNumeric:
+		var f float64
+		return json.Unmarshal(answer, &f) == nil
+	case questionShortAnswer:
+		var s string
+		return json.Unmarshal(answer, &s) == nil
+	}
+	return false
+}
+
+// score returns the points earned by an answer, or nil when a short answer is waiting for manual review.
+// A missing answer scores zero.
+func (k quizAnswerKey) score(answer json.RawMessage) *float64 {
+	zero, full := 0.0, k.Points
+	if len(answer) == 0 || string(answer) == "null" {
+		return &zero
+	}
+
+	switch k.Type {
+	case questionMultipleChoice:
+		var got, want int
+		if json.Unmarshal(answer, &got) == nil && json.Unmarshal(k.Correct, &want) == nil && got == want {
+			return &full
+		}
+	case questionMultiSelect:
+		var got, want []int
+		if json.Unmarshal(answer, &got) == nil && json.Unmarshal(k.Correct, &want) == nil && sameIndexSet(got, want) {
+			return &full
+		}
+	case questionTrueFalse:
+		var got, want bool
+		if json.Unmarshal(answer, &got) == nil && json.Unmarshal(k.Correct, &want) == nil && got == want {
+			return &full
+		}
+	case questionNumeric:
+		var got, want float64
+		if json.Unmarshal(answer, &got) == nil && json.Unmarshal(k.Correct, &want) == nil &&
+			math.Abs(got-want) <= k.Tolerance+1e-9 {
+			return &full
+		}
+	case questionShortAnswer:
+		var text string
+		if json.Unmarshal(answer, &text) == nil && strings.TrimSpace(text) != "" {
+			return nil
+		}
+	}
+	return &zero
+}
+
+// sameIndexSet reports whether two lists of option indexes select the same options
+func sameIndexSet(a, b []int) bool {
+	set := map[int]bool{}
+	for _, i := range a {
+		set[i] = true
+	}
+	want := map[int]bool{}
+	for _, i := range b {
+		want[i] = true
+	}
+	if len(set) != len(want) {
+		return false
+	}
+	for i := range want {
+		if !set[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateQuestionBankHandler creates a question bank in a classroom
+func CreateQuestionBankHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	var req QuestionBankRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "classroom", courseID, permEditContent); !ok {
+		return
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO question_bank (course_id, title, created_at, archive_delete_flag)
+		VALUES (?, ?, NOW(), TRUE)`, courseID, req.Title)
+	if err != nil {
+		log.Printf("Error creating question bank: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create question bank"})
+		return
+	}
+	bankID, _ := result.LastInsertId()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Question bank created successfully",
+		"bank_id":   bankID,
+		"course_id": courseID,
+		"title":     req.Title,
+	})
+}
+
+// GetQuestionBanksHandler lists the question banks of a classroom
+func GetQuestionBanksHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "classroom", courseID, permViewClassroom); !ok {
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT b.bank_id, b.course_id, b.title, b.created_at,
+		(SELECT COUNT(*) FROM quiz_question q WHERE q.bank_id = b.bank_id AND q.archive_delete_flag = TRUE)
+		FROM question_bank b
+		WHERE b.course_id = ? AND b.archive_delete_flag = TRUE
+		ORDER BY b.created_at DESC`, courseID)
+	if err != nil {
+		log.Printf("Error querying question banks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch question banks"})
+		return
+	}
+	defer rows.Close()
+
+	banks := []models.QuestionBank{}
+	for rows.Next() {
+		var b models.QuestionBank
+		if err := rows.Scan(&b.BankID, &b.CourseID, &b.Title, &b.CreatedAt, &b.QuestionCount); err != nil {
+			log.Printf("Error scanning question bank: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process question banks"})
+			return
+		}
+		banks = append(banks, b)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"question_banks": banks})
+}
+
+// DeleteQuestionBankHandler soft deletes a question bank that no quiz draws from
+func DeleteQuestionBankHandler(c *gin.Context) {
+	bankID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question bank ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "question_bank", bankID, permEditContent); !ok {
+		return
+	}
+
+	var inUse bool
+	err = db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM quiz q
+			JOIN assignment a ON q.assignment_id = a.assignment_id
+			WHERE q.bank_id = ? AND q.archive_delete_flag = TRUE AND a.archive_delete_flag = TRUE
+		)`, bankID).Scan(&inUse)
+	if err != nil {
+		log.Printf("Error checking question bank usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusConflict, gin.H{"error": "Question bank is used by a quiz"})
+		return
+	}
+
+	_, err = db.Exec(`
+		UPDATE question_bank SET archive_delete_flag = FALSE
+		WHERE bank_id = ?`, bankID)
+	if err != nil {
+		log.Printf("Error deleting question bank: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete question bank"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Question bank deleted successfully"})
+}
+
+// CreateQuizQuestionHandler adds a question to a question bank
+func CreateQuizQuestionHandler(c *gin.Context) {
+	bankID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question bank ID"})
+		return
+	}
+
+	var req QuizQuestionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "question_bank", bankID, permEditContent); !ok {
+		return
+	}
+
+	options, correct := questionColumns(req)
+	result, err := db.Exec(`
+		INSERT INTO quiz_question (bank_id, question_type, prompt, options, correct_answer, tolerance, points, created_at, archive_delete_flag)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NOW(), TRUE)`,
+		bankID, req.Type, req.Prompt, options, correct, req.Tolerance, *req.Points)
+	if err != nil {
+		log.Printf("Error creating quiz question: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create question"})
+		return
+	}
+	questionID, _ := result.LastInsertId()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":     "Question created successfully",
+		"question_id": questionID,
+		"bank_id":     bankID,
+	})
+}
+
+// questionColumns encodes the JSON columns of a question, using NULL for absent values
+func questionColumns(req QuizQuestionRequest) (options, correct interface{}) {
+	if len(req.Options) > 0 {
+		encoded, _ := json.Marshal(req.Options)
+		options = string(encoded)
+	}
+	if len(req.CorrectAnswer) > 0 && string(req.CorrectAnswer) != "null" {
+		correct = string(req.CorrectAnswer)
+	}
+	return options, correct
+}
+
+// GetQuizQuestionsHandler lists the questions of a question bank, including answers
+func GetQuizQuestionsHandler(c *gin.Context) {
+	bankID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question bank ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "question_bank", bankID, permEditContent); !ok {
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT question_id, bank_id, question_type, prompt, options, correct_answer, tolerance, points
+		FROM quiz_question
+		WHERE bank_id = ? AND archive_delete_flag = TRUE
+		ORDER BY question_id`, bankID)
+	if err != nil {
+		log.Printf("Error querying quiz questions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+		return
+	}
+	defer rows.Close()
+
+	questions := []models.QuizQuestion{}
+	for rows.Next() {
+		var q models.QuizQuestion
+		var options, correct []byte
+		if err := rows.Scan(&q.QuestionID, &q.BankID, &q.Type, &q.Prompt, &options, &correct, &q.Tolerance, &q.Points); err != nil {
+			log.Printf("Error scanning quiz question: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process questions"})
+			return
+		}
+		if len(options) > 0 {
+			json.Unmarshal(options, &q.Options)
+		}
+		if len(correct) > 0 {
+			q.CorrectAnswer = correct
+		}
+		questions = append(questions, q)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"questions": questions})
+}
+
+// UpdateQuizQuestionHandler replaces a quiz question. Answers already scored keep their points.
+func UpdateQuizQuestionHandler(c *gin.Context) {
+	questionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question ID"})
+		return
+	}
+
+	var req QuizQuestionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "question", questionID, permEditContent); !ok {
+		return
+	}
+
+	// Option indexes are stored in attempts, so the options of a question already drawn must keep their positions
+	var drawn bool
+	var oldOptions []byte
+	err = db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM quiz_answer WHERE question_id = ?), options
+		FROM quiz_question WHERE question_id = ?`, questionID, questionID).Scan(&drawn, &oldOptions)
+	if err != nil {
+		log.Printf("Error checking question usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var previous []string
+	if len(oldOptions) > 0 {
+		json.Unmarshal(oldOptions, &previous)
+	}
+	if drawn && len(previous) != len(req.Options) {
+		c.JSON(http.StatusConflict, gin.H{"error": "The number of options cannot change once the question has been used in an attempt"})
+		return
+	}
+
+	options, correct := questionColumns(req)
+	_, err = db.Exec(`
+		UPDATE quiz_question
+		SET question_type = ?, prompt = ?, options = ?, correct_answer = ?, tolerance = ?, points = ?
+		WHERE question_id = ? AND archive_delete_flag = TRUE`,
+		req.Type, req.Prompt, options, correct, req.Tolerance, *req.Points, questionID)
+	if err != nil {
+		log.Printf("Error updating quiz question: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update question"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Question updated successfully", "question_id": questionID})
+}
+
+// DeleteQuizQuestionHandler soft deletes a quiz question so it is no longer drawn into new attempts
+func DeleteQuizQuestionHandler(c *gin.Context) {
+	questionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "question", questionID, permEditContent); !ok {
+		return
+	}
+
+	_, err = db.Exec(`
+		UPDATE quiz_question SET archive_delete_flag = FALSE
+		WHERE question_id = ?`, questionID)
+	if err != nil {
+		log.Printf("Error deleting quiz question: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete question"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Question deleted successfully"})
+}
+
+// SetQuizHandler turns an assignment into a quiz or updates its quiz settings
+func SetQuizHandler(c *gin.Context) {
+	assignmentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		return
+	}
+
+	var req QuizSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if req.MaxAttempts == 0 {
+		req.MaxAttempts = 1
+	}
+	if req.MaxAttempts < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_attempts must be positive"})
+		return
+	}
+	if req.QuestionCount != nil && *req.QuestionCount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "question_count must be positive"})
+		return
+	}
+	if req.TimeLimitMinutes != nil && *req.TimeLimitMinutes <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "time_limit_minutes must be positive"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "assignment", assignmentID, permEditContent); !ok {
+		return
+	}
+
+	var courseID int
+	var isGroup bool
+	err = db.QueryRow(`
+		SELECT course_id, is_group_assignment FROM assignment
+		WHERE assignment_id = ? AND archive_delete_flag = TRUE`, assignmentID).Scan(&courseID, &isGroup)
+	if err != nil {
+		log.Printf("Error querying assignment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignment"})
+		return
+	}
+	if isGroup {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Group assignments cannot be quizzes"})
+		return
+	}
+	code, err := isCodeAssignment(db, assignmentID)
+	if err != nil {
+		log.Printf("Error checking code assignment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if code {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code assignments cannot be quizzes"})
+		return
+	}
+	if _, err := loadPeerReviewSettings(db, assignmentID); err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Peer-reviewed assignments cannot be quizzes"})
+		return
+	} else if err != sql.ErrNoRows {
+		log.Printf("Error checking peer review: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// The bank must belong to the same classroom
+	var bankCourseID int
+	err = db.QueryRow(`
+		SELECT course_id FROM question_bank
+		WHERE bank_id = ? AND archive_delete_flag = TRUE`, req.BankID).Scan(&bankCourseID)
+	if err == sql.ErrNoRows || (err == nil && bankCourseID != courseID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Question bank not found in this classroom"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying question bank: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Regular submissions and quiz attempts cannot be mixed
+	var hasSubmissions bool
+	err = db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM submission s
+			WHERE s.assignment_id = ? AND s.archive_delete_flag = TRUE
+			AND NOT EXISTS (SELECT 1 FROM quiz_attempt qa WHERE qa.submission_id = s.submission_id)
+		)`, assignmentID).Scan(&hasSubmissions)
+	if err != nil {
+		log.Printf("Error checking submissions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if hasSubmissions {
+		c.JSON(http.StatusConflict, gin.H{"error": "Assignment already has submissions and cannot become a quiz"})
+		return
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO quiz (assignment_id, bank_id, question_count, time_limit_minutes, max_attempts,
+		shuffle_questions, shuffle_options, archive_delete_flag)
+		VALUES (?, ?, ?, ?, ?, ?, ?, TRUE)
+		ON DUPLICATE KEY UPDATE bank_id = VALUES(bank_id), question_count = VALUES(question_count),
+		time_limit_minutes = VALUES(time_limit_minutes), max_attempts = VALUES(max_attempts),
+		shuffle_questions = VALUES(shuffle_questions), shuffle_options = VALUES(shuffle_options),
+		archive_delete_flag = TRUE`,
+		assignmentID, req.BankID, req.QuestionCount, req.TimeLimitMinutes, req.MaxAttempts,
+		req.ShuffleQuestions, req.ShuffleOptions)
+	if err != nil {
+		log.Printf("Error saving quiz settings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save quiz settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Quiz settings saved successfully",
+		"quiz": models.Quiz{
+			AssignmentID:     assignmentID,
+			BankID:           req.BankID,
+			QuestionCount:    req.QuestionCount,
+			TimeLimitMinutes: req.TimeLimitMinutes,
+			MaxAttempts:      req.MaxAttempts,
+			ShuffleQuestions: req.ShuffleQuestions,
+			ShuffleOptions:   req.ShuffleOptions,
+		},
+	})
+}
+
+// loadQuiz fetches the quiz settings of an assignment, or sql.ErrNoRows if it is not a quiz
+func loadQuiz(db *sql.DB, assignmentID int) (models.Quiz, error) {
+	var q models.Quiz
+	err := db.QueryRow(`
+		SELECT assignment_id, bank_id, question_count, time_limit_minutes, max_attempts, shuffle_questions, shuffle_options
+		FROM quiz
+		WHERE assignment_id = ? AND archive_delete_flag = TRUE`, assignmentID).
+		Scan(&q.AssignmentID, &q.BankID, &q.QuestionCount, &q.TimeLimitMinutes, &q.MaxAttempts, &q.ShuffleQuestions, &q.ShuffleOptions)
+	return q, err
+}
+
+// isQuiz reports whether an assignment is a quiz
+func isQuiz(db *sql.DB, assignmentID int) (bool, error) {
+	var quiz bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM quiz WHERE assignment_id = ? AND archive_delete_flag = TRUE
+		)`, assignmentID).Scan(&quiz)
+	return quiz, err
+}
+
+// GetQuizHandler returns the quiz settings of an assignment. Students also get their own attempts.
+func GetQuizHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+
+	assignmentID, err := strconv.Atoi(c.Param("assignment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	var studentID int
+	if role == "teacher" {
+		if _, ok := authorizeStaffAccess(c, db, "assignment", assignmentID, permViewClassroom); !ok {
+			return
+		}
+	} else {
+		studentID, _, err = assignmentStudent(db, userID, assignmentID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+			return
+		} else if err != nil {
+			log.Printf("Error checking quiz access: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	quiz, err := loadQuiz(db, assignmentID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment is not a quiz"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying quiz: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quiz"})
+		return
+	}
+
+	if role == "teacher" {
+		c.JSON(http.StatusOK, gin.H{"quiz": quiz})
+		return
+	}
+
+	attempts, err := quizAttempts(db, assignmentID, studentID)
+	if err != nil {
+		log.Printf("Error querying quiz attempts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attempts"})
+		return
+	}
+
+	// Students do not see which bank questions are drawn from
+	c.JSON(http.StatusOK, gin.H{
+		"quiz": gin.H{
+			"assignment_id":      quiz.AssignmentID,
+			"question_count":     quiz.QuestionCount,
+			"time_limit_minutes": quiz.TimeLimitMinutes,
+			"max_attempts":       quiz.MaxAttempts,
+		},
+		"attempts":           attempts,
+		"attempts_remaining": max(quiz.MaxAttempts-len(attempts), 0),
+	})
+}
+
+// quizAttempts lists a student's attempts at a quiz, oldest first
+func quizAttempts(db *sql.DB, assignmentID, studentID int) ([]models.QuizAttempt, error) {
+	rows, err := db.Query(`
+		SELECT attempt_id, assignment_id, student_id, submission_id, attempt_number, status,
+		started_at, expires_at, submitted_at, points_earned, points_possible
+		FROM quiz_attempt
+		WHERE assignment_id = ? AND student_id = ?
+		ORDER BY attempt_number`, assignmentID, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []models.QuizAttempt{}
+	for rows.Next() {
+		var a models.QuizAttempt
+		if err := rows.Scan(&a.AttemptID, &a.AssignmentID, &a.StudentID, &a.SubmissionID, &a.AttemptNumber, &a.Status,
+			&a.StartedAt, &a.ExpiresAt, &a.SubmittedAt, &a.PointsEarned, &a.PointsPossible); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
@@ -0,0 +1,745 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/models"
+)
+
+// quizSubmitGrace allows for network latency when an attempt is submitted right at its deadline
+const quizSubmitGrace = 30 * time.Second
+
+// QuizAnswerRequest is one answer in a quiz attempt submission. Options are referenced by their option_id.
+type QuizAnswerRequest struct {
+	QuestionID int             `json:"question_id" binding:"required"`
+	Answer     json.RawMessage `json:"answer"`
+}
+
+// SubmitQuizAttemptRequest is the request body for submitting a quiz attempt
+type SubmitQuizAttemptRequest struct {
+	Answers []QuizAnswerRequest `json:"answers"`
+}
+
+// QuestionScore is a grader's score for a short answer in a quiz attempt
+type QuestionScore struct {
+	QuestionID int     `json:"question_id" binding:"required"`
+	Points     float64 `json:"points"`
+}
+
+// drawnQuestion is a question drawn from the bank into a new attempt
+type drawnQuestion struct {
+	ID      int
+	Options int
+	Points  float64
+}
+
+// attemptQuestions returns the questions of an attempt in the order they were presented,
+// with options in their presented order. Correct answers are only included when reveal is set.
+func attemptQuestions(db *sql.DB, attemptID int, reveal bool) ([]gin.H, error) {
+	rows, err := db.Query(`
+		SELECT q.question_id, q.question_type, q.prompt, q.options, q.correct_answer, q.points,
+		qa.option_order, qa.answer, qa.points_awarded
+		FROM quiz_answer qa
+		JOIN quiz_question q ON qa.question_id = q.question_id
+		WHERE qa.attempt_id = ?
+		ORDER BY qa.position`, attemptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	questions := []gin.H{}
+	for rows.Next() {
+		var questionID int
+		var qType, prompt string
+		var points float64
+		var options, correct, optionOrder, answer []byte
+		var awarded *float64
+		if err := rows.Scan(&questionID, &qType, &prompt, &options, &correct, &points, &optionOrder, &answer, &awarded); err != nil {
+			return nil, err
+		}
+
+		var texts []string
+		var order []int
+		if len(options) > 0 {
+			json.Unmarshal(options, &texts)
+		}
+		if len(optionOrder) > 0 {
+			json.Unmarshal(optionOrder, &order)
+		}
+		presented := []gin.H{}
+		for _, i := range order {
+			if i < len(texts) {
+				presented = append(presented, gin.H{"option_id": i, "text": texts[i]})
+			}
+		}
+
+		question := gin.H{
+			"question_id":    questionID,
+			"question_type":  qType,
+			"prompt":         prompt,
+			"points":         points,
+			"options":        presented,
+			"answer":         nil,
+			"points_awarded": awarded,
+		}
+		if len(answer) > 0 {
+			question["answer"] = json.RawMessage(answer)
+		}
+		if reveal && len(correct) > 0 {
+			question["correct_answer"] = json.RawMessage(correct)
+		}
+		questions = append(questions, question)
+	}
+	return questions, rows.Err()
+}
+
+// loadQuizAttempt fetches a single attempt
+func loadQuizAttempt(db *sql.DB, attemptID int) (models.QuizAttempt, error) {
+	var a models.QuizAttempt
+	err := db.QueryRow(`
+		SELECT attempt_id, assignment_id, student_id, submission_id, attempt_number, status,
+		started_at, expires_at, submitted_at, points_earned, points_possible
+		FROM quiz_attempt
+		WHERE attempt_id = ?`, attemptID).
+		Scan(&a.AttemptID, &a.AssignmentID, &a.StudentID, &a.SubmissionID, &a.AttemptNumber, &a.Status,
+			&a.StartedAt, &a.ExpiresAt, &a.SubmittedAt, &a.PointsEarned, &a.PointsPossible)
+	return a, err
+}
+
+// expireQuizAttempt closes an in-progress attempt whose time ran out. It still counts as an attempt.
+func expireQuizAttempt(db *sql.DB, attemptID int) error {
+	_, err := db.Exec(`
+		UPDATE quiz_attempt SET status = 'expired', points_earned = 0
+		WHERE attempt_id = ? AND status = 'in_progress'`, attemptID)
+	return err
+}
+
+// refreshQuizSubmission sets the score of a quiz submission from the best of its attempts, scaled to the
+// assignment's max points. The submission stays in needs_review while any attempt has unreviewed short answers.
+func refreshQuizSubmission(tx *sql.Tx, submissionID int) error {
+	_, err := tx.Exec(`
+		UPDATE submission s
+		JOIN assignment a ON s.assignment_id = a.assignment_id
+		SET s.score = (
+			SELECT ROUND(MAX(qa.points_earned / NULLIF(qa.points_possible, 0)) * a.max_points)
+			FROM quiz_attempt qa
+			WHERE qa.submission_id = s.submission_id AND qa.status IN ('graded', 'needs_review')
+		),
+		s.status = IF(EXISTS (
+			SELECT 1 FROM quiz_attempt qa
+			WHERE qa.submission_id = s.submission_id AND qa.status = 'needs_review'
+		), 'needs_review', 'graded')
+		WHERE s.submission_id = ?`, submissionID)
+	return err
+}
+
+// StartQuizAttemptHandler starts a new attempt at a quiz, or resumes the student's attempt in progress
+func StartQuizAttemptHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	if role != "student" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only students can take quizzes"})
+		return
+	}
+
+	assignmentID, err := strconv.Atoi(c.Param("assignment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	studentID, courseID, err := assignmentStudent(db, userID, assignmentID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error checking quiz access: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	quiz, err := loadQuiz(db, assignmentID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment is not a quiz"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying quiz: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quiz"})
+		return
+	}
+
+	if !requireWritableClassroom(c, db, "classroom", courseID) {
+		return
+	}
+
+	reason, err := moduleLockReason(db, studentID, moduleItemAssignment, assignmentID)
+	if err != nil {
+		log.Printf("Error checking module lock: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if reason != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": reason})
+		return
+	}
+
+	var dueDate time.Time
+	err = db.QueryRow(`
+		SELECT due_date FROM assignment
+		WHERE assignment_id = ? AND archive_delete_flag = TRUE`, assignmentID).Scan(&dueDate)
+	if err != nil {
+		log.Printf("Error querying assignment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignment"})
+		return
+	}
+	now := time.Now()
+	if now.After(dueDate) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Due date is over. You cannot start this quiz"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the student so parallel starts cannot both pass the attempt count below
+	var locked int
+	err = tx.QueryRow(`SELECT student_id FROM student WHERE student_id = ? FOR UPDATE`, studentID).Scan(&locked)
+	if err != nil {
+		log.Printf("Error locking student: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Resume the attempt in progress, or close it if its time ran out
+	var openID int
+	var openExpires *time.Time
+	err = tx.QueryRow(`
+		SELECT attempt_id, expires_at FROM quiz_attempt
+		WHERE assignment_id = ? AND student_id = ? AND status = 'in_progress'`, assignmentID, studentID).
+		Scan(&openID, &openExpires)
+	if err == nil {
+		if openExpires == nil || now.Before(*openExpires) {
+			respondQuizAttempt(c, db, openID, http.StatusOK)
+			return
+		}
+		if err := expireQuizAttempt(db, openID); err != nil {
+			log.Printf("Error expiring quiz attempt: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	} else if err != sql.ErrNoRows {
+		log.Printf("Error querying open quiz attempt: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var used int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM quiz_attempt
+		WHERE assignment_id = ? AND student_id = ?`, assignmentID, studentID).Scan(&used)
+	if err != nil {
+		log.Printf("Error counting quiz attempts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if used >= quiz.MaxAttempts {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No attempts remaining"})
+		return
+	}
+
+	// Draw the questions for this attempt
+	rows, err := db.Query(`
+		SELECT question_id, options, points FROM quiz_question
+		WHERE bank_id = ? AND archive_delete_flag = TRUE
+		ORDER BY question_id`, quiz.BankID)
+	if err != nil {
+		log.Printf("Error querying quiz questions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+		return
+	}
+	var drawn []drawnQuestion
+	for rows.Next() {
+		var q drawnQuestion
+		var options []byte
+		if err := rows.Scan(&q.ID, &options, &q.Points); err != nil {
+			rows.Close()
+			log.Printf("Error scanning quiz question: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process questions"})
+			return
+		}
+		var texts []string
+		if len(options) > 0 {
+			json.Unmarshal(options, &texts)
+		}
+		q.Options = len(texts)
+		drawn = append(drawn, q)
+	}
+	rows.Close()
+	if len(drawn) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quiz has no questions"})
+		return
+	}
+
+	if quiz.QuestionCount != nil && *quiz.QuestionCount < len(drawn) {
+		rand.Shuffle(len(drawn), func(i, j int) { drawn[i], drawn[j] = drawn[j], drawn[i] })
+		drawn = drawn[:*quiz.QuestionCount]
+		if !quiz.ShuffleQuestions {
+			sort.Slice(drawn, func(i, j int) bool { return drawn[i].ID < drawn[j].ID })
+		}
+	} else if quiz.ShuffleQuestions {
+		rand.Shuffle(len(drawn), func(i, j int) { drawn[i], drawn[j] = drawn[j], drawn[i] })
+	}
+
+	var possible float64
+	for _, q := range drawn {
+		possible += q.Points
+	}
+
+	// An attempt never runs past the due date
+	expiresAt := dueDate
+	if quiz.TimeLimitMinutes != nil {
+		limit := now.Add(time.Duration(*quiz.TimeLimitMinutes) * time.Minute)
+		if limit.Before(expiresAt) {
+			expiresAt = limit
+		}
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO quiz_attempt (assignment_id, student_id, attempt_number, status, started_at, expires_at, points_possible)
+		VALUES (?, ?, ?, 'in_progress', ?, ?, ?)`,
+		assignmentID, studentID, used+1, now, expiresAt, possible)
+	if err != nil {
+		log.Printf("Error creating quiz attempt: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start attempt"})
+		return
+	}
+	attemptID, _ := result.LastInsertId()
+
+	for position, q := range drawn {
+		var optionOrder interface{}
+		if q.Options > 0 {
+			order := make([]int, q.Options)
+			for i := range order {
+				order[i] = i
+			}
+			if quiz.ShuffleOptions {
+				rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+			}
+			encoded, _ := json.Marshal(order)
+			optionOrder = string(encoded)
+		}
+		_, err = tx.Exec(`
+			INSERT INTO quiz_answer (attempt_id, question_id, position, option_order)
+			VALUES (?, ?, ?, ?)`, attemptID, q.ID, position, optionOrder)
+		if err != nil {
+			log.Printf("Error drawing quiz question: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start attempt"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	respondQuizAttempt(c, db, int(attemptID), http.StatusCreated)
+}
+
+// respondQuizAttempt writes an attempt and its questions for the student taking it
+func respondQuizAttempt(c *gin.Context, db *sql.DB, attemptID int, status int) {
+	attempt, err := loadQuizAttempt(db, attemptID)
+	if err != nil {
+		log.Printf("Error querying quiz attempt: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attempt"})
+		return
+	}
+	questions, err := attemptQuestions(db, attemptID, false)
+	if err != nil {
+		log.Printf("Error querying attempt questions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+		return
+	}
+	c.JSON(status, gin.H{"attempt": attempt, "questions": questions})
+}
+
+// GetQuizAttemptHandler returns an attempt with its questions and answers.
+// Students can view their own attempts; staff also see the correct answers.
+func GetQuizAttemptHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+
+	attemptID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attempt ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	attempt, err := loadQuizAttempt(db, attemptID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attempt not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying quiz attempt: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attempt"})
+		return
+	}
+
+	reveal := false
+	if role == "teacher" {
+		if _, ok := authorizeStaffAccess(c, db, "assignment", attempt.AssignmentID, permViewClassroom); !ok {
+			return
+		}
+		reveal = true
+	} else {
+		var studentID int
+		err = db.QueryRow(`
+			SELECT student_id FROM student
+			WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&studentID)
+		if err != nil || studentID != attempt.StudentID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attempt not found"})
+			return
+		}
+	}
+
+	questions, err := attemptQuestions(db, attemptID, reveal)
+	if err != nil {
+		log.Printf("Error querying attempt questions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attempt": attempt, "questions": questions})
+}
+
+// SubmitQuizAttemptHandler scores an attempt and records the result in the student's submission.
+// Objective questions are scored immediately; short answers leave the submission in needs_review
+// until a grader scores them through GradeSubmissionHandler.
+func SubmitQuizAttemptHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	if role != "student" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only students can take quizzes"})
+		return
+	}
+
+	attemptID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attempt ID"})
+		return
+	}
+
+	var req SubmitQuizAttemptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	var studentID int
+	err = db.QueryRow(`
+		SELECT student_id FROM student
+		WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&studentID)
+	if err != nil {
+		log.Printf("Error querying student: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	attempt, err := loadQuizAttempt(db, attemptID)
+	if err == sql.ErrNoRows || (err == nil && attempt.StudentID != studentID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attempt not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying quiz attempt: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attempt"})
+		return
+	}
+	if attempt.Status != "in_progress" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attempt has already been submitted"})
+		return
+	}
+
+	if !requireWritableClassroom(c, db, "assignment", attempt.AssignmentID) {
+		return
+	}
+
+	if attempt.ExpiresAt != nil && time.Now().After(attempt.ExpiresAt.Add(quizSubmitGrace)) {
+		if err := expireQuizAttempt(db, attemptID); err != nil {
+			log.Printf("Error expiring quiz attempt: %v", err)
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Time limit exceeded; the attempt has been closed"})
+		return
+	}
+
+	// Load the answer key for the questions drawn into this attempt
+	rows, err := db.Query(`
+		SELECT q.question_id, q.question_type, q.options, q.correct_answer, q.tolerance, q.points
+		FROM quiz_answer qa
+		JOIN quiz_question q ON qa.question_id = q.question_id
+		WHERE qa.attempt_id = ?`, attemptID)
+	if err != nil {
+		log.Printf("Error querying answer key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+		return
+	}
+	keys := map[int]quizAnswerKey{}
+	for rows.Next() {
+		var questionID int
+		var key quizAnswerKey
+		var options, correct []byte
+		if err := rows.Scan(&questionID, &key.Type, &options, &correct, &key.Tolerance, &key.Points); err != nil {
+			rows.Close()
+			log.Printf("Error scanning answer key: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process questions"})
+			return
+		}
+		var texts []string
+		if len(options) > 0 {
+			json.Unmarshal(options, &texts)
+		}
+		key.Options = len(texts)
+		key.Correct = correct
+		keys[questionID] = key
+	}
+	rows.Close()
+
+	answers := map[int]json.RawMessage{}
+	for _, a := range req.Answers {
+		key, ok := keys[a.QuestionID]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Question %d is not part of this attempt", a.QuestionID)})
+			return
+		}
+		if len(a.Answer) == 0 || string(a.Answer) == "null" {
+			continue
+		}
+		if !key.validAnswer(a.Answer) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid answer for question %d", a.QuestionID)})
+			return
+		}
+		answers[a.QuestionID] = a.Answer
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// A concurrent submit of the same attempt waits here, then finds it no longer in progress
+	var lockedStatus string
+	err = tx.QueryRow(`
+		SELECT status FROM quiz_attempt
+		WHERE attempt_id = ? FOR UPDATE`, attemptID).Scan(&lockedStatus)
+	if err != nil {
+		log.Printf("Error locking quiz attempt: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit attempt"})
+		return
+	}
+	if lockedStatus != "in_progress" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attempt has already been submitted"})
+		return
+	}
+
+	var earned float64
+	pendingReview := 0
+	for questionID, key := range keys {
+		answer := answers[questionID]
+		awarded := key.score(answer)
+		if awarded == nil {
+			pendingReview++
+		} else {
+			earned += *awarded
+		}
+
+		var stored interface{}
+		if answer != nil {
+			stored = string(answer)
+		}
+		_, err = tx.Exec(`
+			UPDATE quiz_answer SET answer = ?, points_awarded = ?
+			WHERE attempt_id = ? AND question_id = ?`, stored, awarded, attemptID, questionID)
+		if err != nil {
+			log.Printf("Error saving quiz answer: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit attempt"})
+			return
+		}
+	}
+
+	// Every attempt at a quiz is recorded against the student's single submission for the assignment
+	content := fmt.Sprintf("Quiz attempt %d", attempt.AttemptNumber)
+	var submissionID int
+	err = tx.QueryRow(`
+		SELECT submission_id FROM submission
+		WHERE assignment_id = ? AND student_id = ? AND archive_delete_flag = TRUE`, attempt.AssignmentID, studentID).
+		Scan(&submissionID)
+	if err == sql.ErrNoRows {
+		result, err := tx.Exec(`
+			INSERT INTO submission (assignment_id, student_id, content, submitted_at, status, archive_delete_flag)
+			VALUES (?, ?, ?, NOW(), 'submitted', TRUE)`, attempt.AssignmentID, studentID, content)
+		if err != nil {
+			log.Printf("Error inserting submission: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit attempt"})
+			return
+		}
+		id, _ := result.LastInsertId()
+		submissionID = int(id)
+	} else if err != nil {
+		log.Printf("Error querying submission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit attempt"})
+		return
+	} else {
+		_, err = tx.Exec(`
+			UPDATE submission SET content = ?, submitted_at = NOW()
+			WHERE submission_id = ?`, content, submissionID)
+		if err != nil {
+			log.Printf("Error updating submission: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit attempt"})
+			return
+		}
+	}
+
+	status := "graded"
+	if pendingReview > 0 {
+		status = "needs_review"
+	}
+	result, err := tx.Exec(`
+		UPDATE quiz_attempt
+		SET status = ?, submitted_at = NOW(), points_earned = ?, submission_id = ?
+		WHERE attempt_id = ? AND status = 'in_progress'`, status, earned, submissionID, attemptID)
+	if err != nil {
+		log.Printf("Error updating quiz attempt: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit attempt"})
+		return
+	}
+	if updated, _ := result.RowsAffected(); updated != 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attempt has already been submitted"})
+		return
+	}
+
+	if err := refreshQuizSubmission(tx, submissionID); err != nil {
+		log.Printf("Error scoring quiz submission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit attempt"})
+		return
+	}
+
+	var score *int
+	var submissionStatus string
+	err = tx.QueryRow(`
+		SELECT score, status FROM submission WHERE submission_id = ?`, submissionID).Scan(&score, &submissionStatus)
+	if err != nil {
+		log.Printf("Error querying submission score: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit attempt"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Attempt submitted successfully",
+		"attempt_id":        attemptID,
+		"status":            status,
+		"points_earned":     earned,
+		"points_possible":   attempt.PointsPossible,
+		"pending_review":    pendingReview,
+		"submission_id":     submissionID,
+		"submission_score":  score,
+		"submission_status": submissionStatus,
+	})
+}
+
+// reviewQuizAnswers applies a grader's scores to the short answers of a quiz attempt and rescores the submission.
+// attemptID 0 selects the oldest attempt still waiting for review. It returns a message for the client when
+// the scores are invalid.
+func reviewQuizAnswers(tx *sql.Tx, submissionID, attemptID int, scores []QuestionScore) (string, error) {
+	if attemptID == 0 {
+		err := tx.QueryRow(`
+			SELECT attempt_id FROM quiz_attempt
+			WHERE submission_id = ? AND status = 'needs_review'
+			ORDER BY attempt_number LIMIT 1`, submissionID).Scan(&attemptID)
+		if err == sql.ErrNoRows {
+			return "No quiz answers are waiting for review", nil
+		} else if err != nil {
+			return "", err
+		}
+	} else {
+		var belongs bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM quiz_attempt
+				WHERE attempt_id = ? AND submission_id = ? AND status IN ('graded', 'needs_review')
+			)`, attemptID, submissionID).Scan(&belongs)
+		if err != nil {
+			return "", err
+		}
+		if !belongs {
+			return "Attempt not found for this submission", nil
+		}
+	}
+
+	for _, s := range scores {
+		var qType string
+		var points float64
+		err := tx.QueryRow(`
+			SELECT q.question_type, q.points
+			FROM quiz_answer qa
+			JOIN quiz_question q ON qa.question_id = q.question_id
+			WHERE qa.attempt_id = ? AND qa.question_id = ?`, attemptID, s.QuestionID).Scan(&qType, &points)
+		if err == sql.ErrNoRows {
+			return fmt.Sprintf("Question %d is not part of this attempt", s.QuestionID), nil
+		} else if err != nil {
+			return "", err
+		}
+		if qType != questionShortAnswer {
+			return fmt.Sprintf("Question %d is scored automatically", s.QuestionID), nil
+		}
+		if s.Points < 0 || s.Points > points {
+			return fmt.Sprintf("Points for question %d must be between 0 and %g", s.QuestionID, points), nil
+		}
+
+		_, err = tx.Exec(`
+			UPDATE quiz_answer SET points_awarded = ?
+			WHERE attempt_id = ? AND question_id = ?`, s.Points, attemptID, s.QuestionID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	_, err := tx.Exec(`
+		UPDATE quiz_attempt qa
+		SET qa.points_earned = (SELECT COALESCE(SUM(points_awarded), 0) FROM quiz_answer WHERE attempt_id = qa.attempt_id),
+		qa.status = IF(EXISTS (
+			SELECT 1 FROM quiz_answer WHERE attempt_id = qa.attempt_id AND points_awarded IS NULL
+		), 'needs_review', 'graded')
+		WHERE qa.attempt_id = ?`, attemptID)
+	if err != nil {
+		return "", err
+	}
+	return "", refreshQuizSubmission(tx, submissionID)
+}
@@ -0,0 +1,618 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/mailer"
+	"edusync/models"
+	"edusync/utils"
+)
+
+const (
+	maxRosterBytes = 2 << 20
+	maxRosterRows  = 2000
+)
+
+// Outcomes of a roster line
+const (
+	rosterCreated  = "created"
+	rosterExisting = "existing"
+	rosterError    = "error"
+)
+
+// rosterColumns are the columns a roster may have, in any order. name and email are required; role defaults to
+// student.
+var rosterColumns = []string{"name", "email", "role", "grade_level", "enrollment_year", "course_ids"}
+
+// rosterRow is one line of a roster. Err is set when the line is invalid.
+type rosterRow struct {
+	Line           int
+	Name           string
+	Email          string
+	Role           string
+	GradeLevel     *string
+	EnrollmentYear *int
+	CourseIDs      []int
+	Err            string
+}
+
+// AcceptInvitationRequest is the request body for setting the password of an invited account
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// parseRoster reads a CSV roster with a header line. Errors are meant for the client; problems with single lines
+// are reported on their rows instead.
+func parseRoster(r io.Reader) ([]rosterRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("Roster is empty")
+	} else if err != nil {
+		return nil, fmt.Errorf("Invalid CSV: %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !slices.Contains(rosterColumns, name) {
+			return nil, fmt.Errorf("Unknown column %q, expected %s", name, strings.Join(rosterColumns, ", "))
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"name", "email"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("Missing column %q", name)
+		}
+	}
+
+	var rows []rosterRow
+	seen := map[string]int{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Invalid CSV: %v", err)
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		if len(rows) == maxRosterRows {
+			return nil, fmt.Errorf("Roster has more than %d rows", maxRosterRows)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		line, _ := reader.FieldPos(0)
+		row := rosterRow{Line: line, Name: field("name"), Email: field("email"), Role: field("role")}
+		row.Err = row.parse(field("grade_level"), field("enrollment_year"), field("course_ids"))
+		if row.Err == "" {
+			key := strings.ToLower(row.Email)
+			if first, ok := seen[key]; ok {
+				row.Err = fmt.Sprintf("Email already appears on line %d", first)
+			} else {
+				seen[key] = row.Line
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parse validates the row's fields and fills in the optional ones, returning a message when the row is invalid
+func (row *rosterRow) parse(gradeLevel, enrollmentYear, courseIDs string) string {
+	if row.Name == "" {
+		return "name is required"
+	}
+	if !utils.ValidateEmail(row.Email) {
+		return "Invalid email format"
+	}
+	row.Role = strings.ToLower(row.Role)
+	if row.Role == "" {
+		row.Role = "student"
+	}
+	if row.Role != "student" && row.Role != "teacher" {
+		return "role must be 'student' or 'teacher'"
+	}
+
+	if gradeLevel != "" {
+		row.GradeLevel = &gradeLevel
+	}
+	if enrollmentYear != "" {
+		year, err := strconv.Atoi(enrollmentYear)
+		if err != nil {
+			return "Invalid enrollment_year"
+		}
+		row.EnrollmentYear = &year
+	}
+
+	// Course IDs may be separated by semicolons or spaces, or by commas inside a quoted field
+	for _, v := range strings.FieldsFunc(courseIDs, func(r rune) bool { return r == ',' || r == ';' || r == ' ' }) {
+		courseID, err := strconv.Atoi(v)
+		if err != nil || courseID <= 0 {
+			return "Invalid course ID " + strconv.Quote(v)
+		}
+		if !slices.Contains(row.CourseIDs, courseID) {
+			row.CourseIDs = append(row.CourseIDs, courseID)
+		}
+	}
+	if row.Role == "teacher" && len(row.CourseIDs) > 0 {
+		return "course_ids can only be given for students"
+	}
+	return ""
+}
+
+// rosterCourseProblems checks the classrooms named in a roster, returning why each unusable one cannot be enrolled
+// in. teacherID is 0 for organization admins, who may enroll students in any classroom of the organization.
+func rosterCourseProblems(db *sql.DB, orgID, teacherID int, courseIDs []int) (map[int]string, error) {
+	problems := map[int]string{}
+	if len(courseIDs) == 0 {
+		return problems, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(courseIDs)), ",")
+	args := []interface{}{orgID}
+	for _, id := range courseIDs {
+		args = append(args, id)
+	}
+	rows, err := db.Query(`
+		SELECT course_id, is_archived FROM classroom
+		WHERE org_id = ? AND course_id IN (`+placeholders+`) AND archive_delete_flag = TRUE`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	archived := map[int]bool{}
+	for rows.Next() {
+		var id int
+		var isArchived bool
+		if err := rows.Scan(&id, &isArchived); err != nil {
+			return nil, err
+		}
+		archived[id] = isArchived
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range courseIDs {
+		isArchived, found := archived[id]
+		switch {
+		case !found:
+			problems[id] = fmt.Sprintf("Classroom %d not found", id)
+		case isArchived:
+			problems[id] = fmt.Sprintf("Classroom %d is archived", id)
+		case teacherID != 0:
+			allowed, err := teacherCan(db, teacherID, id, permManageStudents)
+			if err != nil {
+				return nil, err
+			}
+			if !allowed {
+				problems[id] = fmt.Sprintf("Unauthorized to manage students of classroom %d", id)
+			}
+		}
+	}
+	return problems, nil
+}
+
+// importRosterRow creates or updates the account of one roster row and enrolls it, or works out what would happen in
+// a dry run. It returns the invitation token to mail, if one was issued.
+func importRosterRow(db *sql.DB, orgID int, row rosterRow, dryRun bool) (models.RosterResult, string, error) {
+	result := models.RosterResult{Line: row.Line, Email: row.Email, Status: rosterCreated, Enrolled: []int{}}
+
+	var userID int64
+	var userOrg int
+	var userRole string
+	var pending bool
+	err := db.QueryRow(`
+		SELECT user_id, org_id, role, password = '' FROM user
+		WHERE email = ? AND archive_delete_flag = TRUE`, row.Email).Scan(&userID, &userOrg, &userRole, &pending)
+	exists := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return result, "", err
+	}
+
+	var studentID int64
+	invite := !exists
+	if exists {
+		if userOrg != orgID {
+			return rosterRowError(result, "Email belongs to an account of another organization"), "", nil
+		}
+		if userRole != row.Role {
+			return rosterRowError(result, "Existing account is a "+userRole), "", nil
+		}
+		result.Status = rosterExisting
+		result.UserID = &userID
+		if row.Role == "student" {
+			err := db.QueryRow(`
+				SELECT student_id FROM student
+				WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&studentID)
+			if err != nil {
+				return result, "", err
+			}
+		}
+		// Accounts that never set a password are invited again once their last invitation has lapsed
+		if pending {
+			var invited bool
+			err := db.QueryRow(`
+				SELECT EXISTS (
+					SELECT 1 FROM user_token
+					WHERE user_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > NOW()
+				)`, userID, tokenInvitation).Scan(&invited)
+			if err != nil {
+				return result, "", err
+			}
+			invite = !invited
+		}
+	} else {
+		allowed, err := orgAllowsEmail(db, orgID, row.Email)
+		if err != nil {
+			return result, "", err
+		}
+		if !allowed {
+			return rosterRowError(result, "Email domain is not allowed by this organization"), "", nil
+		}
+	}
+
+	for _, courseID := range row.CourseIDs {
+		var enrolled bool
+		if studentID != 0 {
+			err := db.QueryRow(`
+				SELECT EXISTS (
+					SELECT 1 FROM enrollment
+					WHERE student_id = ? AND course_id = ? AND archive_delete_flag = TRUE
+				)`, studentID, courseID).Scan(&enrolled)
+			if err != nil {
+				return result, "", err
+			}
+		}
+		if enrolled {
+			continue
+		}
+		full, err := classroomFull(db.QueryRow, courseID)
+		if err != nil {
+			return result, "", err
+		}
+		if full {
+			return rosterRowError(result, fmt.Sprintf("Classroom %d is full", courseID)), "", nil
+		}
+		result.Enrolled = append(result.Enrolled, courseID)
+	}
+
+	if dryRun {
+		result.Invited = invite
+		return result, "", nil
+	}
+	if exists && !invite && len(result.Enrolled) == 0 {
+		return result, "", nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return result, "", err
+	}
+	defer tx.Rollback()
+
+	if !exists {
+		// The password stays empty, which no login matches, until the invitation is accepted
+		res, err := tx.Exec(`
+			INSERT INTO user (name, email, password, role, org_id, archive_delete_flag)
+			VALUES (?, ?, '', ?, ?, TRUE)`, row.Name, row.Email, row.Role, orgID)
+		if err != nil {
+			return result, "", err
+		}
+		if userID, err = res.LastInsertId(); err != nil {
+			return result, "", err
+		}
+		if row.Role == "teacher" {
+			_, err = tx.Exec(`
+				INSERT INTO teacher (user_id, archive_delete_flag)
+				VALUES (?, TRUE)`, userID)
+		} else {
+			res, err = tx.Exec(`
+				INSERT INTO student (user_id, grade_level, enrollment_year, archive_delete_flag)
+				VALUES (?, ?, ?, TRUE)`, userID, row.GradeLevel, row.EnrollmentYear)
+			if err == nil {
+				studentID, err = res.LastInsertId()
+			}
+		}
+		if err != nil {
+			return result, "", err
+		}
+		result.UserID = &userID
+	}
+
+	// Students who left a classroom are enrolled in it again. The capacity is checked once more with the classroom
+	// locked, as other enrollments may have filled it since.
+	for _, courseID := range result.Enrolled {
+		full, err := classroomFull(tx.QueryRow, courseID)
+		if err != nil {
+			return result, "", err
+		}
+		if full {
+			if !exists {
+				result.UserID = nil
+			}
+			return rosterRowError(result, fmt.Sprintf("Classroom %d is full", courseID)), "", nil
+		}
+		_, err = tx.Exec(`
+			INSERT INTO enrollment (student_id, course_id, enrollment_date, status, archive_delete_flag)
+			VALUES (?, ?, CURDATE(), 'active', TRUE)
+			ON DUPLICATE KEY UPDATE enrollment_date = CURDATE(), status = 'active', archive_delete_flag = TRUE`,
+			studentID, courseID)
+		if err != nil {
+			return result, "", err
+		}
+	}
+
+	var token string
+	if invite {
+		if token, err = issueUserToken(tx, userID, tokenInvitation, invitationTTL); err != nil {
+			return result, "", err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, "", err
+	}
+	return result, token, nil
+}
+
+// classroomFull reports whether the classroom has a capacity and no room left under it. Run in a transaction, it
+// locks the classroom row until the transaction ends.
+func classroomFull(queryRow func(query string, args ...interface{}) *sql.Row, courseID int) (bool, error) {
+	var capacity sql.NullInt64
+	err := queryRow(`
+		SELECT capacity FROM classroom
+		WHERE course_id = ?
+		FOR UPDATE`, courseID).Scan(&capacity)
+	if err != nil || !capacity.Valid {
+		return false, err
+	}
+	var enrolled int64
+	err = queryRow(`
+		SELECT COUNT(*) FROM enrollment
+		WHERE course_id = ? AND status = 'active' AND archive_delete_flag = TRUE`, courseID).Scan(&enrolled)
+	return enrolled >= capacity.Int64, err
+}
+
+// rosterRowError marks a roster result as failed
+func rosterRowError(result models.RosterResult, msg string) models.RosterResult {
+	result.Status = rosterError
+	result.Error = msg
+	result.Enrolled = []int{}
+	return result
+}
+
+// invitationMessage is the email inviting an imported user to set their password
+func invitationMessage(name, email, orgName, token string) mailer.Message {
+	return mailer.Message{
+		To:      email,
+		Subject: "Your " + orgName + " account on EduSync",
+		Body: "Hello " + name + ",\n\n" +
+			"An account has been created for you by " + orgName + ". Choose a password to sign in:\n\n" +
+			tokenLink("/set-password", token) + "\n\n" +
+			"This link expires in " + strconv.Itoa(int(invitationTTL.Hours()/24)) + " days.\n",
+	}
+}
+
+// ImportRosterHandler creates accounts from a CSV roster, enrolls students in the listed classrooms and mails new
+// users an invitation to set their password. The roster is the body of the request, or the "file" field of a
+// multipart form. With dry_run=true nothing is written and the report says what would happen.
+//
+// Re-running a roster is safe: existing accounts of the organization are matched by email and only enrolled where
+// they are missing. Organization admins can import teachers and students into any classroom; teachers can import
+// students into classrooms whose students they manage.
+func ImportRosterHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	orgID := c.GetInt("orgID")
+
+	dryRun := false
+	if v := c.Query("dry_run"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dry_run, expected true or false"})
+			return
+		}
+		dryRun = parsed
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	isAdmin, err := isOrgAdmin(db, userID)
+	if err != nil {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	teacherID := 0
+	if !isAdmin {
+		if role != "teacher" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only teachers and organization admins can import rosters"})
+			return
+		}
+		err := db.QueryRow(`
+			SELECT teacher_id FROM teacher
+			WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&teacherID)
+		if err != nil {
+			log.Printf("Error querying teacher: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Teacher not found"})
+			return
+		}
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxRosterBytes)
+	var input io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Roster file is required"})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			log.Printf("Error opening roster: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read roster"})
+			return
+		}
+		defer file.Close()
+		input = file
+	}
+
+	rows, err := parseRoster(input)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Roster is larger than %d bytes", maxRosterBytes)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var courseIDs []int
+	for _, row := range rows {
+		for _, id := range row.CourseIDs {
+			if !slices.Contains(courseIDs, id) {
+				courseIDs = append(courseIDs, id)
+			}
+		}
+	}
+	problems, err := rosterCourseProblems(db, orgID, teacherID, courseIDs)
+	if err != nil {
+		log.Printf("Error checking roster classrooms: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	org, err := loadOrganization(db, orgID)
+	if err != nil {
+		log.Printf("Error querying organization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organization"})
+		return
+	}
+
+	results := make([]models.RosterResult, 0, len(rows))
+	counts := map[string]int{}
+	for _, row := range rows {
+		result := models.RosterResult{Line: row.Line, Email: row.Email}
+		if row.Err == "" && teacherID != 0 {
+			if row.Role == "teacher" {
+				row.Err = "Only organization admins can import teachers"
+			} else if len(row.CourseIDs) == 0 {
+				row.Err = "course_ids is required when a teacher imports students"
+			}
+		}
+		for _, id := range row.CourseIDs {
+			if row.Err == "" && problems[id] != "" {
+				row.Err = problems[id]
+			}
+		}
+
+		var token string
+		if row.Err != "" {
+			result = rosterRowError(result, row.Err)
+		} else if result, token, err = importRosterRow(db, orgID, row, dryRun); err != nil {
+			log.Printf("Error importing roster line %d: %v", row.Line, err)
+			result = rosterRowError(result, "Database error")
+		}
+
+		if token != "" {
+			if err := sendMail(c, invitationMessage(row.Name, row.Email, org.Name, token)); err != nil {
+				log.Printf("Error mailing invitation to %s: %v", row.Email, err)
+				result.Warning = "Invitation email could not be sent; import the roster again to retry"
+			} else {
+				result.Invited = true
+			}
+		}
+		counts[result.Status]++
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run":  dryRun,
+		"created":  counts[rosterCreated],
+		"existing": counts[rosterExisting],
+		"failed":   counts[rosterError],
+		"rows":     results,
+	})
+}
+
+// AcceptInvitationHandler sets the password of an account created from a roster, using the token mailed to its
+// user
+func AcceptInvitationHandler(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	passwordHash, err := utils.HashPassword(req.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeUserToken(tx, req.Token, tokenInvitation)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invitation is invalid or has expired"})
+		return
+	} else if err != nil {
+		log.Printf("Error checking invitation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var email string
+	if err := tx.QueryRow(`SELECT email FROM user WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&email); err != nil {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invitation is invalid or has expired"})
+		return
+	}
+	// The invitation reached the user's mailbox, which verifies the address
+	_, err = tx.Exec(`
+		UPDATE user SET password = ?, email_verified_at = COALESCE(email_verified_at, NOW())
+		WHERE user_id = ?`, passwordHash, userID)
+	if err != nil {
+		log.Printf("Error setting password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set password"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"email": email, "message": "Password set; you can now log in"})
+}
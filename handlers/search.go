@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"database/sql"
+	"html"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/models"
+)
+
+const (
+	defaultSearchLimit  = 20
+	maxSearchLimit      = 50
+	maxSearchLength     = 200 // Longest accepted query, in bytes
+	maxSearchTerms      = 10
+	minSearchTermLength = 2   // Single letters match nearly every row; MySQL's own minimum is innodb_ft_min_token_size
+	snippetWidth        = 160 // Runes of body text around the first match
+)
+
+// searchTypes are the kinds of content a search covers
+var searchTypes = []string{"announcement", "material", "assignment"}
+
+// searchQuery returns the query for one kind of content. It yields type, ID, course ID, course title, title, body,
+// created time, due date and relevance; the relevance and match conditions each bind the boolean query, around the
+// course IDs.
+func searchQuery(kind, placeholders, visible string) string {
+	switch kind {
+	case "announcement":
+		return `
+			SELECT 'announcement', a.announcement_id, a.course_id, c.title, a.title, COALESCE(a.content, ''), a.created_at, NULL,
+			MATCH(a.title, a.content) AGAINST (? IN BOOLEAN MODE)
+			FROM announcement a
+			JOIN classroom c ON a.course_id = c.course_id
+			WHERE a.course_id IN (` + placeholders + `) AND a.archive_delete_flag = TRUE` + visible + `
+			AND MATCH(a.title, a.content) AGAINST (? IN BOOLEAN MODE)`
+	case "material":
+		return `
+			SELECT 'material', m.material_id, m.course_id, c.title, m.title, COALESCE(m.description, ''), m.uploaded_at, NULL,
+			MATCH(m.title, m.description) AGAINST (? IN BOOLEAN MODE)
+			FROM material m
+			JOIN classroom c ON m.course_id = c.course_id
+			WHERE m.course_id IN (` + placeholders + `) AND m.archive_delete_flag = TRUE
+			AND MATCH(m.title, m.description) AGAINST (? IN BOOLEAN MODE)`
+	}
+	return `
+		SELECT 'assignment', a.assignment_id, a.course_id, c.title, a.title, COALESCE(a.description, ''), a.created_at, a.due_date,
+		MATCH(a.title, a.description) AGAINST (? IN BOOLEAN MODE)
+		FROM assignment a
+		JOIN classroom c ON a.course_id = c.course_id
+		WHERE a.course_id IN (` + placeholders + `) AND a.archive_delete_flag = TRUE` + visible + `
+		AND MATCH(a.title, a.description) AGAINST (? IN BOOLEAN MODE)`
+}
+
+// searchTerms splits a query into lowercase words. Everything but letters and digits separates words, which also
+// keeps the boolean-mode operators of MySQL out of the terms.
+func searchTerms(q string) []string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if utf8.RuneCountInString(word) < minSearchTermLength {
+			continue
+		}
+		if !slices.Contains(terms, word) && len(terms) < maxSearchTerms {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// booleanQuery matches any of the terms as a word prefix, ranking rows that match more of them higher
+func booleanQuery(terms []string) string {
+	return strings.Join(terms, "* ") + "*"
+}
+
+// highlightMatches returns the HTML-escaped runes of text in [start, end) with every word starting with one of the
+// terms wrapped in <mark>. lower holds text lowercased rune by rune.
+func highlightMatches(text, lower []rune, terms [][]rune, start, end int) string {
+	var b strings.Builder
+	plain := start
+	for i := start; i < end; {
+		matched := 0
+		if i == 0 || !isWordRune(lower[i-1]) {
+			for _, term := range terms {
+				if len(term) > matched && i+len(term) <= len(lower) && slices.Equal(lower[i:i+len(term)], term) {
+					matched = len(term)
+				}
+			}
+		}
+		if matched == 0 {
+			i++
+			continue
+		}
+		stop := min(i+matched, end)
+		b.WriteString(html.EscapeString(string(text[plain:i])))
+		b.WriteString("<mark>" + html.EscapeString(string(text[i:stop])) + "</mark>")
+		i, plain = stop, stop
+	}
+	b.WriteString(html.EscapeString(string(text[plain:end])))
+	return b.String()
+}
+
+// isWordRune reports whether r can be part of a search term
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// lowerRunes lowercases text one rune at a time so positions line up with the original
+func lowerRunes(text []rune) []rune {
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+	}
+	return lower
+}
+
+// termRunes converts the search terms for matching against lowerRunes output
+func termRunes(terms []string) [][]rune {
+	runes := make([][]rune, len(terms))
+	for i, term := range terms {
+		runes[i] = []rune(term)
+	}
+	return runes
+}
+
+// highlightText highlights every match in a short text such as a title
+func highlightText(text string, terms []string) string {
+	runes := []rune(text)
+	return highlightMatches(runes, lowerRunes(runes), termRunes(terms), 0, len(runes))
+}
+
+// searchSnippet cuts an excerpt of about snippetWidth runes around the first match in body, with matches
+// highlighted. Bodies without a match are excerpted from the start.
+func searchSnippet(body string, terms []string) string {
+	text := []rune(strings.Join(strings.Fields(body), " "))
+	lower := lowerRunes(text)
+	patterns := termRunes(terms)
+
+	first := -1
+	for i := range lower {
+		if i > 0 && isWordRune(lower[i-1]) {
+			continue
+		}
+		for _, term := range patterns {
+			if i+len(term) <= len(lower) && slices.Equal(lower[i:i+len(term)], term) {
+				first = i
+				break
+			}
+		}
+		if first >= 0 {
+			break
+		}
+	}
+
+	start := 0
+	if first > snippetWidth/3 {
+		// Keep some context before the match, starting on a word boundary
+		start = first - snippetWidth/3
+		for start < first && lower[start-1] != ' ' {
+			start++
+		}
+	}
+	end := min(start+snippetWidth, len(text))
+	if end < len(text) {
+		for cut := end; cut > start+snippetWidth/2; cut-- {
+			if text[cut] == ' ' {
+				end = cut
+				break
+			}
+		}
+	}
+
+	snippet := highlightMatches(text, lower, patterns, start, end)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(text) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// SearchHandler searches the announcements, materials and assignments of every classroom the caller teaches or is
+// enrolled in. q is required; type narrows the search to a comma-separated list of kinds and course_id to one
+// classroom. Students only find announcements and assignments that have gone live.
+func SearchHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	if role != "teacher" && role != "student" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized role"})
+		return
+	}
+
+	q := c.Query("q")
+	if len(q) > maxSearchLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is too long"})
+		return
+	}
+	terms := searchTerms(q)
+	if len(terms) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q must contain at least one word of two or more letters"})
+		return
+	}
+
+	types := searchTypes
+	if v := c.Query("type"); v != "" {
+		types = nil
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if !slices.Contains(searchTypes, t) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "type must be announcement, material or assignment"})
+				return
+			}
+			if !slices.Contains(types, t) {
+				types = append(types, t)
+			}
+		}
+	}
+
+	limit := defaultSearchLimit
+	if v := c.Query("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit, expected 1 to " + strconv.Itoa(maxSearchLimit)})
+			return
+		}
+		limit = parsed
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	roleName, _ := role.(string)
+	courseIDs, err := accessibleCourses(db, userID, roleName)
+	if err != nil {
+		log.Printf("Error querying classrooms: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if v := c.Query("course_id"); v != "" {
+		courseID, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+			return
+		}
+		if !slices.Contains(courseIDs, courseID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this classroom"})
+			return
+		}
+		courseIDs = []int{courseID}
+	}
+
+	results := []models.SearchResult{}
+	if len(courseIDs) == 0 {
+		c.JSON(http.StatusOK, gin.H{"query": q, "results": results})
+		return
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(courseIDs)), ",")
+	visible := ""
+	if role != "teacher" {
+		visible = ` AND ` + visibleToStudents("a")
+	}
+	match := booleanQuery(terms)
+
+	var parts []string
+	var args []interface{}
+	for _, t := range types {
+		parts = append(parts, "("+searchQuery(t, placeholders, visible)+")")
+		args = append(args, match)
+		for _, id := range courseIDs {
+			args = append(args, id)
+		}
+		args = append(args, match)
+	}
+
+	rows, err := db.Query(strings.Join(parts, " UNION ALL ")+` ORDER BY 9 DESC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		log.Printf("Error searching content: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search"})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.SearchResult
+		var body string
+		if err := rows.Scan(&r.Type, &r.ID, &r.CourseID, &r.CourseTitle, &r.Title, &body, &r.CreatedAt, &r.DueDate, &r.Score); err != nil {
+			log.Printf("Error scanning search result: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process search results"})
+			return
+		}
+		r.Highlight = highlightText(r.Title, terms)
+		r.Snippet = searchSnippet(body, terms)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating search results: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"query": q, "results": results})
+}
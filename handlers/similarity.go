@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/models"
+	"edusync/similarity"
+)
+
+// SimilarityReportRequest is the request body for starting a similarity report
+type SimilarityReportRequest struct {
+	Threshold *float64 `json:"threshold"` // Share of matching text above which a pair is flagged, 0.5 when omitted
+}
+
+// CreateSimilarityReportHandler queues a similarity check across every submission to an assignment
+func CreateSimilarityReportHandler(c *gin.Context) {
+	assignmentID, err := strconv.Atoi(c.Param("assignment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		return
+	}
+
+	var req SimilarityReportRequest
+	// The body is optional
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	threshold := 0.5
+	if req.Threshold != nil {
+		threshold = *req.Threshold
+	}
+	if threshold <= 0 || threshold > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be greater than 0 and at most 1"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	teacherID, ok := authorizeStaffAccess(c, db, "assignment", assignmentID, permGrade)
+	if !ok {
+		return
+	}
+
+	// Only one report per assignment runs at a time
+	var pending bool
+	err = db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM similarity_report
+			WHERE assignment_id = ? AND status IN ('queued', 'running')
+		)`, assignmentID).Scan(&pending)
+	if err != nil {
+		log.Printf("Error checking similarity reports: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if pending {
+		c.JSON(http.StatusConflict, gin.H{"error": "A similarity report for this assignment is already in progress"})
+		return
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO similarity_report (assignment_id, requested_by, threshold, status, created_at)
+		VALUES (?, ?, ?, 'queued', NOW())`, assignmentID, teacherID, threshold)
+	if err != nil {
+		log.Printf("Error creating similarity report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create similarity report"})
+		return
+	}
+	reportID, _ := result.LastInsertId()
+
+	similarity.Start(db, int(reportID))
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":       "Similarity report queued",
+		"report_id":     reportID,
+		"assignment_id": assignmentID,
+		"threshold":     threshold,
+		"status":        "queued",
+	})
+}
+
+// GetSimilarityReportsHandler lists the similarity reports of an assignment, newest first
+func GetSimilarityReportsHandler(c *gin.Context) {
+	assignmentID, err := strconv.Atoi(c.Param("assignment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "assignment", assignmentID, permViewClassroom); !ok {
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT report_id, assignment_id, threshold, status, submission_count, pairs_total, pairs_done, error, created_at, finished_at
+		FROM similarity_report
+		WHERE assignment_id = ?
+		ORDER BY report_id DESC`, assignmentID)
+	if err != nil {
+		log.Printf("Error querying similarity reports: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch similarity reports"})
+		return
+	}
+	defer rows.Close()
+
+	reports := []models.SimilarityReport{}
+	for rows.Next() {
+		var r models.SimilarityReport
+		if err := rows.Scan(&r.ReportID, &r.AssignmentID, &r.Threshold, &r.Status, &r.SubmissionCount,
+			&r.PairsTotal, &r.PairsDone, &r.Error, &r.CreatedAt, &r.FinishedAt); err != nil {
+			log.Printf("Error scanning similarity report: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process similarity reports"})
+			return
+		}
+		reports = append(reports, r)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reports": reports})
+}
+
+// GetSimilarityReportHandler returns a report's progress and, once complete, the flagged pairs with their matching spans
+func GetSimilarityReportHandler(c *gin.Context) {
+	reportID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	var r models.SimilarityReport
+	err = db.QueryRow(`
+		SELECT report_id, assignment_id, threshold, status, submission_count, pairs_total, pairs_done, error, created_at, finished_at
+		FROM similarity_report
+		WHERE report_id = ?`, reportID).Scan(&r.ReportID, &r.AssignmentID, &r.Threshold, &r.Status, &r.SubmissionCount,
+		&r.PairsTotal, &r.PairsDone, &r.Error, &r.CreatedAt, &r.FinishedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Similarity report not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying similarity report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch similarity report"})
+		return
+	}
+
+	if _, ok := authorizeStaffAccess(c, db, "assignment", r.AssignmentID, permViewClassroom); !ok {
+		return
+	}
+
+	progress := 1.0
+	if r.PairsTotal > 0 {
+		progress = float64(r.PairsDone) / float64(r.PairsTotal)
+	} else if r.Status == "queued" || r.Status == "running" {
+		progress = 0
+	}
+
+	rows, err := db.Query(`
+		SELECT m.submission_a, sa.student_id, ua.name, m.submission_b, sb.student_id, ub.name, m.similarity, m.spans
+		FROM similarity_match m
+		JOIN submission sa ON m.submission_a = sa.submission_id
+		JOIN student sta ON sa.student_id = sta.student_id
+		JOIN user ua ON sta.user_id = ua.user_id
+		JOIN submission sb ON m.submission_b = sb.submission_id
+		JOIN student stb ON sb.student_id = stb.student_id
+		JOIN user ub ON stb.user_id = ub.user_id
+		WHERE m.report_id = ?
+		ORDER BY m.similarity DESC`, reportID)
+	if err != nil {
+		log.Printf("Error querying similarity matches: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch matches"})
+		return
+	}
+	defer rows.Close()
+
+	matches := []gin.H{}
+	for rows.Next() {
+		var submissionA, studentA, submissionB, studentB int
+		var nameA, nameB string
+		var score float64
+		var spans []byte
+		if err := rows.Scan(&submissionA, &studentA, &nameA, &submissionB, &studentB, &nameB, &score, &spans); err != nil {
+			log.Printf("Error scanning similarity match: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process matches"})
+			return
+		}
+		var decoded []similarity.Span
+		if len(spans) > 0 {
+			json.Unmarshal(spans, &decoded)
+		}
+		matches = append(matches, gin.H{
+			"submission_a": gin.H{"submission_id": submissionA, "student_id": studentA, "student_name": nameA},
+			"submission_b": gin.H{"submission_id": submissionB, "student_id": studentB, "student_name": nameB},
+			"similarity":   score,
+			"spans":        decoded,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"report":   r,
+		"progress": progress,
+		"matches":  matches,
+	})
+}
+
+// similaritySummaries returns each submission's result in the latest completed similarity report of an assignment.
+// The map is empty when no report has completed.
+func similaritySummaries(db *sql.DB, assignmentID int) (map[int]*models.SimilaritySummary, error) {
+	summaries := map[int]*models.SimilaritySummary{}
+
+	var reportID int
+	err := db.QueryRow(`
+		SELECT report_id FROM similarity_report
+		WHERE assignment_id = ? AND status = 'completed'
+		ORDER BY report_id DESC LIMIT 1`, assignmentID).Scan(&reportID)
+	if err == sql.ErrNoRows {
+		return summaries, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT s.submission_id, COALESCE(MAX(m.similarity), 0), COUNT(m.similarity)
+		FROM submission s
+		LEFT JOIN similarity_match m ON m.report_id = ? AND (m.submission_a = s.submission_id OR m.submission_b = s.submission_id)
+		WHERE s.assignment_id = ? AND s.archive_delete_flag = TRUE
+		GROUP BY s.submission_id`, reportID, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var submissionID int
+		summary := &models.SimilaritySummary{ReportID: reportID}
+		if err := rows.Scan(&submissionID, &summary.MaxSimilarity, &summary.MatchCount); err != nil {
+			return nil, err
+		}
+		summaries[submissionID] = summary
+	}
+	return summaries, rows.Err()
+}
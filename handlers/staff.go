@@ -0,0 +1,679 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/models"
+)
+
+// Classroom staff roles
+const (
+	staffRoleOwner     = "owner"
+	staffRoleCoTeacher = "co_teacher"
+	staffRoleTA        = "ta"
+)
+
+// Classroom staff permissions checked by the handlers
+const (
+	permViewClassroom   = "view_classroom"
+	permEditClassroom   = "edit_classroom"
+	permEditContent     = "edit_content"
+	permGrade           = "grade"
+	permManageStudents  = "manage_students"
+	permManageStaff     = "manage_staff"
+	permDeleteClassroom = "delete_classroom"
+)
+
+// staffPermissionConditions maps each permission to the classroom_staff condition that grants it.
+// Deleting a classroom is reserved for its owner and cannot be delegated.
+var staffPermissionConditions = map[string]string{
+	permViewClassroom:   "TRUE",
+	permEditClassroom:   "cs.can_edit_classroom = TRUE",
+	permEditContent:     "cs.can_edit_content = TRUE",
+	permGrade:           "cs.can_grade = TRUE",
+	permManageStudents:  "cs.can_manage_students = TRUE",
+	permManageStaff:     "cs.can_manage_staff = TRUE",
+	permDeleteClassroom: "cs.role = 'owner'",
+}
+
+// StaffPermissions is the set of configurable permissions held by a staff member
+type StaffPermissions struct {
+	CanEditClassroom  bool `json:"can_edit_classroom"`
+	CanEditContent    bool `json:"can_edit_content"`
+	CanGrade          bool `json:"can_grade"`
+	CanManageStudents bool `json:"can_manage_students"`
+	CanManageStaff    bool `json:"can_manage_staff"`
+}
+
+// staffRoleDefaults holds the permissions each role starts with
+var staffRoleDefaults = map[string]StaffPermissions{
+	staffRoleOwner:     {CanEditClassroom: true, CanEditContent: true, CanGrade: true, CanManageStudents: true, CanManageStaff: true},
+	staffRoleCoTeacher: {CanEditClassroom: true, CanEditContent: true, CanGrade: true, CanManageStudents: true},
+	staffRoleTA:        {CanGrade: true},
+}
+
+// StaffPermissionsRequest overrides individual role defaults; omitted fields keep the default
+type StaffPermissionsRequest struct {
+	CanEditClassroom  *bool `json:"can_edit_classroom"`
+	CanEditContent    *bool `json:"can_edit_content"`
+	CanGrade          *bool `json:"can_grade"`
+	CanManageStudents *bool `json:"can_manage_students"`
+	CanManageStaff    *bool `json:"can_manage_staff"`
+}
+
+// InviteStaffRequest is the request body for inviting a teacher to a classroom's staff
+type InviteStaffRequest struct {
+	Email       string                   `json:"email" binding:"required"`
+	Role        string                   `json:"role" binding:"required"`
+	Permissions *StaffPermissionsRequest `json:"permissions"`
+}
+
+// UpdateStaffRequest is the request body for changing a staff member's role or permissions
+type UpdateStaffRequest struct {
+	Role        *string                  `json:"role"`
+	Permissions *StaffPermissionsRequest `json:"permissions"`
+}
+
+// apply returns base with the requested overrides applied
+func (r *StaffPermissionsRequest) apply(base StaffPermissions) StaffPermissions {
+	if r == nil {
+		return base
+	}
+	if r.CanEditClassroom != nil {
+		base.CanEditClassroom = *r.CanEditClassroom
+	}
+	if r.CanEditContent != nil {
+		base.CanEditContent = *r.CanEditContent
+	}
+	if r.CanGrade != nil {
+		base.CanGrade = *r.CanGrade
+	}
+	if r.CanManageStudents != nil {
+		base.CanManageStudents = *r.CanManageStudents
+	}
+	if r.CanManageStaff != nil {
+		base.CanManageStaff = *r.CanManageStaff
+	}
+	return base
+}
+
+// staffGrantRefusal returns why the teacher may not raise a staff member's permissions from before to after, or
+// "" if they may. Only the owner can hand out staff management, and no one can grant a permission they lack.
+func staffGrantRefusal(db *sql.DB, teacherID, courseID int, before, after StaffPermissions) (string, error) {
+	var role string
+	var own StaffPermissions
+	err := db.QueryRow(`
+		SELECT role, can_edit_classroom, can_edit_content, can_grade, can_manage_students, can_manage_staff
+		FROM classroom_staff
+		WHERE course_id = ? AND teacher_id = ? AND status = 'active' AND archive_delete_flag = TRUE`,
+		courseID, teacherID).
+		Scan(&role, &own.CanEditClassroom, &own.CanEditContent, &own.CanGrade, &own.CanManageStudents,
+			&own.CanManageStaff)
+	if err != nil {
+		return "", err
+	}
+	if role == staffRoleOwner {
+		return "", nil
+	}
+	if after.CanManageStaff && !before.CanManageStaff {
+		return "Only the classroom owner can grant can_manage_staff", nil
+	}
+
+	grants := []struct {
+		name          string
+		granted, held bool
+	}{
+		{"can_edit_classroom", after.CanEditClassroom && !before.CanEditClassroom, own.CanEditClassroom},
+		{"can_edit_content", after.CanEditContent && !before.CanEditContent, own.CanEditContent},
+		{"can_grade", after.CanGrade && !before.CanGrade, own.CanGrade},
+		{"can_manage_students", after.CanManageStudents && !before.CanManageStudents, own.CanManageStudents},
+	}
+	for _, g := range grants {
+		if g.granted && !g.held {
+			return "You cannot grant " + g.name + " without holding it", nil
+		}
+	}
+	return "", nil
+}
+
+// staffCourseLookups finds the classroom that owns a given row
+var staffCourseLookups = map[string]string{
+	"announcement": `
+		SELECT course_id FROM announcement
+		WHERE announcement_id = ? AND archive_delete_flag = TRUE`,
+	"assignment": `
+		SELECT course_id FROM assignment
+		WHERE assignment_id = ? AND archive_delete_flag = TRUE`,
+	"material": `
+		SELECT course_id FROM material
+		WHERE material_id = ? AND archive_delete_flag = TRUE`,
+	"group": `
+		SELECT course_id FROM student_group
+		WHERE group_id = ? AND archive_delete_flag = TRUE`,
+	"question_bank": `
+		SELECT course_id FROM question_bank
+		WHERE bank_id = ? AND archive_delete_flag = TRUE`,
+	"question": `
+		SELECT b.course_id FROM quiz_question q
+		JOIN question_bank b ON q.bank_id = b.bank_id
+		WHERE q.question_id = ? AND q.archive_delete_flag = TRUE AND b.archive_delete_flag = TRUE`,
+	"submission": `
+		SELECT a.course_id FROM submission s
+		JOIN assignment a ON s.assignment_id = a.assignment_id
+		WHERE s.submission_id = ? AND s.archive_delete_flag = TRUE AND a.archive_delete_flag = TRUE`,
+	"session": `
+		SELECT course_id FROM class_session
+		WHERE session_id = ? AND archive_delete_flag = TRUE`,
+	"module": `
+		SELECT course_id FROM class_module
+		WHERE module_id = ? AND archive_delete_flag = TRUE`,
+}
+
+// staffInOrg joins a classroom_staff cs and classroom c query to the staff member's user u, keeping classrooms of
+// their organization only
+const staffInOrg = `
+	JOIN teacher t ON cs.teacher_id = t.teacher_id
+	JOIN user u ON t.user_id = u.user_id AND u.org_id = c.org_id`
+
+// teacherCan reports whether the teacher is active staff on the classroom with the given permission
+func teacherCan(db *sql.DB, teacherID, courseID int, perm string) (bool, error) {
+	var allowed bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM classroom_staff cs
+			JOIN classroom c ON cs.course_id = c.course_id`+staffInOrg+`
+			WHERE cs.course_id = ? AND cs.teacher_id = ? AND cs.status = 'active'
+			AND cs.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE
+			AND `+staffPermissionConditions[perm]+`
+		)`, courseID, teacherID).Scan(&allowed)
+	return allowed, err
+}
+
+// teacherCanOn is teacherCan for the classroom owning a row.
+// kind is one of the keys of staffCourseLookups.
+func teacherCanOn(db *sql.DB, teacherID int, kind string, id int, perm string) (bool, error) {
+	var courseID int
+	err := db.QueryRow(staffCourseLookups[kind], id).Scan(&courseID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return teacherCan(db, teacherID, courseID, perm)
+}
+
+// teacherCanAll reports whether the teacher holds the permission on every given classroom
+func teacherCanAll(db *sql.DB, teacherID int, courseIDs []int, perm string) (bool, error) {
+	placeholders := make([]string, len(courseIDs))
+	args := []interface{}{teacherID}
+	for i, courseID := range courseIDs {
+		placeholders[i] = "?"
+		args = append(args, courseID)
+	}
+
+	var allowed int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM classroom_staff cs
+		JOIN classroom c ON cs.course_id = c.course_id`+staffInOrg+`
+		WHERE cs.teacher_id = ? AND cs.course_id IN (`+strings.Join(placeholders, ",")+`)
+		AND cs.status = 'active' AND cs.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE
+		AND `+staffPermissionConditions[perm],
+		args...).Scan(&allowed)
+	if err != nil {
+		return false, err
+	}
+	return allowed == len(courseIDs), nil
+}
+
+// addClassroomOwner records the teacher as the active owner of a newly created classroom
+func addClassroomOwner(tx *sql.Tx, courseID int64, teacherID int) error {
+	_, err := tx.Exec(`
+		INSERT INTO classroom_staff (course_id, teacher_id, role, status, can_edit_classroom, can_edit_content,
+		can_grade, can_manage_students, can_manage_staff, created_at, archive_delete_flag)
+		VALUES (?, ?, 'owner', 'active', TRUE, TRUE, TRUE, TRUE, TRUE, NOW(), TRUE)`,
+		courseID, teacherID)
+	return err
+}
+
+// staffTeacherID looks up the teacher ID of the calling user
+func staffTeacherID(c *gin.Context, db *sql.DB) (int, bool) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	if role != "teacher" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only teachers can manage classroom staff"})
+		return 0, false
+	}
+
+	var teacherID int
+	err := db.QueryRow(`
+		SELECT teacher_id FROM teacher
+		WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&teacherID)
+	if err != nil {
+		log.Printf("Error querying teacher: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Teacher not found"})
+		return 0, false
+	}
+	return teacherID, true
+}
+
+// authorizeStaffAccess checks that the caller is a teacher holding perm on the classroom owning the given row.
+// kind is "classroom" or one of the keys of staffCourseLookups. Changes are refused in archived classrooms.
+// It writes the error response itself and returns the teacher ID.
+func authorizeStaffAccess(c *gin.Context, db *sql.DB, kind string, id int, perm string) (int, bool) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	if role != "teacher" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only teachers can manage classroom content"})
+		return 0, false
+	}
+
+	var teacherID int
+	err := db.QueryRow(`
+		SELECT teacher_id FROM teacher
+		WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&teacherID)
+	if err != nil {
+		log.Printf("Error querying teacher: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Teacher not found"})
+		return 0, false
+	}
+
+	var allowed bool
+	if kind == "classroom" {
+		allowed, err = teacherCan(db, teacherID, id, perm)
+	} else {
+		allowed, err = teacherCanOn(db, teacherID, kind, id, perm)
+	}
+	if err != nil {
+		log.Printf("Error checking classroom authorization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return 0, false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized for this classroom"})
+		return 0, false
+	}
+
+	if perm != permViewClassroom {
+		if !requireWritableClassroom(c, db, kind, id) {
+			return 0, false
+		}
+	}
+	return teacherID, true
+}
+
+// GetClassroomStaffHandler lists the staff of a classroom, including pending invitations
+func GetClassroomStaffHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	teacherID, ok := staffTeacherID(c, db)
+	if !ok {
+		return
+	}
+
+	allowed, err := teacherCan(db, teacherID, courseID, permViewClassroom)
+	if err != nil {
+		log.Printf("Error checking staff permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to view this classroom's staff"})
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT cs.staff_id, cs.course_id, cs.teacher_id, u.name, u.email, cs.role, cs.status,
+		cs.can_edit_classroom, cs.can_edit_content, cs.can_grade, cs.can_manage_students, cs.can_manage_staff, cs.created_at
+		FROM classroom_staff cs
+		JOIN teacher t ON cs.teacher_id = t.teacher_id
+		JOIN user u ON t.user_id = u.user_id
+		WHERE cs.course_id = ? AND cs.archive_delete_flag = TRUE
+		ORDER BY FIELD(cs.role, 'owner', 'co_teacher', 'ta'), u.name`, courseID)
+	if err != nil {
+		log.Printf("Error querying classroom staff: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	var staff []models.ClassroomStaff
+	for rows.Next() {
+		var s models.ClassroomStaff
+		if err := rows.Scan(&s.StaffID, &s.CourseID, &s.TeacherID, &s.Name, &s.Email, &s.Role, &s.Status,
+			&s.CanEditClassroom, &s.CanEditContent, &s.CanGrade, &s.CanManageStudents, &s.CanManageStaff, &s.CreatedAt); err != nil {
+			log.Printf("Error scanning classroom staff: %v", err)
+			continue
+		}
+		staff = append(staff, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating classroom staff: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, staff)
+}
+
+// InviteClassroomStaffHandler invites another teacher to join a classroom as a co-teacher or TA
+func InviteClassroomStaffHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	var req InviteStaffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if req.Role != staffRoleCoTeacher && req.Role != staffRoleTA {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be 'co_teacher' or 'ta'"})
+		return
+	}
+	perms := req.Permissions.apply(staffRoleDefaults[req.Role])
+
+	db := c.MustGet("db").(*sql.DB)
+	teacherID, ok := staffTeacherID(c, db)
+	if !ok {
+		return
+	}
+
+	allowed, err := teacherCan(db, teacherID, courseID, permManageStaff)
+	if err != nil {
+		log.Printf("Error checking staff permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to manage this classroom's staff"})
+		return
+	}
+
+	refusal, err := staffGrantRefusal(db, teacherID, courseID, StaffPermissions{}, perms)
+	if err != nil {
+		log.Printf("Error checking staff permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if refusal != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": refusal})
+		return
+	}
+
+	var inviteeID int
+	err = db.QueryRow(`
+		SELECT t.teacher_id FROM teacher t
+		JOIN user u ON t.user_id = u.user_id
+		JOIN classroom c ON c.course_id = ? AND c.org_id = u.org_id
+		WHERE u.email = ? AND t.archive_delete_flag = TRUE AND u.archive_delete_flag = TRUE`,
+		courseID, strings.TrimSpace(req.Email)).Scan(&inviteeID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No teacher with that email"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying invited teacher: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var exists bool
+	err = db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM classroom_staff
+			WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE
+		)`, courseID, inviteeID).Scan(&exists)
+	if err != nil {
+		log.Printf("Error checking classroom staff: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Teacher is already on this classroom's staff"})
+		return
+	}
+
+	// A previously removed staff member is re-invited in place
+	_, err = db.Exec(`
+		INSERT INTO classroom_staff (course_id, teacher_id, role, status, can_edit_classroom, can_edit_content,
+		can_grade, can_manage_students, can_manage_staff, invited_by, created_at, archive_delete_flag)
+		VALUES (?, ?, ?, 'invited', ?, ?, ?, ?, ?, ?, NOW(), TRUE)
+		ON DUPLICATE KEY UPDATE role = VALUES(role), status = 'invited',
+		can_edit_classroom = VALUES(can_edit_classroom), can_edit_content = VALUES(can_edit_content),
+		can_grade = VALUES(can_grade), can_manage_students = VALUES(can_manage_students),
+		can_manage_staff = VALUES(can_manage_staff), invited_by = VALUES(invited_by),
+		created_at = NOW(), archive_delete_flag = TRUE`,
+		courseID, inviteeID, req.Role, perms.CanEditClassroom, perms.CanEditContent,
+		perms.CanGrade, perms.CanManageStudents, perms.CanManageStaff, teacherID)
+	if err != nil {
+		log.Printf("Error inviting classroom staff: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"course_id":   courseID,
+		"teacher_id":  inviteeID,
+		"role":        req.Role,
+		"status":      "invited",
+		"permissions": perms,
+		"message":     "Invitation sent",
+	})
+}
+
+// AcceptStaffInvitationHandler lets an invited teacher join the classroom's staff
+func AcceptStaffInvitationHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	teacherID, ok := staffTeacherID(c, db)
+	if !ok {
+		return
+	}
+
+	result, err := db.Exec(`
+		UPDATE classroom_staff
+		SET status = 'active'
+		WHERE course_id = ? AND teacher_id = ? AND status = 'invited' AND archive_delete_flag = TRUE`,
+		courseID, teacherID)
+	if err != nil {
+		log.Printf("Error accepting staff invitation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending invitation for this classroom"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"course_id":  courseID,
+		"teacher_id": teacherID,
+		"status":     "active",
+		"message":    "Invitation accepted",
+	})
+}
+
+// UpdateClassroomStaffHandler changes a staff member's role or permissions
+func UpdateClassroomStaffHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+	staffTeacher, err := strconv.Atoi(c.Param("teacher_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid teacher ID"})
+		return
+	}
+
+	var req UpdateStaffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if req.Role != nil && *req.Role != staffRoleCoTeacher && *req.Role != staffRoleTA {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be 'co_teacher' or 'ta'"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	teacherID, ok := staffTeacherID(c, db)
+	if !ok {
+		return
+	}
+
+	allowed, err := teacherCan(db, teacherID, courseID, permManageStaff)
+	if err != nil {
+		log.Printf("Error checking staff permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to manage this classroom's staff"})
+		return
+	}
+
+	var current StaffPermissions
+	var currentRole string
+	err = db.QueryRow(`
+		SELECT role, can_edit_classroom, can_edit_content, can_grade, can_manage_students, can_manage_staff
+		FROM classroom_staff
+		WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE`, courseID, staffTeacher).
+		Scan(&currentRole, &current.CanEditClassroom, &current.CanEditContent, &current.CanGrade,
+			&current.CanManageStudents, &current.CanManageStaff)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Staff member not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying classroom staff: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if currentRole == staffRoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The classroom owner's role cannot be changed"})
+		return
+	}
+
+	// A role change resets permissions to the new role's defaults before overrides apply
+	newRole := currentRole
+	base := current
+	if req.Role != nil && *req.Role != currentRole {
+		newRole = *req.Role
+		base = staffRoleDefaults[newRole]
+	}
+	perms := req.Permissions.apply(base)
+
+	refusal, err := staffGrantRefusal(db, teacherID, courseID, current, perms)
+	if err != nil {
+		log.Printf("Error checking staff permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if refusal != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": refusal})
+		return
+	}
+
+	_, err = db.Exec(`
+		UPDATE classroom_staff
+		SET role = ?, can_edit_classroom = ?, can_edit_content = ?, can_grade = ?,
+		can_manage_students = ?, can_manage_staff = ?
+		WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE`,
+		newRole, perms.CanEditClassroom, perms.CanEditContent, perms.CanGrade,
+		perms.CanManageStudents, perms.CanManageStaff, courseID, staffTeacher)
+	if err != nil {
+		log.Printf("Error updating classroom staff: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"course_id":   courseID,
+		"teacher_id":  staffTeacher,
+		"role":        newRole,
+		"permissions": perms,
+	})
+}
+
+// RemoveClassroomStaffHandler removes a staff member or declines an invitation.
+// Teachers can always remove themselves; removing others requires the manage-staff permission.
+func RemoveClassroomStaffHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid course ID"})
+		return
+	}
+	staffTeacher, err := strconv.Atoi(c.Param("teacher_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid teacher ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	teacherID, ok := staffTeacherID(c, db)
+	if !ok {
+		return
+	}
+
+	if staffTeacher != teacherID {
+		allowed, err := teacherCan(db, teacherID, courseID, permManageStaff)
+		if err != nil {
+			log.Printf("Error checking staff permission: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to manage this classroom's staff"})
+			return
+		}
+	}
+
+	var staffRole string
+	err = db.QueryRow(`
+		SELECT role FROM classroom_staff
+		WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE`, courseID, staffTeacher).Scan(&staffRole)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Staff member not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying classroom staff: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if staffRole == staffRoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The classroom owner cannot be removed"})
+		return
+	}
+
+	_, err = db.Exec(`
+		UPDATE classroom_staff
+		SET archive_delete_flag = FALSE
+		WHERE course_id = ? AND teacher_id = ? AND archive_delete_flag = TRUE`, courseID, staffTeacher)
+	if err != nil {
+		log.Printf("Error removing classroom staff: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Staff member removed"})
+}
@@ -138,7 +138,8 @@ func GetStudentDashboardHandler(c *gin.Context) {
 			err = db.QueryRow(`
 				SELECT COUNT(*) 
 				FROM assignment 
-				WHERE course_id = ? AND due_date > NOW() AND archive_delete_flag = TRUE`, course["course_id"]).Scan(&upcomingAssignments)
+				WHERE course_id = ? AND due_date > NOW() AND archive_delete_flag = TRUE
+				AND `+visibleToStudents(""), course["course_id"]).Scan(&upcomingAssignments)
 			if err != nil {
 				log.Printf("Error counting upcoming assignments for course %v: %v", course["course_id"], err)
 				continue
@@ -147,13 +148,28 @@ func GetStudentDashboardHandler(c *gin.Context) {
 		}
 	}
 
+	// Attendance over each course's past sessions
+	attendance, err := attendanceSummaries(db, studentID, 0)
+	if err != nil {
+		log.Printf("Error querying attendance summaries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	for _, course := range courses {
+		summary := attendance[course["course_id"].(int)]
+		if summary == nil {
+			summary = &models.AttendanceSummary{}
+		}
+		course["attendance"] = summary
+	}
+
 	// Get recent submissions
 	rows, err = db.Query(`
 		SELECT s.submission_id, s.assignment_id, s.submitted_at, s.status
 		FROM submission s
-		WHERE s.student_id = ? AND s.archive_delete_flag = TRUE
+		WHERE s.archive_delete_flag = TRUE AND `+submissionOwnedBy+`
 		ORDER BY s.submitted_at DESC
-		LIMIT 5`, studentID)
+		LIMIT 5`, studentID, studentID)
 	if err != nil {
 		log.Printf("Error querying submissions: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -201,7 +217,8 @@ func GetStudentDashboardHandler(c *gin.Context) {
 			SELECT a.announcement_id, a.course_id, a.title, a.content, a.created_at, a.is_pinned
 		 FROM announcement a
 		 WHERE a.course_id IN (` + strings.Join(placeholders, ",") + `)
-		 AND a.is_pinned = TRUE AND a.archive_delete_flag = TRUE`
+		 AND a.is_pinned = TRUE AND a.archive_delete_flag = TRUE
+		 AND ` + visibleToStudents("a")
 
 		rows, err = db.Query(query, args...)
 		if err != nil {
@@ -242,6 +259,7 @@ func GetStudentDashboardHandler(c *gin.Context) {
 		 FROM announcement a
 		 WHERE a.course_id IN (` + strings.Join(placeholders, ",") + `)
 		 AND a.archive_delete_flag = TRUE
+		 AND ` + visibleToStudents("a") + `
 		 ORDER BY a.created_at DESC
 		 LIMIT 5`
 
@@ -286,7 +304,8 @@ func GetStudentDashboardHandler(c *gin.Context) {
 		 FROM assignment a
 		 WHERE a.course_id IN (` + strings.Join(placeholders, ",") + `)
 		 AND a.due_date BETWEEN ? AND ?
-		 AND a.archive_delete_flag = TRUE`
+		 AND a.archive_delete_flag = TRUE
+		 AND ` + visibleToStudents("a")
 		
 		// Create a new args slice for this query, starting with courseIDs
 		dueArgs := make([]interface{}, len(args), len(args)+2)
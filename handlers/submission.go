@@ -5,10 +5,12 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"edusync/grader"
 	"edusync/models"
 )
 
@@ -45,12 +47,14 @@ func CreateSubmissionHandler(c *gin.Context) {
 		return
 	}
 
-	// Check if the assignment exists and fetch due date
+	// Check if the assignment exists and fetch due date (drafts and scheduled assignments are not visible yet)
 	var courseID int
 	var dueDate time.Time
+	var isGroup bool
 	err = db.QueryRow(`
-		SELECT course_id, due_date FROM assignment 
-		WHERE assignment_id = ? AND archive_delete_flag = TRUE`, req.AssignmentID).Scan(&courseID, &dueDate)
+		SELECT course_id, due_date, is_group_assignment FROM assignment 
+		WHERE assignment_id = ? AND archive_delete_flag = TRUE
+		AND `+visibleToStudents(""), req.AssignmentID).Scan(&courseID, &dueDate, &isGroup)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
 		return
@@ -60,13 +64,52 @@ func CreateSubmissionHandler(c *gin.Context) {
 		return
 	}
 
+	// Quizzes are submitted through quiz attempts
+	quiz, err := isQuiz(db, req.AssignmentID)
+	if err != nil {
+		log.Printf("Error checking quiz: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignment: " + err.Error()})
+		return
+	}
+	if quiz {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This assignment is a quiz; start a quiz attempt instead"})
+		return
+	}
+
+	// Code assignments are graded by running the submitted source against the assignment's tests
+	code, err := isCodeAssignment(db, req.AssignmentID)
+	if err != nil {
+		log.Printf("Error checking code assignment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignment: " + err.Error()})
+		return
+	}
+	if msg := checkSourceCode(code, req.SourceCode); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Group assignments are submitted once on behalf of the student's group
+	var groupID interface{}
+	if isGroup {
+		id, err := studentGroupID(db, studentID, courseID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You must be in a group to submit this group assignment"})
+			return
+		} else if err != nil {
+			log.Printf("Error querying student group: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch group: " + err.Error()})
+			return
+		}
+		groupID = id
+	}
+
 	// Check due date
 	if time.Now().After(dueDate) {
 		// Check if a submission exists
 		var existingSubmissionID int
 		err = db.QueryRow(`
 			SELECT submission_id FROM submission 
-			WHERE assignment_id = ? AND student_id = ? AND archive_delete_flag = TRUE`, req.AssignmentID, studentID).
+			WHERE assignment_id = ? AND (student_id = ? OR group_id = ?) AND archive_delete_flag = TRUE`, req.AssignmentID, studentID, groupID).
 			Scan(&existingSubmissionID)
 		if err == nil {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Due date is over. You submitted on time, but you can no longer update your submission"})
@@ -97,14 +140,30 @@ func CreateSubmissionHandler(c *gin.Context) {
 		return
 	}
 
-	// Check for existing submission
+	if !requireWritableClassroom(c, db, "classroom", courseID) {
+		return
+	}
+
+	// Assignments in a locked module cannot be worked on yet, or any longer
+	reason, err := moduleLockReason(db, studentID, moduleItemAssignment, req.AssignmentID)
+	if err != nil {
+		log.Printf("Error checking module lock: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if reason != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": reason})
+		return
+	}
+
+	// Check for existing submission, by the student or by their group
 	var existingSubmissionID int
 	err = db.QueryRow(`
 		SELECT submission_id FROM submission 
-		WHERE assignment_id = ? AND student_id = ? AND archive_delete_flag = TRUE`, req.AssignmentID, studentID).
+		WHERE assignment_id = ? AND (student_id = ? OR group_id = ?) AND archive_delete_flag = TRUE`, req.AssignmentID, studentID, groupID).
 		Scan(&existingSubmissionID)
 	if err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "You have already submitted this assignment"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You or your group have already submitted this assignment"})
 		return
 	} else if err != sql.ErrNoRows {
 		log.Printf("Error checking existing submission: %v", err)
@@ -112,11 +171,19 @@ func CreateSubmissionHandler(c *gin.Context) {
 		return
 	}
 
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
 	// Create submission
-	result, err := db.Exec(`
-		INSERT INTO submission (assignment_id, student_id, content, submitted_at, status, archive_delete_flag)
-		VALUES (?, ?, ?, NOW(), 'submitted', TRUE)`,
-		req.AssignmentID, studentID, req.Content)
+	result, err := tx.Exec(`
+		INSERT INTO submission (assignment_id, student_id, group_id, content, source_code, submitted_at, status, archive_delete_flag)
+		VALUES (?, ?, ?, ?, ?, NOW(), 'submitted', TRUE)`,
+		req.AssignmentID, studentID, groupID, req.Content, req.SourceCode)
 	if err != nil {
 		log.Printf("Error inserting submission: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create submission: " + err.Error()})
@@ -130,12 +197,31 @@ func CreateSubmissionHandler(c *gin.Context) {
 		return
 	}
 
+	if code {
+		if err := queueGradingJob(tx, int(submissionID)); err != nil {
+			log.Printf("Error queueing grading job: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue grading: " + err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	if code {
+		grader.Wake()
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message":       "Submission created successfully",
-		"submission_id": submissionID,
-		"assignment_id": req.AssignmentID,
-		"student_id":    studentID,
-		"status":        "submitted",
+		"message":        "Submission created successfully",
+		"submission_id":  submissionID,
+		"assignment_id":  req.AssignmentID,
+		"student_id":     studentID,
+		"group_id":       groupID,
+		"status":         "submitted",
+		"grading_queued": code,
 	})
 }
 
@@ -178,11 +264,11 @@ func UpdateSubmissionHandler(c *gin.Context) {
 		return
 	}
 
-	// Check if the submission exists and belongs to the student, and fetch assignment_id
+	// Check if the submission exists and belongs to the student or their group, and fetch assignment_id
 	var assignmentID int
 	err = db.QueryRow(`
-		SELECT assignment_id FROM submission 
-		WHERE submission_id = ? AND student_id = ? AND archive_delete_flag = TRUE`, submissionID, studentID).
+		SELECT s.assignment_id FROM submission s
+		WHERE s.submission_id = ? AND s.archive_delete_flag = TRUE AND `+submissionOwnedBy, submissionID, studentID, studentID).
 		Scan(&assignmentID)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found or unauthorized"})
@@ -193,6 +279,27 @@ func UpdateSubmissionHandler(c *gin.Context) {
 		return
 	}
 
+	quiz, err := isQuiz(db, assignmentID)
+	if err != nil {
+		log.Printf("Error checking quiz: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignment: " + err.Error()})
+		return
+	}
+	if quiz {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quiz submissions are updated by submitting a new attempt"})
+		return
+	}
+	code, err := isCodeAssignment(db, assignmentID)
+	if err != nil {
+		log.Printf("Error checking code assignment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignment: " + err.Error()})
+		return
+	}
+	if msg := checkSourceCode(code, req.SourceCode); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
 	// Fetch due date
 	var dueDate time.Time
 	err = db.QueryRow(`
@@ -204,32 +311,96 @@ func UpdateSubmissionHandler(c *gin.Context) {
 		return
 	}
 
+	if !requireWritableClassroom(c, db, "submission", submissionID) {
+		return
+	}
+
 	// Check due date
 	if time.Now().After(dueDate) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Due date is over. You can no longer update your submission"})
 		return
 	}
 
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
 	// Update submission
-	_, err = db.Exec(`
+	_, err = tx.Exec(`
 		UPDATE submission 
-		SET content = ?, submitted_at = NOW(), status = 'submitted'
-		WHERE submission_id = ? AND student_id = ? AND archive_delete_flag = TRUE`,
-		req.Content, submissionID, studentID)
+		SET content = ?, source_code = ?, submitted_at = NOW(), status = 'submitted'
+		WHERE submission_id = ? AND archive_delete_flag = TRUE`,
+		req.Content, req.SourceCode, submissionID)
 	if err != nil {
 		log.Printf("Error updating submission: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update submission: " + err.Error()})
 		return
 	}
 
+	if code {
+		if err := queueGradingJob(tx, submissionID); err != nil {
+			log.Printf("Error queueing grading job: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue grading: " + err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	if code {
+		grader.Wake()
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message":       "Submission updated successfully",
-		"submission_id": submissionID,
-		"content":       req.Content,
-		"status":        "submitted",
+		"message":        "Submission updated successfully",
+		"submission_id":  submissionID,
+		"content":        req.Content,
+		"status":         "submitted",
+		"grading_queued": code,
 	})
 }
 
+// maxSourceCodeBytes caps the size of submitted source code
+const maxSourceCodeBytes = 256 * 1024
+
+// checkSourceCode validates the source code of a submission and returns a message for the client when it is invalid
+func checkSourceCode(code bool, source *string) string {
+	if !code {
+		if source != nil {
+			return "source_code is only accepted for code assignments"
+		}
+		return ""
+	}
+	if source == nil || strings.TrimSpace(*source) == "" {
+		return "source_code is required for code assignments"
+	}
+	if len(*source) > maxSourceCodeBytes {
+		return "source_code is too large"
+	}
+	return ""
+}
+
+// queueGradingJob queues a submission for the code runner, cancelling any run still waiting for an older version
+func queueGradingJob(tx *sql.Tx, submissionID int) error {
+	_, err := tx.Exec(`
+		UPDATE grading_job SET status = 'cancelled', finished_at = NOW()
+		WHERE submission_id = ? AND status = 'queued'`, submissionID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO grading_job (submission_id, status, created_at)
+		VALUES (?, 'queued', NOW())`, submissionID)
+	return err
+}
+
 // GradeSubmissionHandler grades a submission
 func GradeSubmissionHandler(c *gin.Context) {
 	userID, exists := c.Get("userID")
@@ -280,10 +451,11 @@ func GradeSubmissionHandler(c *gin.Context) {
 		FROM submission s
 		JOIN assignment a ON s.assignment_id = a.assignment_id
 		JOIN classroom c ON a.course_id = c.course_id
-		JOIN teacher t ON c.teacher_id = t.teacher_id
+		JOIN classroom_staff cs ON cs.course_id = c.course_id AND cs.status = 'active' AND cs.archive_delete_flag = TRUE
+		JOIN teacher t ON cs.teacher_id = t.teacher_id
 		WHERE s.submission_id = ? AND s.archive_delete_flag = TRUE
 		AND a.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE
-		AND t.archive_delete_flag = TRUE AND t.user_id = ?`, submissionID, userIDInt).Scan(&teacherID)
+		AND t.archive_delete_flag = TRUE AND t.user_id = ? AND cs.can_grade = TRUE`, submissionID, userIDInt).Scan(&teacherID)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to grade this submission"})
 		return
@@ -293,32 +465,193 @@ func GradeSubmissionHandler(c *gin.Context) {
 		return
 	}
 
+	if !requireWritableClassroom(c, db, "submission", submissionID) {
+		return
+	}
+
 	var req struct {
 		Score    int    `json:"score"`
 		Feedback string `json:"feedback"`
+		// Per-member adjustments for group submissions; a null score falls back to the group grade
+		MemberGrades []struct {
+			StudentID int     `json:"student_id" binding:"required"`
+			Score     *int    `json:"score"`
+			Feedback  *string `json:"feedback"`
+		} `json:"member_grades"`
+		// Scores for the short answers of a quiz attempt; the submission score is then recomputed from the quiz
+		QuestionScores []QuestionScore `json:"question_scores"`
+		AttemptID      int             `json:"attempt_id"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
 		return
 	}
 
-	_, err = db.Exec(`
-		UPDATE submission 
-		SET score = ?, feedback = ?, status = 'graded'
-		WHERE submission_id = ? AND archive_delete_flag = TRUE`,
-		req.Score, req.Feedback, submissionID)
+	var groupID sql.NullInt64
+	err = db.QueryRow(`
+		SELECT group_id FROM submission 
+		WHERE submission_id = ? AND archive_delete_flag = TRUE`, submissionID).Scan(&groupID)
+	if err != nil {
+		log.Printf("Error querying submission group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch submission: " + err.Error()})
+		return
+	}
+	if len(req.MemberGrades) > 0 && !groupID.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "member_grades only apply to group submissions"})
+		return
+	}
+	for _, mg := range req.MemberGrades {
+		var isMember bool
+		err = db.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM student_group_member 
+				WHERE group_id = ? AND student_id = ? AND archive_delete_flag = TRUE
+			)`, groupID.Int64, mg.StudentID).Scan(&isMember)
+		if err != nil {
+			log.Printf("Error checking group membership: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check group membership: " + err.Error()})
+			return
+		}
+		if !isMember {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Student " + strconv.Itoa(mg.StudentID) + " is not a member of this group"})
+			return
+		}
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
-		log.Printf("Error grading submission: %v", err)
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	status := "graded"
+	teacherScore := req.Score
+	var peerPoints *float64
+	if len(req.QuestionScores) > 0 {
+		msg, err := reviewQuizAnswers(tx, submissionID, req.AttemptID, req.QuestionScores)
+		if err != nil {
+			log.Printf("Error reviewing quiz answers: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grade submission: " + err.Error()})
+			return
+		}
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		var score sql.NullInt64
+		err = tx.QueryRow(`
+			SELECT score, status FROM submission WHERE submission_id = ?`, submissionID).Scan(&score, &status)
+		if err != nil {
+			log.Printf("Error querying quiz score: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grade submission: " + err.Error()})
+			return
+		}
+		req.Score = int(score.Int64)
+		_, err = tx.Exec(`
+			UPDATE submission SET feedback = ?
+			WHERE submission_id = ? AND archive_delete_flag = TRUE`, req.Feedback, submissionID)
+		if err != nil {
+			log.Printf("Error saving feedback: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grade submission: " + err.Error()})
+			return
+		}
+	} else {
+		// Peer-reviewed assignments may blend the average peer score into the grade
+		req.Score, peerPoints, err = peerGrade(tx, submissionID, req.Score)
+		if err != nil {
+			log.Printf("Error querying peer scores: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grade submission: " + err.Error()})
+			return
+		}
+		_, err = tx.Exec(`
+			UPDATE submission 
+			SET score = ?, feedback = ?, status = 'graded'
+			WHERE submission_id = ? AND archive_delete_flag = TRUE`,
+			req.Score, req.Feedback, submissionID)
+		if err != nil {
+			log.Printf("Error grading submission: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grade submission: " + err.Error()})
+			return
+		}
+	}
+
+	// Members left out of this grading lose any individual grade they had
+	staleQuery := `DELETE FROM submission_member_grade WHERE submission_id = ?`
+	staleArgs := []interface{}{submissionID}
+	if len(req.MemberGrades) > 0 {
+		staleQuery += ` AND student_id NOT IN (` + strings.TrimSuffix(strings.Repeat("?,", len(req.MemberGrades)), ",") + `)`
+		for _, mg := range req.MemberGrades {
+			staleArgs = append(staleArgs, mg.StudentID)
+		}
+	}
+	if _, err := tx.Exec(staleQuery, staleArgs...); err != nil {
+		log.Printf("Error clearing member grades: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grade submission: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	for _, mg := range req.MemberGrades {
+		_, err = tx.Exec(`
+			INSERT INTO submission_member_grade (submission_id, student_id, score, feedback)
+			VALUES (?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE score = VALUES(score), feedback = VALUES(feedback)`,
+			submissionID, mg.StudentID, mg.Score, mg.Feedback)
+		if err != nil {
+			log.Printf("Error saving member grade: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grade submission: " + err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	response := gin.H{
 		"submission_id": submissionID,
 		"score":         req.Score,
 		"feedback":      req.Feedback,
-		"status":        "graded",
-	})
+		"member_grades": req.MemberGrades,
+		"status":        status,
+	}
+	if peerPoints != nil {
+		response["teacher_score"] = teacherScore
+		response["peer_points"] = *peerPoints
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// submissionListSpec is the sorting and filtering of an assignment's submission list
+var submissionListSpec = listSpec{
+	Sorts: map[string]listColumn{
+		"submitted_at": {Expr: "COALESCE(s.submitted_at, TIMESTAMP '1970-01-01 00:00:00')", Kind: kindTime},
+		"score":        {Expr: "COALESCE(s.score, -1)", Kind: kindInt},
+	},
+	DefaultSort: "submitted_at",
+	ID:          "s.submission_id",
+	Filters: map[string]listFilter{
+		"status":           {Expr: "s.status", Kind: kindString, Values: []string{"submitted", "needs_review", "graded"}},
+		"submitted_before": {Expr: "s.submitted_at", Kind: kindTime, Op: "<"},
+		"submitted_after":  {Expr: "s.submitted_at", Kind: kindTime, Op: ">="},
+	},
+}
+
+// studentSubmissionListSpec is the sorting and filtering of a student's own submissions across classrooms
+var studentSubmissionListSpec = listSpec{
+	Sorts:       submissionListSpec.Sorts,
+	DefaultSort: "-submitted_at",
+	ID:          "s.submission_id",
+	Filters: map[string]listFilter{
+		"status":           submissionListSpec.Filters["status"],
+		"submitted_before": submissionListSpec.Filters["submitted_before"],
+		"submitted_after":  submissionListSpec.Filters["submitted_after"],
+		"assignment_id":    {Expr: "s.assignment_id", Kind: kindInt},
+		"course_id":        {Expr: "a.course_id", Kind: kindInt},
+	},
 }
 
 // GetSubmissionsByAssignmentHandler lists submissions for an assignment
@@ -358,6 +691,12 @@ func GetSubmissionsByAssignmentHandler(c *gin.Context) {
 		return
 	}
 
+	page, err := parseListPage(c, submissionListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	var query string
 	var args []interface{}
 
@@ -374,7 +713,8 @@ func GetSubmissionsByAssignmentHandler(c *gin.Context) {
 			SELECT t.teacher_id
 			FROM assignment a
 			JOIN classroom c ON a.course_id = c.course_id
-			JOIN teacher t ON c.teacher_id = t.teacher_id
+			JOIN classroom_staff cs ON cs.course_id = c.course_id AND cs.status = 'active' AND cs.archive_delete_flag = TRUE
+			JOIN teacher t ON cs.teacher_id = t.teacher_id
 			WHERE a.assignment_id = ? AND a.archive_delete_flag = TRUE
 			AND c.archive_delete_flag = TRUE AND t.archive_delete_flag = TRUE
 			AND t.user_id = ?`, assignmentID, userIDInt).Scan(&teacherID)
@@ -388,12 +728,13 @@ func GetSubmissionsByAssignmentHandler(c *gin.Context) {
 		}
 
 		query = `
-			SELECT s.submission_id, s.assignment_id, s.student_id, s.content, s.submitted_at, s.score, s.feedback, s.status
+			SELECT s.submission_id, s.assignment_id, s.student_id, s.content, s.submitted_at, s.score, s.feedback, s.status, s.group_id` + page.Select() + `
 			FROM submission s
 			JOIN student st ON s.student_id = st.student_id
 			JOIN enrollment e ON st.student_id = e.student_id
 			JOIN classroom c ON e.course_id = c.course_id
-			JOIN teacher t ON c.teacher_id = t.teacher_id
+			JOIN classroom_staff cs ON cs.course_id = c.course_id AND cs.status = 'active' AND cs.archive_delete_flag = TRUE
+			JOIN teacher t ON cs.teacher_id = t.teacher_id
 			WHERE s.assignment_id = ? AND s.archive_delete_flag = TRUE AND st.archive_delete_flag = TRUE
 			AND e.archive_delete_flag = TRUE AND c.archive_delete_flag = TRUE AND t.archive_delete_flag = TRUE
 			AND t.user_id = ?`
@@ -445,17 +786,20 @@ func GetSubmissionsByAssignmentHandler(c *gin.Context) {
 			return
 		}
 
+		// Group submissions show the member's own adjusted grade where one was given
 		query = `
-			SELECT submission_id, assignment_id, student_id, content, submitted_at, score, feedback, status
-			FROM submission 
-			WHERE assignment_id = ? AND student_id = ? AND archive_delete_flag = TRUE`
-		args = []interface{}{assignmentID, studentID}
+			SELECT s.submission_id, s.assignment_id, s.student_id, s.content, s.submitted_at,
+			COALESCE(mg.score, s.score), COALESCE(mg.feedback, s.feedback), s.status, s.group_id` + page.Select() + `
+			FROM submission s
+			LEFT JOIN submission_member_grade mg ON mg.submission_id = s.submission_id AND mg.student_id = ?
+			WHERE s.assignment_id = ? AND s.archive_delete_flag = TRUE AND ` + submissionOwnedBy
+		args = []interface{}{studentID, assignmentID, studentID, studentID}
 	} else {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized role"})
 		return
 	}
 
-	rows, err := db.Query(query, args...)
+	rows, err := db.Query(query+page.Where()+page.OrderLimit(), append(args, page.Args()...)...)
 	if err != nil {
 		log.Printf("Error querying submissions: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch submissions: " + err.Error()})
@@ -464,14 +808,18 @@ func GetSubmissionsByAssignmentHandler(c *gin.Context) {
 	defer rows.Close()
 
 	var submissions []models.Submission
-	for rows.Next() {
+	for rows.Next() && page.Next() {
 		var s models.Submission
-		var score sql.NullInt64
+		var score, groupID sql.NullInt64
 		var feedback sql.NullString
-		if err := rows.Scan(&s.SubmissionID, &s.AssignmentID, &s.StudentID, &s.Content, &s.SubmittedAt, &score, &feedback, &s.Status); err != nil {
+		if err := rows.Scan(page.Dest(&s.SubmissionID, &s.AssignmentID, &s.StudentID, &s.Content, &s.SubmittedAt, &score, &feedback, &s.Status, &groupID)...); err != nil {
 			log.Printf("Error scanning submission: %v", err)
 			continue
 		}
+		if groupID.Valid {
+			groupIDValue := int(groupID.Int64)
+			s.GroupID = &groupIDValue
+		}
 		if score.Valid {
 			scoreValue := int(score.Int64)
 			s.Score = &scoreValue
@@ -489,6 +837,20 @@ func GetSubmissionsByAssignmentHandler(c *gin.Context) {
 		return
 	}
 
+	// Teachers see each submission's result in the latest similarity report
+	if role == "teacher" {
+		summaries, err := similaritySummaries(db, assignmentID)
+		if err != nil {
+			log.Printf("Error querying similarity summaries: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch similarity results: " + err.Error()})
+			return
+		}
+		for i := range submissions {
+			submissions[i].Similarity = summaries[submissions[i].SubmissionID]
+		}
+	}
+
+	page.SetNextCursor(c)
 	c.JSON(http.StatusOK, submissions)
 }
 
@@ -541,7 +903,8 @@ func GetAssignmentStatisticsHandler(c *gin.Context) {
 		SELECT t.teacher_id
 		FROM assignment a
 		JOIN classroom c ON a.course_id = c.course_id
-		JOIN teacher t ON c.teacher_id = t.teacher_id
+		JOIN classroom_staff cs ON cs.course_id = c.course_id AND cs.status = 'active' AND cs.archive_delete_flag = TRUE
+		JOIN teacher t ON cs.teacher_id = t.teacher_id
 		WHERE a.assignment_id = ? AND a.archive_delete_flag = TRUE
 		AND c.archive_delete_flag = TRUE AND t.archive_delete_flag = TRUE
 		AND t.user_id = ?`, assignmentID, userIDInt).Scan(&teacherID)
@@ -589,10 +952,28 @@ func GetAssignmentStatisticsHandler(c *gin.Context) {
 		return
 	}
 
+	// Count the enrolled students covered by a submission, either their own or their group's
+	var coveredStudents int
+	err = db.QueryRow(`
+		SELECT COUNT(*) 
+		FROM enrollment e
+		WHERE e.course_id = ? AND e.archive_delete_flag = TRUE
+		AND EXISTS (
+			SELECT 1 FROM submission s
+			WHERE s.assignment_id = ? AND s.archive_delete_flag = TRUE
+			AND (s.student_id = e.student_id OR s.group_id IN (
+				SELECT group_id FROM student_group_member WHERE student_id = e.student_id AND archive_delete_flag = TRUE))
+		)`, courseID, assignmentID).Scan(&coveredStudents)
+	if err != nil {
+		log.Printf("Error counting students with submissions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count submissions: " + err.Error()})
+		return
+	}
+
 	// Calculate submission rate
 	var submissionRate float64
 	if totalStudents > 0 {
-		submissionRate = (float64(submissionCount) / float64(totalStudents)) * 100
+		submissionRate = (float64(coveredStudents) / float64(totalStudents)) * 100
 	} else {
 		submissionRate = 0
 	}
@@ -667,13 +1048,15 @@ func GetSubmissionHandler(c *gin.Context) {
 
 	// Fetch the submission
 	var submission models.Submission
-	var score sql.NullInt64
+	var score, groupID sql.NullInt64
 	var feedback sql.NullString
 	err = db.QueryRow(`
-		SELECT submission_id, assignment_id, student_id, content, submitted_at, score, feedback, status
-		FROM submission 
-		WHERE submission_id = ? AND student_id = ? AND archive_delete_flag = TRUE`,
-		submissionID, studentID).Scan(
+		SELECT s.submission_id, s.assignment_id, s.student_id, s.content, s.submitted_at,
+		COALESCE(mg.score, s.score), COALESCE(mg.feedback, s.feedback), s.status, s.group_id, s.source_code
+		FROM submission s
+		LEFT JOIN submission_member_grade mg ON mg.submission_id = s.submission_id AND mg.student_id = ?
+		WHERE s.submission_id = ? AND s.archive_delete_flag = TRUE AND `+submissionOwnedBy,
+		studentID, submissionID, studentID, studentID).Scan(
 		&submission.SubmissionID,
 		&submission.AssignmentID,
 		&submission.StudentID,
@@ -682,6 +1065,8 @@ func GetSubmissionHandler(c *gin.Context) {
 		&score,
 		&feedback,
 		&submission.Status,
+		&groupID,
+		&submission.SourceCode,
 	)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found or unauthorized"})
@@ -693,6 +1078,10 @@ func GetSubmissionHandler(c *gin.Context) {
 	}
 
 	// Handle nullable fields
+	if groupID.Valid {
+		groupIDValue := int(groupID.Int64)
+		submission.GroupID = &groupIDValue
+	}
 	if score.Valid {
 		scoreValue := int(score.Int64)
 		submission.Score = &scoreValue
@@ -740,11 +1129,21 @@ func GetStudentSubmissionsHandler(c *gin.Context) {
 		return
 	}
 
-	// Fetch all submissions for the student
+	page, err := parseListPage(c, studentSubmissionListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Fetch the student's submissions, including those made by their groups
 	rows, err := db.Query(`
-		SELECT submission_id, assignment_id, student_id, content, submitted_at, score, feedback, status
-		FROM submission 
-		WHERE student_id = ? AND archive_delete_flag = TRUE`, studentID)
+		SELECT s.submission_id, s.assignment_id, s.student_id, s.content, s.submitted_at,
+		COALESCE(mg.score, s.score), COALESCE(mg.feedback, s.feedback), s.status, s.group_id`+page.Select()+`
+		FROM submission s
+		JOIN assignment a ON s.assignment_id = a.assignment_id
+		LEFT JOIN submission_member_grade mg ON mg.submission_id = s.submission_id AND mg.student_id = ?
+		WHERE s.archive_delete_flag = TRUE AND `+submissionOwnedBy+page.Where()+page.OrderLimit(),
+		append([]interface{}{studentID, studentID, studentID}, page.Args()...)...)
 	if err != nil {
 		log.Printf("Error querying submissions: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch submissions: " + err.Error()})
@@ -753,14 +1152,18 @@ func GetStudentSubmissionsHandler(c *gin.Context) {
 	defer rows.Close()
 
 	var submissions []models.Submission
-	for rows.Next() {
+	for rows.Next() && page.Next() {
 		var s models.Submission
-		var score sql.NullInt64
+		var score, groupID sql.NullInt64
 		var feedback sql.NullString
-		if err := rows.Scan(&s.SubmissionID, &s.AssignmentID, &s.StudentID, &s.Content, &s.SubmittedAt, &score, &feedback, &s.Status); err != nil {
+		if err := rows.Scan(page.Dest(&s.SubmissionID, &s.AssignmentID, &s.StudentID, &s.Content, &s.SubmittedAt, &score, &feedback, &s.Status, &groupID)...); err != nil {
 			log.Printf("Error scanning submission: %v", err)
 			continue
 		}
+		if groupID.Valid {
+			groupIDValue := int(groupID.Int64)
+			s.GroupID = &groupIDValue
+		}
 		if score.Valid {
 			scoreValue := int(score.Int64)
 			s.Score = &scoreValue
@@ -778,5 +1181,187 @@ func GetStudentSubmissionsHandler(c *gin.Context) {
 		return
 	}
 
+	page.SetNextCursor(c)
 	c.JSON(http.StatusOK, submissions)
+}
+
+// GetSubmissionTestResultsHandler returns the latest code runner results for a submission.
+// Students see the output of visible tests only.
+func GetSubmissionTestResultsHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	role, _ := c.Get("role")
+
+	submissionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if role == "teacher" {
+		if _, ok := authorizeStaffAccess(c, db, "submission", submissionID, permViewClassroom); !ok {
+			return
+		}
+	} else {
+		var studentID int
+		err = db.QueryRow(`
+			SELECT student_id FROM student 
+			WHERE user_id = ? AND archive_delete_flag = TRUE`, userID).Scan(&studentID)
+		if err != nil {
+			log.Printf("Error querying student: %v", err)
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+		var owned bool
+		err = db.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM submission s
+				WHERE s.submission_id = ? AND s.archive_delete_flag = TRUE AND `+submissionOwnedBy+`
+			)`, submissionID, studentID, studentID).Scan(&owned)
+		if err != nil {
+			log.Printf("Error checking submission ownership: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !owned {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found or unauthorized"})
+			return
+		}
+	}
+
+	var jobID int
+	var status string
+	var jobError sql.NullString
+	var createdAt time.Time
+	var finishedAt sql.NullTime
+	err = db.QueryRow(`
+		SELECT job_id, status, error, created_at, finished_at FROM grading_job
+		WHERE submission_id = ? AND status <> 'cancelled'
+		ORDER BY job_id DESC LIMIT 1`, submissionID).Scan(&jobID, &status, &jobError, &createdAt, &finishedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Submission has not been queued for grading"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying grading job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch grading job"})
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT t.test_id, t.name, t.points, t.is_hidden, r.passed, r.stdout, r.stderr, r.exit_code, r.timed_out, r.runtime_ms
+		FROM grading_result r
+		JOIN code_test_case t ON r.test_id = t.test_id
+		WHERE r.job_id = ?
+		ORDER BY t.position, t.test_id`, jobID)
+	if err != nil {
+		log.Printf("Error querying grading results: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch results"})
+		return
+	}
+	defer rows.Close()
+
+	results := []gin.H{}
+	passed := 0
+	for rows.Next() {
+		var testID, exitCode, runtimeMS int
+		var name string
+		var points float64
+		var hidden, ok, timedOut bool
+		var stdout, stderr sql.NullString
+		if err := rows.Scan(&testID, &name, &points, &hidden, &ok, &stdout, &stderr, &exitCode, &timedOut, &runtimeMS); err != nil {
+			log.Printf("Error scanning grading result: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process results"})
+			return
+		}
+		if ok {
+			passed++
+		}
+		result := gin.H{
+			"test_id":    testID,
+			"name":       name,
+			"points":     points,
+			"is_hidden":  hidden,
+			"passed":     ok,
+			"timed_out":  timedOut,
+			"runtime_ms": runtimeMS,
+		}
+		if !hidden || role == "teacher" {
+			result["stdout"] = stdout.String
+			result["stderr"] = stderr.String
+			result["exit_code"] = exitCode
+		}
+		results = append(results, result)
+	}
+
+	response := gin.H{
+		"submission_id": submissionID,
+		"job_id":        jobID,
+		"status":        status,
+		"error":         nil,
+		"queued_at":     createdAt.Format(time.RFC3339),
+		"finished_at":   nil,
+		"passed":        passed,
+		"total":         len(results),
+		"results":       results,
+	}
+	if jobError.Valid {
+		response["error"] = jobError.String
+	}
+	if finishedAt.Valid {
+		response["finished_at"] = finishedAt.Time.Format(time.RFC3339)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RegradeSubmissionHandler queues a code submission to be run against the current tests again
+func RegradeSubmissionHandler(c *gin.Context) {
+	submissionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if _, ok := authorizeStaffAccess(c, db, "submission", submissionID, permGrade); !ok {
+		return
+	}
+
+	var hasSource bool
+	err = db.QueryRow(`
+		SELECT s.source_code IS NOT NULL AND EXISTS (
+			SELECT 1 FROM code_assignment ca WHERE ca.assignment_id = s.assignment_id AND ca.archive_delete_flag = TRUE
+		)
+		FROM submission s
+		WHERE s.submission_id = ? AND s.archive_delete_flag = TRUE`, submissionID).Scan(&hasSource)
+	if err != nil {
+		log.Printf("Error querying submission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch submission: " + err.Error()})
+		return
+	}
+	if !hasSource {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Submission is not for a code assignment"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := queueGradingJob(tx, submissionID); err != nil {
+		log.Printf("Error queueing grading job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue grading: " + err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	grader.Wake()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Submission queued for grading", "submission_id": submissionID})
 }
\ No newline at end of file
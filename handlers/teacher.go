@@ -207,6 +207,7 @@ func GetTeacherProfileHandler(c *gin.Context) {
 
 // GetTeacherByIDHandler retrieves a teacher's profile by teacher_id (for admin or authorized users)
 func GetTeacherByIDHandler(c *gin.Context) {
+	orgID, _ := c.Get("orgID")
 	teacherID, err := strconv.Atoi(c.Param("teacher_id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid teacher ID"})
@@ -216,9 +217,10 @@ func GetTeacherByIDHandler(c *gin.Context) {
 	db := c.MustGet("db").(*sql.DB)
 	var teacher models.Teacher
 	err = db.QueryRow(`
-		SELECT teacher_id, user_id, dept
-		FROM teacher 
-		WHERE teacher_id = ? AND archive_delete_flag = TRUE`, teacherID).
+		SELECT t.teacher_id, t.user_id, t.dept
+		FROM teacher t
+		JOIN user u ON t.user_id = u.user_id
+		WHERE t.teacher_id = ? AND u.org_id = ? AND t.archive_delete_flag = TRUE`, teacherID, orgID).
 		Scan(&teacher.TeacherID, &teacher.UserID, &teacher.Dept)
 	if err == sql.ErrNoRows {
 		log.Printf("Teacher not found for teacher_id %d", teacherID)
@@ -261,9 +263,10 @@ func GetTeacherDashboardHandler(c *gin.Context) {
 	}
 
 	rows, err := db.Query(`
-		SELECT course_id, title, description
-		FROM classroom 
-		WHERE teacher_id = ? AND archive_delete_flag = TRUE`, teacherID)
+		SELECT c.course_id, c.title, c.description
+		FROM classroom c
+		JOIN classroom_staff cs ON cs.course_id = c.course_id AND cs.status = 'active' AND cs.archive_delete_flag = TRUE
+		WHERE cs.teacher_id = ? AND c.archive_delete_flag = TRUE`, teacherID)
 	if err != nil {
 		log.Printf("Error querying classrooms: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -322,7 +325,8 @@ func GetTeacherUpcomingAssignmentsHandler(c *gin.Context) {
 		SELECT a.assignment_id, a.course_id, a.title, a.description, a.due_date, a.max_points
 		FROM assignment a
 		JOIN classroom c ON a.course_id = c.course_id
-		WHERE c.teacher_id = ? 
+		JOIN classroom_staff cs ON cs.course_id = c.course_id AND cs.status = 'active' AND cs.archive_delete_flag = TRUE
+		WHERE cs.teacher_id = ? 
 		AND a.due_date > ? 
 		AND a.archive_delete_flag = TRUE 
 		AND c.archive_delete_flag = TRUE
@@ -361,24 +365,25 @@ func GetTeacherUpcomingAssignmentsHandler(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"teacher_id":   teacherID,
-		"assignments":  assignments,
+		"teacher_id":  teacherID,
+		"assignments": assignments,
 	})
 }
 
-// ListTeachersHandler lists all teachers (for admin or authorized users)
+// ListTeachersHandler lists all teachers of the caller's organization (for organization admins)
 func ListTeachersHandler(c *gin.Context) {
-	role, _ := c.Get("role")
-	if role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can list all teachers"})
+	orgID, _ := c.Get("orgID")
+
+	db := c.MustGet("db").(*sql.DB)
+	if !authorizeOrgAdmin(c, db) {
 		return
 	}
 
-	db := c.MustGet("db").(*sql.DB)
 	rows, err := db.Query(`
-		SELECT teacher_id, user_id, dept
-		FROM teacher 
-		WHERE archive_delete_flag = TRUE`)
+		SELECT t.teacher_id, t.user_id, t.dept
+		FROM teacher t
+		JOIN user u ON t.user_id = u.user_id
+		WHERE u.org_id = ? AND t.archive_delete_flag = TRUE AND u.archive_delete_flag = TRUE`, orgID)
 	if err != nil {
 		log.Printf("Error querying teachers: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/auth"
+)
+
+// TwoFactorEnrollRequest is the request body for starting two-factor enrollment
+type TwoFactorEnrollRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// TwoFactorCodeRequest is the request body for actions confirmed with an authenticator or backup code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorReauthRequest is the request body for actions confirmed with both the password and a code
+type TwoFactorReauthRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// twoFactorRequired reports whether the user's organization requires them to keep two-factor authentication on
+func twoFactorRequired(db *sql.DB, userID interface{}) (bool, error) {
+	var required bool
+	err := db.QueryRow(`
+		SELECT u.role = 'teacher' AND o.require_teacher_2fa
+		FROM user u
+		JOIN organization o ON u.org_id = o.org_id
+		WHERE u.user_id = ?`, userID).Scan(&required)
+	return required, err
+}
+
+// verifySecondFactor checks a code for the caller in its own transaction. Wrong codes count as failed logins, so
+// a stolen session cannot be used to guess codes. It writes the error response itself.
+func verifySecondFactor(c *gin.Context, db *sql.DB, code string) bool {
+	userID, _ := c.Get("userID")
+
+	var email string
+	if err := db.QueryRow(`SELECT email FROM user WHERE user_id = ?`, userID).Scan(&email); err != nil {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	guard := c.MustGet("loginGuard").(*auth.LoginGuard)
+	now := time.Now()
+	if auth.Throttled(c, guard, email, now) {
+		return false
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return false
+	}
+	defer tx.Rollback()
+
+	ok, err := auth.VerifySecondFactor(tx, userID.(int), code)
+	if err == nil && ok {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error checking authentication code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if !ok {
+		// Release the user row first; the audit log entry for a lockout references it
+		tx.Rollback()
+		guard.Fail(db, email, c.ClientIP(), userID.(int), now)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return false
+	}
+	return true
+}
+
+// GetTwoFactorStatusHandler tells the caller whether two-factor authentication is on, whether their organization
+// requires it, and how many backup codes they have left
+func GetTwoFactorStatusHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	db := c.MustGet("db").(*sql.DB)
+	var enabledAt *time.Time
+	var remaining int
+	err := db.QueryRow(`
+		SELECT u.totp_enabled_at,
+		(SELECT COUNT(*) FROM backup_code b WHERE b.user_id = u.user_id AND b.used_at IS NULL)
+		FROM user u
+		WHERE u.user_id = ? AND u.archive_delete_flag = TRUE`, userID).Scan(&enabledAt, &remaining)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying two-factor status: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	required, err := twoFactorRequired(db, userID)
+	if err != nil {
+		log.Printf("Error querying organization policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                enabledAt != nil,
+		"enabled_at":             enabledAt,
+		"required":               required,
+		"backup_codes_remaining": remaining,
+	})
+}
+
+// EnrollTwoFactorHandler starts two-factor enrollment with a new secret. The otpauth URI is meant to be shown as a
+// QR code; nothing changes at login until the first code is confirmed.
+func EnrollTwoFactorHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req TwoFactorEnrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if !checkPassword(c, db, req.Password) {
+		return
+	}
+
+	var email string
+	var enabled bool
+	err := db.QueryRow(`
+		SELECT email, totp_enabled_at IS NOT NULL FROM user
+		WHERE user_id = ?`, userID).Scan(&email, &enabled)
+	if err != nil {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already on"})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating two-factor secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+	_, err = db.Exec(`
+		UPDATE user SET totp_secret = ?, totp_last_step = NULL
+		WHERE user_id = ? AND totp_enabled_at IS NULL`, secret, userID)
+	if err != nil {
+		log.Printf("Error saving two-factor secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": auth.TOTPProvisioningURI(email, secret),
+		"message":          "Scan the code with an authenticator app, then confirm with the code it shows",
+	})
+}
+
+// ConfirmTwoFactorHandler turns two-factor authentication on once the caller proves their app has the secret, and
+// returns their backup codes
+func ConfirmTwoFactorHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var secret sql.NullString
+	var enabled bool
+	err = tx.QueryRow(`
+		SELECT totp_secret, totp_enabled_at IS NOT NULL FROM user
+		WHERE user_id = ?
+		FOR UPDATE`, userID).Scan(&secret, &enabled)
+	if err != nil {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already on"})
+		return
+	}
+	if !secret.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start enrollment first"})
+		return
+	}
+	step, ok := auth.ValidateTOTP(secret.String, req.Code, 0, time.Now())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE user SET totp_enabled_at = NOW(), totp_last_step = ?
+		WHERE user_id = ?`, step, userID)
+	if err != nil {
+		log.Printf("Error enabling two-factor authentication: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to turn on two-factor authentication"})
+		return
+	}
+	codes, err := auth.IssueBackupCodes(tx, userID.(int))
+	if err != nil {
+		log.Printf("Error issuing backup codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to turn on two-factor authentication"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":      true,
+		"backup_codes": codes,
+		"message":      "Keep the backup codes somewhere safe; each one works once if you lose your authenticator",
+	})
+}
+
+// RegenerateBackupCodesHandler replaces the caller's backup codes, confirmed with their password and a current code
+func RegenerateBackupCodesHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req TwoFactorReauthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if !checkPassword(c, db, req.Password) || !verifySecondFactor(c, db, req.Code) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	codes, err := auth.IssueBackupCodes(tx, userID.(int))
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error issuing backup codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue backup codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"backup_codes": codes})
+}
+
+// disableTwoFactor turns two-factor authentication off for a user and forgets their secret and backup codes.
+// endSessions also signs the user out everywhere.
+func disableTwoFactor(db *sql.DB, userID interface{}, endSessions bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE user SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL
+		WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM backup_code WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if endSessions {
+		_, err = tx.Exec(`UPDATE user SET session_version = session_version + 1 WHERE user_id = ?`, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DisableTwoFactorHandler turns two-factor authentication off for the caller, unless their organization requires it
+func DisableTwoFactorHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req TwoFactorReauthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	required, err := twoFactorRequired(db, userID)
+	if err != nil {
+		log.Printf("Error querying organization policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if required {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your organization requires two-factor authentication"})
+		return
+	}
+	if !checkPassword(c, db, req.Password) || !verifySecondFactor(c, db, req.Code) {
+		return
+	}
+
+	if err := disableTwoFactor(db, userID, false); err != nil {
+		log.Printf("Error disabling two-factor authentication: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to turn off two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"enabled": false, "message": "Two-factor authentication turned off"})
+}
+
+// ResetMemberTwoFactorHandler turns off two-factor authentication for a member who lost both their authenticator and
+// their backup codes, so they can log in with their password and enroll again. Sessions already open on the account
+// are ended, in case whoever lost the authenticator is not the only one using it.
+func ResetMemberTwoFactorHandler(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	orgID, _ := c.Get("orgID")
+
+	memberID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	db := c.MustGet("db").(*sql.DB)
+	if !authorizeOrgAdmin(c, db) {
+		return
+	}
+
+	var email string
+	err = db.QueryRow(`
+		SELECT email FROM user
+		WHERE user_id = ? AND org_id = ? AND archive_delete_flag = TRUE`, memberID, orgID).Scan(&email)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error querying user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := disableTwoFactor(db, memberID, true); err != nil {
+		log.Printf("Error resetting two-factor authentication for user %d: %v", memberID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+	auth.LogTwoFactorReset(db, memberID, email, userID.(int))
+
+	c.JSON(http.StatusOK, gin.H{"user_id": memberID, "message": "Two-factor authentication reset"})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"edusync/config"
+	"edusync/mailer"
+	"edusync/utils"
+)
+
+// Purposes of the single-use tokens mailed to users
+const (
+	tokenInvitation        = "invitation"
+	tokenPasswordReset     = "password_reset"
+	tokenEmailVerification = "email_verification"
+	tokenEmailChange       = "email_change"
+)
+
+// How long each kind of token stays valid
+const (
+	invitationTTL        = 7 * 24 * time.Hour
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+)
+
+// issueUserToken stores a new token for the user and returns it. Unused tokens issued earlier for the same purpose
+// stop working, so only the latest link mailed out is valid.
+func issueUserToken(tx *sql.Tx, userID int64, purpose string, ttl time.Duration) (string, error) {
+	token, err := utils.GenerateToken(32)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`
+		UPDATE user_token SET used_at = NOW()
+		WHERE user_id = ? AND purpose = ? AND used_at IS NULL`, userID, purpose)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO user_token (user_id, purpose, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND), NOW())`,
+		userID, purpose, utils.HashToken(token), int64(ttl.Seconds()))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeUserToken marks a token used and returns the user it was issued to. Unknown, used and expired tokens, and
+// tokens issued for another purpose, give sql.ErrNoRows.
+func consumeUserToken(tx *sql.Tx, token, purpose string) (int64, error) {
+	var tokenID, userID int64
+	err := tx.QueryRow(`
+		SELECT token_id, user_id FROM user_token
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > NOW()
+		FOR UPDATE`, utils.HashToken(token), purpose).Scan(&tokenID, &userID)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE user_token SET used_at = NOW() WHERE token_id = ?`, tokenID); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// tokenLink is the address of an app page that takes a mailed token
+func tokenLink(path, token string) string {
+	return config.ConfigInstance.AppURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendMail hands a message to the request's mail sender
+func sendMail(c *gin.Context, msg mailer.Message) error {
+	return c.MustGet("mailer").(mailer.Sender).Send(msg)
+}
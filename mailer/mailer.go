@@ -0,0 +1,99 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"edusync/config"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers email. Handlers take the sender from the request context under "mailer", so it can be swapped
+// without touching them.
+type Sender interface {
+	Send(msg Message) error
+}
+
+// New returns an SMTP sender when the configuration names a server, and a LogSender otherwise
+func New(cfg *config.Config) Sender {
+	if cfg.SMTPHost == "" {
+		return LogSender{}
+	}
+	return &SMTPSender{
+		Addr:     cfg.SMTPHost + ":" + cfg.SMTPPort,
+		Host:     cfg.SMTPHost,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.MailFrom,
+	}
+}
+
+// LogSender writes messages to the log instead of sending them, for development without a mail server
+type LogSender struct{}
+
+// Send logs the message
+func (LogSender) Send(msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// Recorder keeps messages instead of sending them, so tests can inspect what would have been mailed
+type Recorder struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Send records the message
+func (r *Recorder) Send(msg Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+// Messages returns the messages recorded so far, oldest first
+func (r *Recorder) Messages() []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Message(nil), r.messages...)
+}
+
+// SMTPSender sends mail through an SMTP server, authenticating when a username is set
+type SMTPSender struct {
+	Addr     string // host:port
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers the message
+func (s *SMTPSender) Send(msg Message) error {
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return fmt.Errorf("mail header contains a line break")
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	body := "From: " + s.From + "\r\n" +
+		"To: " + msg.To + "\r\n" +
+		"Subject: " + msg.Subject + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		strings.ReplaceAll(msg.Body, "\n", "\r\n")
+	return smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, []byte(body))
+}
@@ -8,10 +8,16 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
+	"edusync/auth"
 	"edusync/config"
 	"edusync/db"
+	"edusync/grader"
+	"edusync/mailer"
 	"edusync/middleware"
 	"edusync/routes"
+	"edusync/scheduler"
+	"edusync/similarity"
+	"edusync/storage"
 )
 
 func main() {
@@ -26,14 +32,38 @@ func main() {
 	}
 	defer db.CloseConnection()
 
+	// Similarity reports left running by a previous process are started over by the scheduler
+	if err := similarity.RequeueInterrupted(db.DB); err != nil {
+		log.Printf("Failed to requeue interrupted similarity reports: %v", err)
+	}
+
+	// Publish scheduled announcements and assignments in the background
+	scheduler.Start(db.DB, cfg.SchedulerInterval)
+
+	// Run queued code submissions against their tests, one at a time
+	grader.Start(db.DB, cfg.GraderInterval)
+
+	// Invitations and account emails go through SMTP when configured, and to the log otherwise
+	mail := mailer.New(cfg)
+
+	// Uploaded profile pictures are kept in the upload directory and served from /uploads
+	store := storage.New(cfg)
+
+	// Failed logins are counted in the database unless LOGIN_ATTEMPT_STORE=memory
+	guard := auth.NewLoginGuard(cfg, db.DB)
+
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
+	// Lockouts key on ClientIP, so forwarded addresses are only believed from known proxies
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "X-Next-Cursor"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -42,10 +72,14 @@ func main() {
 
 	router.Use(func(c *gin.Context) {
 		c.Set("db", db.DB)
+		c.Set("mailer", mail)
+		c.Set("storage", store)
+		c.Set("loginGuard", guard)
 		c.Next()
 	})
 
 	routes.SetupRoutes(router)
+	router.Static("/uploads", cfg.UploadDir)
 
 	port := cfg.Port
 	fmt.Printf("Server running on port %s\n", port)
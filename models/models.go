@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // LoginRequest for authentication
 type LoginRequest struct {
@@ -8,6 +11,12 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// TwoFactorLoginRequest completes a login for users with two-factor authentication
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"` // Authenticator code or backup code
+}
+
 // RegisterRequest for user registration
 type RegisterRequest struct {
 	Name           string  `json:"name" binding:"required"`
@@ -16,7 +25,7 @@ type RegisterRequest struct {
 	Role           string  `json:"role" binding:"required,oneof=teacher student"`
 	ContactNumber  *string `json:"contact_number"`
 	ProfilePicture *string `json:"profile_picture"`
-	Org            *string `json:"org"`
+	Org            *string `json:"org"`            // Organization slug; found from the email domain when omitted
 	Dept           *string `json:"dept"`           // For teacher
 	GradeLevel     *string `json:"grade_level"`    // For student
 	EnrollmentYear *int    `json:"enrollment_year"` // For student
@@ -24,15 +33,20 @@ type RegisterRequest struct {
 
 // User model
 type User struct {
-	UserID         int       `json:"user_id"`
-	Name           string    `json:"name"`
-	Email          string    `json:"email"`
-	Password       string    `json:"password"`
-	CreatedAt      time.Time `json:"created_at"`
-	ContactNumber  *string   `json:"contact_number"`
-	ProfilePicture *string   `json:"profile_picture"`
-	Role           string    `json:"role"`
-	Org            *string   `json:"org"`
+	UserID            int               `json:"user_id"`
+	Name              string            `json:"name"`
+	Email             string            `json:"email"`
+	EmailVerified     bool              `json:"email_verified"`
+	PendingEmail      *string           `json:"pending_email,omitempty"` // New address awaiting confirmation
+	Password          string            `json:"password"`
+	CreatedAt         time.Time         `json:"created_at"`
+	ContactNumber     *string           `json:"contact_number"`
+	ProfilePicture    *string           `json:"profile_picture"`
+	ProfileThumbnails map[string]string `json:"profile_thumbnails,omitempty"` // Thumbnail URLs by size in pixels
+	Role              string            `json:"role"`
+	OrgID             int               `json:"org_id"`
+	Org               string            `json:"org"` // Organization name
+	IsOrgAdmin        bool              `json:"is_org_admin"`
 }
 
 // Teacher model
@@ -52,13 +66,35 @@ type Student struct {
 
 // Classroom model
 type Classroom struct {
-	CourseID     int       `json:"course_id"`
-	TeacherID    int       `json:"teacher_id"`
-	Title        string    `json:"title"`
-	Description  *string   `json:"description"`
-	StartDate    *time.Time `json:"start_date"`
-	EndDate      *time.Time `json:"end_date"`
-	SubjectArea  *string   `json:"subject_area"`
+	CourseID    int        `json:"course_id"`
+	TeacherID   int        `json:"teacher_id"`
+	Title       string     `json:"title"`
+	Description *string    `json:"description"`
+	StartDate   *time.Time `json:"start_date"`
+	EndDate     *time.Time `json:"end_date"`
+	SubjectArea *string    `json:"subject_area"`
+	IsArchived  bool       `json:"is_archived"`
+	ArchivedAt  *time.Time `json:"archived_at"`
+	IsListed    bool       `json:"is_listed"` // Shown in the public catalog
+	Capacity    *int       `json:"capacity"`  // Most active enrollments allowed; null for no limit
+	StaffRole   string     `json:"staff_role,omitempty"`
+}
+
+// ClassroomStaff model
+type ClassroomStaff struct {
+	StaffID           int       `json:"staff_id"`
+	CourseID          int       `json:"course_id"`
+	TeacherID         int       `json:"teacher_id"`
+	Name              string    `json:"name"`
+	Email             string    `json:"email"`
+	Role              string    `json:"role"`
+	Status            string    `json:"status"`
+	CanEditClassroom  bool      `json:"can_edit_classroom"`
+	CanEditContent    bool      `json:"can_edit_content"`
+	CanGrade          bool      `json:"can_grade"`
+	CanManageStudents bool      `json:"can_manage_students"`
+	CanManageStaff    bool      `json:"can_manage_staff"`
+	CreatedAt         time.Time `json:"created_at"`
 }
 
 // Enrollment model
@@ -89,33 +125,361 @@ type Material struct {
 
 // Announcement model
 type Announcement struct {
-	AnnouncementID int       `json:"announcement_id"`
-	CourseID       int       `json:"course_id"`
-	Title          string    `json:"title"`
-	Content        *string   `json:"content"`
-	CreatedAt      time.Time `json:"created_at"`
-	IsPinned       bool      `json:"is_pinned"`
+	AnnouncementID int        `json:"announcement_id"`
+	CourseID       int        `json:"course_id"`
+	Title          string     `json:"title"`
+	Content        *string    `json:"content"`
+	CreatedAt      time.Time  `json:"created_at"`
+	IsPinned       bool       `json:"is_pinned"`
+	Status         string     `json:"status"`
+	PublishAt      *time.Time `json:"publish_at"`
+	SourceID       *int       `json:"source_announcement_id"`
 }
 
 // Assignment model
 type Assignment struct {
-	AssignmentID int       `json:"assignment_id"`
-	CourseID     int       `json:"course_id"`
-	Title        string    `json:"title"`
-	Description  *string   `json:"description"`
-	DueDate      time.Time `json:"due_date"`
-	MaxPoints    int       `json:"max_points"`
-	CreatedAt    time.Time `json:"created_at"`
+	AssignmentID int        `json:"assignment_id"`
+	CourseID     int        `json:"course_id"`
+	Title        string     `json:"title"`
+	Description  *string    `json:"description"`
+	DueDate      time.Time  `json:"due_date"`
+	MaxPoints    int        `json:"max_points"`
+	CreatedAt    time.Time  `json:"created_at"`
+	Status       string     `json:"status"`
+	PublishAt    *time.Time `json:"publish_at"`
+	SourceID     *int       `json:"source_assignment_id"`
+	IsGroup      bool       `json:"is_group_assignment"`
+	IsQuiz       bool       `json:"is_quiz"`
 }
 
 // Submission model
 type Submission struct {
+	SubmissionID int                `json:"submission_id"`
+	AssignmentID int                `json:"assignment_id"`
+	StudentID    int                `json:"student_id"`
+	Content      *string            `json:"content"`
+	SubmittedAt  time.Time          `json:"submitted_at"`
+	Score        *int               `json:"score"`
+	Feedback     *string            `json:"feedback"`
+	Status       string             `json:"status"`
+	GroupID      *int               `json:"group_id"`
+	SourceCode   *string            `json:"source_code,omitempty"`
+	Similarity   *SimilaritySummary `json:"similarity,omitempty"`
+}
+
+// StudentGroup model
+type StudentGroup struct {
+	GroupID   int           `json:"group_id"`
+	CourseID  int           `json:"course_id"`
+	Name      string        `json:"name"`
+	CreatedAt time.Time     `json:"created_at"`
+	Members   []GroupMember `json:"members"`
+}
+
+// GroupMember model
+type GroupMember struct {
+	StudentID int    `json:"student_id"`
+	Name      string `json:"name"`
+}
+
+// SubmissionComment model
+type SubmissionComment struct {
+	CommentID    int       `json:"comment_id"`
 	SubmissionID int       `json:"submission_id"`
-	AssignmentID int       `json:"assignment_id"`
-	StudentID    int       `json:"student_id"`
-	Content      *string   `json:"content"`
-	SubmittedAt  time.Time `json:"submitted_at"`
-	Score        *int      `json:"score"`
-	Feedback     *string   `json:"feedback"`
-	Status       string    `json:"status"`
+	UserID       int       `json:"user_id"`
+	AuthorName   string    `json:"author_name"`
+	AuthorRole   string    `json:"author_role"`
+	Content      string    `json:"content"`
+	AnchorType   *string   `json:"anchor_type"`
+	AnchorStart  *int      `json:"anchor_start"`
+	AnchorEnd    *int      `json:"anchor_end"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// QuestionBank model
+type QuestionBank struct {
+	BankID        int       `json:"bank_id"`
+	CourseID      int       `json:"course_id"`
+	Title         string    `json:"title"`
+	CreatedAt     time.Time `json:"created_at"`
+	QuestionCount int       `json:"question_count"`
+}
+
+// QuizQuestion model
+type QuizQuestion struct {
+	QuestionID    int             `json:"question_id"`
+	BankID        int             `json:"bank_id"`
+	Type          string          `json:"question_type"`
+	Prompt        string          `json:"prompt"`
+	Options       []string        `json:"options,omitempty"`
+	CorrectAnswer json.RawMessage `json:"correct_answer,omitempty"`
+	Tolerance     float64         `json:"tolerance"`
+	Points        float64         `json:"points"`
+}
+
+// Quiz model
+type Quiz struct {
+	AssignmentID     int  `json:"assignment_id"`
+	BankID           int  `json:"bank_id"`
+	QuestionCount    *int `json:"question_count"`
+	TimeLimitMinutes *int `json:"time_limit_minutes"`
+	MaxAttempts      int  `json:"max_attempts"`
+	ShuffleQuestions bool `json:"shuffle_questions"`
+	ShuffleOptions   bool `json:"shuffle_options"`
+}
+
+// QuizAttempt model
+type QuizAttempt struct {
+	AttemptID      int        `json:"attempt_id"`
+	AssignmentID   int        `json:"assignment_id"`
+	StudentID      int        `json:"student_id"`
+	SubmissionID   *int       `json:"submission_id"`
+	AttemptNumber  int        `json:"attempt_number"`
+	Status         string     `json:"status"`
+	StartedAt      time.Time  `json:"started_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	SubmittedAt    *time.Time `json:"submitted_at"`
+	PointsEarned   *float64   `json:"points_earned"`
+	PointsPossible float64    `json:"points_possible"`
+}
+
+// CodeAssignment model
+type CodeAssignment struct {
+	AssignmentID  int            `json:"assignment_id"`
+	Language      string         `json:"language"`
+	TimeLimitMS   int            `json:"time_limit_ms"`
+	MemoryLimitMB int            `json:"memory_limit_mb"`
+	TestCases     []CodeTestCase `json:"test_cases"`
+}
+
+// CodeTestCase model
+type CodeTestCase struct {
+	TestID         int     `json:"test_id"`
+	Name           string  `json:"name"`
+	Input          *string `json:"input,omitempty"`
+	ExpectedOutput *string `json:"expected_output,omitempty"`
+	Points         float64 `json:"points"`
+	IsHidden       bool    `json:"is_hidden"`
+}
+
+// SimilaritySummary is a submission's result in the latest similarity report for its assignment
+type SimilaritySummary struct {
+	ReportID      int     `json:"report_id"`
+	MaxSimilarity float64 `json:"max_similarity"`
+	MatchCount    int     `json:"match_count"`
+}
+
+// SimilarityReport model
+type SimilarityReport struct {
+	ReportID        int        `json:"report_id"`
+	AssignmentID    int        `json:"assignment_id"`
+	Threshold       float64    `json:"threshold"`
+	Status          string     `json:"status"`
+	SubmissionCount int        `json:"submission_count"`
+	PairsTotal      int        `json:"pairs_total"`
+	PairsDone       int        `json:"pairs_done"`
+	Error           *string    `json:"error"`
+	CreatedAt       time.Time  `json:"created_at"`
+	FinishedAt      *time.Time `json:"finished_at"`
+}
+
+// RubricCriterion is one scored line of a peer review rubric
+type RubricCriterion struct {
+	Criterion   string  `json:"criterion"`
+	Description string  `json:"description,omitempty"`
+	MaxPoints   float64 `json:"max_points"`
+}
+
+// PeerReviewSettings model
+type PeerReviewSettings struct {
+	AssignmentID         int               `json:"assignment_id"`
+	ReviewsPerSubmission int               `json:"reviews_per_submission"`
+	ReviewDueDate        time.Time         `json:"review_due_date"`
+	Rubric               []RubricCriterion `json:"rubric"`
+	GradeWeight          float64           `json:"grade_weight"`
+	AssignedAt           *time.Time        `json:"assigned_at"`
+}
+
+// PeerReview model
+type PeerReview struct {
+	ReviewID     int        `json:"review_id"`
+	SubmissionID int        `json:"submission_id"`
+	ReviewerID   *int       `json:"reviewer_id,omitempty"`   // Hidden from the reviewed student
+	ReviewerName *string    `json:"reviewer_name,omitempty"` // Hidden from the reviewed student
+	Status       string     `json:"status"`
+	Scores       []float64  `json:"scores"`
+	Comments     *string    `json:"comments"`
+	Score        *float64   `json:"score"` // Share of the rubric points awarded, from 0 to 1
+	AssignedAt   time.Time  `json:"assigned_at"`
+	SubmittedAt  *time.Time `json:"submitted_at"`
+}
+
+// ClassSession model
+type ClassSession struct {
+	SessionID        int        `json:"session_id"`
+	CourseID         int        `json:"course_id"`
+	SessionDate      time.Time  `json:"session_date"`
+	Topic            *string    `json:"topic"`
+	CheckInExpiresAt *time.Time `json:"check_in_expires_at,omitempty"` // Only shown to staff
+	CreatedAt        time.Time  `json:"created_at"`
+	Attendance       *string    `json:"attendance,omitempty"` // The calling student's status
+}
+
+// AttendanceRecord model
+type AttendanceRecord struct {
+	SessionID   int        `json:"session_id"`
+	StudentID   int        `json:"student_id"`
+	Name        string     `json:"name,omitempty"`
+	Status      *string    `json:"status"` // Null when the student has not been marked yet
+	Note        *string    `json:"note"`
+	CheckedInAt *time.Time `json:"checked_in_at"`
+}
+
+// AttendanceSummary counts a student's attendance over the past sessions of a classroom
+type AttendanceSummary struct {
+	Sessions       int      `json:"sessions"`
+	Present        int      `json:"present"`
+	Late           int      `json:"late"`
+	Absent         int      `json:"absent"`
+	Excused        int      `json:"excused"`
+	Unmarked       int      `json:"unmarked"`
+	AttendanceRate *float64 `json:"attendance_rate"` // Share of marked, unexcused sessions attended, late included
+}
+
+// CalendarEvent is a dated item from one of the user's classrooms
+type CalendarEvent struct {
+	UID         string     `json:"uid"`  // Stable identifier, also used in the iCalendar feed
+	Type        string     `json:"type"` // assignment_due, peer_review_due, class_session, classroom_start or classroom_end
+	Title       string     `json:"title"`
+	CourseID    int        `json:"course_id"`
+	CourseTitle string     `json:"course_title"`
+	SourceID    int        `json:"source_id"` // ID of the assignment, session or classroom the event comes from
+	Start       time.Time  `json:"start"`
+	End         *time.Time `json:"end,omitempty"`
+	AllDay      bool       `json:"all_day"`
+}
+
+// Module is an ordered unit of a classroom's materials and assignments
+type Module struct {
+	ModuleID        int          `json:"module_id"`
+	CourseID        int          `json:"course_id"`
+	Title           string       `json:"title"`
+	Description     *string      `json:"description"`
+	Position        int          `json:"position"`
+	UnlockAt        *time.Time   `json:"unlock_at"`
+	LockAt          *time.Time   `json:"lock_at"`
+	PrerequisiteIDs []int        `json:"prerequisite_ids"`
+	Items           []ModuleItem `json:"items"`
+	CreatedAt       time.Time    `json:"created_at"`
+	Status          string       `json:"status,omitempty"`        // Student view only: locked, available or completed
+	LockedReason    string       `json:"locked_reason,omitempty"` // Why a locked module is locked
+}
+
+// ModuleItem is a material or assignment placed in a module
+type ModuleItem struct {
+	ItemType  string     `json:"type"` // material or assignment
+	ContentID int        `json:"id"`
+	Title     string     `json:"title"`
+	Position  int        `json:"position"`
+	DueDate   *time.Time `json:"due_date,omitempty"`  // Assignments only
+	Completed *bool      `json:"completed,omitempty"` // Student view only
+}
+
+// MaterialViewRecord is one enrolled student's activity on a material
+type MaterialViewRecord struct {
+	StudentID        int        `json:"student_id"`
+	Name             string     `json:"name"`
+	Viewed           bool       `json:"viewed"`
+	ViewCount        int        `json:"view_count"`
+	DownloadCount    int        `json:"download_count"`
+	FirstViewedAt    *time.Time `json:"first_viewed_at"`
+	LastViewedAt     *time.Time `json:"last_viewed_at"`
+	LastDownloadedAt *time.Time `json:"last_downloaded_at"`
+	CompletedAt      *time.Time `json:"completed_at"` // When the student marked the material as done
+}
+
+// MaterialProgress is a student's activity on one material of a classroom
+type MaterialProgress struct {
+	MaterialID   int        `json:"material_id"`
+	Title        string     `json:"title"`
+	Viewed       bool       `json:"viewed"` // Opened or downloaded at least once
+	LastViewedAt *time.Time `json:"last_viewed_at"`
+	Downloaded   bool       `json:"downloaded"`
+	Completed    bool       `json:"completed"`
+}
+
+// ClassroomProgress summarizes how far a student has worked through a classroom
+type ClassroomProgress struct {
+	CourseID             int                `json:"course_id"`
+	MaterialsTotal       int                `json:"materials_total"`
+	MaterialsViewed      int                `json:"materials_viewed"`
+	MaterialsCompleted   int                `json:"materials_completed"`
+	AssignmentsTotal     int                `json:"assignments_total"` // Published assignments only
+	AssignmentsSubmitted int                `json:"assignments_submitted"`
+	ModulesTotal         int                `json:"modules_total"`
+	ModulesCompleted     int                `json:"modules_completed"`
+	Materials            []MaterialProgress `json:"materials"`
+}
+
+// SearchResult is an announcement, material or assignment matching a search
+type SearchResult struct {
+	Type        string     `json:"type"` // announcement, material or assignment
+	ID          int        `json:"id"`
+	CourseID    int        `json:"course_id"`
+	CourseTitle string     `json:"course_title"`
+	Title       string     `json:"title"`
+	Highlight   string     `json:"highlight"` // HTML-escaped title with matches wrapped in <mark>
+	Snippet     string     `json:"snippet"`   // HTML-escaped excerpt of the body with matches wrapped in <mark>
+	Score       float64    `json:"score"`
+	CreatedAt   *time.Time `json:"created_at"`
+	DueDate     *time.Time `json:"due_date,omitempty"` // Assignments only
+}
+
+// CatalogEntry is a listed classroom as shown in the catalog
+type CatalogEntry struct {
+	CourseID    int        `json:"course_id"`
+	Title       string     `json:"title"`
+	Description *string    `json:"description"`
+	SubjectArea *string    `json:"subject_area"`
+	StartDate   *time.Time `json:"start_date"`
+	EndDate     *time.Time `json:"end_date"`
+	TeacherName string     `json:"teacher_name"`
+	Enrolled    int        `json:"enrolled"`
+	Capacity    *int       `json:"capacity"`
+	IsFull      bool       `json:"is_full"`
+	IsEnrolled  bool       `json:"is_enrolled"` // Whether the caller is already enrolled
+}
+
+// Organization is a school the service is run for. Its users and classrooms never see another organization's data.
+type Organization struct {
+	OrgID               int       `json:"org_id"`
+	Name                string    `json:"name"`
+	Slug                string    `json:"slug"`
+	LogoURL             *string   `json:"logo_url"`
+	PrimaryColor        *string   `json:"primary_color"`
+	AllowedEmailDomains []string  `json:"allowed_email_domains"` // Anyone may register when empty
+	RequireTeacher2FA   bool      `json:"require_teacher_2fa"`   // Teachers must turn on two-factor authentication
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// OrgMember is a user as listed to organization admins
+type OrgMember struct {
+	UserID     int       `json:"user_id"`
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+	Role       string    `json:"role"`
+	IsOrgAdmin bool      `json:"is_org_admin"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// RosterResult is the outcome of importing one line of a roster, or what it would be in a dry run
+type RosterResult struct {
+	Line     int    `json:"line"`
+	Email    string `json:"email"`
+	Status   string `json:"status"` // created, existing or error
+	UserID   *int64 `json:"user_id,omitempty"`
+	Enrolled []int  `json:"enrolled"` // Classrooms the user was newly enrolled in
+	Invited  bool   `json:"invited"`  // Whether an invitation to set a password was mailed
+	Error    string `json:"error,omitempty"`
+	Warning  string `json:"warning,omitempty"`
 }
\ No newline at end of file
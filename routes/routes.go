@@ -19,6 +19,15 @@ func SetupRoutes(r *gin.Engine) {
 	// Public routes
 	r.POST("/api/register", handlers.RegisterHandler)
 	r.POST("/api/login", auth.LoginHandler)
+	r.POST("/api/login/2fa", auth.LoginTwoFactorHandler)                    // Exchange the challenge token and an authenticator code for a session
+	r.GET("/api/calendar/feed/:token", handlers.CalendarFeedHandler)        // iCalendar feed, authenticated by the secret token in the URL
+	r.GET("/api/orgs/:slug", handlers.GetOrganizationBrandingHandler)       // Name and branding for an organization's login page
+	r.POST("/api/invitations/accept", handlers.AcceptInvitationHandler)     // Set the password of an account created from a roster
+	r.POST("/api/password/forgot", handlers.ForgotPasswordHandler)          // Mail a password reset link
+	r.POST("/api/password/reset", handlers.ResetPasswordHandler)            // Set a new password with the mailed token
+	r.POST("/api/email/verify", handlers.VerifyEmailHandler)                // Confirm an email address with the mailed token
+	r.POST("/api/email/verify/resend", handlers.ResendVerificationHandler)  // Mail a new verification link
+	r.POST("/api/email/change/confirm", handlers.ConfirmEmailChangeHandler) // Move an account to its new address with the mailed token
 
 	// Protected routes (require authentication)
 	protected := r.Group("/api")
@@ -26,14 +35,67 @@ func SetupRoutes(r *gin.Engine) {
 
 	// General user routes
 	protected.GET("/profile", handlers.GetProfileHandler)
+	protected.PUT("/profile", handlers.UpdateProfileHandler)                 // JSON merge patch of the GET /profile document
+	protected.POST("/profile/picture", handlers.UploadProfilePictureHandler) // Multipart "file", stored with thumbnails
+	protected.DELETE("/profile/picture", handlers.DeleteProfilePictureHandler)
 	protected.GET("/auth/check", handlers.CheckAuthHandler)
 	protected.GET("/stats", handlers.GetUserStatsHandler)
+	protected.GET("/calendar", handlers.GetCalendarHandler)              // Teacher/Student: Events across all classrooms
+	protected.POST("/calendar/feed", handlers.CreateCalendarFeedHandler) // Issue a new feed URL, revoking the old one
+	protected.DELETE("/calendar/feed", handlers.DeleteCalendarFeedHandler)
+	protected.GET("/search", handlers.SearchHandler)      // Teacher/Student: Search announcements, materials and assignments
+	protected.GET("/catalog", handlers.GetCatalogHandler) // Browse listed classrooms open for enrollment
 
+	// Account routes
+	protected.PUT("/account/password", handlers.ChangePasswordHandler) // Change password and sign out other sessions
+	protected.PUT("/account/email", handlers.ChangeEmailHandler)       // Mail a confirmation link to a new address
+	protected.DELETE("/account", handlers.DeleteAccountHandler)        // Erase personal details and sign out everywhere
+	protected.GET("/account/2fa", handlers.GetTwoFactorStatusHandler)
+	protected.POST("/account/2fa/enroll", handlers.EnrollTwoFactorHandler)             // New secret and otpauth:// URI for a QR code
+	protected.POST("/account/2fa/confirm", handlers.ConfirmTwoFactorHandler)           // Turn on with a first code; returns backup codes
+	protected.POST("/account/2fa/backup-codes", handlers.RegenerateBackupCodesHandler) // Replace the backup codes
+	protected.DELETE("/account/2fa", handlers.DisableTwoFactorHandler)
+
+	// Organization routes
+	protected.GET("/org", handlers.GetOrganizationHandler)                              // The caller's organization and its settings
+	protected.PUT("/org", handlers.UpdateOrganizationHandler)                           // Org admin: Name, branding and allowed email domains
+	protected.GET("/org/members", handlers.GetOrganizationMembersHandler)               // Org admin: Users of the organization
+	protected.PUT("/org/members/:id", handlers.UpdateOrganizationMemberHandler)         // Org admin: Grant or revoke the admin role
+	protected.POST("/org/members/:id/unlock", handlers.UnlockOrganizationMemberHandler) // Org admin: Lift a login lockout
+	protected.DELETE("/org/members/:id/2fa", handlers.ResetMemberTwoFactorHandler)      // Org admin: Turn off a member's two-factor authentication
+	protected.POST("/users/import", handlers.ImportRosterHandler)                       // Org admin/Teacher: Create and enroll accounts from a CSV roster
 
 	// Teacher-specific routes
 	protected.POST("/classrooms", handlers.CreateClassroomHandler)
 	protected.PUT("/classrooms/:id", handlers.UpdateClassroomHandler)
 	protected.DELETE("/classrooms/:id", handlers.DeleteClassroomHandler)
+	protected.POST("/classrooms/:id/clone", handlers.CloneClassroomHandler)
+	protected.POST("/classrooms/:id/archive", handlers.ArchiveClassroomHandler)
+	protected.POST("/classrooms/:id/restore", handlers.RestoreClassroomHandler)
+	protected.GET("/classrooms/:id/staff", handlers.GetClassroomStaffHandler)
+	protected.POST("/classrooms/:id/staff", handlers.InviteClassroomStaffHandler)
+	protected.POST("/classrooms/:id/staff/accept", handlers.AcceptStaffInvitationHandler)
+	protected.PUT("/classrooms/:id/staff/:teacher_id", handlers.UpdateClassroomStaffHandler)
+	protected.DELETE("/classrooms/:id/staff/:teacher_id", handlers.RemoveClassroomStaffHandler)
+	protected.POST("/classrooms/:id/groups", handlers.CreateGroupHandler)
+	protected.POST("/classrooms/:id/groups/random", handlers.CreateRandomGroupsHandler)
+	protected.GET("/classrooms/:id/groups", handlers.GetGroupsHandler)
+	protected.PUT("/groups/:id", handlers.UpdateGroupHandler)
+	protected.DELETE("/groups/:id", handlers.DeleteGroupHandler)
+	protected.POST("/classrooms/:id/sessions", handlers.CreateClassSessionHandler)
+	protected.GET("/classrooms/:id/sessions", handlers.GetClassSessionsHandler) // Teacher: Attendance counts; Student: Own attendance
+	protected.PUT("/sessions/:id", handlers.UpdateClassSessionHandler)
+	protected.DELETE("/sessions/:id", handlers.DeleteClassSessionHandler)
+	protected.GET("/sessions/:id/attendance", handlers.GetSessionAttendanceHandler)
+	protected.PUT("/sessions/:id/attendance", handlers.MarkAttendanceHandler)
+	protected.POST("/sessions/:id/check-in-code", handlers.OpenCheckInHandler)
+	protected.DELETE("/sessions/:id/check-in-code", handlers.CloseCheckInHandler)
+	protected.POST("/classrooms/:id/modules", handlers.CreateModuleHandler)
+	protected.GET("/classrooms/:id/modules", handlers.GetModulesHandler) // Teacher/Student: Modules with their items; students also get their progress
+	protected.PUT("/classrooms/:id/modules/order", handlers.ReorderModulesHandler)
+	protected.PUT("/modules/:id", handlers.UpdateModuleHandler)
+	protected.DELETE("/modules/:id", handlers.DeleteModuleHandler)
+	protected.PUT("/modules/:id/items", handlers.SetModuleItemsHandler)
 	protected.GET("/teacher/classrooms", handlers.GetTeacherClassroomsHandler)
 	protected.GET("/classrooms/:id", handlers.GetClassroomDetailsHandler)
 	protected.POST("/announcements", handlers.CreateAnnouncementHandler)
@@ -44,10 +106,27 @@ func SetupRoutes(r *gin.Engine) {
 	protected.PUT("/assignments/:id", handlers.UpdateAssignmentHandler)
 	protected.DELETE("/assignments/:id", handlers.DeleteAssignmentHandler)
 	protected.GET("/classrooms/:id/assignments", handlers.GetAssignmentsByClassroomHandler)
+	protected.POST("/classrooms/:id/question-banks", handlers.CreateQuestionBankHandler)
+	protected.GET("/classrooms/:id/question-banks", handlers.GetQuestionBanksHandler)
+	protected.DELETE("/question-banks/:id", handlers.DeleteQuestionBankHandler)
+	protected.POST("/question-banks/:id/questions", handlers.CreateQuizQuestionHandler)
+	protected.GET("/question-banks/:id/questions", handlers.GetQuizQuestionsHandler)
+	protected.PUT("/quiz-questions/:id", handlers.UpdateQuizQuestionHandler)
+	protected.DELETE("/quiz-questions/:id", handlers.DeleteQuizQuestionHandler)
+	protected.PUT("/assignments/:id/code", handlers.SetCodeAssignmentHandler)
+	protected.GET("/assignments/:assignment_id/code", handlers.GetCodeAssignmentHandler) // Teacher/Student: Language, limits and test cases
+	protected.PUT("/assignments/:id/quiz", handlers.SetQuizHandler)
+	protected.GET("/assignments/:assignment_id/quiz", handlers.GetQuizHandler) // Teacher/Student: Quiz settings, and the student's attempts
+	protected.PUT("/assignments/:id/peer-review", handlers.SetPeerReviewHandler)
+	protected.GET("/assignments/:assignment_id/peer-review", handlers.GetAssignmentPeerReviewsHandler) // Teacher: Peer scores per submission; Student: Reviews assigned to them
 	protected.POST("/materials", handlers.CreateMaterialHandler)
 	protected.PUT("/materials/:id", handlers.UpdateMaterialHandler)
 	protected.DELETE("/materials/:id", handlers.DeleteMaterialHandler)
 	protected.GET("/classrooms/:id/materials", handlers.GetMaterialsByClassroomHandler)
+	protected.GET("/materials/:id", handlers.GetMaterialHandler)                    // Teacher/Student: A student opening a material counts as a view
+	protected.GET("/materials/:id/download", handlers.DownloadMaterialHandler)      // Teacher/Student: Redirect to the file, counting student downloads
+	protected.GET("/materials/:id/views", handlers.GetMaterialViewsHandler)         // Teacher: Who has and hasn't viewed a material
+	protected.GET("/classrooms/:id/progress", handlers.GetClassroomProgressHandler) // Student: Own progress through a classroom
 	protected.PUT("/teacher/profile", handlers.UpdateTeacherHandler)
 	protected.GET("/teacher/profile", handlers.GetTeacherProfileHandler)
 	protected.GET("/teacher/dashboard", handlers.GetTeacherDashboardHandler)
@@ -56,16 +135,33 @@ func SetupRoutes(r *gin.Engine) {
 	protected.GET("/classrooms/:id/students/:student_id", handlers.GetStudentProfileHandler)
 	protected.GET("/teacher/assignments/upcoming", handlers.GetUpcomingAssignmentsHandler)
 	protected.GET("/assignments/:assignment_id/statistics", handlers.GetAssignmentStatisticsHandler)
+	protected.POST("/assignments/:assignment_id/similarity-reports", handlers.CreateSimilarityReportHandler) // Teacher: Start a plagiarism check
+	protected.GET("/assignments/:assignment_id/similarity-reports", handlers.GetSimilarityReportsHandler)
+	protected.GET("/similarity-reports/:id", handlers.GetSimilarityReportHandler) // Teacher: Progress and flagged pairs
 
 	// Submission routes (shared by teachers and students)
 	protected.POST("/submissions/:id/grade", handlers.GradeSubmissionHandler)                            // Teacher: Grade a submission
+	protected.POST("/submissions/:id/regrade", handlers.RegradeSubmissionHandler)                        // Teacher: Re-run a code submission against its tests
+	protected.GET("/submissions/:id/test-results", handlers.GetSubmissionTestResultsHandler)             // Teacher/Student: Latest code runner results
 	protected.GET("/assignments/:assignment_id/submissions", handlers.GetSubmissionsByAssignmentHandler) // Teacher/Student: View submissions for an assignment
 	protected.GET("/submissions/:id", handlers.GetSubmissionHandler)                                     // Student: View a specific submission (handler needs implementation)
+	protected.POST("/submissions/:id/comments", handlers.CreateSubmissionCommentHandler)                 // Teacher/Student: Comment on a submission
+	protected.GET("/submissions/:id/comments", handlers.GetSubmissionCommentsHandler)                    // Teacher/Student: View the comment thread
+	protected.GET("/submissions/:id/peer-reviews", handlers.GetSubmissionPeerReviewsHandler)             // Teacher/Student: Peer reviews of a submission
+	protected.DELETE("/submissions/:id/comments/:comment_id", handlers.DeleteSubmissionCommentHandler)   // Teacher/Student: Delete own comment
 
 	// Student-specific routes
 	protected.POST("/submissions", handlers.CreateSubmissionHandler)
 	protected.PUT("/submissions/:id", handlers.UpdateSubmissionHandler)
+	protected.POST("/assignments/:assignment_id/quiz/attempts", handlers.StartQuizAttemptHandler) // Student: Start or resume a quiz attempt
+	protected.GET("/quiz-attempts/:id", handlers.GetQuizAttemptHandler)
+	protected.POST("/quiz-attempts/:id/submit", handlers.SubmitQuizAttemptHandler)
+	protected.GET("/peer-reviews/:id", handlers.GetPeerReviewHandler)
+	protected.PUT("/peer-reviews/:id", handlers.SubmitPeerReviewHandler)         // Student: Score and comment on an assigned submission
 	protected.GET("/student/submissions", handlers.GetStudentSubmissionsHandler) // Student: View all their submissions (handler needs implementation)
+	protected.POST("/sessions/:id/check-in", handlers.CheckInHandler)            // Student: Self check-in with the session's code
+	protected.POST("/materials/:id/complete", handlers.CompleteMaterialHandler)  // Student: Mark a material as done
+	protected.DELETE("/materials/:id/complete", handlers.UncompleteMaterialHandler)
 	protected.POST("/enroll", handlers.EnrollStudentHandler)
 	protected.GET("/student/enrollments", handlers.GetStudentEnrollmentsHandler)
 	protected.PUT("/student/profile", handlers.UpdateStudentProfileHandler)
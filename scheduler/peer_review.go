@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"database/sql"
+	"log"
+	"math/rand"
+	"sort"
+)
+
+// reviewedSubmission is a submission waiting for peer reviewers
+type reviewedSubmission struct {
+	ID       int
+	AuthorID int
+}
+
+// AssignPeerReviews hands out the peer reviews of every assignment whose due date has passed.
+// Each assignment is distributed once; students who submit late are not reviewed.
+func AssignPeerReviews(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT p.assignment_id FROM peer_review_settings p
+		JOIN assignment a ON p.assignment_id = a.assignment_id
+		WHERE p.assigned_at IS NULL AND p.archive_delete_flag = TRUE
+		AND a.due_date <= NOW() AND a.archive_delete_flag = TRUE`)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		count, err := assignPeerReviews(db, id)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			log.Printf("Assigned %d peer review(s) for assignment %d", count, id)
+		}
+	}
+	return nil
+}
+
+// assignPeerReviews distributes one assignment's submissions among the enrolled students and marks it assigned
+func assignPeerReviews(db *sql.DB, assignmentID int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Locking the settings row keeps two scheduler ticks from distributing the same assignment
+	var perSubmission, courseID int
+	err = tx.QueryRow(`
+		SELECT p.reviews_per_submission, a.course_id FROM peer_review_settings p
+		JOIN assignment a ON p.assignment_id = a.assignment_id
+		WHERE p.assignment_id = ? AND p.assigned_at IS NULL
+		FOR UPDATE`, assignmentID).Scan(&perSubmission, &courseID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	submissions, err := reviewedSubmissions(tx, assignmentID)
+	if err != nil {
+		return 0, err
+	}
+	reviewers, err := activeStudents(tx, courseID)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for submissionID, assigned := range distributeReviews(submissions, reviewers, perSubmission) {
+		for _, reviewerID := range assigned {
+			if _, err := tx.Exec(`
+				INSERT IGNORE INTO peer_review (submission_id, reviewer_id, status, assigned_at)
+				VALUES (?, ?, 'assigned', NOW())`, submissionID, reviewerID); err != nil {
+				return 0, err
+			}
+			count++
+		}
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE peer_review_settings SET assigned_at = NOW()
+		WHERE assignment_id = ?`, assignmentID); err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
+
+// reviewedSubmissions lists the submissions of an assignment with their authors
+func reviewedSubmissions(tx *sql.Tx, assignmentID int) ([]reviewedSubmission, error) {
+	rows, err := tx.Query(`
+		SELECT submission_id, student_id FROM submission
+		WHERE assignment_id = ? AND archive_delete_flag = TRUE`, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var submissions []reviewedSubmission
+	for rows.Next() {
+		var s reviewedSubmission
+		if err := rows.Scan(&s.ID, &s.AuthorID); err != nil {
+			return nil, err
+		}
+		submissions = append(submissions, s)
+	}
+	return submissions, rows.Err()
+}
+
+// activeStudents lists the students actively enrolled in a classroom
+func activeStudents(tx *sql.Tx, courseID int) ([]int, error) {
+	rows, err := tx.Query(`
+		SELECT e.student_id FROM enrollment e
+		JOIN student s ON e.student_id = s.student_id
+		WHERE e.course_id = ? AND e.status = 'active'
+		AND e.archive_delete_flag = TRUE AND s.archive_delete_flag = TRUE`, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var students []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		students = append(students, id)
+	}
+	return students, rows.Err()
+}
+
+// distributeReviews picks up to perSubmission reviewers for each submission, never its author, so that the
+// review load is spread as evenly as possible. Ties are broken at random so pairings differ between assignments.
+func distributeReviews(submissions []reviewedSubmission, reviewers []int, perSubmission int) map[int][]int {
+	order := append([]reviewedSubmission(nil), submissions...)
+	rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	candidates := append([]int(nil), reviewers...)
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+
+	load := map[int]int{}
+	assigned := map[int][]int{}
+	for _, s := range order {
+		// The stable sort keeps the shuffled order among reviewers with the same load
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return load[candidates[i]] < load[candidates[j]]
+		})
+		for _, reviewerID := range candidates {
+			if len(assigned[s.ID]) == perSubmission {
+				break
+			}
+			if reviewerID == s.AuthorID {
+				continue
+			}
+			assigned[s.ID] = append(assigned[s.ID], reviewerID)
+			load[reviewerID]++
+		}
+	}
+	return assigned
+}
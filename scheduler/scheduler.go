@@ -0,0 +1,143 @@
+package scheduler
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"edusync/auth"
+	"edusync/similarity"
+)
+
+// Job is a unit of periodic background work run by the scheduler
+type Job struct {
+	Name string
+	Run  func(db *sql.DB) error
+}
+
+// PublishEvent describes an announcement or assignment that has just gone live
+type PublishEvent struct {
+	Kind     string // "announcement" or "assignment"
+	ID       int
+	CourseID int
+	Title    string
+}
+
+// OnPublish is called for every item the scheduler publishes
+var OnPublish = func(e PublishEvent) {
+	log.Printf("Published %s %d (%q) in course %d", e.Kind, e.ID, e.Title, e.CourseID)
+}
+
+// Jobs lists the work performed on every scheduler tick
+var Jobs = []Job{
+	{Name: "publish scheduled content", Run: PublishDueContent},
+	{Name: "archive ended classrooms", Run: ArchiveEndedClassrooms},
+	{Name: "run queued similarity reports", Run: similarity.RunQueued},
+	{Name: "assign peer reviews", Run: AssignPeerReviews},
+	{Name: "prune failed logins", Run: auth.PruneLoginAttempts},
+}
+
+// Start runs all scheduler jobs every interval until the process exits
+func Start(db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			RunOnce(db)
+			<-ticker.C
+		}
+	}()
+}
+
+// RunOnce executes every scheduler job a single time
+func RunOnce(db *sql.DB) {
+	for _, job := range Jobs {
+		if err := job.Run(db); err != nil {
+			log.Printf("Scheduler job %q failed: %v", job.Name, err)
+		}
+	}
+}
+
+// PublishDueContent publishes scheduled announcements and assignments whose publish time has passed
+func PublishDueContent(db *sql.DB) error {
+	now := time.Now()
+
+	announcements, err := collectDue(db, `
+		SELECT announcement_id, course_id, title FROM announcement
+		WHERE status = 'scheduled' AND publish_at <= ? AND archive_delete_flag = TRUE`, now)
+	if err != nil {
+		return err
+	}
+	for _, e := range announcements {
+		// Announcements are ordered by created_at, so they surface at their publish time
+		result, err := db.Exec(`
+			UPDATE announcement
+			SET status = 'published', created_at = publish_at
+			WHERE announcement_id = ? AND status = 'scheduled'`, e.ID)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			e.Kind = "announcement"
+			OnPublish(e)
+		}
+	}
+
+	assignments, err := collectDue(db, `
+		SELECT assignment_id, course_id, title FROM assignment
+		WHERE status = 'scheduled' AND publish_at <= ? AND archive_delete_flag = TRUE`, now)
+	if err != nil {
+		return err
+	}
+	for _, e := range assignments {
+		result, err := db.Exec(`
+			UPDATE assignment
+			SET status = 'published'
+			WHERE assignment_id = ? AND status = 'scheduled'`, e.ID)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			e.Kind = "assignment"
+			OnPublish(e)
+		}
+	}
+
+	return nil
+}
+
+// collectDue reads id, course_id, title rows for items waiting to be published
+func collectDue(db *sql.DB, query string, args ...interface{}) ([]PublishEvent, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []PublishEvent
+	for rows.Next() {
+		var e PublishEvent
+		if err := rows.Scan(&e.ID, &e.CourseID, &e.Title); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// ArchiveEndedClassrooms archives classrooms whose end date has passed.
+// Classrooms that were archived before and then restored keep their archived_at and are skipped.
+func ArchiveEndedClassrooms(db *sql.DB) error {
+	result, err := db.Exec(`
+		UPDATE classroom
+		SET is_archived = TRUE, archived_at = NOW()
+		WHERE end_date < CURDATE() AND is_archived = FALSE AND archived_at IS NULL
+		AND archive_delete_flag = TRUE`)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		log.Printf("Archived %d classroom(s) past their end date", affected)
+	}
+	return nil
+}
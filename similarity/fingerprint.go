@@ -0,0 +1,207 @@
+package similarity
+
+import (
+	"hash/fnv"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ShingleSize is the number of consecutive words in a shingle
+const ShingleSize = 5
+
+// numHashes is the length of a MinHash signature
+const numHashes = 128
+
+// token is a normalized word and its byte range in the original text
+type token struct {
+	word       string
+	start, end int
+}
+
+// Document is the fingerprint of one submission's text
+type Document struct {
+	Text      string
+	tokens    []token
+	shingles  []uint64 // Shingle hash at each starting token position
+	set       map[uint64]bool
+	signature [numHashes]uint64
+}
+
+// Span is a run of matching text, as byte offsets into each document
+type Span struct {
+	AStart int    `json:"a_start"`
+	AEnd   int    `json:"a_end"`
+	BStart int    `json:"b_start"`
+	BEnd   int    `json:"b_end"`
+	Text   string `json:"text"` // The matching text as it appears in the first document
+}
+
+// tokenize splits text into lowercase words of letters and digits, keeping their positions
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		wordRune := unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+		if wordRune && start < 0 {
+			start = i
+		} else if !wordRune && start >= 0 {
+			tokens = append(tokens, newToken(text, start, i))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, newToken(text, start, len(text)))
+	}
+	return tokens
+}
+
+func newToken(text string, start, end int) token {
+	word := make([]rune, 0, end-start)
+	for i := start; i < end; {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		word = append(word, unicode.ToLower(r))
+		i += size
+	}
+	return token{word: string(word), start: start, end: end}
+}
+
+// NewDocument shingles the text and computes its MinHash signature.
+// Texts shorter than one shingle are treated as a single shingle.
+func NewDocument(text string) *Document {
+	d := &Document{Text: text, tokens: tokenize(text), set: map[uint64]bool{}}
+	if len(d.tokens) == 0 {
+		return d
+	}
+
+	width := min(ShingleSize, len(d.tokens))
+	for i := 0; i+width <= len(d.tokens); i++ {
+		h := fnv.New64a()
+		for _, t := range d.tokens[i : i+width] {
+			h.Write([]byte(t.word))
+			h.Write([]byte{0})
+		}
+		sum := h.Sum64()
+		d.shingles = append(d.shingles, sum)
+		d.set[sum] = true
+	}
+
+	for i := range d.signature {
+		d.signature[i] = ^uint64(0)
+	}
+	for shingle := range d.set {
+		for i := range d.signature {
+			if v := mix(shingle ^ seeds[i]); v < d.signature[i] {
+				d.signature[i] = v
+			}
+		}
+	}
+	return d
+}
+
+// seeds gives each MinHash function its own permutation of the shingle hashes
+var seeds = func() [numHashes]uint64 {
+	var s [numHashes]uint64
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range s {
+		x = mix(x + uint64(i))
+		s[i] = x
+	}
+	return s
+}()
+
+// mix is the splitmix64 finalizer
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Empty reports whether the document has no words to compare
+func (d *Document) Empty() bool {
+	return len(d.set) == 0
+}
+
+// Estimate approximates the Jaccard similarity of two documents from their MinHash signatures
+func Estimate(a, b *Document) float64 {
+	if a.Empty() || b.Empty() {
+		return 0
+	}
+	equal := 0
+	for i := range a.signature {
+		if a.signature[i] == b.signature[i] {
+			equal++
+		}
+	}
+	return float64(equal) / numHashes
+}
+
+// Jaccard is the exact share of shingles the two documents have in common
+func Jaccard(a, b *Document) float64 {
+	if a.Empty() || b.Empty() {
+		return 0
+	}
+	shared := 0
+	for s := range a.set {
+		if b.set[s] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a.set)+len(b.set)-shared)
+}
+
+// MatchingSpans finds the longest runs of shingles the documents share, longest first, up to limit spans
+func MatchingSpans(a, b *Document, limit int) []Span {
+	width := min(ShingleSize, len(a.tokens), len(b.tokens))
+	positions := map[uint64][]int{}
+	for j, s := range b.shingles {
+		positions[s] = append(positions[s], j)
+	}
+
+	var spans []Span
+	covered := make([]bool, len(a.shingles))
+	for i := 0; i < len(a.shingles); i++ {
+		if covered[i] {
+			continue
+		}
+		// Extend the longest run starting here against every place the shingle occurs in b
+		bestLen, bestJ := 0, -1
+		for _, j := range positions[a.shingles[i]] {
+			n := 0
+			for i+n < len(a.shingles) && j+n < len(b.shingles) && a.shingles[i+n] == b.shingles[j+n] {
+				n++
+			}
+			if n > bestLen {
+				bestLen, bestJ = n, j
+			}
+		}
+		if bestJ < 0 {
+			continue
+		}
+		for k := i; k < i+bestLen; k++ {
+			covered[k] = true
+		}
+
+		lastA := i + bestLen - 1 + width - 1
+		lastB := bestJ + bestLen - 1 + width - 1
+		span := Span{
+			AStart: a.tokens[i].start,
+			AEnd:   a.tokens[lastA].end,
+			BStart: b.tokens[bestJ].start,
+			BEnd:   b.tokens[lastB].end,
+		}
+		span.Text = a.Text[span.AStart:span.AEnd]
+		spans = append(spans, span)
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].AEnd-spans[i].AStart > spans[j].AEnd-spans[j].AStart
+	})
+	if len(spans) > limit {
+		spans = spans[:limit]
+	}
+	return spans
+}
@@ -0,0 +1,160 @@
+package similarity
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// maxSpans caps how many matching spans are stored for a flagged pair
+const maxSpans = 20
+
+// progressEvery is how many pairs are compared between progress updates
+const progressEvery = 200
+
+// submissionText is one submission taking part in a report
+type submissionText struct {
+	ID  int
+	Doc *Document
+}
+
+// Start runs a queued report in the background
+func Start(db *sql.DB, reportID int) {
+	go func() {
+		if err := Run(db, reportID); err != nil {
+			log.Printf("Similarity report %d failed: %v", reportID, err)
+		}
+	}()
+}
+
+// RequeueInterrupted puts reports left running by a previous process back in the queue. It is called once at
+// startup, before the scheduler picks queued reports up.
+func RequeueInterrupted(db *sql.DB) error {
+	_, err := db.Exec(`
+		UPDATE similarity_report SET status = 'queued', started_at = NULL, pairs_done = 0
+		WHERE status = 'running'`)
+	return err
+}
+
+// RunQueued starts every report still waiting in the queue, such as ones left behind by a restart.
+// It is registered as a scheduler job, so the comparisons themselves run in the background rather than on the tick.
+func RunQueued(db *sql.DB) error {
+	rows, err := db.Query(`SELECT report_id FROM similarity_report WHERE status = 'queued' ORDER BY report_id`)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	// Run claims each report, so one already started by its handler or an earlier tick is skipped
+	for _, id := range ids {
+		Start(db, id)
+	}
+	return nil
+}
+
+// Run claims a queued report and compares every pair of submissions for its assignment.
+// A report that is already claimed is left alone.
+func Run(db *sql.DB, reportID int) error {
+	result, err := db.Exec(`
+		UPDATE similarity_report SET status = 'running', started_at = NOW()
+		WHERE report_id = ? AND status = 'queued'`, reportID)
+	if err != nil {
+		return err
+	}
+	if claimed, _ := result.RowsAffected(); claimed == 0 {
+		return nil
+	}
+
+	if err := compare(db, reportID); err != nil {
+		db.Exec(`
+			UPDATE similarity_report SET status = 'failed', error = ?, finished_at = NOW()
+			WHERE report_id = ?`, err.Error(), reportID)
+		return err
+	}
+	return nil
+}
+
+func compare(db *sql.DB, reportID int) error {
+	var assignmentID int
+	var threshold float64
+	err := db.QueryRow(`
+		SELECT assignment_id, threshold FROM similarity_report
+		WHERE report_id = ?`, reportID).Scan(&assignmentID, &threshold)
+	if err != nil {
+		return fmt.Errorf("loading report: %w", err)
+	}
+
+	// Code submissions are compared by their source, everything else by its text
+	rows, err := db.Query(`
+		SELECT submission_id, COALESCE(source_code, content, '') FROM submission
+		WHERE assignment_id = ? AND archive_delete_flag = TRUE
+		ORDER BY submission_id`, assignmentID)
+	if err != nil {
+		return fmt.Errorf("loading submissions: %w", err)
+	}
+	var texts []submissionText
+	for rows.Next() {
+		var id int
+		var text string
+		if err := rows.Scan(&id, &text); err != nil {
+			rows.Close()
+			return err
+		}
+		texts = append(texts, submissionText{ID: id, Doc: NewDocument(text)})
+	}
+	rows.Close()
+
+	// An interrupted run may have flagged some pairs already
+	if _, err := db.Exec(`DELETE FROM similarity_match WHERE report_id = ?`, reportID); err != nil {
+		return err
+	}
+
+	total := len(texts) * (len(texts) - 1) / 2
+	if _, err := db.Exec(`
+		UPDATE similarity_report SET submission_count = ?, pairs_total = ?, pairs_done = 0
+		WHERE report_id = ?`, len(texts), total, reportID); err != nil {
+		return err
+	}
+
+	done := 0
+	for i := 0; i < len(texts); i++ {
+		for j := i + 1; j < len(texts); j++ {
+			a, b := texts[i], texts[j]
+			// MinHash screens out clearly different pairs before the exact comparison
+			if Estimate(a.Doc, b.Doc) >= threshold-0.1 {
+				if score := Jaccard(a.Doc, b.Doc); score >= threshold {
+					spans, _ := json.Marshal(MatchingSpans(a.Doc, b.Doc, maxSpans))
+					if _, err := db.Exec(`
+						INSERT INTO similarity_match (report_id, submission_a, submission_b, similarity, spans)
+						VALUES (?, ?, ?, ?, ?)`, reportID, a.ID, b.ID, score, string(spans)); err != nil {
+						return err
+					}
+				}
+			}
+
+			done++
+			if done%progressEvery == 0 {
+				if _, err := db.Exec(`
+					UPDATE similarity_report SET pairs_done = ?
+					WHERE report_id = ?`, done, reportID); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	_, err = db.Exec(`
+		UPDATE similarity_report SET status = 'completed', pairs_done = ?, finished_at = NOW()
+		WHERE report_id = ?`, done, reportID)
+	return err
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+
+	// Register the formats accepted by DecodeImage
+	_ "image/gif"
+	_ "image/png"
+)
+
+// maxImagePixels caps the size of a decoded image, so a small file cannot expand into gigabytes of memory
+const maxImagePixels = 40_000_000
+
+// ErrNotImage is returned for data that is not a JPEG, PNG or GIF image
+var ErrNotImage = errors.New("file is not a JPEG, PNG or GIF image")
+
+// ErrImageTooLarge is returned for images with more than maxImagePixels pixels
+var ErrImageTooLarge = errors.New("image dimensions are too large")
+
+// DecodeImage decodes a JPEG, PNG or GIF image, checking its dimensions before decoding the pixels
+func DecodeImage(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, ErrNotImage
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+	return img, nil
+}
+
+// SquareThumbnail crops the centre square of the image and scales it down to size×size, averaging the source pixels
+// behind each output pixel. Images smaller than size are cropped but not enlarged. Transparent areas become white.
+func SquareThumbnail(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side)
+	src := image.NewRGBA(crop)
+	draw.Draw(src, crop, image.NewUniform(color.White), image.Point{}, draw.Src)
+	offset := image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2)
+	draw.Draw(src, crop, img, offset, draw.Over)
+
+	size = min(size, side)
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		y0, y1 := y*side/size, (y+1)*side/size
+		for x := 0; x < size; x++ {
+			x0, x1 := x*side/size, (x+1)*side/size
+			var r, g, bl, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					r += int(row[sx*4])
+					g += int(row[sx*4+1])
+					bl += int(row[sx*4+2])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+	return dst
+}
+
+// EncodeJPEG encodes the image as a JPEG
+func EncodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
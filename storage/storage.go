@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"edusync/config"
+)
+
+// Store keeps uploaded files under slash-separated keys. Handlers take the store from the request context under
+// "storage", so it can be swapped without touching them.
+type Store interface {
+	Put(key string, data []byte) error
+	Delete(key string) error
+	URL(key string) string
+}
+
+// New returns a store writing to the configured upload directory
+func New(cfg *config.Config) Store {
+	return &Local{Dir: cfg.UploadDir, BaseURL: cfg.UploadURL}
+}
+
+// Local stores files in a directory that is served at BaseURL
+type Local struct {
+	Dir     string
+	BaseURL string
+}
+
+// Put writes the file, creating its parent directories
+func (l *Local) Put(key string, data []byte) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0o644)
+}
+
+// Delete removes the file. A file that is already gone is not an error.
+func (l *Local) Delete(key string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// URL is the address the file is served at
+func (l *Local) URL(key string) string {
+	return l.BaseURL + "/" + key
+}
+
+// path maps a key into the upload directory, refusing keys that would escape it
+func (l *Local) path(key string) (string, error) {
+	if key == "" || path.Clean(key) != key || strings.HasPrefix(key, "/") || strings.HasPrefix(key, "..") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(l.Dir, filepath.FromSlash(key)), nil
+}